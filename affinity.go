@@ -0,0 +1,116 @@
+package pac
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// affinitySweepSize is the number of pinned hosts after which expired pins
+// are removed when a new host is pinned.
+const affinitySweepSize = 1024
+
+type affinityEntry struct {
+	proxy   Proxy
+	expires time.Time
+}
+
+// proxyAffinity pins destination hosts to the proxy that first served them,
+// so that selectors spreading load across a proxy farm do not move a host's
+// connections from one proxy to the next. A pin expires after ttl without a
+// successful connection and is dropped as soon as the proxy fails.
+type proxyAffinity struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	now   func() time.Time
+	hosts map[string]affinityEntry
+}
+
+func newProxyAffinity(ttl time.Duration) *proxyAffinity {
+	if ttl <= 0 {
+		return nil
+	}
+	return &proxyAffinity{
+		ttl:   ttl,
+		now:   time.Now,
+		hosts: make(map[string]affinityEntry),
+	}
+}
+
+func affinityKey(target *url.URL) string {
+	if target == nil {
+		return ""
+	}
+	return strings.ToLower(target.Hostname())
+}
+
+// apply moves the proxy pinned to target's host to the front of candidates,
+// provided the PAC still returned it.
+func (a *proxyAffinity) apply(target *url.URL, candidates []Proxy) []Proxy {
+	key := affinityKey(target)
+	if a == nil || key == "" {
+		return candidates
+	}
+	a.mu.Lock()
+	e, ok := a.hosts[key]
+	if ok && !a.now().Before(e.expires) {
+		delete(a.hosts, key)
+		ok = false
+	}
+	a.mu.Unlock()
+	if !ok {
+		return candidates
+	}
+
+	for i, c := range candidates {
+		if c != e.proxy {
+			continue
+		}
+		if i == 0 {
+			return candidates
+		}
+		ordered := make([]Proxy, 0, len(candidates))
+		ordered = append(ordered, c)
+		ordered = append(ordered, candidates[:i]...)
+		return append(ordered, candidates[i+1:]...)
+	}
+	return candidates
+}
+
+// succeeded pins target's host to p unless it is pinned to another proxy
+// already, and extends the pin.
+func (a *proxyAffinity) succeeded(target *url.URL, p Proxy) {
+	key := affinityKey(target)
+	if a == nil || key == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if e, ok := a.hosts[key]; ok && e.proxy != p && now.Before(e.expires) {
+		return
+	}
+	if len(a.hosts) >= affinitySweepSize {
+		for k, e := range a.hosts {
+			if !now.Before(e.expires) {
+				delete(a.hosts, k)
+			}
+		}
+	}
+	a.hosts[key] = affinityEntry{proxy: p, expires: now.Add(a.ttl)}
+}
+
+// failed drops the pin of target's host if it points to p.
+func (a *proxyAffinity) failed(target *url.URL, p Proxy) {
+	key := affinityKey(target)
+	if a == nil || key == "" {
+		return
+	}
+	a.mu.Lock()
+	if e, ok := a.hosts[key]; ok && e.proxy == p {
+		delete(a.hosts, key)
+	}
+	a.mu.Unlock()
+}
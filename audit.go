@@ -0,0 +1,112 @@
+package pac
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes one proxy decision, passed to PACProxyConfig.Audit.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	Host string    `json:"host"`
+	// Result is the raw PAC result, e.g. "PROXY a:3128; DIRECT".
+	Result ProxyString `json:"result,omitempty"`
+	// Proxy is the candidate tried first: the first directive of Result
+	// after selection and health ordering, or nil on errors.
+	Proxy      *Proxy        `json:"proxy,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+	ScriptHash string        `json:"script_hash"`
+	Error      string        `json:"error,omitempty"`
+	// URL and DNSQueries are set with PACProxyConfig.AuditDNS: the target
+	// URL as passed to the script and every hostname the script asked to
+	// resolve for it, in order, including lookups rejected by DNSFilter.
+	URL        string   `json:"url,omitempty"`
+	DNSQueries []string `json:"dns_queries,omitempty"`
+}
+
+// AuditFunc receives one AuditRecord per lookup. Failures are logged and
+// reported to OnError with the op "audit".
+type AuditFunc func(ctx context.Context, record AuditRecord) error
+
+// JSONAudit returns an AuditFunc writing each record as one line of JSON to
+// w. Writes are serialized, so w need not be safe for concurrent use.
+func JSONAudit(w io.Writer) AuditFunc {
+	var mu sync.Mutex
+	return func(_ context.Context, record AuditRecord) error {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(line, '\n'))
+		return err
+	}
+}
+
+// dnsQueryLog collects the hostnames resolved during one lookup.
+type dnsQueryLog struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+type dnsQueryLogKey struct{}
+
+// withDNSQueryLog returns ctx carrying a new dnsQueryLog if DNS queries are
+// audited.
+func (p *PACProxy) withDNSQueryLog(ctx context.Context) context.Context {
+	if p.audit == nil || !p.auditDNS {
+		return ctx
+	}
+	return context.WithValue(ctx, dnsQueryLogKey{}, &dnsQueryLog{})
+}
+
+// recordDNSQuery adds host to the dnsQueryLog of ctx, if any.
+func recordDNSQuery(ctx context.Context, host string) {
+	if l, ok := ctx.Value(dnsQueryLogKey{}).(*dnsQueryLog); ok {
+		l.mu.Lock()
+		l.hosts = append(l.hosts, host)
+		l.mu.Unlock()
+	}
+}
+
+func dnsQueries(ctx context.Context) ([]string, bool) {
+	l, ok := ctx.Value(dnsQueryLogKey{}).(*dnsQueryLog)
+	if !ok {
+		return nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.hosts...), true
+}
+
+func (p *PACProxy) auditDecision(ctx context.Context, start time.Time, script *pacScript, targetURL *url.URL, result ProxyString, chosen []Proxy, err error) {
+	if p.audit == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:       start,
+		Host:       targetURL.Hostname(),
+		Result:     result,
+		Duration:   time.Since(start),
+		ScriptHash: hex.EncodeToString(script.hash[:]),
+	}
+	if queries, ok := dnsQueries(ctx); ok {
+		record.URL = p.evalURL(targetURL).String()
+		record.DNSQueries = queries
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else if len(chosen) > 0 {
+		record.Proxy = &chosen[0]
+	}
+	if auditErr := p.audit(ctx, record); auditErr != nil {
+		p.logf(ctx, LogError, "write audit record failed", "err", auditErr)
+		p.emitError(ctx, "audit", auditErr)
+	}
+}
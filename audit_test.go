@@ -0,0 +1,83 @@
+package pac_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestJSONAudit tests that every lookup writes one JSON audit record.
+func TestJSONAudit(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "bad.example.com") { throw new Error("boom"); }
+		return "PROXY proxy.example.com:3128; DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	var buf bytes.Buffer
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{Audit: pac.JSONAudit(&buf)})
+	targetURL, _ := url.Parse("http://example.com/secret?q=1")
+	if _, err := proxy.FindProxiesForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxies for URL: %v", err)
+	}
+	badURL, _ := url.Parse("http://bad.example.com")
+	if _, err := proxy.FindProxyStringForURL(badURL); err == nil {
+		t.Fatal("Expected an error for bad.example.com")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audit records, got %q", buf.String())
+	}
+	var records [2]pac.AuditRecord
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &records[i]); err != nil {
+			t.Fatalf("Error decoding audit record %q: %v", line, err)
+		}
+	}
+	ok := records[0]
+	if ok.Host != "example.com" || ok.Result != "PROXY proxy.example.com:3128; DIRECT" || ok.Proxy == nil ||
+		*ok.Proxy != (pac.Proxy{Type: pac.ProxyHTTP, Host: "proxy.example.com:3128"}) || len(ok.ScriptHash) != 64 || ok.Time.IsZero() {
+		t.Fatalf("Unexpected audit record: %s", lines[0])
+	}
+	if strings.Contains(lines[0], "secret") {
+		t.Fatalf("Expected the audit record to omit the path, got %s", lines[0])
+	}
+	if bad := records[1]; bad.Host != "bad.example.com" || bad.Error == "" || bad.Proxy != nil {
+		t.Fatalf("Unexpected audit record for a failed lookup: %s", lines[1])
+	}
+}
+
+// TestAuditDNS tests that AuditDNS records the hostnames a script resolves.
+func TestAuditDNS(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		dnsResolve("localhost");
+		isResolvable("beacon.invalid");
+		isInNet("127.0.0.1", "127.0.0.0", "255.0.0.0");
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	var records []pac.AuditRecord
+	audit := func(_ context.Context, record pac.AuditRecord) error {
+		records = append(records, record)
+		return nil
+	}
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{Audit: audit, AuditDNS: true, DNSFilter: pac.DenyDNS(".invalid")})
+	targetURL, _ := url.Parse("http://example.com/")
+	if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d", len(records))
+	}
+	if got := records[0]; got.URL != "http://example.com/" || !reflect.DeepEqual(got.DNSQueries, []string{"localhost", "beacon.invalid"}) {
+		t.Fatalf("Unexpected audit record: %+v", got)
+	}
+}
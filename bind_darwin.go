@@ -0,0 +1,31 @@
+//go:build darwin
+// +build darwin
+
+package pac
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface returns a net.Dialer Control that scopes sockets to ifi
+// with IP_BOUND_IF, so they use its routes even if another interface, such
+// as a VPN tunnel, holds the default route.
+func bindToInterface(ifi *net.Interface) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(network, _ string, c syscall.RawConn) error {
+		var err error
+		ctrlErr := c.Control(func(fd uintptr) {
+			if network == "tcp6" || network == "udp6" {
+				err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, ifi.Index)
+			} else {
+				err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, ifi.Index)
+			}
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package pac
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface returns a net.Dialer Control that binds sockets to ifi
+// with SO_BINDTODEVICE, which needs CAP_NET_RAW.
+func bindToInterface(ifi *net.Interface) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(_, _ string, c syscall.RawConn) error {
+		var err error
+		ctrlErr := c.Control(func(fd uintptr) {
+			err = unix.BindToDevice(int(fd), ifi.Name)
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package pac
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func bindToInterface(ifi *net.Interface) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, fmt.Errorf("binding to interface %s is not supported on this platform", ifi.Name)
+}
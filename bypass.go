@@ -0,0 +1,156 @@
+package pac
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// BypassList is a list of destinations that skip the PAC script and always
+// go DIRECT. It understands the NO_PROXY syntax plus CIDRs and wildcards.
+type BypassList struct {
+	rules []bypassRule
+}
+
+type bypassRule struct {
+	all     bool
+	local   bool
+	network *net.IPNet
+	ip      net.IP
+	domain  string // matches the domain and its subdomains
+	suffix  string // matches subdomains only (leading ".")
+	pattern string // shell wildcard matched against the host
+	port    string
+}
+
+// ParseBypassList parses a comma or whitespace separated list of entries:
+//   - "*" matches every host
+//   - "example.com" matches example.com and its subdomains
+//   - ".example.com" and "*.example.com" match subdomains of example.com
+//   - "10.0.0.0/8" and "fd00::/8" match IP literals in the network
+//   - "192.168.1.1" and "[::1]" match the IP literal
+//   - wildcards such as "10.1.*" or "*.corp.*" are matched with shExpMatch rules
+//   - "<local>" matches plain host names without dots
+//
+// Host entries may carry a ":port" suffix to only match that port.
+func ParseBypassList(s string) *BypassList {
+	b := &BypassList{}
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n'
+	})
+	for _, field := range fields {
+		if rule, ok := parseBypassRule(field); ok {
+			b.rules = append(b.rules, rule)
+		}
+	}
+	return b
+}
+
+// BypassListFromEnv parses the NO_PROXY (or no_proxy) environment variable.
+func BypassListFromEnv() *BypassList {
+	v := os.Getenv("NO_PROXY")
+	if v == "" {
+		v = os.Getenv("no_proxy")
+	}
+	return ParseBypassList(v)
+}
+
+func parseBypassRule(entry string) (bypassRule, bool) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	switch entry {
+	case "":
+		return bypassRule{}, false
+	case "*":
+		return bypassRule{all: true}, true
+	case "<local>":
+		return bypassRule{local: true}, true
+	}
+
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return bypassRule{network: network}, true
+	}
+
+	var rule bypassRule
+	host := entry
+	if h, port, err := net.SplitHostPort(entry); err == nil {
+		host, rule.port = h, port
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	if ip := net.ParseIP(host); ip != nil {
+		rule.ip = ip
+		return rule, true
+	}
+	switch {
+	case strings.HasPrefix(host, "*.") && !strings.Contains(host[2:], "*"):
+		rule.suffix = host[1:]
+	case strings.Contains(host, "*") || strings.Contains(host, "?"):
+		rule.pattern = host
+	case strings.HasPrefix(host, "."):
+		rule.suffix = host
+	default:
+		rule.domain = host
+	}
+	return rule, true
+}
+
+// Match reports whether requests to target bypass the PAC script.
+func (b *BypassList) Match(target *url.URL) bool {
+	if b == nil || target == nil || len(b.rules) == 0 {
+		return false
+	}
+	host, port, ip := targetHostPort(target)
+	for _, rule := range b.rules {
+		if rule.matches(host, port, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func targetHostPort(target *url.URL) (host, port string, ip net.IP) {
+	host = strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	port = target.Port()
+	if port == "" {
+		port = defaultPort(target.Scheme)
+	}
+	return host, port, net.ParseIP(host)
+}
+
+func (r bypassRule) matches(host, port string, ip net.IP) bool {
+	if r.port != "" && r.port != port {
+		return false
+	}
+	switch {
+	case r.all:
+		return true
+	case r.local:
+		return ip == nil && !strings.Contains(host, ".")
+	case r.network != nil:
+		return ip != nil && r.network.Contains(ip)
+	case r.ip != nil:
+		return ip != nil && r.ip.Equal(ip)
+	case r.suffix != "":
+		return strings.HasSuffix(host, r.suffix)
+	case r.pattern != "":
+		matched, _ := path.Match(r.pattern, host)
+		return matched
+	default:
+		return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+	}
+}
+
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	case "ftp":
+		return "21"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,165 @@
+package pac_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TestBypassListMatch tests NO_PROXY style entries, CIDRs and wildcards.
+func TestBypassListMatch(t *testing.T) {
+	bypass := pac.ParseBypassList("example.com, .internal.net, *.corp.local, 10.0.0.0/8, [::1], intranet:8080, <local>, db-?.lab")
+
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		{"http://example.com", true},
+		{"https://www.example.com", true},
+		{"http://notexample.com", false},
+		{"http://internal.net", false},
+		{"http://a.internal.net", true},
+		{"http://x.corp.local", true},
+		{"http://10.1.2.3", true},
+		{"http://11.1.2.3", false},
+		{"http://[::1]:8080", true},
+		{"http://intranet:8080", true},
+		{"http://intranet.example.org:9090", false},
+		{"http://printer", true},
+		{"http://db-1.lab", true},
+		{"http://db-10.lab", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			target, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatalf("Failed to parse target URL: %v", err)
+			}
+			if got := bypass.Match(target); got != test.expected {
+				t.Fatalf("Expected match %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+// TestBypassSkipsPAC tests that bypassed hosts go DIRECT without consulting the PAC.
+func TestBypassSkipsPAC(t *testing.T) {
+	proxy := newTestPACProxy(t, "PROXY proxy.example.com:8080", &pac.PACProxyConfig{
+		Bypass: pac.ParseBypassList(".local"),
+	})
+
+	targetURL, _ := url.Parse("http://printer.local")
+	proxyStr, err := proxy.FindProxyStringForURL(targetURL)
+	if err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	if proxyStr != "DIRECT" {
+		t.Fatalf("Expected proxy string DIRECT, got %s", proxyStr)
+	}
+}
+
+// TestOverrides tests that override rules short-circuit the PAC and can be replaced at runtime.
+func TestOverrides(t *testing.T) {
+	proxy := newTestPACProxy(t, "PROXY proxy.example.com:8080", &pac.PACProxyConfig{
+		Overrides: []pac.OverrideRule{
+			{Match: "api.example.com", Result: "DIRECT"},
+			{Match: "10.0.0.0/8", Result: "PROXY fallback.example.com:3128"},
+		},
+	})
+
+	tests := []struct {
+		target   string
+		expected pac.ProxyString
+	}{
+		{"https://api.example.com/v1", "DIRECT"},
+		{"http://10.2.3.4", "PROXY fallback.example.com:3128"},
+		{"http://www.example.com", "PROXY proxy.example.com:8080"},
+	}
+	for _, test := range tests {
+		targetURL, _ := url.Parse(test.target)
+		proxyStr, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", test.target, err)
+		}
+		if proxyStr != test.expected {
+			t.Fatalf("Expected %s for %s, got %s", test.expected, test.target, proxyStr)
+		}
+	}
+
+	if err := proxy.SetOverrides([]pac.OverrideRule{{Match: "example.com", Result: "bogus"}}); err == nil {
+		t.Fatalf("Expected error for invalid override result")
+	}
+	if err := proxy.SetOverrides(nil); err != nil {
+		t.Fatalf("Error clearing overrides: %v", err)
+	}
+	targetURL, _ := url.Parse("https://api.example.com")
+	if proxyStr, _ := proxy.FindProxyStringForURL(targetURL); proxyStr != "PROXY proxy.example.com:8080" {
+		t.Fatalf("Expected PAC result after clearing overrides, got %s", proxyStr)
+	}
+}
+
+// TestCombinedProxyFunc tests the precedence between environment proxy settings and the PAC.
+func TestCombinedProxyFunc(t *testing.T) {
+	proxy := newTestPACProxy(t, "PROXY pac.example.com:8080", nil)
+	env := &httpproxy.Config{
+		HTTPSProxy: "http://env.example.com:3128",
+		NoProxy:    ".internal",
+	}
+
+	tests := []struct {
+		precedence pac.Precedence
+		target     string
+		expected   string
+	}{
+		{pac.PreferEnv, "https://example.com", "http://env.example.com:3128"},
+		{pac.PreferEnv, "http://example.com", "http://pac.example.com:8080"},
+		{pac.PreferEnv, "https://db.internal", ""},
+		{pac.PreferPAC, "https://example.com", "http://pac.example.com:8080"},
+		{pac.PreferPAC, "https://db.internal", "http://pac.example.com:8080"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.target, nil)
+		proxyURL, err := pac.CombinedProxyFunc(proxy, env, test.precedence)(req)
+		if err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", test.target, err)
+		}
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != test.expected {
+			t.Fatalf("Precedence %d, %s: expected %q, got %q", test.precedence, test.target, test.expected, got)
+		}
+	}
+}
+
+// TestProxyFilter tests that proxies rejected by the ProxyFilter are dropped from the candidates.
+func TestProxyFilter(t *testing.T) {
+	targetURL, _ := url.Parse("http://example.com")
+
+	proxy := newTestPACProxy(t, "PROXY evil.example.net:8080; PROXY 10.1.2.3:3128; DIRECT", &pac.PACProxyConfig{
+		ProxyFilter: pac.AllowProxies("10.0.0.0/8"),
+	})
+	proxies, err := proxy.FindProxiesForURL(targetURL)
+	if err != nil {
+		t.Fatalf("Error finding proxies for URL: %v", err)
+	}
+	expected := []pac.Proxy{{Type: pac.ProxyHTTP, Host: "10.1.2.3:3128"}, {Type: pac.ProxyDirect}}
+	if !reflect.DeepEqual(proxies, expected) {
+		t.Fatalf("Expected proxies %v, got %v", expected, proxies)
+	}
+
+	proxy = newTestPACProxy(t, "PROXY evil.example.net:8080", &pac.PACProxyConfig{
+		ProxyFilter: pac.DenyProxies(".example.net"),
+	})
+	if _, err := proxy.FindProxiesForURL(targetURL); !errors.Is(err, pac.ErrNoValidProxy) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrNoValidProxy, err)
+	}
+}
@@ -0,0 +1,62 @@
+package pac
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRefreshMinInterval = time.Minute
+	defaultRefreshMaxInterval = 24 * time.Hour
+)
+
+// cacheLifetime returns how long a response stays fresh according to its
+// Cache-Control, Age, Expires and Date headers. ok is false if the headers
+// say nothing about it.
+func cacheLifetime(h http.Header, now time.Time) (lifetime time.Duration, ok bool) {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, true
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil || seconds < 0 {
+				return 0, true
+			}
+			lifetime = time.Duration(seconds) * time.Second
+			if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && age > 0 {
+				lifetime -= time.Duration(age) * time.Second
+			}
+			return max(lifetime, 0), true
+		}
+	}
+
+	expires := h.Get("Expires")
+	if expires == "" {
+		return 0, false
+	}
+	expiresAt, err := http.ParseTime(expires)
+	if err != nil {
+		// Invalid dates such as "0" mean already expired.
+		return 0, true
+	}
+	date := now
+	if d, err := http.ParseTime(h.Get("Date")); err == nil {
+		date = d
+	}
+	return max(expiresAt.Sub(date), 0), true
+}
+
+// refreshDelay returns the time until the next refresh: the lifetime
+// announced by the last PAC response bounded by the configured minimum and
+// maximum, or RefreshInterval if the response had no caching headers.
+func (p *PACProxy) refreshDelay() time.Duration {
+	lifetime := time.Duration(p.fetchLifetime.Load())
+	if lifetime < 0 {
+		return p.refreshInterval
+	}
+	return min(max(lifetime, p.refreshMin), p.refreshMax)
+}
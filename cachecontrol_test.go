@@ -0,0 +1,46 @@
+package pac_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestRefreshCacheControl tests that Cache-Control of the PAC response schedules the next refresh.
+func TestRefreshCacheControl(t *testing.T) {
+	var script atomic.Value
+	script.Store(`function FindProxyForURL(url, host) { return "PROXY old.example.com:3128"; }`)
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		_, _ = io.WriteString(w, script.Load().(string))
+	}))
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		RefreshInterval:    time.Hour,
+		RefreshMinInterval: 10 * time.Millisecond,
+	})
+
+	script.Store(`function FindProxyForURL(url, host) { return "PROXY new.example.com:3128"; }`)
+	targetURL, _ := url.Parse("http://example.com")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+		if got == "PROXY new.example.com:3128" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the script to be refreshed before RefreshInterval, still got %s", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,51 @@
+package pac
+
+import (
+	"context"
+	"net"
+
+	"github.com/dop251/goja"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying ip, the address of the client
+// an evaluation is made for. Gateways that resolve proxies on behalf of
+// their clients use it with ClientIPGlobal or ClientIPArgument, so one PAC
+// script can decide per client.
+func WithClientIP(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// passesClientIP reports whether scripts see the client IP.
+func (p *PACProxy) passesClientIP() bool {
+	return p.clientGlobal != "" || p.clientArg
+}
+
+// clientIP returns the client IP of ctx as passed to the script, "" if
+// there is none or the PACProxy does not pass it.
+func (p *PACProxy) clientIP(ctx context.Context) string {
+	if !p.passesClientIP() {
+		return ""
+	}
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// passClientIP sets the global name to client, unless name is empty, and
+// appends client to args if arg is set. The global is set on every
+// evaluation, so a client never sees the address of the one before.
+func passClientIP(vm JSRuntime, name string, arg bool, client string, args []goja.Value) ([]goja.Value, error) {
+	if name != "" {
+		if err := vm.Set(name, client); err != nil {
+			return nil, err
+		}
+	}
+	if arg {
+		args = append(args, vm.ToValue(client))
+	}
+	return args, nil
+}
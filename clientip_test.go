@@ -0,0 +1,60 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+func TestClientIP(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host, argIP) {
+		if (isInNet(argIP, "10.1.0.0", "255.255.0.0")) return "PROXY lab:1";
+		return "PROXY " + (argIP || "none") + "-" + (clientAddr || "none") + ":1";
+	}`)
+	defer pacServer.Close()
+	target := &url.URL{Scheme: "http", Host: "example.com", Path: "/"}
+	evaluator := []string{os.Args[0], "-test.run=^TestEvaluatorHelperProcess$", "--", "pac-evaluator"}
+
+	for _, command := range [][]string{nil, evaluator} {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+			ClientIPGlobal:   "clientAddr",
+			ClientIPArgument: true,
+			DecisionCacheTTL: time.Minute,
+			EvaluatorCommand: command,
+		})
+		for _, tc := range []struct {
+			ip   string
+			want pac.ProxyString
+		}{
+			{"10.1.2.3", "PROXY lab:1"},
+			{"192.0.2.1", "PROXY 192.0.2.1-192.0.2.1:1"},
+			{"", "PROXY none-none:1"},
+			// Cached per client.
+			{"10.1.2.3", "PROXY lab:1"},
+			{"192.0.2.1", "PROXY 192.0.2.1-192.0.2.1:1"},
+		} {
+			ctx := context.Background()
+			if tc.ip != "" {
+				ctx = pac.WithClientIP(ctx, net.ParseIP(tc.ip))
+			}
+			got, err := proxy.FindProxyStringForURLContext(ctx, target)
+			if err != nil || got != tc.want {
+				t.Fatalf("Expected %q for client %q with evaluator %v, got %q, %v", tc.want, tc.ip, command != nil, got, err)
+			}
+		}
+		proxy.Close()
+	}
+
+	// Without the options the script sees neither.
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+	if _, err := proxy.FindProxyStringForURLContext(pac.WithClientIP(context.Background(), net.ParseIP("10.1.2.3")), target); !errors.Is(err, pac.ErrEvaluatePAC) || !strings.Contains(err.Error(), "clientAddr") {
+		t.Fatalf("Expected a ReferenceError for clientAddr, got %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+// Command pac-evaluator evaluates PAC scripts on behalf of a PACProxy
+// configured with
+//
+//	pac.PACProxyConfig{EvaluatorCommand: []string{"pac-evaluator"}}
+//
+// It speaks JSON lines over stdin and stdout and exits when stdin is closed.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/phlipse/go-pac"
+)
+
+func main() {
+	if err := pac.ServeEvaluator(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "pac-evaluator:", err)
+		os.Exit(1)
+	}
+}
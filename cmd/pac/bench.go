@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// runBench evaluates a URL corpus against a PAC and reports the latency
+// percentiles, the helper DNS lookups and the distribution of decisions.
+func runBench(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	concurrency := fs.Int("c", 1, "number of concurrent evaluations")
+	count := fs.Int("count", 1, "number of passes over the corpus")
+	timeout := fs.Duration("timeout", 0, "script timeout (default 5s)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac bench [-c n] [-count n] [-timeout d] <pac> <corpus>")
+		fmt.Fprintln(stderr, "<corpus> has one URL per line, - reads stdin")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 || *concurrency < 1 || *count < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	urls, err := readCorpus(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(stderr, "pac: corpus has no URLs")
+		return 1
+	}
+
+	var lookups atomic.Int64
+	proxy, err := openPAC(fs.Arg(0), &pac.PACProxyConfig{
+		ScriptTimeout: *timeout,
+		DNSFilter:     func(string) bool { lookups.Add(1); return true },
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	defer proxy.Close()
+
+	jobs := make([]*url.URL, 0, len(urls)**count)
+	for range *count {
+		jobs = append(jobs, urls...)
+	}
+	r := bench(proxy, jobs, *concurrency)
+	r.lookups = lookups.Load()
+	r.print(stdout)
+	if r.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readCorpus reads the URLs of path, one per line, skipping blank lines and
+// # comments.
+func readCorpus(path string) ([]*url.URL, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var urls []*url.URL
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("%s:%d: invalid URL %q", path, line, raw)
+		}
+		urls = append(urls, u)
+	}
+	return urls, scanner.Err()
+}
+
+type benchResult struct {
+	durations []time.Duration
+	decisions map[string]int
+	errors    int
+	lookups   int64
+	elapsed   time.Duration
+}
+
+// bench evaluates jobs with concurrency workers.
+func bench(proxy *pac.PACProxy, jobs []*url.URL, concurrency int) *benchResult {
+	r := &benchResult{durations: make([]time.Duration, len(jobs)), decisions: make(map[string]int)}
+	var mu sync.Mutex
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(jobs) {
+					return
+				}
+				evalStart := time.Now()
+				result, err := proxy.FindProxyStringForURL(jobs[i])
+				r.durations[i] = time.Since(evalStart)
+				decision := string(result)
+				if err != nil {
+					decision = "error: " + err.Error()
+				}
+				mu.Lock()
+				r.decisions[decision]++
+				if err != nil {
+					r.errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	sort.Slice(r.durations, func(i, j int) bool { return r.durations[i] < r.durations[j] })
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations.
+func (r *benchResult) percentile(p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(r.durations)))) - 1
+	return r.durations[max(i, 0)].Round(time.Microsecond)
+}
+
+func (r *benchResult) print(w io.Writer) {
+	n := len(r.durations)
+	fmt.Fprintf(w, "evaluations: %d (%d errors) in %s, %.0f/s\n", n, r.errors, r.elapsed.Round(time.Millisecond), float64(n)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "latency:     p50 %s, p95 %s, p99 %s, max %s\n", r.percentile(0.50), r.percentile(0.95), r.percentile(0.99), r.percentile(1))
+	fmt.Fprintf(w, "dns lookups: %d (%.2f per evaluation)\n", r.lookups, float64(r.lookups)/float64(n))
+	fmt.Fprintln(w, "decisions:")
+	decisions := make([]string, 0, len(r.decisions))
+	for d := range r.decisions {
+		decisions = append(decisions, d)
+	}
+	sort.Slice(decisions, func(i, j int) bool {
+		a, b := decisions[i], decisions[j]
+		return r.decisions[a] > r.decisions[b] || r.decisions[a] == r.decisions[b] && a < b
+	})
+	for _, d := range decisions {
+		fmt.Fprintf(w, "  %6d %5.1f%%  %s\n", r.decisions[d], 100*float64(r.decisions[d])/float64(n), d)
+	}
+}
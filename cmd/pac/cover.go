@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/phlipse/go-pac"
+)
+
+// runCover evaluates a URL corpus against a PAC and reports the branches of
+// the script each took, marking the ones no URL reached.
+func runCover(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cover", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dead := fs.Bool("dead", false, "print only branches no URL took")
+	timeout := fs.Duration("timeout", 0, "script timeout (default 5s)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac cover [-dead] [-timeout d] <pac> <corpus>")
+		fmt.Fprintln(stderr, "<corpus> has one URL per line, - reads stdin")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	urls, err := readCorpus(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	proxy, err := openPAC(fs.Arg(0), &pac.PACProxyConfig{ScriptTimeout: *timeout})
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	defer proxy.Close()
+
+	c, err := proxy.Coverage(context.Background(), urls)
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	printCoverage(stdout, c, *dead)
+	return 0
+}
+
+func printCoverage(w io.Writer, c *pac.Coverage, deadOnly bool) {
+	percent := 100.0
+	if len(c.Branches) > 0 {
+		percent = 100 * float64(c.Covered()) / float64(len(c.Branches))
+	}
+	fmt.Fprintf(w, "branches: %d of %d taken (%.1f%%) by %d URLs (%d errors)\n", c.Covered(), len(c.Branches), percent, c.URLs, c.Errors)
+	for _, b := range c.Branches {
+		if deadOnly && b.Count > 0 {
+			continue
+		}
+		mark := ""
+		if b.Count == 0 {
+			mark = "  DEAD"
+		}
+		fmt.Fprintf(w, "  line %4d  %-8s %6d  %s%s\n", b.Line, b.Kind, b.Count, b.Code, mark)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// proxyEnv lists the environment variables printed by detect, as read by
+// httpproxy.FromEnvironment.
+var proxyEnv = []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"}
+
+// runDetect prints every PAC URL source with what it returned and how long
+// it took, the proxy environment variables and the PAC URL that wins.
+func runDetect(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("detect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	domain := fs.String("domain", "", "DNS domain to start WPAD discovery at (default: the host's domain)")
+	noWPAD := fs.Bool("no-wpad", false, "skip WPAD discovery")
+	iface := fs.String("interface", "", "detect for one network interface, e.g. en0 or utun3")
+	timeout := fs.Duration("timeout", 30*time.Second, "overall detection timeout")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac detect [-domain d] [-no-wpad] [-interface name] [-timeout d]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	d, err := pac.DetectPACURL(ctx, &pac.DetectOptions{Domain: *domain, NoWPAD: *noWPAD, Interface: *iface})
+	printDetection(stdout, d, os.LookupEnv)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func printDetection(w io.Writer, d *pac.Detection, lookupEnv func(string) (string, bool)) {
+	for _, s := range d.Sources {
+		label := s.Name + ":"
+		took := ""
+		if s.Duration > 0 {
+			took = fmt.Sprintf(" [%v]", s.Duration.Round(time.Microsecond))
+		}
+		switch {
+		case s.Err == nil:
+			fmt.Fprintf(w, "%-8s%s%s\n", label, s.URL, took)
+		case s.URL == "":
+			fmt.Fprintf(w, "%-8s(%v)%s\n", label, s.Err, took)
+		default:
+			fmt.Fprintf(w, "%-8s%s (%v)%s\n", label, s.URL, s.Err, took)
+		}
+	}
+	for _, name := range proxyEnv {
+		if v, ok := lookupEnv(name); ok {
+			fmt.Fprintf(w, "%-8s%s=%s\n", "env:", name, redactProxy(v))
+		}
+	}
+	if d.URL == nil {
+		fmt.Fprintf(w, "%-8snone\n", "using:")
+		return
+	}
+	fmt.Fprintf(w, "%-8s%s (%s)\n", "using:", d.URL, d.Source)
+}
+
+// redactProxy hides the password of a proxy URL so the output can be pasted
+// into a support ticket.
+func redactProxy(v string) string {
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return v
+}
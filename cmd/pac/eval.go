@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// runEval prints the decision, the parsed proxies and the duration of each
+// URL, optionally with the PAC helper calls made for it or an explanation
+// of the decision.
+func runEval(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	trace := fs.Bool("trace", false, "print the PAC helper calls of each evaluation")
+	explain := fs.Bool("explain", false, "print the helper calls, DNS answers and return statement behind each decision")
+	compat := fs.String("compat", "default", "helper semantics: default, chromium, firefox or winhttp")
+	timeout := fs.Duration("timeout", 0, "script timeout (default 5s)")
+	at := fs.String("at", "", "evaluate as if the time were this RFC 3339 `time`, e.g. 2025-06-01T03:00:00Z")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac eval [-trace] [-explain | -at time] [-compat mode] [-timeout d] <pac> <url>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	mode, ok := pac.ParseCompatMode(*compat)
+	var atTime time.Time
+	if *at != "" {
+		var err error
+		if atTime, err = time.Parse(time.RFC3339, *at); err != nil || *explain {
+			ok = false
+		}
+	}
+	if fs.NArg() < 2 || !ok {
+		fs.Usage()
+		return 2
+	}
+
+	proxy, err := openPAC(fs.Arg(0), &pac.PACProxyConfig{ScriptTimeout: *timeout, CompatMode: mode})
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	defer proxy.Close()
+
+	code := 0
+	for _, raw := range fs.Args()[1:] {
+		targetURL, err := url.Parse(raw)
+		if err != nil || targetURL.Host == "" {
+			fmt.Fprintf(stderr, "pac: invalid URL %q\n", raw)
+			code = 1
+			continue
+		}
+		var calls []pac.HelperCall
+		ctx := context.Background()
+		if *trace {
+			ctx = pac.WithHelperTrace(ctx, func(call pac.HelperCall) { calls = append(calls, call) })
+		}
+		start := time.Now()
+		var (
+			result      pac.ProxyString
+			explanation *pac.Explanation
+		)
+		switch {
+		case *explain:
+			explanation, err = proxy.Explain(ctx, targetURL)
+			result = explanation.Result
+		case !atTime.IsZero():
+			result, err = proxy.FindProxyForURLAt(ctx, targetURL, atTime)
+		default:
+			result, err = proxy.FindProxyStringForURLContext(ctx, targetURL)
+		}
+		elapsed := time.Since(start)
+
+		fmt.Fprintln(stdout, raw)
+		if err != nil {
+			fmt.Fprintf(stdout, "  error:    %v\n", err)
+			code = 1
+		} else {
+			fmt.Fprintf(stdout, "  result:   %s\n", result)
+			fmt.Fprintf(stdout, "  proxies:  %s\n", formatProxies(result.Proxies()))
+		}
+		fmt.Fprintf(stdout, "  duration: %s\n", elapsed.Round(time.Microsecond))
+		for _, call := range calls {
+			fmt.Fprintf(stdout, "  trace:    %s\n", formatCall(call))
+		}
+		if explanation != nil {
+			printExplanation(stdout, explanation)
+		}
+	}
+	return code
+}
+
+func printExplanation(w io.Writer, e *pac.Explanation) {
+	fmt.Fprintf(w, "  source:   %s\n", e.Source)
+	for _, check := range e.Checks {
+		fmt.Fprintf(w, "  check:    line %d: %s\n", check.Line, formatCall(check.HelperCall))
+	}
+	for _, answer := range e.DNS {
+		if answer.Err != nil {
+			fmt.Fprintf(w, "  dns:      %s: %v\n", answer.Host, answer.Err)
+		} else {
+			fmt.Fprintf(w, "  dns:      %s = %s\n", answer.Host, strings.Join(answer.Addrs, ", "))
+		}
+	}
+	if e.Return != nil {
+		fmt.Fprintf(w, "  return:   line %d: %s\n", e.Return.Line, e.Return.Statement)
+	}
+}
+
+func formatProxies(proxies []pac.Proxy) string {
+	if len(proxies) == 0 {
+		return "(none)"
+	}
+	s := make([]string, len(proxies))
+	for i, p := range proxies {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// formatCall renders call like JavaScript, e.g. dnsResolve("a") = "10.0.0.1".
+func formatCall(call pac.HelperCall) string {
+	args := make([]string, len(call.Args))
+	for i, arg := range call.Args {
+		args[i] = formatValue(arg)
+	}
+	return fmt.Sprintf("%s(%s) = %s", call.Name, strings.Join(args, ", "), formatValue(call.Result))
+}
+
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
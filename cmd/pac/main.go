@@ -0,0 +1,66 @@
+// Command pac lets network admins test PAC scripts without writing Go.
+//
+// Usage:
+//
+//	pac eval [-trace] [-explain | -at time] [-compat mode] [-timeout d] <pac> <url>...
+//	pac validate [-max-size n] <file>...
+//	pac serve [-addr host:port] [-watch] <file>
+//	pac detect [-domain d] [-no-wpad] [-interface name] [-timeout d]
+//	pac bench [-c n] [-count n] [-timeout d] <pac> <corpus>
+//	pac cover [-dead] [-timeout d] <pac> <corpus>
+//	pac replay [-timeout d] <pac> <recording>
+//
+// <pac> is a local file or an http(s) URL.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: pac <command> [flags] [args]
+
+commands:
+  eval      evaluate a PAC script against URLs
+  validate  lint PAC files, exiting non-zero on problems
+  serve     serve a PAC file over HTTP
+  detect    show where the system PAC URL comes from
+  bench     measure a PAC script against a URL corpus
+  cover     show the branches of a PAC script a URL corpus takes
+  replay    compare a PAC script against recorded decisions
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "eval":
+		return runEval(args[1:], stdout, stderr)
+	case "validate":
+		return runValidate(args[1:], stdout, stderr)
+	case "serve":
+		return runServe(args[1:], stdout, stderr)
+	case "detect":
+		return runDetect(args[1:], stdout, stderr)
+	case "bench":
+		return runBench(args[1:], stdout, stderr)
+	case "cover":
+		return runCover(args[1:], stdout, stderr)
+	case "replay":
+		return runReplay(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "pac: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
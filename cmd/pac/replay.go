@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/phlipse/go-pac"
+)
+
+// runReplay re-evaluates the decisions of a pac.Recorder file against a PAC
+// and prints the ones that changed.
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	timeout := fs.Duration("timeout", 0, "script timeout (default 5s)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac replay [-timeout d] <pac> <recording>")
+		fmt.Fprintln(stderr, "<recording> is written by pac.Recorder, - reads stdin")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(1); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "pac: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+	decisions, err := pac.ReadRecording(r)
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %s: %v\n", fs.Arg(1), err)
+		return 1
+	}
+	proxy, err := openPAC(fs.Arg(0), &pac.PACProxyConfig{ScriptTimeout: *timeout})
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	defer proxy.Close()
+
+	diffs, err := pac.Replay(context.Background(), proxy, decisions)
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(stdout, "%s://%s\n", d.Scheme, d.Host)
+		fmt.Fprintf(stdout, "  recorded: %s\n", d.Result)
+		if d.Err != nil {
+			fmt.Fprintf(stdout, "  error:    %v\n", d.Err)
+		} else {
+			fmt.Fprintf(stdout, "  now:      %s\n", d.Got)
+		}
+	}
+	fmt.Fprintf(stdout, "replayed %d decisions, %d changed\n", len(decisions), len(diffs))
+	if len(diffs) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	pacContentType = "application/x-ns-proxy-autoconfig"
+	watchInterval  = time.Second
+)
+
+// runServe hosts a PAC file over HTTP until interrupted.
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	watch := fs.Bool("watch", false, "reload the file when it changes")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac serve [-addr host:port] [-watch] <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	logger := log.New(stderr, "", log.LstdFlags)
+	f := &pacFile{path: fs.Arg(0), logger: logger}
+	if _, err := f.load(); err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *watch {
+		go f.watch(ctx, watchInterval)
+	}
+	srv := &http.Server{Handler: f.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(stdout, "serving %s at http://%s%s\n", f.path, ln.Addr(), f.urlPath())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(stderr, "pac: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// pacFile serves the content of a PAC file, reloaded by load.
+type pacFile struct {
+	path   string
+	logger *log.Logger
+
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+// urlPath is the path the file is served at besides "/".
+func (f *pacFile) urlPath() string {
+	return "/" + filepath.Base(f.path)
+}
+
+// load reads the file if it was modified since the last load and reports
+// whether it did.
+func (f *pacFile) load() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.mu.RLock()
+	unchanged := f.data != nil && info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	f.data, f.modTime = data, info.ModTime()
+	f.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads the file every interval until ctx is done.
+func (f *pacFile) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := f.load()
+			switch {
+			case err != nil:
+				f.logger.Printf("reload %s: %v", f.path, err)
+			case changed:
+				f.logger.Printf("reloaded %s", f.path)
+			}
+		}
+	}
+}
+
+// handler serves the file at "/" and urlPath and logs every request.
+func (f *pacFile) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		f.serve(rec, r)
+		f.logger.Printf("%s %s %s %d %dB %s", r.RemoteAddr, r.Method, r.URL.Path, rec.status, rec.bytes, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+func (f *pacFile) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != f.urlPath() {
+		http.NotFound(w, r)
+		return
+	}
+	f.mu.RLock()
+	data, modTime := f.data, f.modTime
+	f.mu.RUnlock()
+	w.Header().Set("Content-Type", pacContentType)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
+
+// statusRecorder captures the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
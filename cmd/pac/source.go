@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/phlipse/go-pac"
+)
+
+// pacSource returns the PAC URL for source, a local file or an http(s) URL.
+// Local files are served through cfg.Client.
+func pacSource(source string, cfg *pac.PACProxyConfig) (*url.URL, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return url.Parse(source)
+	}
+	path, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Client = &http.Client{Transport: http.NewFileTransport(http.Dir(filepath.Dir(path)))}
+	return &url.URL{Scheme: "file", Path: "/" + filepath.Base(path)}, nil
+}
+
+// openPAC fetches and compiles the PAC script at source.
+func openPAC(source string, cfg *pac.PACProxyConfig) (*pac.PACProxy, error) {
+	pacURL, err := pacSource(source, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return pac.NewPACProxy(pacURL, cfg)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+	"github.com/phlipse/go-pac"
+)
+
+// defaultMaxSize matches the default PACProxyConfig.MaxScriptSize.
+const defaultMaxSize = 1 << 20
+
+// runValidate lints PAC files and exits non-zero if any has a problem.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	maxSize := fs.Int64("max-size", defaultMaxSize, "maximum script size in bytes, 0 for no limit")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pac validate [-max-size n] <file>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, path := range fs.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "pac: %v\n", err)
+			code = 1
+			continue
+		}
+		problems := validate(path, src, *maxSize)
+		for _, problem := range problems {
+			fmt.Fprintln(stdout, problem)
+		}
+		if len(problems) > 0 {
+			code = 1
+		} else {
+			fmt.Fprintf(stdout, "%s: ok\n", path)
+		}
+	}
+	return code
+}
+
+// validate returns the problems of the PAC script src, each prefixed with
+// its position.
+func validate(name string, src []byte, maxSize int64) []string {
+	var problems []string
+	if maxSize > 0 && int64(len(src)) > maxSize {
+		problems = append(problems, fmt.Sprintf("%s: script is %d bytes, over the limit of %d", name, len(src), maxSize))
+	}
+
+	var fset file.FileSet
+	prog, err := parser.ParseFile(&fset, name, src, 0)
+	if err != nil {
+		var list parser.ErrorList
+		if !errors.As(err, &list) {
+			return append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+		for _, e := range list {
+			problems = append(problems, fmt.Sprintf("%s: syntax error: %s", e.Position, e.Message))
+		}
+		return problems
+	}
+
+	l := &linter{fset: &fset, declared: make(map[string]bool)}
+	l.checkEntryPoint(name, prog)
+	l.checkUnreachable(prog.Body)
+	walk(prog, l.visit)
+	l.checkCalls()
+	sort.SliceStable(l.problems, func(i, j int) bool { return l.problems[i].idx < l.problems[j].idx })
+	for _, p := range l.problems {
+		problems = append(problems, p.msg)
+	}
+	return problems
+}
+
+type linter struct {
+	fset     *file.FileSet
+	problems []lintProblem
+	declared map[string]bool
+	calls    []*ast.Identifier
+}
+
+type lintProblem struct {
+	idx file.Idx
+	msg string
+}
+
+func (l *linter) report(idx file.Idx, format string, args ...any) {
+	msg := fmt.Sprintf("%s: %s", l.fset.Position(idx), fmt.Sprintf(format, args...))
+	l.problems = append(l.problems, lintProblem{idx: idx, msg: msg})
+}
+
+// checkEntryPoint reports a missing FindProxyForURL or one that does not
+// take (url, host).
+func (l *linter) checkEntryPoint(name string, prog *ast.Program) {
+	for _, st := range prog.Body {
+		var params *ast.ParameterList
+		var idx file.Idx
+		switch st := st.(type) {
+		case *ast.FunctionDeclaration:
+			if st.Function.Name != nil && st.Function.Name.Name == "FindProxyForURL" {
+				params, idx = st.Function.ParameterList, st.Function.Name.Idx
+			}
+		case *ast.VariableStatement:
+			params, idx = entryBinding(st.List)
+		case *ast.LexicalDeclaration:
+			params, idx = entryBinding(st.List)
+		}
+		if params == nil {
+			continue
+		}
+		if n := len(params.List); n != 2 || params.Rest != nil {
+			l.report(idx, "FindProxyForURL must take (url, host), got %d parameters", n)
+		}
+		return
+	}
+	l.problems = append(l.problems, lintProblem{msg: name + ": FindProxyForURL is not defined"})
+}
+
+// entryBinding returns the parameters of a function assigned to
+// FindProxyForURL by a var, let or const binding in list.
+func entryBinding(list []*ast.Binding) (*ast.ParameterList, file.Idx) {
+	for _, b := range list {
+		if id, ok := b.Target.(*ast.Identifier); ok && id.Name == "FindProxyForURL" {
+			switch fn := b.Initializer.(type) {
+			case *ast.FunctionLiteral:
+				return fn.ParameterList, id.Idx
+			case *ast.ArrowFunctionLiteral:
+				return fn.ParameterList, id.Idx
+			}
+		}
+	}
+	return nil, 0
+}
+
+// checkUnreachable reports the first statement of list that follows one
+// that always returns, throws, breaks or continues. Function declarations
+// are hoisted and therefore never unreachable.
+func (l *linter) checkUnreachable(list []ast.Statement) {
+	for i, st := range list {
+		if !terminates(st) {
+			continue
+		}
+		for _, next := range list[i+1:] {
+			switch next.(type) {
+			case *ast.FunctionDeclaration, *ast.EmptyStatement:
+				continue
+			}
+			l.report(next.Idx0(), "unreachable code")
+			break
+		}
+		return
+	}
+}
+
+func terminates(st ast.Statement) bool {
+	switch st := st.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	case *ast.BranchStatement:
+		return st.Token == token.BREAK || st.Token == token.CONTINUE
+	case *ast.BlockStatement:
+		return len(st.List) > 0 && terminates(st.List[len(st.List)-1])
+	case *ast.IfStatement:
+		return st.Alternate != nil && terminates(st.Consequent) && terminates(st.Alternate)
+	}
+	return false
+}
+
+func (l *linter) visit(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.FunctionLiteral:
+		if n.Name != nil {
+			l.declared[string(n.Name.Name)] = true
+		}
+	case *ast.Binding:
+		if id, ok := n.Target.(*ast.Identifier); ok {
+			l.declared[string(id.Name)] = true
+		}
+	case *ast.CatchStatement:
+		if id, ok := n.Parameter.(*ast.Identifier); ok {
+			l.declared[string(id.Name)] = true
+		}
+	case *ast.AssignExpression:
+		if id, ok := n.Left.(*ast.Identifier); ok {
+			l.declared[string(id.Name)] = true
+		}
+	case *ast.CallExpression:
+		if id, ok := n.Callee.(*ast.Identifier); ok {
+			l.calls = append(l.calls, id)
+		}
+	case *ast.BlockStatement:
+		l.checkUnreachable(n.List)
+	case *ast.CaseStatement:
+		l.checkUnreachable(n.Consequent)
+	}
+}
+
+// checkCalls reports calls of functions that are neither declared by the
+// script, PAC helpers nor JavaScript built-ins.
+func (l *linter) checkCalls() {
+	vm := pac.NewGojaRuntime()
+	_ = vm.DefinePACFunctions()
+	for _, id := range l.calls {
+		name := string(id.Name)
+		if !l.declared[name] && vm.Get(name) == nil {
+			l.report(id.Idx, "call of undefined function %s", name)
+		}
+	}
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// walk calls visit for n and every node below it. goja has no AST visitor,
+// so the tree is traversed by reflection.
+func walk(n ast.Node, visit func(ast.Node)) {
+	walkValue(reflect.ValueOf(n), visit, make(map[uintptr]bool))
+}
+
+func walkValue(v reflect.Value, visit func(ast.Node), seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkValue(v.Elem(), visit, seen)
+		}
+	case reflect.Pointer:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || !v.Type().Implements(nodeType) || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		visit(v.Interface().(ast.Node))
+		walkValue(v.Elem(), visit, seen)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				walkValue(v.Field(i), visit, seen)
+			}
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			walkValue(v.Index(i), visit, seen)
+		}
+	}
+}
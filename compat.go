@@ -0,0 +1,161 @@
+package pac
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// CompatMode selects whose PAC semantics the helpers and the arguments of
+// FindProxyForURL follow, for decisions identical to a browser's.
+type CompatMode int
+
+const (
+	// CompatDefault keeps the go-pac semantics: FindProxyForURL gets the
+	// full URL and the host with its port, dnsResolve and isInNet handle
+	// IPv4 and IPv6, shExpMatch matches like path.Match, and empty results
+	// follow EmptyResult.
+	CompatDefault CompatMode = iota
+	// CompatChromium follows Chromium: the path and query of https and wss
+	// URLs are stripped, dnsResolve returns IPv4 addresses only, and
+	// myIpAddress falls back to IPv6 and then 127.0.0.1.
+	CompatChromium
+	// CompatFirefox follows Firefox: the path and query of all URLs are
+	// stripped, dnsResolve returns the first address of either family, and
+	// myIpAddress falls back to 127.0.0.1.
+	CompatFirefox
+	// CompatWinHTTP follows WinHTTP and Internet Explorer: the URL is passed
+	// in full, dnsResolve returns IPv4 addresses only, and myIpAddress falls
+	// back to 127.0.0.1.
+	CompatWinHTTP
+)
+
+// In all browser modes FindProxyForURL gets the URL without user info and
+// fragment and the host without port, isInNet only matches IPv4, shExpMatch
+// treats only * and ? as special, with * matching "/" too, empty or null
+// results mean DIRECT, and setTimeout and friends are defined as no-ops.
+
+// String returns the name of m as accepted by ParseCompatMode.
+func (m CompatMode) String() string {
+	switch m {
+	case CompatChromium:
+		return "chromium"
+	case CompatFirefox:
+		return "firefox"
+	case CompatWinHTTP:
+		return "winhttp"
+	default:
+		return "default"
+	}
+}
+
+// ParseCompatMode returns the mode named "default", "chromium", "firefox"
+// or "winhttp", ignoring case.
+func ParseCompatMode(name string) (CompatMode, bool) {
+	for _, m := range []CompatMode{CompatDefault, CompatChromium, CompatFirefox, CompatWinHTTP} {
+		if strings.EqualFold(name, m.String()) {
+			return m, true
+		}
+	}
+	return CompatDefault, false
+}
+
+func (m CompatMode) browser() bool {
+	return m != CompatDefault
+}
+
+// scriptArgs returns the url and host arguments of FindProxyForURL.
+func (m CompatMode) scriptArgs(targetURL *url.URL) (string, string) {
+	if !m.browser() {
+		return targetURL.String(), targetURL.Host
+	}
+	u := *targetURL
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	scheme := strings.ToLower(u.Scheme)
+	if m == CompatFirefox || (m == CompatChromium && (scheme == "https" || scheme == "wss")) {
+		u.Path, u.RawPath, u.RawQuery, u.ForceQuery = "/", "", "", false
+	}
+	return u.String(), u.Hostname()
+}
+
+// dnsResolve picks the dnsResolve result from the addresses of a host.
+func (m CompatMode) dnsResolve(addrs []string) string {
+	for _, addr := range addrs {
+		if m == CompatChromium || m == CompatWinHTTP {
+			if ip := net.ParseIP(addr); ip == nil || ip.To4() == nil {
+				continue
+			}
+		}
+		return addr
+	}
+	return ""
+}
+
+// myIpAddress picks the myIpAddress result from the interface addresses.
+func (m CompatMode) myIpAddress(addrs []net.Addr) string {
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP.String()
+		}
+		if v6 == nil && !ipnet.IP.IsLinkLocalUnicast() {
+			v6 = ipnet.IP
+		}
+	}
+	switch {
+	case !m.browser():
+		return ""
+	case m == CompatChromium && v6 != nil:
+		return v6.String()
+	default:
+		return "127.0.0.1"
+	}
+}
+
+// ipInNet is ipInNet restricted to IPv4 in the browser modes.
+func (m CompatMode) ipInNet(ip net.IP, pattern, mask string) bool {
+	if m.browser() && (ip.To4() == nil || net.ParseIP(pattern).To4() == nil) {
+		return false
+	}
+	return ipInNet(ip, pattern, mask)
+}
+
+// shExpMatch is shExpMatch or, in the browser modes, a glob in which only
+// * and ? are special.
+func (m CompatMode) shExpMatch(str, pat string) bool {
+	if !m.browser() {
+		return shExpMatch(str, pat)
+	}
+	return globMatch([]rune(str), []rune(pat))
+}
+
+// globMatch matches s against a pattern of literal runes, * for any
+// sequence and ? for any rune, backtracking to the last * only.
+func globMatch(s, pat []rune) bool {
+	si, pi := 0, 0
+	star, mark := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(pat) && (pat[pi] == '?' || pat[pi] == s[si]):
+			si++
+			pi++
+		case pi < len(pat) && pat[pi] == '*':
+			star, mark = pi, si
+			pi++
+		case star >= 0:
+			mark++
+			si, pi = mark, star+1
+		default:
+			return false
+		}
+	}
+	for pi < len(pat) && pat[pi] == '*' {
+		pi++
+	}
+	return pi == len(pat)
+}
@@ -0,0 +1,58 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/pactest"
+)
+
+// TestCompatMode tests that the browser modes change the script arguments,
+// the helpers and the handling of empty results.
+func TestCompatMode(t *testing.T) {
+	server := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "empty.example.com") return "";
+		var r = [url, host, dnsResolve("dual.example.com"), myIpAddress(),
+			isInNet("fd00::1", "fd00::", "ffff::"), shExpMatch("a/b.c", "*.c"), shExpMatch("[x]", "[x]")];
+		return "PROXY " + r.join("|");
+	}`)
+	defer server.Close()
+	target, _ := url.Parse("https://user@www.example.com:8443/path?q=1#frag")
+	for _, tc := range []struct {
+		mode pac.CompatMode
+		want pac.ProxyString
+	}{
+		{pac.CompatDefault, "PROXY https://user@www.example.com:8443/path?q=1#frag|www.example.com:8443|fd00::5||true|false|false"},
+		{pac.CompatChromium, "PROXY https://www.example.com:8443/|www.example.com|10.0.0.5|fd00::7|false|true|true"},
+		{pac.CompatFirefox, "PROXY https://www.example.com:8443/|www.example.com|fd00::5|127.0.0.1|false|true|true"},
+		{pac.CompatWinHTTP, "PROXY https://www.example.com:8443/path?q=1|www.example.com|10.0.0.5|127.0.0.1|false|true|true"},
+	} {
+		proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{
+			CompatMode:     tc.mode,
+			Resolver:       pactest.NewResolver(map[string][]string{"dual.example.com": {"fd00::5", "10.0.0.5"}}),
+			InterfaceAddrs: pactest.InterfaceAddrs("127.0.0.1/8", "fe80::1/64", "fd00::7/64"),
+		})
+		got, err := proxy.FindProxyStringForURL(target)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: expected %q, got %q, %v", tc.mode, tc.want, got, err)
+		}
+		empty, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "https", Host: "empty.example.com"})
+		if tc.mode == pac.CompatDefault {
+			if !errors.Is(err, pac.ErrEmptyResult) {
+				t.Errorf("%s: expected ErrEmptyResult, got %q, %v", tc.mode, empty, err)
+			}
+		} else if err != nil || empty != "DIRECT" {
+			t.Errorf("%s: expected DIRECT for an empty result, got %q, %v", tc.mode, empty, err)
+		}
+		proxy.Close()
+	}
+
+	if m, ok := pac.ParseCompatMode("Chromium"); !ok || m != pac.CompatChromium {
+		t.Fatalf("Expected chromium to parse, got %v, %v", m, ok)
+	}
+	if _, ok := pac.ParseCompatMode("safari"); ok {
+		t.Fatalf("Expected safari not to parse")
+	}
+}
@@ -0,0 +1,171 @@
+package pac
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ContextDialer dials connections with a context. It matches
+// golang.org/x/net/proxy.ContextDialer and *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// DialViaProxy connects to addr through proxyURL, e.g. a URL returned by
+// PACProxy.ProxyFunc. http and https proxies are tunneled with CONNECT,
+// sending Proxy-Authorization when proxyURL carries user info. socks4 and
+// socks5 proxies are supported as well; a nil proxyURL dials directly.
+func DialViaProxy(ctx context.Context, proxyURL *url.URL, network, addr string) (net.Conn, error) {
+	forward := &net.Dialer{}
+	if proxyURL == nil {
+		return forward.DialContext(ctx, network, addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https":
+		if proxyURL.Port() == "" {
+			u := *proxyURL
+			u.Host = net.JoinHostPort(u.Hostname(), defaultPort(u.Scheme))
+			proxyURL = &u
+		}
+		return dialConnect(ctx, forward, nil, proxyURL, addr, proxyAuthHeader(proxyURL))
+	case "socks5", "socks5h":
+		return dialSOCKS5(ctx, forward, Proxy{Type: ProxySOCKS5, Host: proxyURL.Host}, socksAuthFromURL(proxyURL), network, addr)
+	case "socks4", "socks4a":
+		return dialSOCKS4(ctx, forward, Proxy{Type: ProxySOCKS4, Host: proxyURL.Host}, socksAuthFromURL(proxyURL), addr)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProxy, proxyURL.Scheme)
+	}
+}
+
+// proxyAuthHeader returns a Proxy-Authorization header for the user info of
+// proxyURL, or nil if there is none.
+func proxyAuthHeader(proxyURL *url.URL) http.Header {
+	if proxyURL.User == nil {
+		return nil
+	}
+	password, _ := proxyURL.User.Password()
+	return basicAuthHeader(proxyURL.User.Username(), password)
+}
+
+func basicAuthHeader(user, password string) http.Header {
+	creds := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	return http.Header{"Proxy-Authorization": {"Basic " + creds}}
+}
+
+func socksAuthFromURL(proxyURL *url.URL) *proxy.Auth {
+	if proxyURL.User == nil {
+		return nil
+	}
+	password, _ := proxyURL.User.Password()
+	return &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+}
+
+// dialConnect opens a tunnel to addr through the HTTP(S) proxy at proxyURL
+// using the CONNECT method.
+func dialConnect(ctx context.Context, forward ContextDialer, tlsConfig *tls.Config, proxyURL *url.URL, addr string, header http.Header) (net.Conn, error) {
+	conn, err := forward.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return connectOver(ctx, conn, tlsConfig, proxyURL, addr, header)
+}
+
+// connectOver opens a tunnel to addr with CONNECT over conn, a connection
+// to the proxy at proxyURL, closing conn if that fails.
+func connectOver(ctx context.Context, conn net.Conn, tlsConfig *tls.Config, proxyURL *url.URL, addr string, header http.Header) (net.Conn, error) {
+	// Abort the handshake when ctx is done and honor its deadline.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tunnel, err := connectHandshake(ctx, conn, tlsConfig, proxyURL, addr, header)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// connectHandshake sends CONNECT, first starting TLS for an https proxy
+// unless conn already is a TLS connection.
+func connectHandshake(ctx context.Context, conn net.Conn, tlsConfig *tls.Config, proxyURL *url.URL, addr string, header http.Header) (net.Conn, error) {
+	if _, ok := conn.(*tls.Conn); !ok && proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, proxyTLSConfig(tlsConfig, proxyURL))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: header,
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy %s refused CONNECT: %s", proxyURL.Host, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// proxyTLSConfig returns a copy of tlsConfig for the https proxy at
+// proxyURL, offering protos with ALPN unless tlsConfig sets NextProtos.
+func proxyTLSConfig(tlsConfig *tls.Config, proxyURL *url.URL, protos ...string) *tls.Config {
+	cfg := tlsConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = proxyURL.Hostname()
+	}
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = protos
+	}
+	return cfg
+}
+
+// bufferedConn returns data the proxy sent right after the CONNECT response
+// before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,199 @@
+package pac
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// CoverageBranch is a branch of the PAC script and the number of URLs that
+// took it.
+type CoverageBranch struct {
+	Line int
+	// Kind is "function" for the body of a function declaration, "then" and
+	// "else" for the outcomes of an if condition, explicit else or not, and
+	// "case" for a switch clause.
+	Kind string
+	// Code is the function name, the condition or the case test, on one
+	// line.
+	Code  string
+	Count int
+}
+
+// Coverage is the branch coverage of the PAC script for a URL corpus.
+type Coverage struct {
+	Branches []CoverageBranch
+	// URLs is the number of evaluations and Errors the number that failed.
+	URLs, Errors int
+}
+
+// Covered returns the number of branches taken at least once.
+func (c *Coverage) Covered() int {
+	n := 0
+	for _, b := range c.Branches {
+		if b.Count > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Dead returns the branches no URL took, in source order: rules the corpus
+// does not need.
+func (c *Coverage) Dead() []CoverageBranch {
+	var dead []CoverageBranch
+	for _, b := range c.Branches {
+		if b.Count == 0 {
+			dead = append(dead, b)
+		}
+	}
+	return dead
+}
+
+// Coverage evaluates every URL of corpus with the PAC script instrumented
+// in a fresh in-process runtime and reports the branches taken, to find
+// dead rules in large PAC files. Coverage is collected for the function
+// declarations of the script, their if statements and switch clauses;
+// function expressions, loops and conditional expressions are not
+// reported. URLs are evaluated by the script regardless of overrides, the
+// bypass list and the decision cache. Failed evaluations count as Errors
+// and do not stop the run; an error is returned if the script cannot be
+// instrumented or ctx is done.
+func (p *PACProxy) Coverage(ctx context.Context, corpus []*url.URL) (*Coverage, error) {
+	source, branches, err := instrumentBranches(p.script.Load().source)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := p.compileLocal(ctx, []byte(source))
+	if err != nil {
+		return nil, err
+	}
+	if err := vm.Set(coverageHook, func(call goja.FunctionCall) goja.Value {
+		taken := call.Argument(0)
+		if len(call.Arguments) == 3 && !call.Argument(2).ToBoolean() {
+			taken = call.Argument(1)
+		}
+		if i := int(taken.ToInteger()); i >= 0 && i < len(branches) {
+			branches[i].Count++
+		}
+		return call.Argument(2)
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExecutePACScript, err)
+	}
+
+	script := &pacScript{source: source, hash: sha256.Sum256([]byte(source)), vm: vm}
+	c := &Coverage{URLs: len(corpus)}
+	for _, u := range corpus {
+		if _, err := p.evaluate(ctx, script, p.evalURL(u)); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			c.Errors++
+		}
+	}
+	// An interrupted evaluation may still be unwinding; see Explain.
+	script.mu.Lock()
+	defer script.mu.Unlock()
+	c.Branches = append([]CoverageBranch(nil), branches...)
+	sort.SliceStable(c.Branches, func(i, j int) bool { return c.Branches[i].Line < c.Branches[j].Line })
+	return c, nil
+}
+
+// coverageHook counts a branch: coverageHook(i) counts i, and
+// coverageHook(i, j, value) counts i if value is truthy, j otherwise, and
+// returns value, so it can wrap a condition.
+const coverageHook = "__pacCover"
+
+// instrumentBranches rewrites the function declarations of source to call
+// coverageHook for each branch, keeping lines intact.
+func instrumentBranches(source string) (string, []CoverageBranch, error) {
+	prog, err := parser.ParseFile(nil, "", source, 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrExecutePACScript, err)
+	}
+	var (
+		branches   []CoverageBranch
+		insertions []sourceInsertion
+	)
+	line := func(offset int) int { return 1 + strings.Count(source[:offset], "\n") }
+	code := func(expr ast.Expression) string {
+		return strings.Join(strings.Fields(source[int(expr.Idx0())-1:int(expr.Idx1())-1]), " ")
+	}
+	add := func(b CoverageBranch) int {
+		branches = append(branches, b)
+		return len(branches) - 1
+	}
+
+	var function func(fn *ast.FunctionLiteral)
+	visit := func(st ast.Statement) {
+		switch st := st.(type) {
+		case *ast.FunctionDeclaration:
+			function(st.Function)
+		case *ast.IfStatement:
+			start := int(st.Test.Idx0()) - 1
+			then := add(CoverageBranch{Line: line(start), Kind: "then", Code: code(st.Test)})
+			elseLine := line(start)
+			switch alt := st.Alternate.(type) {
+			case nil:
+			case *ast.IfStatement:
+				// goja does not record where if statements start.
+				elseLine = line(int(alt.Test.Idx0()) - 1)
+			default:
+				elseLine = line(int(alt.Idx0()) - 1)
+			}
+			otherwise := add(CoverageBranch{Line: elseLine, Kind: "else", Code: code(st.Test)})
+			insertions = append(insertions,
+				sourceInsertion{start, fmt.Sprintf("%s(%d,%d,(", coverageHook, then, otherwise)},
+				sourceInsertion{int(st.Test.Idx1()) - 1, "))"})
+		case *ast.SwitchStatement:
+			for _, c := range st.Body {
+				if len(c.Consequent) == 0 {
+					continue
+				}
+				test := "default"
+				if c.Test != nil {
+					test = code(c.Test)
+				}
+				start := int(c.Consequent[0].Idx0()) - 1
+				i := add(CoverageBranch{Line: line(int(c.Case) - 1), Kind: "case", Code: test})
+				insertions = append(insertions, sourceInsertion{start, fmt.Sprintf("%s(%d);", coverageHook, i)})
+			}
+		}
+	}
+	function = func(fn *ast.FunctionLiteral) {
+		name := "(anonymous)"
+		if fn.Name != nil {
+			name = string(fn.Name.Name)
+		}
+		i := add(CoverageBranch{Line: line(int(fn.Function) - 1), Kind: "function", Code: name})
+		// Directives such as "use strict" must stay first.
+		at, text := int(fn.Body.LeftBrace), fmt.Sprintf("%s(%d);", coverageHook, i)
+		for _, st := range fn.Body.List {
+			directive, ok := st.(*ast.ExpressionStatement)
+			if !ok {
+				break
+			}
+			if _, ok := directive.Expression.(*ast.StringLiteral); !ok {
+				break
+			}
+			at, text = int(directive.Idx1())-1, fmt.Sprintf(";%s(%d);", coverageHook, i)
+		}
+		insertions = append(insertions, sourceInsertion{at, text})
+		for _, st := range fn.Body.List {
+			walkStatements(st, visit)
+		}
+	}
+	for _, st := range prog.Body {
+		if decl, ok := st.(*ast.FunctionDeclaration); ok {
+			function(decl.Function)
+		}
+	}
+	return insert(source, insertions), branches, nil
+}
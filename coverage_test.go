@@ -0,0 +1,61 @@
+package pac_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// TestCoverage tests that Coverage counts the branches a corpus takes
+// without changing the decisions of the script.
+func TestCoverage(t *testing.T) {
+	server := newScriptServer(t, `function FindProxyForURL(url, host) {
+	"use strict";
+	switch (host) {
+	case "a.example.com":
+		return "DIRECT";
+	case "b.example.com":
+	case "c.example.com":
+		return "PROXY c.example.com:3128";
+	default:
+	}
+	if (shExpMatch(host, "*.lab")) return "DIRECT"; else return pick(host);
+	function pick(h) { return h.length > 20 ? "PROXY long.example.com:3128" : "PROXY short.example.com:3128"; }
+}`)
+	defer server.Close()
+	proxy := newTestPACProxyFromURL(t, server.URL, nil)
+
+	var corpus []*url.URL
+	for _, host := range []string{"a.example.com", "x.lab", "www.example.com", "www.example.org"} {
+		corpus = append(corpus, &url.URL{Scheme: "https", Host: host})
+	}
+	c, err := proxy.Coverage(context.Background(), corpus)
+	if err != nil {
+		t.Fatalf("Error collecting coverage: %v", err)
+	}
+	var got []string
+	for _, b := range c.Branches {
+		got = append(got, fmt.Sprintf("%d %s %s %d", b.Line, b.Kind, b.Code, b.Count))
+	}
+	want := []string{
+		"1 function FindProxyForURL 4",
+		`4 case "a.example.com" 1`,
+		`7 case "c.example.com" 0`,
+		"11 then shExpMatch(host, \"*.lab\") 1",
+		"11 else shExpMatch(host, \"*.lab\") 2",
+		"12 function pick 2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected branches\n%q\ngot\n%q", want, got)
+	}
+	if c.URLs != 4 || c.Errors != 0 || c.Covered() != 5 || len(c.Dead()) != 1 {
+		t.Fatalf("Unexpected totals: %+v, covered %d, dead %v", c, c.Covered(), c.Dead())
+	}
+
+	// The script in use is not instrumented.
+	if got, err := proxy.FindProxyStringForURL(corpus[2]); err != nil || got != "PROXY short.example.com:3128" {
+		t.Fatalf("Expected the short proxy, got %q, %v", got, err)
+	}
+}
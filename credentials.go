@@ -0,0 +1,155 @@
+package pac
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// systemCredentialsTTL is how long SystemCredentials keeps the result of a
+// credential store lookup, including a failed one.
+const systemCredentialsTTL = 5 * time.Minute
+
+// CredentialProvider supplies credentials for a proxy. PAC results never carry
+// credentials, so ProxyFunc, Transport and Dialer ask the provider configured
+// in PACProxyConfig.Credentials before connecting. HTTP proxies receive them
+// as Basic Proxy-Authorization, SOCKS5 proxies as user name/password.
+type CredentialProvider interface {
+	GetCredentials(proxyURL *url.URL) (user, password string, ok bool)
+}
+
+// CredentialProviderFunc adapts a function to the CredentialProvider interface.
+type CredentialProviderFunc func(proxyURL *url.URL) (user, password string, ok bool)
+
+// GetCredentials calls the underlying function.
+func (f CredentialProviderFunc) GetCredentials(proxyURL *url.URL) (string, string, bool) {
+	return f(proxyURL)
+}
+
+// StaticCredentials returns a CredentialProvider using the same credentials
+// for every proxy. If hosts are given, only proxies whose host name matches
+// one of them (case-insensitive) receive the credentials.
+func StaticCredentials(user, password string, hosts ...string) CredentialProvider {
+	return CredentialProviderFunc(func(proxyURL *url.URL) (string, string, bool) {
+		if len(hosts) == 0 {
+			return user, password, true
+		}
+		for _, h := range hosts {
+			if strings.EqualFold(h, proxyURL.Hostname()) {
+				return user, password, true
+			}
+		}
+		return "", "", false
+	})
+}
+
+// credentialCache caches the credentials of lookup per proxy host name, so
+// the credential store is not queried, and cannot prompt, on every
+// connection.
+type credentialCache struct {
+	lookup func(host string) (user, password string, ok bool)
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedCredential
+}
+
+type cachedCredential struct {
+	user, password string
+	ok             bool
+	expires        time.Time
+}
+
+func newCredentialCache(ttl time.Duration, lookup func(host string) (string, string, bool)) *credentialCache {
+	return &credentialCache{lookup: lookup, ttl: ttl, entries: make(map[string]cachedCredential)}
+}
+
+// GetCredentials returns the cached credentials of the proxy's host name,
+// looking them up if there are none or they expired.
+func (c *credentialCache) GetCredentials(proxyURL *url.URL) (string, string, bool) {
+	host := strings.ToLower(proxyURL.Hostname())
+	c.mu.Lock()
+	entry, found := c.entries[host]
+	c.mu.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.user, entry.password, entry.ok
+	}
+
+	user, password, ok := c.lookup(host)
+	c.mu.Lock()
+	c.entries[host] = cachedCredential{user: user, password: password, ok: ok, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return user, password, ok
+}
+
+// parseKeychainOutput reads the account and password of
+// `security find-internet-password -g`, which prints the attributes to
+// stdout and the password to stderr.
+func parseKeychainOutput(stdout, stderr string) (string, string, bool) {
+	user, ok := parseKeychainValue(stdout, `"acct"<blob>=`)
+	if !ok {
+		return "", "", false
+	}
+	password, ok := parseKeychainValue(stderr, "password: ")
+	if !ok {
+		return "", "", false
+	}
+	return user, password, true
+}
+
+// parseKeychainValue extracts a quoted value following prefix, e.g.
+// `"acct"<blob>="alice"`.
+func parseKeychainValue(output, prefix string) (string, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		value := strings.TrimPrefix(line, prefix)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			return value[1 : len(value)-1], true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// parseSecretToolOutput reads the first item of `secret-tool search` output.
+func parseSecretToolOutput(output string) (string, string, bool) {
+	var user, password string
+	var haveSecret bool
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "attribute.user", "attribute.username":
+			if user == "" {
+				user = value
+			}
+		case "secret":
+			if haveSecret {
+				return user, password, true
+			}
+			password, haveSecret = value, true
+		}
+	}
+	return user, password, haveSecret && user != ""
+}
+
+// withCredentials returns proxyURL with the user info from the configured
+// CredentialProvider. URLs that already carry user info are returned as is.
+func (p *PACProxy) withCredentials(proxyURL *url.URL) *url.URL {
+	if proxyURL == nil || proxyURL.User != nil || p.credentials == nil {
+		return proxyURL
+	}
+	user, password, ok := p.credentials.GetCredentials(proxyURL)
+	if !ok {
+		return proxyURL
+	}
+	u := *proxyURL
+	u.User = url.UserPassword(user, password)
+	return &u
+}
@@ -0,0 +1,26 @@
+//go:build darwin
+// +build darwin
+
+package pac
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// SystemCredentials returns a CredentialProvider backed by the macOS Keychain.
+// It looks up internet passwords for the proxy's host name using the security
+// command. Results, including missing credentials, are cached per host for
+// five minutes.
+func SystemCredentials() CredentialProvider {
+	return newCredentialCache(systemCredentialsTTL, func(host string) (string, string, bool) {
+		cmd := exec.Command("security", "find-internet-password", "-g", "-s", host)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", "", false
+		}
+		return parseKeychainOutput(stdout.String(), stderr.String())
+	})
+}
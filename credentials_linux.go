@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package pac
+
+import "os/exec"
+
+// SystemCredentials returns a CredentialProvider backed by libsecret (GNOME
+// Keyring, KWallet via the Secret Service API). It searches items with the
+// attribute server=<proxy host name> using the secret-tool command and reads
+// the user from the "user" or "username" attribute. Results, including
+// missing credentials, are cached per host for five minutes.
+func SystemCredentials() CredentialProvider {
+	return newCredentialCache(systemCredentialsTTL, func(host string) (string, string, bool) {
+		out, err := exec.Command("secret-tool", "search", "server", host).Output()
+		if err != nil {
+			return "", "", false
+		}
+		return parseSecretToolOutput(string(out))
+	})
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !darwin && !linux
+// +build !windows,!darwin,!linux
+
+package pac
+
+import "net/url"
+
+// SystemCredentials returns a CredentialProvider that never finds credentials,
+// since this platform has no supported credential store.
+func SystemCredentials() CredentialProvider {
+	return CredentialProviderFunc(func(*url.URL) (string, string, bool) {
+		return "", "", false
+	})
+}
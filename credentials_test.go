@@ -0,0 +1,110 @@
+package pac_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// keychainStdout is the attribute list printed by `security find-internet-password -g -s proxy.example.com`.
+const keychainStdout = `keychain: "/Users/alice/Library/Keychains/login.keychain-db"
+version: 512
+class: "inet"
+attributes:
+    0x00000007 <blob>="proxy.example.com"
+    0x00000008 <blob>=<NULL>
+    "acct"<blob>="alice"
+    "atyp"<blob>="dflt"
+    "cdat"<timedate>=0x32303234303130323131353033375A00  "20240102115037Z\000"
+    "desc"<blob>=<NULL>
+    "port"<uint32>=0x00000C38 
+    "ptcl"<uint32>="htpx"
+    "srvr"<blob>="proxy.example.com"
+`
+
+// TestParseKeychainOutput tests reading the account and password printed by the macOS security command.
+func TestParseKeychainOutput(t *testing.T) {
+	tests := []struct {
+		name           string
+		stdout, stderr string
+		user, password string
+		ok             bool
+	}{
+		{"found", keychainStdout, "password: \"s3cr et\"\n", "alice", "s3cr et", true},
+		{"empty password", keychainStdout, "password: \"\"\n", "alice", "", true},
+		{"hex password", keychainStdout, "password: 0xC3A4  \"\\303\\244\"\n", "", "", false},
+		{"no account", "attributes:\n    \"acct\"<blob>=<NULL>\n", "password: \"s3cret\"\n", "", "", false},
+		{"no output", "", "", "", "", false},
+	}
+	for _, tt := range tests {
+		user, password, ok := pac.ParseKeychainOutput(tt.stdout, tt.stderr)
+		if user != tt.user || password != tt.password || ok != tt.ok {
+			t.Errorf("%s: Expected %q, %q, %v, got %q, %q, %v", tt.name, tt.user, tt.password, tt.ok, user, password, ok)
+		}
+	}
+}
+
+// TestParseSecretToolOutput tests reading the first item printed by `secret-tool search`.
+func TestParseSecretToolOutput(t *testing.T) {
+	item := `[/org/freedesktop/secrets/collection/login/12]
+label = Proxy
+secret = s3cr = et
+created = 2024-01-02 11:50:37
+modified = 2024-01-02 11:50:37
+schema = org.freedesktop.Secret.Generic
+attribute.server = proxy.example.com
+attribute.user = alice
+`
+	tests := []struct {
+		name           string
+		output         string
+		user, password string
+		ok             bool
+	}{
+		{"found", item, "alice", "s3cr = et", true},
+		{"username attribute", "[/org/freedesktop/secrets/collection/login/3]\nsecret = pw\nattribute.username = bob\n", "bob", "pw", true},
+		{"first of two", item + "[/org/freedesktop/secrets/collection/login/13]\nsecret = other\nattribute.user = carol\n", "alice", "s3cr = et", true},
+		{"no user", "[/org/freedesktop/secrets/collection/login/3]\nsecret = pw\n", "", "pw", false},
+		{"no output", "", "", "", false},
+	}
+	for _, tt := range tests {
+		user, password, ok := pac.ParseSecretToolOutput(tt.output)
+		if user != tt.user || password != tt.password || ok != tt.ok {
+			t.Errorf("%s: Expected %q, %q, %v, got %q, %q, %v", tt.name, tt.user, tt.password, tt.ok, user, password, ok)
+		}
+	}
+}
+
+// TestCredentialCache tests that credential store lookups are cached per host, including missing credentials.
+func TestCredentialCache(t *testing.T) {
+	lookups := map[string]int{}
+	cache := pac.NewCredentialCache(time.Minute, func(host string) (string, string, bool) {
+		lookups[host]++
+		return "alice", "secret", host == "proxy.example.com"
+	})
+	for i := 0; i < 3; i++ {
+		for _, rawURL := range []string{"http://PROXY.example.com:8080", "http://other.example.com:8080"} {
+			proxyURL, _ := url.Parse(rawURL)
+			cache.GetCredentials(proxyURL)
+		}
+	}
+	proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+	if user, password, ok := cache.GetCredentials(proxyURL); user != "alice" || password != "secret" || !ok {
+		t.Fatalf("Expected cached credentials, got %q, %q, %v", user, password, ok)
+	}
+	if lookups["proxy.example.com"] != 1 || lookups["other.example.com"] != 1 {
+		t.Fatalf("Expected one lookup per host, got %v", lookups)
+	}
+
+	expiring := pac.NewCredentialCache(0, func(string) (string, string, bool) {
+		lookups["expiring"]++
+		return "", "", false
+	})
+	expiring.GetCredentials(proxyURL)
+	expiring.GetCredentials(proxyURL)
+	if lookups["expiring"] != 2 {
+		t.Fatalf("Expected expired entries to be looked up again, got %d lookups", lookups["expiring"])
+	}
+}
@@ -0,0 +1,93 @@
+//go:build windows
+// +build windows
+
+package pac
+
+import (
+	"net/url"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modadvapi32   = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW = modadvapi32.NewProc("CredReadW")
+	procCredFree  = modadvapi32.NewProc("CredFree")
+)
+
+const credTypeGeneric = 1
+
+// credentialW mirrors the Win32 CREDENTIALW structure.
+type credentialW struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// SystemCredentials returns a CredentialProvider backed by the Windows
+// Credential Manager. It looks up generic credentials whose target name is
+// the proxy's host:port or host name.
+func SystemCredentials() CredentialProvider {
+	return CredentialProviderFunc(func(proxyURL *url.URL) (string, string, bool) {
+		for _, target := range credentialTargets(proxyURL) {
+			if user, password, ok := credRead(target); ok {
+				return user, password, true
+			}
+		}
+		return "", "", false
+	})
+}
+
+func credRead(target string) (string, string, bool) {
+	name, err := windows.UTF16PtrFromString(target)
+	if err != nil {
+		return "", "", false
+	}
+	var cred *credentialW
+	ret, _, _ := procCredReadW.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ret == 0 || cred == nil {
+		return "", "", false
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	user := windows.UTF16PtrToString(cred.UserName)
+	var password string
+	if cred.CredentialBlobSize > 0 && cred.CredentialBlob != nil {
+		blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+		password = decodeCredentialBlob(blob)
+	}
+	return user, password, true
+}
+
+// decodeCredentialBlob decodes the UTF-16LE password Credential Manager stores
+// for generic credentials, falling back to the raw bytes.
+func decodeCredentialBlob(blob []byte) string {
+	if len(blob)%2 != 0 {
+		return string(blob)
+	}
+	u := make([]uint16, len(blob)/2)
+	for i := range u {
+		u[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+	}
+	return string(utf16.Decode(u))
+}
+
+// credentialTargets returns the names a proxy's credentials may be stored
+// under in an OS credential store, most specific first.
+func credentialTargets(proxyURL *url.URL) []string {
+	if proxyURL.Port() == "" {
+		return []string{proxyURL.Hostname()}
+	}
+	return []string{proxyURL.Host, proxyURL.Hostname()}
+}
@@ -0,0 +1,172 @@
+package pac
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const recentEvalsSize = 50
+
+// recentEvals keeps the last lookups for the debug handler.
+type recentEvals struct {
+	mu    sync.Mutex
+	evals []debugEval
+	next  int
+}
+
+type debugEval struct {
+	Time     time.Time     `json:"time"`
+	Host     string        `json:"host"`
+	Result   ProxyString   `json:"result,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	CacheHit bool          `json:"cache_hit"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func (r *recentEvals) record(e EvalEvent) {
+	d := debugEval{Time: time.Now(), Host: e.Host, Result: e.Result, Duration: e.Duration, CacheHit: e.CacheHit}
+	if e.Err != nil {
+		d.Error = e.Err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.evals) < recentEvalsSize {
+		r.evals = append(r.evals, d)
+		return
+	}
+	r.evals[r.next] = d
+	r.next = (r.next + 1) % recentEvalsSize
+}
+
+// snapshot returns the recorded lookups, newest first.
+func (r *recentEvals) snapshot() []debugEval {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]debugEval, 0, len(r.evals))
+	for i := len(r.evals) - 1; i >= 0; i-- {
+		out = append(out, r.evals[(r.next+i)%len(r.evals)])
+	}
+	return out
+}
+
+// debugDetection is Detection with the errors as text.
+type debugDetection struct {
+	URL      string                 `json:"url,omitempty"`
+	Source   string                 `json:"source,omitempty"`
+	Duration time.Duration          `json:"duration_ns"`
+	Sources  []debugDetectionSource `json:"sources"`
+}
+
+type debugDetectionSource struct {
+	Name     string        `json:"name"`
+	URL      string        `json:"url,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func newDebugDetection(d *Detection) *debugDetection {
+	if d == nil {
+		return nil
+	}
+	out := &debugDetection{Source: d.Source, Duration: d.Duration}
+	if d.URL != nil {
+		out.URL = d.URL.String()
+	}
+	for _, s := range d.Sources {
+		source := debugDetectionSource{Name: s.Name, URL: s.URL, Duration: s.Duration}
+		if s.Err != nil {
+			source.Error = s.Err.Error()
+		}
+		out.Sources = append(out.Sources, source)
+	}
+	return out
+}
+
+type debugState struct {
+	URL          string                 `json:"url"`
+	ScriptHash   string                 `json:"script_hash"`
+	ScriptSource string                 `json:"script_source"`
+	Stats        Stats                  `json:"stats"`
+	Decisions    DecisionStats          `json:"decisions"`
+	ProxyMetrics map[Proxy]ProxyMetrics `json:"proxy_metrics"`
+	Health       map[Proxy]healthState  `json:"health"`
+	Recent       []debugEval            `json:"recent_evaluations"`
+	Hosts        []HostEvalStats        `json:"hosts,omitempty"`
+	Detection    *debugDetection        `json:"detection,omitempty"`
+}
+
+func (p *PACProxy) debugState() debugState {
+	script := p.script.Load()
+	return debugState{
+		URL:          p.pacURL,
+		ScriptHash:   hex.EncodeToString(script.hash[:]),
+		ScriptSource: script.source,
+		Stats:        p.Stats(),
+		Decisions:    p.DecisionStats(),
+		ProxyMetrics: p.ProxyMetrics(),
+		Health:       p.health.snapshot(),
+		Recent:       p.recent.snapshot(),
+		Hosts:        p.HostEvalStats(),
+		Detection:    newDebugDetection(p.detection),
+	}
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html><head><title>PAC</title></head><body>
+<h1>PAC {{.URL}}</h1>
+<p>Script {{.ScriptHash}}</p>
+<h2>Caches</h2>
+<table border="1"><tr><th></th><th>Hits</th><th>Misses</th><th>Evictions</th><th>Size</th></tr>
+<tr><td>DNS</td><td>{{.Stats.DNS.Hits}}</td><td>{{.Stats.DNS.Misses}}</td><td>{{.Stats.DNS.Evictions}}</td><td>{{.Stats.DNS.Size}}</td></tr>
+<tr><td>Decisions</td><td>{{.Stats.Decisions.Hits}}</td><td>{{.Stats.Decisions.Misses}}</td><td>{{.Stats.Decisions.Evictions}}</td><td>{{.Stats.Decisions.Size}}</td></tr>
+<tr><td>Script</td><td>{{.Stats.Script.Hits}}</td><td>{{.Stats.Script.Misses}}</td><td>{{.Stats.Script.Evictions}}</td><td>{{.Stats.Script.Size}}</td></tr>
+</table>
+<p>Evaluations {{.Stats.Evaluations.Evaluations}}, errors {{.Stats.Evaluations.Errors}}, timeouts {{.Stats.Evaluations.Timeouts}}</p>
+<h2>Proxy health</h2>
+<table border="1"><tr><th>Proxy</th><th>State</th><th>Failures</th><th>Open until</th></tr>
+{{range $proxy, $h := .Health}}<tr><td>{{$proxy}}</td><td>{{$h.State}}</td><td>{{$h.Failures}}</td><td>{{if not $h.OpenUntil.IsZero}}{{$h.OpenUntil}}{{end}}</td></tr>
+{{end}}</table>
+<h2>Recent evaluations</h2>
+<table border="1"><tr><th>Time</th><th>Host</th><th>Result</th><th>Duration</th><th>Cache hit</th><th>Error</th></tr>
+{{range .Recent}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Host}}</td><td>{{.Result}}</td><td>{{.Duration}}</td><td>{{.CacheHit}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{with .Hosts}}<h2>Hosts</h2>
+<table border="1"><tr><th>Host</th><th>Evaluations</th><th>Errors</th><th>Cache hits</th><th>Avg latency</th><th>Cached decision</th><th>Age</th></tr>
+{{range .}}<tr><td>{{.Host}}</td><td>{{.Evaluations}}</td><td>{{.Errors}}</td><td>{{.CacheHits}}</td><td>{{.AvgLatency}}</td><td>{{.Decision}}</td><td>{{if .Decision}}{{.DecisionAge}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Detection}}<h2>Detection</h2>
+<p>Found {{if .URL}}{{.URL}} ({{.Source}}){{else}}no PAC URL{{end}} in {{.Duration}}</p>
+<table border="1"><tr><th>Source</th><th>URL</th><th>Duration</th><th>Error</th></tr>
+{{range .Sources}}<tr><td>{{.Name}}</td><td>{{.URL}}</td><td>{{.Duration}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}<h2>Script</h2>
+<pre>{{.ScriptSource}}</pre>
+</body></html>
+`))
+
+// DebugHandler returns an http.Handler serving the current script and its
+// hash, the recent lookups, the cache statistics, the proxy health, the
+// HostEvalStats and the Detection of the config, for mounting in an admin
+// server, e.g. under /debug/pac. It serves JSON, or
+// HTML to browsers and for ?format=html. The view includes the PAC source
+// and destination hosts, so do not expose it publicly.
+func (p *PACProxy) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := p.debugState()
+		format := r.URL.Query().Get("format")
+		if format == "html" || format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = debugTemplate.Execute(w, state)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(state)
+	})
+}
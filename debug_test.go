@@ -0,0 +1,66 @@
+package pac_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestDebugHandler tests the JSON and HTML views of the debug handler.
+func TestDebugHandler(t *testing.T) {
+	pacServer := newPACServer(t, "PROXY proxy.example.com:3128")
+	defer pacServer.Close()
+	pac.SetTestPACURL(pacServer.URL)
+	t.Cleanup(func() { pac.SetTestPACURL("") })
+	detection, err := pac.DetectPACURL(context.Background(), &pac.DetectOptions{NoWPAD: true})
+	if err != nil {
+		t.Fatalf("Error detecting PAC URL: %v", err)
+	}
+
+	proxy := newTestPACProxyFromURL(t, detection.URL.String(), &pac.PACProxyConfig{Detection: detection})
+	targetURL, _ := url.Parse("http://example.com")
+	if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	proxy.ReportProxyFailure(pac.Proxy{Type: pac.ProxyHTTP, Host: "proxy.example.com:3128"})
+
+	rec := httptest.NewRecorder()
+	proxy.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pac", nil))
+	var state struct {
+		ScriptHash   string                          `json:"script_hash"`
+		ScriptSource string                          `json:"script_source"`
+		Health       map[string]map[string]any       `json:"health"`
+		Recent       []struct{ Host, Result string } `json:"recent_evaluations"`
+		Detection    struct {
+			URL, Source string
+			Sources     []struct{ Name, URL, Error string }
+		} `json:"detection"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatalf("Error decoding debug state: %v", err)
+	}
+	if len(state.ScriptHash) != 64 || !strings.Contains(state.ScriptSource, "FindProxyForURL") {
+		t.Fatalf("Unexpected script in debug state: %q %q", state.ScriptHash, state.ScriptSource)
+	}
+	if len(state.Recent) != 1 || state.Recent[0].Host != "example.com" || state.Recent[0].Result != "PROXY proxy.example.com:3128" {
+		t.Fatalf("Unexpected recent evaluations: %+v", state.Recent)
+	}
+	if h := state.Health["PROXY proxy.example.com:3128"]; h["state"] != "open" {
+		t.Fatalf("Expected the failed proxy to be open, got %v", state.Health)
+	}
+	if d := state.Detection; d.URL != pacServer.URL || d.Source != "system" || len(d.Sources) != 3 || d.Sources[1].Name != "policy" || d.Sources[1].Error == "" {
+		t.Fatalf("Unexpected detection in debug state: %+v", d)
+	}
+
+	rec = httptest.NewRecorder()
+	proxy.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pac?format=html", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") || !strings.Contains(rec.Body.String(), "example.com") {
+		t.Fatalf("Unexpected HTML view (%s): %s", ct, rec.Body.String())
+	}
+}
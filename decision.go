@@ -0,0 +1,204 @@
+package pac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja/ast"
+)
+
+// decisionKey identifies a cached PAC result. It covers the script version
+// and how it is evaluated, see decisionPrefix, the scheme, the host and the
+// client IP passed to the script, if any. Path and query are ignored unless
+// the script reads its url argument.
+func decisionKey(script *pacScript, target *url.URL, client string) string {
+	key := script.decisionPrefix + " " + strings.ToLower(target.Scheme) + "://" + strings.ToLower(target.Host)
+	if script.readsURL {
+		key = script.decisionPrefix + " url " + target.String()
+	}
+	if client != "" {
+		key += " " + client
+	}
+	return key
+}
+
+// evalFingerprint describes the options that change what a script returns
+// for a URL, so that PACProxies sharing a DecisionCache, such as the
+// profiles of a Manager, only share the decisions of the same script
+// evaluated the same way. Resolvers, DNS filters and custom runtimes cannot
+// be compared and are not covered.
+func evalFingerprint(cfg *PACProxyConfig) string {
+	return fmt.Sprintf("compat=%d extensions=%t module=%t sandbox=%t entry=%q empty=%d client=%q,%t runtime=%t",
+		cfg.CompatMode, cfg.ExtensionHelpers, cfg.ModuleSyntax, cfg.Sandbox, cfg.EntryPoints, cfg.EmptyResult,
+		cfg.ClientIPGlobal, cfg.ClientIPArgument, cfg.NewRuntime != nil)
+}
+
+// decisionPrefix returns the prefix of the decision keys of the script with
+// hash, evaluated as described by p.evalFingerprint.
+func (p *PACProxy) decisionPrefix(hash [sha256.Size]byte) string {
+	sum := sha256.Sum256(append(hash[:], p.evalFingerprint...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// scriptReadsURL reports whether the entry point of source may read its url
+// argument, so that its decisions can differ between URLs of one host. It
+// errs towards true: the parameter, arguments and eval are searched as
+// words in the function body, and entry points that are not function
+// declarations with a plain first parameter count as reading it.
+func scriptReadsURL(source, entry string) bool {
+	fn := findProxyFunction(source, entry)
+	if fn == nil || fn.ParameterList.Rest != nil {
+		return true
+	}
+	words := []string{"arguments", "eval"}
+	if params := fn.ParameterList.List; len(params) > 0 {
+		param, ok := params[0].Target.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		words = append(words, string(param.Name))
+	}
+	body := source[fn.Body.Idx0()-1 : fn.Body.Idx1()-1]
+	for _, word := range words {
+		if containsWord(body, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether word occurs in s other than as part of a
+// longer JavaScript identifier.
+func containsWord(s, word string) bool {
+	isIdent := func(c byte) bool {
+		return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+	}
+	for i := 0; ; {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		if (start == 0 || !isIdent(s[start-1])) && (end == len(s) || !isIdent(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func (p *PACProxy) cachedDecision(script *pacScript, target *url.URL, client string) (ProxyString, bool) {
+	if p.decisions == nil {
+		return "", false
+	}
+	value, ok := p.decisions.Get(decisionKey(script, target, client))
+	p.decisionStats.record(ok)
+	p.observeCache("decision", ok)
+	if !ok {
+		return "", false
+	}
+	return ProxyString(value), true
+}
+
+func (p *PACProxy) cacheDecision(script *pacScript, target *url.URL, client string, result ProxyString) {
+	if p.decisions != nil {
+		p.decisions.Set(decisionKey(script, target, client), []byte(result), p.decisionTTL)
+		p.decisionCounts.cached(target.Hostname(), result, time.Now(), p.decisionTTL)
+		p.observeCaches()
+	}
+}
+
+// decisionFile is the on-disk format of a persisted decision cache.
+type decisionFile struct {
+	Script    string              `json:"script"`
+	Decisions []persistedDecision `json:"decisions"`
+}
+
+type persistedDecision struct {
+	Key     string    `json:"key"`
+	Result  string    `json:"result"`
+	Expires time.Time `json:"expires"`
+}
+
+// loadDecisions warms the decision cache from DecisionCacheFile. Entries of
+// another script version or that expired meanwhile are skipped; a missing
+// file is not an error.
+func (p *PACProxy) loadDecisions(ctx context.Context) {
+	store, ok := p.decisions.(*MemoryStore)
+	if p.decisionFile == "" || !ok {
+		return
+	}
+	data, err := os.ReadFile(p.decisionFile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			p.logf(ctx, LogWarn, "read decision cache failed", "path", p.decisionFile, "err", err)
+		}
+		return
+	}
+	var file decisionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		p.logf(ctx, LogWarn, "parse decision cache failed", "path", p.decisionFile, "err", err)
+		return
+	}
+	script := p.script.Load()
+	if file.Script != hex.EncodeToString(script.hash[:]) {
+		p.logf(ctx, LogDebug, "decision cache belongs to another script", "path", p.decisionFile)
+		return
+	}
+
+	now := time.Now()
+	var loaded int
+	for _, d := range file.Decisions {
+		if ttl := d.Expires.Sub(now); ttl > 0 {
+			store.Set(d.Key, []byte(d.Result), ttl)
+			loaded++
+		}
+	}
+	p.logf(ctx, LogInfo, "decision cache loaded", "path", p.decisionFile, "entries", loaded)
+}
+
+// saveDecisions writes the decisions of the current script to
+// DecisionCacheFile.
+func (p *PACProxy) saveDecisions() error {
+	store, ok := p.decisions.(*MemoryStore)
+	if p.decisionFile == "" || !ok {
+		return nil
+	}
+	script := p.script.Load()
+	prefix := script.decisionPrefix + " "
+	file := decisionFile{
+		Script:    hex.EncodeToString(script.hash[:]),
+		Decisions: store.persisted(prefix),
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(p.decisionFile)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(p.decisionFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.decisionFile)
+}
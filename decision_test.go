@@ -0,0 +1,102 @@
+package pac_test
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestDecisionCache tests that PAC results are cached per scheme and host.
+func TestDecisionCache(t *testing.T) {
+	pacServer := newScriptServer(t, `var n = 0;
+	function FindProxyForURL(url, host) { n++; return "PROXY p" + n + ".example.com:3128"; }`)
+	defer pacServer.Close()
+
+	store := pac.NewMemoryStore(0)
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{DecisionCacheTTL: time.Minute, DecisionCache: store})
+
+	tests := []struct {
+		target string
+		want   pac.ProxyString
+	}{
+		{"http://example.com/a", "PROXY p1.example.com:3128"},
+		{"http://example.com/b?q=1", "PROXY p1.example.com:3128"},
+		{"https://example.com/a", "PROXY p2.example.com:3128"},
+		{"http://other.example.com/", "PROXY p3.example.com:3128"},
+	}
+	for _, tt := range tests {
+		targetURL, _ := url.Parse(tt.target)
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", tt.target, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: expected proxy string %s, got %s", tt.target, tt.want, got)
+		}
+	}
+}
+
+// TestDecisionCacheURL tests that decisions of scripts reading the url argument are cached per URL.
+func TestDecisionCacheURL(t *testing.T) {
+	tests := []struct {
+		name, script string
+		want         []pac.ProxyString
+	}{
+		{"url", `var n = 0;
+	function FindProxyForURL(url, host) { n++; return url.indexOf("/api/") >= 0 ? "PROXY api" + n + ".example.com:3128" : "DIRECT"; }`,
+			[]pac.ProxyString{"PROXY api1.example.com:3128", "DIRECT", "PROXY api1.example.com:3128"}},
+		{"arguments", `var n = 0;
+	function FindProxyForURL() { n++; return arguments[0].indexOf("/api/") >= 0 ? "PROXY api" + n + ".example.com:3128" : "DIRECT"; }`,
+			[]pac.ProxyString{"PROXY api1.example.com:3128", "DIRECT", "PROXY api1.example.com:3128"}},
+		{"renamed", `var n = 0;
+	function FindProxyForURL(u, h) { n++; return u.indexOf("/api/") >= 0 ? "PROXY api" + n + ".example.com:3128" : "DIRECT"; }`,
+			[]pac.ProxyString{"PROXY api1.example.com:3128", "DIRECT", "PROXY api1.example.com:3128"}},
+		{"host only", `var n = 0;
+	function FindProxyForURL(url, host) { n++; var urlish = host; return "PROXY p" + n + ".example.com:3128"; }`,
+			[]pac.ProxyString{"PROXY p1.example.com:3128", "PROXY p1.example.com:3128", "PROXY p1.example.com:3128"}},
+	}
+	for _, tt := range tests {
+		proxy := newScriptPACProxy(t, tt.script, &pac.PACProxyConfig{DecisionCacheTTL: time.Minute})
+		for i, target := range []string{"http://example.com/api/a", "http://example.com/web", "http://example.com/api/a"} {
+			targetURL, _ := url.Parse(target)
+			got, err := proxy.FindProxyStringForURL(targetURL)
+			if err != nil {
+				t.Fatalf("%s: Error finding proxy for %s: %v", tt.name, target, err)
+			}
+			if got != tt.want[i] {
+				t.Fatalf("%s: %s: expected proxy string %s, got %s", tt.name, target, tt.want[i], got)
+			}
+		}
+	}
+}
+
+// TestDecisionCacheFile tests that the decision cache is written on Close and warm-loaded by the next PACProxy.
+func TestDecisionCacheFile(t *testing.T) {
+	pacServer := newPACServer(t, "PROXY proxy.example.com:3128")
+	defer pacServer.Close()
+	cfg := &pac.PACProxyConfig{
+		DecisionCacheTTL:  time.Minute,
+		DecisionCacheFile: filepath.Join(t.TempDir(), "decisions.json"),
+	}
+	targetURL, _ := url.Parse("http://example.com")
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, cfg)
+	if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Error closing PAC proxy: %v", err)
+	}
+
+	proxy = newTestPACProxyFromURL(t, pacServer.URL, cfg)
+	defer proxy.Close()
+	if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	if stats := proxy.Stats(); stats.Decisions.Hits != 1 || stats.Decisions.Misses != 0 {
+		t.Fatalf("Expected a warm decision cache, got %+v", stats.Decisions)
+	}
+}
@@ -0,0 +1,214 @@
+package pac
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDecisionStatsHosts bounds the number of hosts in DecisionStats.Hosts and
+// HostEvalStats, so crawling many destinations cannot grow the counters
+// without limit.
+const maxDecisionStatsHosts = 10000
+
+// DecisionStats counts the results of lookups by their first proxy
+// endpoint, DIRECT included.
+type DecisionStats struct {
+	Results map[Proxy]uint64
+	// Hosts breaks Results down by destination host. It is only filled if
+	// PACProxyConfig.DecisionStatsByHost is set.
+	Hosts map[string]map[Proxy]uint64
+}
+
+// HostEvalStats holds the lookup statistics of one destination host.
+type HostEvalStats struct {
+	Host string
+	// Evaluations counts the lookups that ran the script, Errors the failed
+	// ones among them and CacheHits the lookups answered by the decision
+	// cache.
+	Evaluations uint64
+	Errors      uint64
+	CacheHits   uint64
+	// AvgLatency is the mean duration of the evaluations.
+	AvgLatency time.Duration
+	// Decision is the decision cached for the host, "" if none is cached,
+	// and DecisionAge how long ago it was cached. With several schemes it
+	// is the one cached last.
+	Decision    ProxyString
+	DecisionAge time.Duration
+}
+
+// decisionCounts collects DecisionStats and, by host, HostEvalStats.
+type decisionCounts struct {
+	mu      sync.Mutex
+	byHost  bool
+	results map[Proxy]uint64
+	hosts   map[string]*hostCounts
+}
+
+// hostCounts holds the counters of one destination host.
+type hostCounts struct {
+	results                        map[Proxy]uint64
+	evaluations, errors, cacheHits uint64
+	latency                        time.Duration
+	decision                       ProxyString
+	cachedAt                       time.Time
+	expires                        time.Time
+}
+
+func newDecisionCounts(byHost bool) *decisionCounts {
+	return &decisionCounts{
+		byHost:  byHost,
+		results: make(map[Proxy]uint64),
+		hosts:   make(map[string]*hostCounts),
+	}
+}
+
+// host returns the counters of host, nil if they are not kept by host or
+// the table is full. The caller holds c.mu; byHost does not change, so
+// callers may check it before locking.
+func (c *decisionCounts) host(host string) *hostCounts {
+	if !c.byHost {
+		return nil
+	}
+	host = strings.ToLower(host)
+	counts, ok := c.hosts[host]
+	if !ok {
+		if len(c.hosts) >= maxDecisionStatsHosts {
+			return nil
+		}
+		counts = &hostCounts{results: make(map[Proxy]uint64)}
+		c.hosts[host] = counts
+	}
+	return counts
+}
+
+func (c *decisionCounts) record(host string, proxy Proxy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[proxy]++
+	if counts := c.host(host); counts != nil {
+		counts.results[proxy]++
+	}
+}
+
+func (c *decisionCounts) evaluated(host string, elapsed time.Duration, err error) {
+	if !c.byHost {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if counts := c.host(host); counts != nil {
+		counts.evaluations++
+		counts.latency += elapsed
+		if err != nil {
+			counts.errors++
+		}
+	}
+}
+
+func (c *decisionCounts) cacheHit(host string) {
+	if !c.byHost {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if counts := c.host(host); counts != nil {
+		counts.cacheHits++
+	}
+}
+
+// cached records result as the decision cached for host until now+ttl.
+func (c *decisionCounts) cached(host string, result ProxyString, now time.Time, ttl time.Duration) {
+	if !c.byHost {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if counts := c.host(host); counts != nil {
+		counts.decision, counts.cachedAt, counts.expires = result, now, now.Add(ttl)
+	}
+}
+
+func (c *decisionCounts) snapshot() DecisionStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := DecisionStats{Results: make(map[Proxy]uint64, len(c.results))}
+	for proxy, n := range c.results {
+		stats.Results[proxy] = n
+	}
+	if c.byHost {
+		stats.Hosts = make(map[string]map[Proxy]uint64, len(c.hosts))
+		for host, counts := range c.hosts {
+			if len(counts.results) == 0 {
+				continue
+			}
+			hostCounts := make(map[Proxy]uint64, len(counts.results))
+			for proxy, n := range counts.results {
+				hostCounts[proxy] = n
+			}
+			stats.Hosts[host] = hostCounts
+		}
+	}
+	return stats
+}
+
+// hostSnapshot returns the HostEvalStats sorted by evaluations, most first,
+// then by host, nil if they are not kept by host.
+func (c *decisionCounts) hostSnapshot(now time.Time) []HostEvalStats {
+	c.mu.Lock()
+	if !c.byHost {
+		c.mu.Unlock()
+		return nil
+	}
+	stats := make([]HostEvalStats, 0, len(c.hosts))
+	for host, counts := range c.hosts {
+		s := HostEvalStats{Host: host, Evaluations: counts.evaluations, Errors: counts.errors, CacheHits: counts.cacheHits}
+		if counts.evaluations > 0 {
+			s.AvgLatency = counts.latency / time.Duration(counts.evaluations)
+		}
+		if counts.decision != "" && now.Before(counts.expires) {
+			s.Decision, s.DecisionAge = counts.decision, now.Sub(counts.cachedAt)
+		}
+		stats = append(stats, s)
+	}
+	c.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Evaluations != stats[j].Evaluations {
+			return stats[i].Evaluations > stats[j].Evaluations
+		}
+		return stats[i].Host < stats[j].Host
+	})
+	return stats
+}
+
+func (c *decisionCounts) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = make(map[Proxy]uint64)
+	c.hosts = make(map[string]*hostCounts)
+}
+
+// DecisionStats returns how often lookups resulted in DIRECT or in each
+// proxy endpoint, counted by the first directive of the result. Lookups
+// answered by overrides, the bypass list or the decision cache count too.
+func (p *PACProxy) DecisionStats() DecisionStats {
+	return p.decisionCounts.snapshot()
+}
+
+// HostEvalStats returns the lookup statistics of each destination host,
+// sorted by evaluations, most first, for capacity planning and to spot
+// hosts that defeat the decision cache. It is nil unless
+// PACProxyConfig.DecisionStatsByHost is set, and covers the same hosts as
+// DecisionStats.Hosts.
+func (p *PACProxy) HostEvalStats() []HostEvalStats {
+	return p.decisionCounts.hostSnapshot(time.Now())
+}
+
+// ResetDecisionStats clears the counters of DecisionStats and
+// HostEvalStats, e.g. right after deploying a PAC change to see where
+// traffic goes now.
+func (p *PACProxy) ResetDecisionStats() {
+	p.decisionCounts.reset()
+}
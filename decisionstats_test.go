@@ -0,0 +1,94 @@
+package pac_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestDecisionStats tests that lookup results are counted per proxy endpoint and destination host.
+func TestDecisionStats(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "intranet.example.com") { return "DIRECT"; }
+		return "PROXY proxy.example.com:3128; DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{DecisionStatsByHost: true})
+	for _, target := range []string{"http://intranet.example.com", "http://a.example.com", "https://a.example.com/x", "http://b.example.com"} {
+		targetURL, _ := url.Parse(target)
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", target, err)
+		}
+	}
+
+	direct := pac.Proxy{Type: pac.ProxyDirect}
+	httpProxy := pac.Proxy{Type: pac.ProxyHTTP, Host: "proxy.example.com:3128"}
+	stats := proxy.DecisionStats()
+	if want := map[pac.Proxy]uint64{direct: 1, httpProxy: 3}; !reflect.DeepEqual(stats.Results, want) {
+		t.Fatalf("Expected results %v, got %v", want, stats.Results)
+	}
+	if got := stats.Hosts["a.example.com"]; !reflect.DeepEqual(got, map[pac.Proxy]uint64{httpProxy: 2}) {
+		t.Fatalf("Unexpected counts for a.example.com: %v", got)
+	}
+
+	proxy.ResetDecisionStats()
+	if stats := proxy.DecisionStats(); len(stats.Results) != 0 || len(stats.Hosts) != 0 {
+		t.Fatalf("Expected no counts after reset, got %+v", stats)
+	}
+}
+
+// TestHostEvalStats tests the per-host evaluation counters kept with DecisionStatsByHost.
+func TestHostEvalStats(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "bad.example.com") { throw new Error("boom"); }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{DecisionStatsByHost: true, DecisionCacheTTL: time.Minute})
+	for _, host := range []string{"a.example.com", "A.example.com", "a.example.com", "b.example.com", "bad.example.com", "bad.example.com"} {
+		_, _ = proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: host})
+	}
+
+	stats := proxy.HostEvalStats()
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 hosts, got %+v", stats)
+	}
+	if s := stats[0]; s.Host != "bad.example.com" || s.Evaluations != 2 || s.Errors != 2 || s.CacheHits != 0 || s.Decision != "" {
+		t.Fatalf("Unexpected stats for bad.example.com: %+v", s)
+	}
+	if s := stats[1]; s.Host != "a.example.com" || s.Evaluations != 1 || s.CacheHits != 2 || s.Decision != "PROXY proxy.example.com:3128" || s.DecisionAge < 0 || s.DecisionAge > time.Minute {
+		t.Fatalf("Unexpected stats for a.example.com: %+v", s)
+	}
+	if s := stats[2]; s.Host != "b.example.com" || s.Evaluations != 1 || s.CacheHits != 0 {
+		t.Fatalf("Unexpected stats for b.example.com: %+v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	proxy.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pac", nil))
+	var state struct {
+		Hosts []pac.HostEvalStats `json:"hosts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil || len(state.Hosts) != 3 || state.Hosts[1].CacheHits != 2 {
+		t.Fatalf("Unexpected hosts in debug state: %+v, %v", state.Hosts, err)
+	}
+
+	proxy.ResetDecisionStats()
+	if stats := proxy.HostEvalStats(); len(stats) != 0 {
+		t.Fatalf("Expected ResetDecisionStats to clear the host stats, got %+v", stats)
+	}
+
+	// Off by default.
+	plain := newTestPACProxyFromURL(t, pacServer.URL, nil)
+	_, _ = plain.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "a.example.com"})
+	if stats := plain.HostEvalStats(); stats != nil {
+		t.Fatalf("Expected no host stats without DecisionStatsByHost, got %+v", stats)
+	}
+}
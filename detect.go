@@ -0,0 +1,286 @@
+package pac
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DetectOptions configures DetectPACURL.
+type DetectOptions struct {
+	// Domain is the DNS domain WPAD discovery starts at. It defaults to the
+	// domain of the host name followed by the DNS search domains, which
+	// systemd-resolved lists for every link, e.g. those pushed by VPNs, or
+	// to the search domains of Interface.
+	Domain string
+	// Client fetches WPAD candidates. It defaults to a client with a five
+	// second timeout that does not use a proxy.
+	Client *http.Client
+	// NoWPAD disables WPAD discovery, through DHCP and DNS.
+	NoWPAD bool
+	// Interface constrains detection to a network interface, e.g. en0 or
+	// the utun tunnel of a split-tunnel VPN, which may have a PAC URL of
+	// its own. The system source then reads the PAC URL and search domains
+	// of that interface, which is supported on macOS, DHCP leases are
+	// skipped and WPAD candidates are fetched over the interface, unless
+	// Client is set. Binding to an interface is supported on macOS and on
+	// Linux, where it needs CAP_NET_RAW.
+	Interface string
+}
+
+// DetectionSource is one PAC URL source tried by DetectPACURL.
+type DetectionSource struct {
+	// Name is "system" for the OS setting read by GetPACURL, "policy" for
+	// the machine-wide setting on Windows, "dhcp" for DHCP option 252,
+	// "wpad" for WPAD DNS candidates and "env" for the PAC_URL environment
+	// variable.
+	Name string
+	// URL is the PAC URL the source returned or, for WPAD, the candidate
+	// that was tried. It is empty if the source had none.
+	URL string
+	// Err is why the source was not usable, nil if it was.
+	Err error
+	// Duration is how long the source took, including for WPAD the lookup
+	// of the domains before the first candidate.
+	Duration time.Duration
+}
+
+// Detection is the result of DetectPACURL.
+type Detection struct {
+	// Sources lists every source tried, in order of precedence.
+	Sources []DetectionSource
+	// URL is the PAC URL of the first usable source, nil if there was none.
+	URL *url.URL
+	// Source is the name of the source URL came from.
+	Source string
+	// Duration is how long the detection took.
+	Duration time.Duration
+}
+
+// DetectPACURL tries every PAC URL source and reports what each returned.
+// Unlike GetPACURL it does not stop at the first hit, so the result
+// explains which URL wins and why. After the system setting it reads the
+// machine-wide setting, from group policy or the machine Internet Settings
+// on Windows only. WPAD discovery then reads DHCP option
+// 252 from the DHCP lease files, on Linux only, and then follows the DNS
+// variant: http://wpad.<domain>/wpad.dat is fetched for the domain and each
+// parent domain down to the registrable one, and a candidate is usable if it
+// answers 200 with a body defining FindProxyForURL. PAC_URL, as read by
+// ConfigFromEnv, comes last. A nil opts uses the defaults. The error is ErrPACURLNotFound if no source
+// was usable.
+func DetectPACURL(ctx context.Context, opts *DetectOptions) (*Detection, error) {
+	if opts == nil {
+		opts = &DetectOptions{}
+	}
+	d := &Detection{}
+	// Sources are tried one after the other, so each took the time since
+	// the previous one was added.
+	start := time.Now()
+	last := start
+	defer func() { d.Duration = time.Since(start) }()
+	add := func(name, u string, err error) {
+		now := time.Now()
+		d.Sources = append(d.Sources, DetectionSource{Name: name, URL: u, Err: err, Duration: now.Sub(last)})
+		last = now
+		if err == nil && d.URL == nil {
+			d.URL, _ = url.Parse(u)
+			d.Source = name
+		}
+	}
+
+	var iface interfaceSettings
+	if opts.Interface != "" {
+		var err error
+		iface, err = retrieveInterfaceSettings(opts.Interface)
+		if err == nil && iface.pacURL == "" {
+			err = fmt.Errorf("%w: interface %s has no PAC URL", ErrPACURLNotFound, opts.Interface)
+		}
+		add("system", iface.pacURL, err)
+	} else if pacURL, err := GetPACURL(); err != nil {
+		add("system", "", err)
+	} else {
+		add("system", pacURL.String(), nil)
+	}
+
+	if opts.Interface != "" {
+		add("policy", "", fmt.Errorf("%w: machine policies are not queried per interface", ErrPACURLNotFound))
+	} else {
+		policyURL, err := retrievePolicyPACURL()
+		add("policy", policyURL, err)
+	}
+
+	if !opts.NoWPAD {
+		if opts.Interface != "" {
+			add("dhcp", "", fmt.Errorf("%w: DHCP leases are not queried per interface", ErrPACURLNotFound))
+		} else {
+			dhcpURL, err := retrieveDHCPPACURL()
+			add("dhcp", dhcpURL, err)
+		}
+
+		client, err := detectClient(opts)
+		domains := []string{opts.Domain}
+		switch {
+		case opts.Domain != "":
+		case opts.Interface != "":
+			domains = iface.domains
+		default:
+			domains = append([]string{hostDomain(ctx)}, systemSearchDomains()...)
+		}
+		candidates := wpadCandidates(domains...)
+		switch {
+		case err != nil:
+			add("wpad", "", err)
+		case len(candidates) == 0:
+			add("wpad", "", fmt.Errorf("%w: no DNS domain to search", ErrPACURLNotFound))
+		default:
+			for _, u := range candidates {
+				add("wpad", u, probeWPAD(ctx, client, u))
+			}
+		}
+	}
+
+	env := envReader{lookup: os.LookupEnv}
+	if envURL := env.pacURL(); env.err != nil {
+		add("env", "", env.err)
+	} else if envURL == nil {
+		add("env", "", fmt.Errorf("%w: PAC_URL is not set", ErrPACURLNotFound))
+	} else {
+		add("env", envURL.String(), nil)
+	}
+
+	if d.URL == nil {
+		return d, ErrPACURLNotFound
+	}
+	return d, nil
+}
+
+// PACURLCandidate is a PAC URL found by GetPACURLs.
+type PACURLCandidate struct {
+	// Source is the name of the DetectionSource that returned URL.
+	Source string
+	URL    *url.URL
+}
+
+// GetPACURLs returns every PAC URL DetectPACURL finds, in order of
+// precedence and without duplicates, so callers can fall back to the next
+// one or report all of them. The error is ErrPACURLNotFound if there is
+// none.
+func GetPACURLs(ctx context.Context, opts *DetectOptions) ([]PACURLCandidate, error) {
+	d, err := DetectPACURL(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []PACURLCandidate
+	seen := make(map[string]bool)
+	for _, s := range d.Sources {
+		if s.Err != nil || seen[s.URL] {
+			continue
+		}
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			continue
+		}
+		seen[s.URL] = true
+		candidates = append(candidates, PACURLCandidate{Source: s.Name, URL: u})
+	}
+	return candidates, nil
+}
+
+// detectClient returns the client fetching WPAD candidates, bound to
+// opts.Interface unless opts.Client is set.
+func detectClient(opts *DetectOptions) (*http.Client, error) {
+	if opts.Client != nil {
+		return opts.Client, nil
+	}
+	transport := &http.Transport{Proxy: nil}
+	if opts.Interface != "" {
+		ifi, err := net.InterfaceByName(opts.Interface)
+		if err != nil {
+			return nil, err
+		}
+		control, err := bindToInterface(ifi)
+		if err != nil {
+			return nil, err
+		}
+		transport.DialContext = (&net.Dialer{Timeout: 5 * time.Second, Control: control}).DialContext
+	}
+	return &http.Client{Timeout: 5 * time.Second, Transport: transport}, nil
+}
+
+// hostDomain returns the DNS domain of the host name, resolving the host
+// name through the search domains if it is not fully qualified.
+func hostDomain(ctx context.Context) string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	if !strings.Contains(name, ".") {
+		if cname, err := net.DefaultResolver.LookupCNAME(ctx, name); err == nil {
+			name = strings.TrimSuffix(cname, ".")
+		}
+	}
+	if _, domain, ok := strings.Cut(name, "."); ok {
+		return domain
+	}
+	return ""
+}
+
+// wpadCandidates returns the WPAD URLs for each domain and its parents,
+// most specific first, skipping URLs of earlier domains. Devolution stops
+// at the registrable domain: above it, such as wpad.co.uk, anyone can
+// register the name and serve a PAC script.
+func wpadCandidates(domains ...string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(domain), ".")
+		registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+		if err != nil {
+			continue
+		}
+		for {
+			if u := "http://wpad." + domain + "/wpad.dat"; !seen[u] {
+				seen[u] = true
+				candidates = append(candidates, u)
+			}
+			if domain == registrable {
+				break
+			}
+			_, domain, _ = strings.Cut(domain, ".")
+		}
+	}
+	return candidates
+}
+
+// probeWPAD fetches the WPAD candidate u and reports why it is unusable.
+func probeWPAD(ctx context.Context, client *http.Client, u string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrPACURLNotFound, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(body, []byte("FindProxyForURL")) {
+		return fmt.Errorf("%w: response does not define FindProxyForURL", ErrPACURLNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestDetectPACURL tests that DetectPACURL reports every source and picks
+// the first usable one.
+func TestDetectPACURL(t *testing.T) {
+	wpadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "wpad.example.com" || r.URL.Path != "/wpad.dat" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	}))
+	defer wpadServer.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, wpadServer.Listener.Addr().String())
+		},
+	}}
+	opts := &pac.DetectOptions{Domain: "corp.example.com", Client: client}
+
+	pac.SetTestPACURL("")
+	d, err := pac.DetectPACURL(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Error detecting PAC URL: %v", err)
+	}
+	var tried []string
+	for _, s := range d.Sources {
+		tried = append(tried, s.Name+" "+s.URL)
+	}
+	want := []string{"system ", "policy ", "dhcp ", "wpad http://wpad.corp.example.com/wpad.dat", "wpad http://wpad.example.com/wpad.dat", "env "}
+	if !reflect.DeepEqual(tried, want) {
+		t.Fatalf("Expected sources %q, got %q", want, tried)
+	}
+	for i, s := range d.Sources {
+		if (i == 4) != (s.Err == nil) || (s.Err != nil && !errors.Is(s.Err, pac.ErrPACURLNotFound)) {
+			t.Fatalf("Unexpected error of source %d: %v", i, s.Err)
+		}
+	}
+	if d.Source != "wpad" || d.URL.String() != "http://wpad.example.com/wpad.dat" {
+		t.Fatalf("Expected the WPAD URL to win, got %s from %s", d.URL, d.Source)
+	}
+	var sum time.Duration
+	for _, s := range d.Sources {
+		sum += s.Duration
+	}
+	if d.Sources[3].Duration <= 0 || sum > d.Duration {
+		t.Fatalf("Expected the source durations to add up to at most %v, got %+v", d.Duration, d.Sources)
+	}
+
+	pac.SetTestPACURL("https://pac.example.com/proxy.pac")
+	t.Cleanup(func() { pac.SetTestPACURL("") })
+	d, err = pac.DetectPACURL(context.Background(), opts)
+	if err != nil || d.Source != "system" || d.URL.String() != "https://pac.example.com/proxy.pac" || len(d.Sources) != 6 {
+		t.Fatalf("Expected the system URL to win after trying all sources, got %+v, %v", d, err)
+	}
+
+	pac.SetTestPACURL("")
+	if _, err := pac.DetectPACURL(context.Background(), &pac.DetectOptions{NoWPAD: true}); !errors.Is(err, pac.ErrPACURLNotFound) {
+		t.Fatalf("Expected ErrPACURLNotFound, got %v", err)
+	}
+}
+
+func TestDetectSearchDomains(t *testing.T) {
+	wpadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "wpad.vpn.example.net" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	}))
+	defer wpadServer.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, wpadServer.Listener.Addr().String())
+		},
+	}}
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(resolvConf, []byte("nameserver 127.0.0.53\nsearch corp.example.com vpn.example.net\ndomain example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pac.SetTestResolvConf(resolvConf)
+	t.Cleanup(func() { pac.SetTestResolvConf("") })
+	pac.SetTestPACURL("")
+
+	d, err := pac.DetectPACURL(context.Background(), &pac.DetectOptions{Client: client})
+	if err != nil || d.URL.String() != "http://wpad.vpn.example.net/wpad.dat" {
+		t.Fatalf("Expected the WPAD URL of the VPN search domain, got %+v, %v", d, err)
+	}
+	// The host's own domain comes first and varies, so only the search
+	// domain candidates are compared.
+	var tried []string
+	for _, s := range d.Sources {
+		if s.Name == "wpad" && (strings.HasSuffix(s.URL, ".example.com/wpad.dat") || strings.HasSuffix(s.URL, ".example.net/wpad.dat")) {
+			tried = append(tried, s.URL)
+		}
+	}
+	want := []string{
+		"http://wpad.corp.example.com/wpad.dat",
+		"http://wpad.example.com/wpad.dat",
+		"http://wpad.vpn.example.net/wpad.dat",
+		"http://wpad.example.net/wpad.dat",
+	}
+	if !reflect.DeepEqual(tried, want) {
+		t.Fatalf("Expected candidates %q, got %q", want, tried)
+	}
+}
+
+func TestDetectInterface(t *testing.T) {
+	var hosts []string
+	wpadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		http.NotFound(w, r)
+	}))
+	defer wpadServer.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, wpadServer.Listener.Addr().String())
+		},
+	}}
+	pac.SetTestPACURL("https://office.example.com/proxy.pac")
+	pac.SetTestInterface("utun3", "https://vpn.example.com/proxy.pac", "vpn.example.net")
+	t.Cleanup(func() {
+		pac.SetTestPACURL("")
+		pac.SetTestInterface("utun3", "")
+	})
+
+	d, err := pac.DetectPACURL(context.Background(), &pac.DetectOptions{Interface: "utun3", Client: client})
+	if err != nil || d.Source != "system" || d.URL.String() != "https://vpn.example.com/proxy.pac" {
+		t.Fatalf("Expected the PAC URL of the interface, got %+v, %v", d, err)
+	}
+	if !errors.Is(d.Sources[1].Err, pac.ErrPACURLNotFound) || !errors.Is(d.Sources[2].Err, pac.ErrPACURLNotFound) {
+		t.Fatalf("Expected the machine policy and DHCP to be skipped, got %+v", d.Sources[1:3])
+	}
+	if want := []string{"wpad.vpn.example.net", "wpad.example.net"}; !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("Expected WPAD candidates of the interface domains %q, got %q", want, hosts)
+	}
+
+	// An unknown interface has no settings, and the default WPAD client
+	// cannot bind to it.
+	d, err = pac.DetectPACURL(context.Background(), &pac.DetectOptions{Interface: "nosuch0"})
+	if !errors.Is(err, pac.ErrPACURLNotFound) || len(d.Sources) != 5 || d.Sources[3].Err == nil {
+		t.Fatalf("Expected ErrPACURLNotFound and a WPAD error, got %+v, %v", d, err)
+	}
+}
+
+func TestDetectDHCP(t *testing.T) {
+	dir := t.TempDir()
+	leases := map[string]string{
+		// dhclient appends renewals; the last lease wins.
+		"dhclient.eth0.leases": `lease {
+  interface "eth0";
+  option wpad "http://old.example.com/wpad.dat";
+}
+lease {
+  interface "eth0";
+  option unknown-252 68:74:74:70:3a:2f:2f:64:68:63:6c:69:65:6e:74:2e:65:78:61:6d:70:6c:65:2e:63:6f:6d:2f:77:70:61:64:2e:64:61:74:0;
+}
+`,
+		"networkd": "ADDRESS=192.0.2.10\nOPTION_252=687474703a2f2f6e6574776f726b642e6578616d706c652e636f6d2f777061642e646174\n",
+		"nm":       "[dhcp4]\nwpad=http://nm.example.com/wpad.dat\n",
+		"none":     "ADDRESS=192.0.2.11\n",
+	}
+	for name, content := range leases {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { pac.SetTestDHCPLeaseFiles() })
+	pac.SetTestPACURL("")
+
+	detect := func(pattern string) (string, error) {
+		t.Helper()
+		pac.SetTestDHCPLeaseFiles(filepath.Join(dir, pattern))
+		d, err := pac.DetectPACURL(context.Background(), &pac.DetectOptions{Domain: "invalid"})
+		if d.URL == nil {
+			return "", err
+		}
+		if d.Source != "dhcp" {
+			t.Fatalf("Expected the DHCP source to win, got %q", d.Source)
+		}
+		return d.URL.String(), err
+	}
+	for pattern, want := range map[string]string{
+		"dhclient.eth0.leases": "http://dhclient.example.com/wpad.dat",
+		"networkd":             "http://networkd.example.com/wpad.dat",
+		"nm":                   "http://nm.example.com/wpad.dat",
+	} {
+		if got, err := detect(pattern); err != nil || got != want {
+			t.Fatalf("Expected %s from %s, got %q, %v", want, pattern, got, err)
+		}
+	}
+
+	// The newest lease file with option 252 is used.
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"dhclient.eth0.leases", "networkd"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := detect("*"); err != nil || got != "http://nm.example.com/wpad.dat" {
+		t.Fatalf("Expected the newest lease, got %q, %v", got, err)
+	}
+	if _, err := detect("none"); !errors.Is(err, pac.ErrPACURLNotFound) {
+		t.Fatalf("Expected ErrPACURLNotFound without option 252, got %v", err)
+	}
+}
+
+func TestGetPACURLs(t *testing.T) {
+	pac.SetTestPACURL("https://user.example.com/proxy.pac")
+	pac.SetTestPolicyPACURL("https://policy.example.com/proxy.pac")
+	t.Setenv("PAC_URL", "https://user.example.com/proxy.pac")
+	t.Cleanup(func() {
+		pac.SetTestPACURL("")
+		pac.SetTestPolicyPACURL("")
+	})
+
+	candidates, err := pac.GetPACURLs(context.Background(), &pac.DetectOptions{NoWPAD: true})
+	if err != nil {
+		t.Fatalf("Error getting PAC URLs: %v", err)
+	}
+	var got []string
+	for _, c := range candidates {
+		got = append(got, c.Source+" "+c.URL.String())
+	}
+	// The duplicate from PAC_URL is dropped.
+	want := []string{"system https://user.example.com/proxy.pac", "policy https://policy.example.com/proxy.pac"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected candidates %q, got %q", want, got)
+	}
+
+	pac.SetTestPACURL("")
+	pac.SetTestPolicyPACURL("")
+	t.Setenv("PAC_URL", "https://env.example.com/proxy.pac")
+	if candidates, err := pac.GetPACURLs(context.Background(), &pac.DetectOptions{NoWPAD: true}); err != nil || len(candidates) != 1 || candidates[0].Source != "env" {
+		t.Fatalf("Expected PAC_URL as the only candidate, got %+v, %v", candidates, err)
+	}
+	t.Setenv("PAC_URL", "")
+	if _, err := pac.GetPACURLs(context.Background(), &pac.DetectOptions{NoWPAD: true}); !errors.Is(err, pac.ErrPACURLNotFound) {
+		t.Fatalf("Expected ErrPACURLNotFound, got %v", err)
+	}
+}
+
+// TestWPADCandidates tests that WPAD devolution stops at the registrable domain.
+func TestWPADCandidates(t *testing.T) {
+	for _, tc := range []struct {
+		domains []string
+		want    []string
+	}{
+		{[]string{"corp.example.com"}, []string{"http://wpad.corp.example.com/wpad.dat", "http://wpad.example.com/wpad.dat"}},
+		{[]string{"host.corp.example.co.uk"}, []string{"http://wpad.host.corp.example.co.uk/wpad.dat", "http://wpad.corp.example.co.uk/wpad.dat", "http://wpad.example.co.uk/wpad.dat"}},
+		{[]string{"Dept.Example.COM.AU."}, []string{"http://wpad.dept.example.com.au/wpad.dat", "http://wpad.example.com.au/wpad.dat"}},
+		// *.kawasaki.jp is a wildcard suffix.
+		{[]string{"host.corp.shop.kawasaki.jp"}, []string{"http://wpad.host.corp.shop.kawasaki.jp/wpad.dat", "http://wpad.corp.shop.kawasaki.jp/wpad.dat"}},
+		{[]string{"corp.lan"}, []string{"http://wpad.corp.lan/wpad.dat"}},
+		// Search domains go through the same devolution, without repeats.
+		{[]string{"a.example.co.uk", "b.example.co.uk"}, []string{"http://wpad.a.example.co.uk/wpad.dat", "http://wpad.example.co.uk/wpad.dat", "http://wpad.b.example.co.uk/wpad.dat"}},
+		{[]string{"co.uk", "com", "localdomain", ""}, nil},
+	} {
+		if got := pac.WPADCandidates(tc.domains...); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: expected %v, got %v", tc.domains, tc.want, got)
+		}
+	}
+}
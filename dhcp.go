@@ -0,0 +1,112 @@
+package pac
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dhcpLeasePACURL returns the PAC URL of DHCP option 252 from the newest
+// lease file matching patterns. It understands the lease files of
+// dhclient, which NetworkManager also writes with its dhclient backend, of
+// the NetworkManager internal client and of systemd-networkd.
+func dhcpLeasePACURL(patterns []string) (string, error) {
+	type lease struct {
+		path  string
+		mtime int64
+	}
+	var leases []lease
+	for _, pattern := range patterns {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				leases = append(leases, lease{path, info.ModTime().UnixNano()})
+			}
+		}
+	}
+	if len(leases) == 0 {
+		return "", fmt.Errorf("%w: no DHCP lease files", ErrPACURLNotFound)
+	}
+	sort.SliceStable(leases, func(i, j int) bool { return leases[i].mtime > leases[j].mtime })
+	for _, l := range leases {
+		data, err := os.ReadFile(l.path)
+		if err != nil {
+			continue
+		}
+		if pacURL := parseDHCPLease(data); pacURL != "" {
+			return pacURL, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no DHCP lease has option 252", ErrPACURLNotFound)
+}
+
+// parseDHCPLease returns the option 252 URL of a lease file, the last one
+// for dhclient files which append each renewed lease. It reads
+//
+//	option wpad "http://...";          dhclient, with a wpad declaration
+//	option unknown-252 68:74:74:70:...; dhclient, without one
+//	wpad=http://...                    NetworkManager internal client
+//	OPTION_252=687474703a...           systemd-networkd
+func parseDHCPLease(data []byte) string {
+	var found string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var name, value string
+		if rest, ok := strings.CutPrefix(line, "option "); ok {
+			name, value, _ = strings.Cut(strings.TrimSuffix(rest, ";"), " ")
+		} else {
+			name, value, _ = strings.Cut(line, "=")
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "wpad", "wpad-url", "unknown-252", "option_252", "private_252":
+		default:
+			continue
+		}
+		if pacURL := dhcpOptionURL(strings.TrimSpace(value)); pacURL != "" {
+			found = pacURL
+		}
+	}
+	return found
+}
+
+// dhcpOptionURL decodes an option value, quoted or hex encoded with or
+// without colons, and returns it if it is an absolute URL.
+func dhcpOptionURL(value string) string {
+	if unquoted, ok := strings.CutPrefix(value, `"`); ok {
+		value = strings.TrimSuffix(unquoted, `"`)
+	} else if decoded, ok := decodeDHCPHex(value); ok {
+		value = decoded
+	}
+	value = strings.TrimRight(value, "\x00")
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return value
+}
+
+func decodeDHCPHex(value string) (string, bool) {
+	if strings.Contains(value, ":") {
+		var b strings.Builder
+		for _, part := range strings.Split(value, ":") {
+			if len(part) == 1 {
+				part = "0" + part
+			}
+			decoded, err := hex.DecodeString(part)
+			if err != nil || len(decoded) != 1 {
+				return "", false
+			}
+			b.Write(decoded)
+		}
+		return b.String(), true
+	}
+	decoded, err := hex.DecodeString(value)
+	return string(decoded), err == nil
+}
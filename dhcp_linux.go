@@ -0,0 +1,19 @@
+//go:build !gopac_testhooks && linux
+// +build !gopac_testhooks,linux
+
+package pac
+
+// dhcpLeaseFiles are where dhclient, NetworkManager and systemd-networkd
+// keep their leases.
+var dhcpLeaseFiles = []string{
+	"/var/lib/dhcp/*.leases",
+	"/var/lib/dhclient/*.lease*",
+	"/var/lib/NetworkManager/*.lease",
+	"/run/NetworkManager/devices/*",
+	"/run/systemd/netif/leases/*",
+}
+
+// retrieveDHCPPACURL reads DHCP option 252 from the lease files.
+func retrieveDHCPPACURL() (string, error) {
+	return dhcpLeasePACURL(dhcpLeaseFiles)
+}
@@ -0,0 +1,12 @@
+//go:build !gopac_testhooks && !linux
+// +build !gopac_testhooks,!linux
+
+package pac
+
+import "fmt"
+
+// retrieveDHCPPACURL reports ErrPACURLNotFound on platforms whose DHCP
+// leases are not read yet.
+func retrieveDHCPPACURL() (string, error) {
+	return "", fmt.Errorf("%w: DHCP option 252 is not queried on this platform", ErrPACURLNotFound)
+}
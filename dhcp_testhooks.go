@@ -0,0 +1,26 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import "sync"
+
+var (
+	testDHCPLeaseFiles   []string
+	testDHCPLeaseFilesMu sync.RWMutex
+)
+
+// SetTestDHCPLeaseFiles sets the lease file patterns DetectPACURL reads
+// DHCP option 252 from in tests. Pass none to reset to "not found".
+func SetTestDHCPLeaseFiles(patterns ...string) {
+	testDHCPLeaseFilesMu.Lock()
+	testDHCPLeaseFiles = patterns
+	testDHCPLeaseFilesMu.Unlock()
+}
+
+func retrieveDHCPPACURL() (string, error) {
+	testDHCPLeaseFilesMu.RLock()
+	patterns := testDHCPLeaseFiles
+	testDHCPLeaseFilesMu.RUnlock()
+	return dhcpLeasePACURL(patterns)
+}
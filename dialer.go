@@ -0,0 +1,213 @@
+package pac
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Custom error types
+var (
+	ErrAllProxiesFailed = errors.New("all proxy candidates failed")
+	ErrUnsupportedProxy = errors.New("unsupported proxy type")
+)
+
+// FallbackPolicy decides what Dialer and Transport do once every proxy of a
+// PAC result without DIRECT failed.
+type FallbackPolicy int
+
+const (
+	// FallbackFail returns ErrAllProxiesFailed, like browsers treat a PAC
+	// result without DIRECT as mandatory.
+	FallbackFail FallbackPolicy = iota
+	// FallbackDirect connects directly as a last resort.
+	FallbackDirect
+)
+
+// withFallback appends DIRECT to candidates if policy asks for it and the
+// PAC result does not contain DIRECT already.
+func withFallback(candidates []Proxy, policy FallbackPolicy) []Proxy {
+	if policy != FallbackDirect {
+		return candidates
+	}
+	for _, c := range candidates {
+		if c.Type == ProxyDirect {
+			return candidates
+		}
+	}
+	return append(candidates[:len(candidates):len(candidates)], Proxy{Type: ProxyDirect})
+}
+
+// Dialer dials TCP connections through the candidates a PACProxy returns for
+// the destination, trying them in order until one succeeds.
+// It implements golang.org/x/net/proxy.Dialer and proxy.ContextDialer.
+type Dialer struct {
+	// PAC evaluates the PAC script for each destination.
+	PAC *PACProxy
+	// Forward dials proxies and DIRECT connections. nil uses a zero net.Dialer.
+	Forward ContextDialer
+	// TLSConfig is used for proxies reached via https.
+	TLSConfig *tls.Config
+	// Scheme is the URL scheme passed to the PAC script for a destination.
+	// Empty uses "http" for port 80 and "https" otherwise.
+	Scheme string
+	// SOCKSAuth provides credentials for SOCKS proxies. nil falls back to
+	// PACProxyConfig.Credentials.
+	SOCKSAuth SOCKSAuth
+	// Fallback decides whether to connect directly after all proxies failed.
+	Fallback FallbackPolicy
+	// HTTP2 tunnels through https proxies with CONNECT over HTTP/2 if the
+	// proxy negotiates it, opening the tunnels as streams of shared
+	// connections per proxy. Proxies that only speak HTTP/1.1 get a
+	// connection per tunnel, as without HTTP2. An expired deadline ends an
+	// HTTP/2 tunnel; it cannot be extended afterwards.
+	HTTP2 bool
+
+	tunnels h2Tunnels
+}
+
+var (
+	_ proxy.Dialer        = (*Dialer)(nil)
+	_ proxy.ContextDialer = (*Dialer)(nil)
+)
+
+// NewDialer creates a Dialer using the given PACProxy.
+func NewDialer(p *PACProxy) *Dialer {
+	return &Dialer{PAC: p}
+}
+
+// Dial connects to addr through the PAC-selected proxies.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr through the PAC-selected proxies: HTTP(S)
+// proxies via CONNECT, SOCKS4/SOCKS5 proxies natively. Non-TCP networks are
+// always dialed directly.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return d.forward().DialContext(ctx, network, addr)
+	}
+
+	target, err := d.targetURL(addr)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := d.PAC.FindProxiesForURLContext(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return d.dialCandidates(ctx, network, addr, target, candidates)
+}
+
+func (d *Dialer) dialCandidates(ctx context.Context, network, addr string, target *url.URL, candidates []Proxy) (net.Conn, error) {
+	var errs []error
+	for _, candidate := range withFallback(candidates, d.Fallback) {
+		d.PAC.metrics.selected(candidate)
+		d.PAC.health.dialing(candidate)
+		start := time.Now()
+		conn, err := d.dialVia(ctx, candidate, network, addr, target)
+		if err == nil {
+			latency := time.Since(start)
+			d.PAC.metrics.dialed(candidate, latency, nil)
+			d.PAC.latency.observe(candidate, latency)
+			d.PAC.affinity.succeeded(target, candidate)
+			d.PAC.ReportProxySuccess(candidate)
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		d.PAC.metrics.dialed(candidate, 0, err)
+		d.PAC.emitError(ctx, "dial", fmt.Errorf("%s: %w", candidate, err))
+		d.PAC.affinity.failed(target, candidate)
+		d.PAC.reportProxyFailure(ctx, candidate)
+		errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+	}
+	return nil, fmt.Errorf("%w: %w", ErrAllProxiesFailed, errors.Join(errs...))
+}
+
+func (d *Dialer) dialVia(ctx context.Context, candidate Proxy, network, addr string, target *url.URL) (net.Conn, error) {
+	switch candidate.Type {
+	case ProxyDirect:
+		return d.forward().DialContext(ctx, network, addr)
+	case ProxyHTTP, ProxyHTTPS:
+		proxyURL, err := candidate.URLFor(target, d.PAC.proxySchemes)
+		if err != nil {
+			return nil, err
+		}
+		return d.dialConnect(ctx, d.PAC.withCredentials(proxyURL), addr)
+	case ProxySOCKS5:
+		return dialSOCKS5(ctx, d.forward(), candidate, d.socksAuth(candidate), network, addr)
+	case ProxySOCKS4:
+		return dialSOCKS4(ctx, d.forward(), candidate, d.socksAuth(candidate), addr)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProxy, candidate.Type)
+	}
+}
+
+// dialConnect tunnels to addr through the HTTP(S) proxy at proxyURL, over
+// HTTP/2 if enabled.
+func (d *Dialer) dialConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	if d.HTTP2 && proxyURL.Scheme == "https" {
+		return d.tunnels.dial(ctx, d.forward(), d.TLSConfig, proxyURL, addr, proxyAuthHeader(proxyURL))
+	}
+	return dialConnect(ctx, d.forward(), d.TLSConfig, proxyURL, addr, proxyAuthHeader(proxyURL))
+}
+
+// CloseIdleConnections closes the HTTP/2 connections to proxies that carry
+// no tunnel.
+func (d *Dialer) CloseIdleConnections() {
+	d.tunnels.closeIdle()
+}
+
+func (d *Dialer) socksAuth(candidate Proxy) *proxy.Auth {
+	if d.SOCKSAuth != nil {
+		return d.SOCKSAuth(candidate)
+	}
+	proxyURL, err := candidate.URL()
+	if err != nil {
+		return nil
+	}
+	return socksAuthFromURL(d.PAC.withCredentials(proxyURL))
+}
+
+func (d *Dialer) forward() ContextDialer {
+	if d.Forward != nil {
+		return d.Forward
+	}
+	return &net.Dialer{}
+}
+
+// forwardDialer adds the Dial method golang.org/x/net/proxy expects.
+type forwardDialer struct {
+	ContextDialer
+}
+
+func (f forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+// targetURL builds the URL passed to the PAC script for a dial to addr.
+func (d *Dialer) targetURL(addr string) (*url.URL, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "https"
+		if port == "80" {
+			scheme = "http"
+		}
+	}
+	return &url.URL{Scheme: scheme, Host: addr}, nil
+}
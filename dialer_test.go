@@ -0,0 +1,480 @@
+package pac_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// newConnectProxy starts an HTTP proxy that only supports CONNECT and counts the tunnels it opened.
+func newConnectProxy(t *testing.T, tunnels *atomic.Int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(connectProxyHandler(tunnels))
+}
+
+func connectProxyHandler(tunnels *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		if tunnels != nil {
+			tunnels.Add(1)
+		}
+
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() { _, _ = io.Copy(upstream, buf) }()
+		_, _ = io.Copy(conn, upstream)
+	})
+}
+
+// newEchoServer starts a TCP server echoing every line it receives.
+func newEchoServer(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+// closedAddr returns a local address nothing is listening on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func echo(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Error reading: %v", err)
+	}
+	if line != "ping\n" {
+		t.Fatalf("Expected echo, got %q", line)
+	}
+}
+
+// TestDialerFallback tests that the dialer skips a dead proxy and tunnels through the next candidate.
+func TestDialerFallback(t *testing.T) {
+	var tunnels atomic.Int32
+	connectProxy := newConnectProxy(t, &tunnels)
+	defer connectProxy.Close()
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	dead := closedAddr(t)
+	proxyHost := strings.TrimPrefix(connectProxy.URL, "http://")
+	proxy := newTestPACProxy(t, "PROXY "+dead+"; PROXY "+proxyHost, nil)
+
+	conn, err := pac.NewDialer(proxy).DialContext(context.Background(), "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	if tunnels.Load() != 1 {
+		t.Fatalf("Expected 1 tunnel, got %d", tunnels.Load())
+	}
+
+	targetURL, _ := url.Parse("https://" + echoServer.Addr().String())
+	proxies, err := proxy.FindProxiesForURL(targetURL)
+	if err != nil {
+		t.Fatalf("Error finding proxies: %v", err)
+	}
+	if proxies[0].Host != proxyHost {
+		t.Fatalf("Expected failed proxy to be skipped, got %v", proxies)
+	}
+}
+
+// TestDialerAllFailed tests that the dialer reports an error once every candidate failed.
+func TestDialerAllFailed(t *testing.T) {
+	proxy := newTestPACProxy(t, "PROXY "+closedAddr(t), nil)
+
+	_, err := pac.NewDialer(proxy).DialContext(context.Background(), "tcp", closedAddr(t))
+	if !errors.Is(err, pac.ErrAllProxiesFailed) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrAllProxiesFailed, err)
+	}
+}
+
+// TestDialViaProxy tests CONNECT tunneling with Proxy-Authorization taken from the proxy URL.
+func TestDialViaProxy(t *testing.T) {
+	authProxy := newAuthConnectProxy(t, "alice", "secret")
+	defer authProxy.Close()
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	proxyURL, _ := url.Parse(authProxy.URL)
+	if _, err := pac.DialViaProxy(context.Background(), proxyURL, "tcp", echoServer.Addr().String()); err == nil {
+		t.Fatalf("Expected tunnel without credentials to fail")
+	}
+
+	proxyURL.User = url.UserPassword("alice", "secret")
+	conn, err := pac.DialViaProxy(context.Background(), proxyURL, "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing via proxy: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+}
+
+// newAuthConnectProxy starts a CONNECT proxy requiring Basic proxy authentication.
+func newAuthConnectProxy(t *testing.T, user, password string) *httptest.Server {
+	t.Helper()
+	connectProxy := newConnectProxy(t, nil)
+	t.Cleanup(connectProxy.Close)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := parseProxyAuth(r); !ok || u != user || p != password {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		connectProxy.Config.Handler.ServeHTTP(w, r)
+	}))
+}
+
+func parseProxyAuth(r *http.Request) (string, string, bool) {
+	req := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+	return req.BasicAuth()
+}
+
+// TestNewGRPCDialer tests that the gRPC dialer evaluates the PAC for the authority as an https URL.
+func TestNewGRPCDialer(t *testing.T) {
+	var tunnels atomic.Int32
+	connectProxy := newConnectProxy(t, &tunnels)
+	defer connectProxy.Close()
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (url.substring(0, 6) == "https:") { return "PROXY `+strings.TrimPrefix(connectProxy.URL, "http://")+`"; }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+
+	conn, err := pac.NewGRPCDialer(proxy)(context.Background(), echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+	if tunnels.Load() != 1 {
+		t.Fatalf("Expected 1 tunnel, got %d", tunnels.Load())
+	}
+}
+
+// TestCredentialProvider tests that configured credentials are sent to proxies by the dialer and the transport.
+func TestCredentialProvider(t *testing.T) {
+	authProxy := newAuthConnectProxy(t, "alice", "secret")
+	defer authProxy.Close()
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+	targetServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer targetServer.Close()
+
+	proxy := newTestPACProxy(t, "PROXY "+strings.TrimPrefix(authProxy.URL, "http://"), &pac.PACProxyConfig{
+		Credentials: pac.StaticCredentials("alice", "secret", "127.0.0.1"),
+	})
+
+	conn, err := pac.NewDialer(proxy).DialContext(context.Background(), "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	transport := pac.NewTransport(proxy)
+	transport.Base.TLSClientConfig = targetServer.Client().Transport.(*http.Transport).TLSClientConfig
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Get(targetServer.URL)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestProxyAffinity tests that a destination host sticks to the proxy that first served it.
+func TestProxyAffinity(t *testing.T) {
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	var tunnelsA, tunnelsB atomic.Int32
+	proxyA := newConnectProxy(t, &tunnelsA)
+	defer proxyA.Close()
+	proxyB := newConnectProxy(t, &tunnelsB)
+	defer proxyB.Close()
+
+	proxy := newTestPACProxy(t, "PROXY "+strings.TrimPrefix(proxyA.URL, "http://")+"; PROXY "+strings.TrimPrefix(proxyB.URL, "http://"), &pac.PACProxyConfig{
+		Selector:    pac.RoundRobinSelector(),
+		AffinityTTL: time.Minute,
+	})
+	dialer := pac.NewDialer(proxy)
+
+	for i := 0; i < 4; i++ {
+		conn, err := dialer.Dial("tcp", echoServer.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial %d: %v", i, err)
+		}
+		echo(t, conn)
+		conn.Close()
+	}
+
+	a, b := tunnelsA.Load(), tunnelsB.Load()
+	if !(a == 4 && b == 0) && !(a == 0 && b == 4) {
+		t.Fatalf("Expected all tunnels through one proxy, got %d and %d", a, b)
+	}
+}
+
+// TestLatencyOrdering tests that the faster of two measured proxies is preferred.
+func TestLatencyOrdering(t *testing.T) {
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	var fastTunnels, slowTunnels atomic.Int32
+	slowHandler := connectProxyHandler(&slowTunnels)
+	slowProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		slowHandler.ServeHTTP(w, r)
+	}))
+	defer slowProxy.Close()
+	fastProxy := newConnectProxy(t, &fastTunnels)
+	defer fastProxy.Close()
+
+	proxy := newTestPACProxy(t, "PROXY "+strings.TrimPrefix(slowProxy.URL, "http://")+"; PROXY "+strings.TrimPrefix(fastProxy.URL, "http://"), &pac.PACProxyConfig{
+		Selector:      pac.RoundRobinSelector(),
+		LatencyMaxAge: time.Minute,
+	})
+	dialer := pac.NewDialer(proxy)
+
+	dial := func() {
+		t.Helper()
+		conn, err := dialer.Dial("tcp", echoServer.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		echo(t, conn)
+		conn.Close()
+	}
+
+	// Round-robin measures both proxies first.
+	dial()
+	dial()
+	fastTunnels.Store(0)
+	slowTunnels.Store(0)
+	for i := 0; i < 4; i++ {
+		dial()
+	}
+	if fastTunnels.Load() != 4 || slowTunnels.Load() != 0 {
+		t.Fatalf("Expected all tunnels through the fast proxy, got fast=%d slow=%d", fastTunnels.Load(), slowTunnels.Load())
+	}
+}
+
+// newTLSConnectProxy starts an https CONNECT proxy, serving HTTP/2 if http2 is set, that counts its connections.
+func newTLSConnectProxy(t *testing.T, http2 bool, conns *atomic.Int32) *httptest.Server {
+	t.Helper()
+	proxyServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			connectProxyHandler(nil).ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		http.NewResponseController(w).Flush()
+		go func() { _, _ = io.Copy(upstream, r.Body) }()
+		buf := make([]byte, 1024)
+		for {
+			n, err := upstream.Read(buf)
+			if n > 0 {
+				_, _ = w.Write(buf[:n])
+				http.NewResponseController(w).Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}))
+	proxyServer.EnableHTTP2 = http2
+	proxyServer.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	proxyServer.StartTLS()
+	t.Cleanup(proxyServer.Close)
+	return proxyServer
+}
+
+// TestDialerHTTP2 tests that tunnels through an https proxy share one HTTP/2 connection, and that proxies without HTTP/2 still get HTTP/1.1 CONNECT.
+func TestDialerHTTP2(t *testing.T) {
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	for _, http2 := range []bool{true, false} {
+		var conns atomic.Int32
+		proxyServer := newTLSConnectProxy(t, http2, &conns)
+		roots := x509.NewCertPool()
+		roots.AddCert(proxyServer.Certificate())
+
+		proxy := newTestPACProxy(t, "HTTPS "+proxyServer.Listener.Addr().String(), nil)
+		dialer := &pac.Dialer{PAC: proxy, HTTP2: true, TLSConfig: &tls.Config{RootCAs: roots}}
+		for i := 0; i < 2; i++ {
+			conn, err := dialer.DialContext(context.Background(), "tcp", echoServer.Addr().String())
+			if err != nil {
+				t.Fatalf("Error dialing with HTTP/2 %v: %v", http2, err)
+			}
+			echo(t, conn)
+			conn.Close()
+		}
+
+		want := int32(1)
+		if !http2 {
+			want = 2
+		}
+		if got := conns.Load(); got != want {
+			t.Errorf("Expected %d proxy connections with HTTP/2 %v, got %d", want, http2, got)
+		}
+		dialer.CloseIdleConnections()
+	}
+}
+
+// TestDialerHTTP2Concurrent tests that concurrent tunnels through a new https proxy wait for one HTTP/2 connection.
+func TestDialerHTTP2Concurrent(t *testing.T) {
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+	var conns atomic.Int32
+	proxyServer := newTLSConnectProxy(t, true, &conns)
+	roots := x509.NewCertPool()
+	roots.AddCert(proxyServer.Certificate())
+
+	proxy := newTestPACProxy(t, "HTTPS "+proxyServer.Listener.Addr().String(), nil)
+	dialer := &pac.Dialer{PAC: proxy, HTTP2: true, TLSConfig: &tls.Config{RootCAs: roots}}
+	defer dialer.CloseIdleConnections()
+	tunnels := make(chan net.Conn, 8)
+	var wg sync.WaitGroup
+	for range cap(tunnels) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := dialer.DialContext(context.Background(), "tcp", echoServer.Addr().String())
+			if err != nil {
+				t.Errorf("Error dialing: %v", err)
+				return
+			}
+			tunnels <- conn
+		}()
+	}
+	wg.Wait()
+	close(tunnels)
+	for conn := range tunnels {
+		echo(t, conn)
+		conn.Close()
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("Expected 1 proxy connection, got %d", got)
+	}
+}
+
+// TestDialerHTTP2Deadline tests that deadlines of HTTP/2 tunnels interrupt blocked reads and writes.
+func TestDialerHTTP2Deadline(t *testing.T) {
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+	var conns atomic.Int32
+	proxyServer := newTLSConnectProxy(t, true, &conns)
+	roots := x509.NewCertPool()
+	roots.AddCert(proxyServer.Certificate())
+
+	proxy := newTestPACProxy(t, "HTTPS "+proxyServer.Listener.Addr().String(), nil)
+	dialer := &pac.Dialer{PAC: proxy, HTTP2: true, TLSConfig: &tls.Config{RootCAs: roots}}
+	defer dialer.CloseIdleConnections()
+	conn, err := dialer.DialContext(context.Background(), "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("Error setting the read deadline: %v", err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) || !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected the read to time out, got %v", err)
+	}
+
+	conn, err = dialer.DialContext(context.Background(), "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Unix(1, 0)); err != nil {
+		t.Fatalf("Error setting a past deadline: %v", err)
+	}
+	// The timer of a past deadline fires right away but still asynchronously.
+	time.Sleep(10 * time.Millisecond)
+	if _, err := conn.Write([]byte("ping\n")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected the write after a past deadline to fail, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package pac
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultScriptCacheTTL = time.Hour
+	diskCacheLockWait     = 10 * time.Second
+	diskCacheLockStale    = 30 * time.Second
+	diskCacheLockPoll     = 50 * time.Millisecond
+)
+
+// DiskCache is a Store keeping entries as files in a directory shared by
+// all processes of a user. Used as PACProxyConfig.ScriptCache it lets
+// short-lived programs reuse a downloaded PAC instead of each downloading it
+// again, like browsers cache the PAC. Files are named after the SHA-256 of
+// the key and replaced atomically; a lock file makes other processes wait
+// for a PAC download in progress instead of starting their own.
+type DiskCache struct {
+	// Dir holds the cache files. Empty uses "go-pac" below os.UserCacheDir.
+	Dir string
+}
+
+var _ Store = (*DiskCache)(nil)
+
+// NewDiskCache returns a DiskCache in the user cache directory.
+func NewDiskCache() *DiskCache {
+	return &DiskCache{}
+}
+
+func (c *DiskCache) dir() (string, error) {
+	if c.Dir != "" {
+		return c.Dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "go-pac"), nil
+}
+
+func (c *DiskCache) path(key string) (string, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".cache"), nil
+}
+
+// Get returns the value stored for key unless it expired. The expiry is
+// kept as the file's modification time.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	path, err := c.path(key)
+	if err != nil {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !time.Now().Before(info.ModTime()) {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set writes value for key via a temporary file and a rename, so readers
+// never see a partial entry.
+func (c *DiskCache) Set(key string, value []byte, ttl time.Duration) {
+	_ = c.set(key, value, ttl)
+}
+
+func (c *DiskCache) set(key string, value []byte, ttl time.Duration) error {
+	path, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	expires := time.Now().Add(ttl)
+	if err := os.Chtimes(tmp.Name(), expires, expires); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete removes the entry for key.
+func (c *DiskCache) Delete(key string) {
+	if path, err := c.path(key); err == nil {
+		_ = os.Remove(path)
+	}
+}
+
+// lock acquires the download lock for key. It waits for another process
+// holding it and breaks locks that look abandoned. The returned function
+// releases the lock; ok is false if the lock could not be acquired.
+func (c *DiskCache) lock(key string) (unlock func(), ok bool) {
+	path, err := c.path(key)
+	if err != nil {
+		return nil, false
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false
+	}
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(diskCacheLockWait)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, true
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > diskCacheLockStale {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+		time.Sleep(diskCacheLockPoll)
+	}
+}
@@ -0,0 +1,39 @@
+package pac_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestDiskCache tests that a second PACProxy loads the script from the disk cache.
+func TestDiskCache(t *testing.T) {
+	var fetches atomic.Int32
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_, _ = io.WriteString(w, `function FindProxyForURL(url, host) { return "PROXY cached.example.com:3128"; }`)
+	}))
+	defer pacServer.Close()
+	cache := &pac.DiskCache{Dir: t.TempDir()}
+
+	for i := 0; i < 2; i++ {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{ScriptCache: cache})
+		targetURL, _ := url.Parse("http://example.com")
+		proxyStr, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+		if proxyStr != "PROXY cached.example.com:3128" {
+			t.Fatalf("Expected proxy string PROXY cached.example.com:3128, got %s", proxyStr)
+		}
+		proxy.Close()
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("Expected 1 download, got %d", n)
+	}
+}
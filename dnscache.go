@@ -0,0 +1,104 @@
+package pac
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDNSCacheSize = 1000
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// DNSCache caches the host lookups of the PAC helpers across evaluations and
+// script refreshes. Failed lookups are not cached. One DNSCache can be shared
+// by several PACProxy instances via PACProxyConfig.DNSCache, so that a host
+// is resolved once for all of them.
+type DNSCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+	entries    map[string]dnsEntry
+	stats      CacheStats
+}
+
+// NewDNSCache returns a DNSCache keeping lookups for ttl and holding up to
+// maxEntries hosts. maxEntries <= 0 uses 1000.
+func NewDNSCache(ttl time.Duration, maxEntries int) *DNSCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultDNSCacheSize
+	}
+	return &DNSCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]dnsEntry),
+	}
+}
+
+// lookup returns the cached addresses of host or resolves them with resolve.
+func (c *DNSCache) lookup(host string, resolve func(string) ([]string, error)) ([]string, error) {
+	if c == nil {
+		return resolve(host)
+	}
+	key := strings.ToLower(host)
+
+	c.mu.Lock()
+	now := c.now()
+	if e, ok := c.entries[key]; ok {
+		if now.Before(e.expires) {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.addrs, nil
+		}
+		delete(c.entries, key)
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	addrs, err := resolve(host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = dnsEntry{addrs: addrs, expires: now.Add(c.ttl)}
+	return addrs, nil
+}
+
+// evict makes room for one entry. It must be called with c.mu held.
+func (c *DNSCache) evict(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			c.stats.Evictions++
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			return
+		}
+		delete(c.entries, k)
+		c.stats.Evictions++
+	}
+}
+
+// Stats returns the counters and the number of cached hosts.
+func (c *DNSCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = len(c.entries)
+	return stats
+}
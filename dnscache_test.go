@@ -0,0 +1,28 @@
+package pac_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestSharedDNSCache tests that PACProxy instances sharing a DNSCache resolve a host once.
+func TestSharedDNSCache(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) { return dnsResolve("localhost") ? "DIRECT" : "PROXY proxy.example.com:3128"; }`)
+	defer pacServer.Close()
+
+	cache := pac.NewDNSCache(time.Minute, 0)
+	targetURL, _ := url.Parse("http://example.com")
+	for i := 0; i < 2; i++ {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{DNSCache: cache})
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+	}
+
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+}
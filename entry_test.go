@@ -0,0 +1,42 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+func TestEntryPoints(t *testing.T) {
+	evaluator := []string{os.Args[0], "-test.run=^TestEvaluatorHelperProcess$", "--", "pac-evaluator"}
+	entryPoints := []string{"FindProxyForURLEx", "FindProxyForURL"}
+	for script, want := range map[string]pac.ProxyString{
+		`function FindProxyForURL(url, host) { return "PROXY standard:1"; }
+		function FindProxyForURLEx(url, host) { return "PROXY ex:1"; }`: "PROXY ex:1",
+		`function FindProxyForURL(url, host) { return "PROXY standard:1"; }`: "PROXY standard:1",
+	} {
+		pacServer := newScriptServer(t, script)
+		for _, command := range [][]string{nil, evaluator} {
+			proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{EntryPoints: entryPoints, EvaluatorCommand: command})
+			got, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com", Path: "/"})
+			proxy.Close()
+			if err != nil || got != want {
+				t.Fatalf("Expected %q with evaluator %v, got %q, %v", want, command != nil, got, err)
+			}
+		}
+		pacServer.Close()
+	}
+
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	defer pacServer.Close()
+	for _, command := range [][]string{nil, evaluator} {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{EntryPoints: []string{"Route", "FindProxyForURLEx"}, EvaluatorCommand: command})
+		_, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com", Path: "/"})
+		proxy.Close()
+		if !errors.Is(err, pac.ErrEvaluatePAC) {
+			t.Fatalf("Expected ErrEvaluatePAC with evaluator %v, got %v", command != nil, err)
+		}
+	}
+}
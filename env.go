@@ -0,0 +1,191 @@
+package pac
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidEnv is returned by ConfigFromEnv for a malformed variable.
+var ErrInvalidEnv = errors.New("invalid PAC environment variable")
+
+// ConfigFromEnv returns the PAC URL and configuration set by environment
+// variables, for deployments configured without code changes:
+//
+//	PAC_URL                      PAC URL, nil if unset
+//	PAC_HTTP_TIMEOUT             HTTPTimeout
+//	PAC_SCRIPT_TIMEOUT           ScriptTimeout
+//	PAC_DNS_TIMEOUT              DNSLookupTimeout
+//	PAC_MAX_SCRIPT_SIZE          MaxScriptSize, in bytes
+//	PAC_SCRIPT_MEMORY_LIMIT      ScriptMemoryLimit, in bytes
+//	PAC_SANDBOX                  Sandbox
+//	PAC_DISABLE_NATIVE_MATCHER   DisableNativeMatcher
+//	PAC_EVALUATOR_COMMAND        EvaluatorCommand, split at spaces
+//	PAC_HTTPS_ONLY               HTTPSOnly
+//	PAC_SCRIPT_SHA256            ScriptSHA256
+//	PAC_REFRESH_INTERVAL         RefreshInterval
+//	PAC_DNS_CACHE_TTL            DNSCacheTTL
+//	PAC_DECISION_CACHE_TTL       DecisionCacheTTL
+//	PAC_DECISION_CACHE_FILE      DecisionCacheFile
+//	PAC_EMPTY_RESULT             EmptyResult, "error" or "direct"
+//	PAC_COMPAT_MODE              CompatMode, see ParseCompatMode
+//	PAC_EXTENSION_HELPERS        ExtensionHelpers
+//	PAC_MODULE_SYNTAX            ModuleSyntax
+//	PAC_ENTRY_POINTS             EntryPoints, separated by commas
+//	PAC_CLIENT_IP_GLOBAL         ClientIPGlobal
+//	PAC_CLIENT_IP_ARGUMENT       ClientIPArgument
+//	PAC_BYPASS                   Bypass, see ParseBypassList
+//	PAC_LOG_FULL_URLS            LogFullURLs
+//
+// Durations use time.ParseDuration and booleans strconv.ParseBool. Unset
+// and empty variables keep the default; like the options of NewPACProxy,
+// a timeout or script size of 0 removes the limit. A malformed variable
+// returns ErrInvalidEnv naming it.
+func ConfigFromEnv() (*url.URL, *PACProxyConfig, error) {
+	return configFromEnv(os.LookupEnv)
+}
+
+func configFromEnv(lookup func(string) (string, bool)) (*url.URL, *PACProxyConfig, error) {
+	e := envReader{lookup: lookup}
+	cfg := &PACProxyConfig{}
+	pacURL := e.pacURL()
+	e.limit("PAC_HTTP_TIMEOUT", &cfg.HTTPTimeout)
+	e.limit("PAC_SCRIPT_TIMEOUT", &cfg.ScriptTimeout)
+	e.limit("PAC_DNS_TIMEOUT", &cfg.DNSLookupTimeout)
+	e.size("PAC_MAX_SCRIPT_SIZE", &cfg.MaxScriptSize)
+	e.value("PAC_SCRIPT_MEMORY_LIMIT", func(v string) (err error) {
+		cfg.ScriptMemoryLimit, err = strconv.ParseInt(v, 10, 64)
+		return err
+	})
+	e.bool("PAC_SANDBOX", &cfg.Sandbox)
+	e.bool("PAC_DISABLE_NATIVE_MATCHER", &cfg.DisableNativeMatcher)
+	e.value("PAC_EVALUATOR_COMMAND", func(v string) error {
+		cfg.EvaluatorCommand = strings.Fields(v)
+		return nil
+	})
+	e.bool("PAC_HTTPS_ONLY", &cfg.HTTPSOnly)
+	e.value("PAC_SCRIPT_SHA256", func(v string) error {
+		cfg.ScriptSHA256 = v
+		return nil
+	})
+	e.duration("PAC_REFRESH_INTERVAL", &cfg.RefreshInterval)
+	e.duration("PAC_DNS_CACHE_TTL", &cfg.DNSCacheTTL)
+	e.duration("PAC_DECISION_CACHE_TTL", &cfg.DecisionCacheTTL)
+	e.value("PAC_DECISION_CACHE_FILE", func(v string) error {
+		cfg.DecisionCacheFile = v
+		return nil
+	})
+	e.value("PAC_EMPTY_RESULT", func(v string) error {
+		switch strings.ToLower(v) {
+		case "error":
+			cfg.EmptyResult = EmptyResultError
+		case "direct":
+			cfg.EmptyResult = EmptyResultDirect
+		default:
+			return errors.New(`want "error" or "direct"`)
+		}
+		return nil
+	})
+	e.value("PAC_COMPAT_MODE", func(v string) error {
+		mode, ok := ParseCompatMode(v)
+		if !ok {
+			return errors.New(`want "default", "chromium", "firefox" or "winhttp"`)
+		}
+		cfg.CompatMode = mode
+		return nil
+	})
+	e.bool("PAC_EXTENSION_HELPERS", &cfg.ExtensionHelpers)
+	e.bool("PAC_MODULE_SYNTAX", &cfg.ModuleSyntax)
+	e.value("PAC_ENTRY_POINTS", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.EntryPoints = append(cfg.EntryPoints, name)
+			}
+		}
+		return nil
+	})
+	e.value("PAC_CLIENT_IP_GLOBAL", func(v string) error {
+		cfg.ClientIPGlobal = v
+		return nil
+	})
+	e.bool("PAC_CLIENT_IP_ARGUMENT", &cfg.ClientIPArgument)
+	e.value("PAC_BYPASS", func(v string) error {
+		cfg.Bypass = ParseBypassList(v)
+		return nil
+	})
+	e.bool("PAC_LOG_FULL_URLS", &cfg.LogFullURLs)
+	if e.err != nil {
+		return nil, nil, e.err
+	}
+	return pacURL, cfg, nil
+}
+
+// envReader parses environment variables, keeping the first error.
+type envReader struct {
+	lookup func(string) (string, bool)
+	err    error
+}
+
+// pacURL reads PAC_URL, which must be absolute.
+func (e *envReader) pacURL() *url.URL {
+	var pacURL *url.URL
+	e.value("PAC_URL", func(v string) (err error) {
+		pacURL, err = url.Parse(v)
+		if err == nil && (pacURL.Scheme == "" || pacURL.Host == "") {
+			err = errors.New("not an absolute URL")
+		}
+		return err
+	})
+	return pacURL
+}
+
+// value calls parse with the trimmed value of name, if set and not empty.
+func (e *envReader) value(name string, parse func(string) error) {
+	v, _ := e.lookup(name)
+	v = strings.TrimSpace(v)
+	if v == "" || e.err != nil {
+		return
+	}
+	if err := parse(v); err != nil {
+		e.err = fmt.Errorf("%w: %s=%q: %v", ErrInvalidEnv, name, v, err)
+	}
+}
+
+func (e *envReader) duration(name string, d *time.Duration) {
+	e.value(name, func(v string) (err error) {
+		*d, err = time.ParseDuration(v)
+		return err
+	})
+}
+
+// limit reads a timeout, mapping 0 to no limit.
+func (e *envReader) limit(name string, d *time.Duration) {
+	e.value(name, func(v string) error {
+		parsed, err := time.ParseDuration(v)
+		*d = explicitDuration(parsed)
+		return err
+	})
+}
+
+// size reads a byte count, mapping 0 to no limit.
+func (e *envReader) size(name string, n *int64) {
+	e.value(name, func(v string) error {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if parsed == 0 {
+			parsed = -1
+		}
+		*n = parsed
+		return err
+	})
+}
+
+func (e *envReader) bool(name string, b *bool) {
+	e.value(name, func(v string) (err error) {
+		*b, err = strconv.ParseBool(v)
+		return err
+	})
+}
@@ -0,0 +1,74 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestConfigFromEnv tests reading the PAC URL and configuration from PAC_*
+// environment variables.
+func TestConfigFromEnv(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "loop.example.com") { var end = Date.now() + 100; while (Date.now() < end) {} }
+		return "";
+	}`)
+	defer pacServer.Close()
+
+	t.Setenv("PAC_URL", pacServer.URL)
+	t.Setenv("PAC_SCRIPT_TIMEOUT", "0")
+	t.Setenv("PAC_DNS_TIMEOUT", "250ms")
+	t.Setenv("PAC_MAX_SCRIPT_SIZE", "4096")
+	t.Setenv("PAC_DECISION_CACHE_TTL", "1m")
+	t.Setenv("PAC_EMPTY_RESULT", "direct")
+	t.Setenv("PAC_COMPAT_MODE", "Chromium")
+	t.Setenv("PAC_EXTENSION_HELPERS", "1")
+	t.Setenv("PAC_SANDBOX", "true")
+	t.Setenv("PAC_EVALUATOR_COMMAND", " ")
+	pacURL, config, err := pac.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Error reading config: %v", err)
+	}
+	if pacURL.String() != pacServer.URL {
+		t.Fatalf("Expected PAC URL %s, got %v", pacServer.URL, pacURL)
+	}
+	want := pac.PACProxyConfig{
+		ScriptTimeout:    -1,
+		DNSLookupTimeout: 250 * time.Millisecond,
+		MaxScriptSize:    4096,
+		DecisionCacheTTL: time.Minute,
+		EmptyResult:      pac.EmptyResultDirect,
+		CompatMode:       pac.CompatChromium,
+		ExtensionHelpers: true,
+		Sandbox:          true,
+	}
+	if !reflect.DeepEqual(*config, want) {
+		t.Fatalf("Expected config %+v, got %+v", want, *config)
+	}
+
+	proxy := newTestPACProxyFromURL(t, pacURL.String(), config)
+	loopURL, _ := url.Parse("http://loop.example.com/")
+	if got, err := proxy.FindProxyStringForURL(loopURL); err != nil || got != "DIRECT" {
+		t.Fatalf("Expected DIRECT without a script timeout, got %q, %v", got, err)
+	}
+
+	for name, value := range map[string]string{
+		"PAC_URL":            "/proxy.pac",
+		"PAC_SCRIPT_TIMEOUT": "5",
+		"PAC_SANDBOX":        "maybe",
+		"PAC_EMPTY_RESULT":   "proxy",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			_, _, err := pac.ConfigFromEnv()
+			if !errors.Is(err, pac.ErrInvalidEnv) || !strings.Contains(err.Error(), name) {
+				t.Fatalf("Expected error %v naming %s, got %v", pac.ErrInvalidEnv, name, err)
+			}
+		})
+	}
+}
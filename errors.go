@@ -0,0 +1,113 @@
+package pac
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+)
+
+// FetchError reports a failed download of the PAC script. It matches
+// ErrFetchPACScript with errors.Is.
+type FetchError struct {
+	URL string
+	// StatusCode is the HTTP status of the response, 0 if there was none.
+	StatusCode int
+	// Err is the cause, nil if the server answered with a status other than
+	// 200.
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v: status code %d", ErrFetchPACScript, e.StatusCode)
+	}
+	return fmt.Sprintf("%v: %v", ErrFetchPACScript, e.Err)
+}
+
+// Is reports whether target is ErrFetchPACScript.
+func (e *FetchError) Is(target error) bool { return target == ErrFetchPACScript }
+
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// EvalError is a JavaScript error of the PAC script, such as a syntax error
+// or an exception. It matches ErrExecutePACScript with errors.Is if it was
+// raised while loading the script and ErrEvaluatePAC if it was raised by
+// FindProxyForURL.
+type EvalError struct {
+	// Load is set for errors raised while loading the script.
+	Load bool
+	// Line and Column locate the error in the script, 0 if unknown.
+	Line, Column int
+	// Err is the error of the JavaScript engine.
+	Err error
+}
+
+func newEvalError(load bool, err error) *EvalError {
+	line, column := jsPosition(err)
+	return &EvalError{Load: load, Line: line, Column: column, Err: err}
+}
+
+// newLoadError is newEvalError for an error loading source. goja drops the
+// position of syntax errors when running a script, so source is parsed
+// again to find it.
+func newLoadError(source string, err error) *EvalError {
+	e := newEvalError(true, err)
+	if e.Line == 0 {
+		if _, parseErr := parser.ParseFile(nil, "", source, 0); parseErr != nil {
+			e.Line, e.Column = jsPosition(parseErr)
+		}
+	}
+	return e
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%v: %v", e.sentinel(), e.Err)
+}
+
+// Is reports whether target is ErrExecutePACScript or ErrEvaluatePAC, as
+// selected by Load.
+func (e *EvalError) Is(target error) bool { return target == e.sentinel() }
+
+func (e *EvalError) Unwrap() error { return e.Err }
+
+func (e *EvalError) sentinel() error {
+	if e.Load {
+		return ErrExecutePACScript
+	}
+	return ErrEvaluatePAC
+}
+
+// jsPosition returns the script position of the first parser error or of
+// the innermost script frame of an exception.
+func jsPosition(err error) (line, column int) {
+	var syntax parser.ErrorList
+	if errors.As(err, &syntax) && len(syntax) > 0 {
+		return syntax[0].Position.Line, syntax[0].Position.Column
+	}
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		for _, frame := range exception.Stack() {
+			if pos := frame.Position(); pos.Line > 0 {
+				return pos.Line, pos.Column
+			}
+		}
+	}
+	return 0, 0
+}
+
+// TimeoutError reports an evaluation interrupted by ScriptTimeout. It
+// matches ErrPACScriptTimeout with errors.Is.
+type TimeoutError struct {
+	// Elapsed is how long the evaluation ran.
+	Elapsed time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v after %v", ErrPACScriptTimeout, e.Elapsed.Round(time.Millisecond))
+}
+
+// Is reports whether target is ErrPACScriptTimeout.
+func (e *TimeoutError) Is(target error) bool { return target == ErrPACScriptTimeout }
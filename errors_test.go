@@ -0,0 +1,75 @@
+package pac_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestStructuredErrors tests the details of FetchError, EvalError and
+// TimeoutError and that they match the sentinel errors.
+func TestStructuredErrors(t *testing.T) {
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	pacURL, _ := url.Parse(notFound.URL + "/proxy.pac")
+	_, err := pac.NewPACProxy(pacURL, nil)
+	var fetchErr *pac.FetchError
+	if !errors.Is(err, pac.ErrFetchPACScript) || !errors.As(err, &fetchErr) {
+		t.Fatalf("Expected a FetchError, got %v", err)
+	}
+	if fetchErr.StatusCode != http.StatusNotFound || fetchErr.URL != pacURL.String() {
+		t.Fatalf("Expected status 404 for %s, got %+v", pacURL, fetchErr)
+	}
+
+	syntaxServer := newScriptServer(t, "function FindProxyForURL(url, host) {\n\treturn )\n}")
+	defer syntaxServer.Close()
+	pacURL, _ = url.Parse(syntaxServer.URL)
+	_, err = pac.NewPACProxy(pacURL, nil)
+	var evalErr *pac.EvalError
+	if !errors.Is(err, pac.ErrExecutePACScript) || errors.Is(err, pac.ErrEvaluatePAC) || !errors.As(err, &evalErr) {
+		t.Fatalf("Expected a load EvalError, got %v", err)
+	}
+	if !evalErr.Load || evalErr.Line != 2 {
+		t.Fatalf("Expected a load error at line 2, got %+v", evalErr)
+	}
+
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "loop.example.com") { while (true) {} }
+		throw new Error("no proxy for " + host);
+	}`)
+	defer pacServer.Close()
+	pacURL, _ = url.Parse(pacServer.URL)
+	proxy, err := pac.NewPACProxy(pacURL, nil, pac.WithScriptTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Error creating PAC proxy: %v", err)
+	}
+	defer proxy.Close()
+
+	targetURL, _ := url.Parse("http://example.com/")
+	_, err = proxy.FindProxyStringForURL(targetURL)
+	if !errors.Is(err, pac.ErrEvaluatePAC) || !errors.As(err, &evalErr) {
+		t.Fatalf("Expected an EvalError, got %v", err)
+	}
+	if evalErr.Load || evalErr.Line != 3 || evalErr.Column == 0 {
+		t.Fatalf("Expected an evaluation error at line 3, got %+v", evalErr)
+	}
+	if !strings.Contains(err.Error(), "no proxy for example.com") {
+		t.Fatalf("Expected the exception message, got %v", err)
+	}
+
+	loopURL, _ := url.Parse("http://loop.example.com/")
+	_, err = proxy.FindProxyStringForURL(loopURL)
+	var timeoutErr *pac.TimeoutError
+	if !errors.Is(err, pac.ErrPACScriptTimeout) || !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected a TimeoutError, got %v", err)
+	}
+	if timeoutErr.Elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected an elapsed time of at least 50ms, got %v", timeoutErr.Elapsed)
+	}
+}
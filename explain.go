@@ -0,0 +1,288 @@
+package pac
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// Explanation is the rationale of a PAC decision, for support tooling. Its
+// String method prints it, e.g.
+//
+//	https://www.example.com/
+//	  source: script
+//	  line 2: dnsDomainIs("www.example.com", ".corp") = false
+//	  line 5: isInNet("www.example.com", "10.0.0.0", "255.0.0.0") = false
+//	  dns:    www.example.com = 93.184.215.14
+//	  return: line 8: return "PROXY proxy.example.com:3128"
+//	  result: PROXY proxy.example.com:3128
+type Explanation struct {
+	// URL is the URL as passed to the script.
+	URL string
+	// Source is what answered the lookup: "override", "bypass" or "script".
+	Source string
+	// Checks are the PAC helper calls of the script, in order.
+	Checks []ExplainCheck
+	// DNS are the host lookups of the helpers and their answers, in order.
+	DNS []DNSAnswer
+	// Return is the return statement of FindProxyForURL that decided, nil
+	// if the script did not run, failed or returned without one.
+	Return *ExplainReturn
+	// Result is the decision, empty if Explain failed.
+	Result ProxyString
+}
+
+// ExplainCheck is a helper call of an explained evaluation.
+type ExplainCheck struct {
+	HelperCall
+	// Matched is set for conditions, such as dnsDomainIs or isInNet, that
+	// returned true.
+	Matched bool
+}
+
+// DNSAnswer is a host lookup of a PAC helper.
+type DNSAnswer struct {
+	Host  string
+	Addrs []string
+	// Err is why the host did not resolve, e.g. a DNSFilter rejection.
+	Err error
+}
+
+// ExplainReturn is a return statement of FindProxyForURL.
+type ExplainReturn struct {
+	Line int
+	// Statement is the source of the statement, on one line.
+	Statement string
+}
+
+// Explain evaluates targetURL like FindProxyStringForURLContext and reports
+// how the script got to its result: the helper calls it made, the DNS
+// answers they used and the return statement that fired. The decision
+// cache is not consulted, and the script runs in process regardless of
+// EvaluatorCommand or EvaluatorWASM, instrumented in a fresh runtime, so
+// Explain is meant for support tooling rather than for every request.
+// If the evaluation fails, the explanation up to the failure is returned
+// with the error.
+func (p *PACProxy) Explain(ctx context.Context, targetURL *url.URL) (*Explanation, error) {
+	targetURL = p.evalURL(targetURL)
+	e := &Explanation{URL: targetURL.String()}
+	if result, ok := p.matchOverride(targetURL); ok {
+		e.Source, e.Result = "override", result
+		return e, nil
+	}
+	if p.bypass.Match(targetURL) {
+		e.Source, e.Result = "bypass", "DIRECT"
+		return e, nil
+	}
+	e.Source = "script"
+
+	loaded := p.script.Load()
+	source, returns := instrumentReturns(loaded.source, loaded.entry)
+	vm, err := p.compileLocal(ctx, []byte(source))
+	if err != nil {
+		return e, err
+	}
+	fired := -1
+	if err := vm.Set(explainReturnHook, func(call goja.FunctionCall) goja.Value {
+		fired = int(call.Argument(0).ToInteger())
+		return call.Argument(1)
+	}); err != nil {
+		return e, fmt.Errorf("%w: %v", ErrExecutePACScript, err)
+	}
+
+	ctx = WithHelperTrace(ctx, func(call HelperCall) {
+		matched, _ := call.Result.(bool)
+		e.Checks = append(e.Checks, ExplainCheck{HelperCall: call, Matched: matched})
+	})
+	answers := &dnsAnswerLog{}
+	ctx = context.WithValue(ctx, dnsAnswerLogKey{}, answers)
+	script := &pacScript{source: source, hash: sha256.Sum256([]byte(source)), vm: vm, entry: loaded.entry}
+	e.Result, err = p.evaluate(ctx, script, targetURL)
+	// An interrupted evaluation may still be unwinding; it holds script.mu
+	// until it no longer records.
+	script.mu.Lock()
+	defer script.mu.Unlock()
+	e.DNS = answers.answers
+	if fired >= 0 && fired < len(returns) {
+		e.Return = &returns[fired]
+	}
+	return e, err
+}
+
+// String prints the explanation, see Explanation.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, e.URL)
+	fmt.Fprintf(&b, "  source: %s\n", e.Source)
+	for _, c := range e.Checks {
+		args := make([]string, len(c.Args))
+		for i, arg := range c.Args {
+			args[i] = explainValue(arg)
+		}
+		fmt.Fprintf(&b, "  line %d: %s(%s) = %s\n", c.Line, c.Name, strings.Join(args, ", "), explainValue(c.Result))
+	}
+	for _, a := range e.DNS {
+		if a.Err != nil {
+			fmt.Fprintf(&b, "  dns:    %s: %v\n", a.Host, a.Err)
+		} else {
+			fmt.Fprintf(&b, "  dns:    %s = %s\n", a.Host, strings.Join(a.Addrs, ", "))
+		}
+	}
+	if e.Return != nil {
+		fmt.Fprintf(&b, "  return: line %d: %s\n", e.Return.Line, e.Return.Statement)
+	}
+	fmt.Fprintf(&b, "  result: %s", e.Result)
+	return b.String()
+}
+
+func explainValue(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
+
+// explainReturnHook wraps the value of every return statement of an
+// instrumented FindProxyForURL.
+const explainReturnHook = "__pacExplainReturn"
+
+// instrumentReturns rewrites each return statement of the entry point
+// function in source to report its index to explainReturnHook, keeping
+// lines intact. It returns source unchanged if it does not parse.
+func instrumentReturns(source, entry string) (string, []ExplainReturn) {
+	fn := findProxyFunction(source, entry)
+	if fn == nil {
+		return source, nil
+	}
+	var (
+		returns    []ExplainReturn
+		insertions []sourceInsertion
+	)
+	walkStatements(fn.Body, func(st ast.Statement) {
+		ret, ok := st.(*ast.ReturnStatement)
+		if !ok {
+			return
+		}
+		i := len(returns)
+		start, end := int(ret.Idx0())-1, int(ret.Idx1())-1
+		returns = append(returns, ExplainReturn{
+			Line:      1 + strings.Count(source[:start], "\n"),
+			Statement: strings.Join(strings.Fields(source[start:end]), " "),
+		})
+		if ret.Argument == nil {
+			insertions = append(insertions, sourceInsertion{start + len("return"), fmt.Sprintf(" %s(%d)", explainReturnHook, i)})
+			return
+		}
+		insertions = append(insertions,
+			sourceInsertion{int(ret.Argument.Idx0()) - 1, fmt.Sprintf("%s(%d,(", explainReturnHook, i)},
+			sourceInsertion{int(ret.Argument.Idx1()) - 1, "))"})
+	})
+	return insert(source, insertions), returns
+}
+
+// sourceInsertion is text to insert at a byte offset of a script.
+type sourceInsertion struct {
+	offset int
+	text   string
+}
+
+// insert returns source with insertions applied; insertions at the same
+// offset keep their order.
+func insert(source string, insertions []sourceInsertion) string {
+	sort.SliceStable(insertions, func(i, j int) bool { return insertions[i].offset < insertions[j].offset })
+	var b strings.Builder
+	last := 0
+	for _, ins := range insertions {
+		b.WriteString(source[last:ins.offset])
+		b.WriteString(ins.text)
+		last = ins.offset
+	}
+	b.WriteString(source[last:])
+	return b.String()
+}
+
+// findProxyFunction returns the declaration of the entry point that wins in
+// source, the last one, or nil.
+func findProxyFunction(source, entry string) *ast.FunctionLiteral {
+	prog, err := parser.ParseFile(nil, "", source, 0)
+	if err != nil {
+		return nil
+	}
+	var fn *ast.FunctionLiteral
+	for _, st := range prog.Body {
+		if decl, ok := st.(*ast.FunctionDeclaration); ok && decl.Function.Name != nil && string(decl.Function.Name.Name) == entry {
+			fn = decl.Function
+		}
+	}
+	return fn
+}
+
+// walkStatements calls fn for st and the statements nested in it, in
+// source order, without descending into functions.
+func walkStatements(st ast.Statement, fn func(ast.Statement)) {
+	fn(st)
+	switch st := st.(type) {
+	case *ast.BlockStatement:
+		for _, s := range st.List {
+			walkStatements(s, fn)
+		}
+	case *ast.IfStatement:
+		walkStatements(st.Consequent, fn)
+		if st.Alternate != nil {
+			walkStatements(st.Alternate, fn)
+		}
+	case *ast.ForStatement:
+		walkStatements(st.Body, fn)
+	case *ast.ForInStatement:
+		walkStatements(st.Body, fn)
+	case *ast.ForOfStatement:
+		walkStatements(st.Body, fn)
+	case *ast.WhileStatement:
+		walkStatements(st.Body, fn)
+	case *ast.DoWhileStatement:
+		walkStatements(st.Body, fn)
+	case *ast.LabelledStatement:
+		walkStatements(st.Statement, fn)
+	case *ast.WithStatement:
+		walkStatements(st.Body, fn)
+	case *ast.SwitchStatement:
+		for _, c := range st.Body {
+			for _, s := range c.Consequent {
+				walkStatements(s, fn)
+			}
+		}
+	case *ast.TryStatement:
+		walkStatements(st.Body, fn)
+		if st.Catch != nil {
+			walkStatements(st.Catch.Body, fn)
+		}
+		if st.Finally != nil {
+			walkStatements(st.Finally, fn)
+		}
+	}
+}
+
+// dnsAnswerLog collects the helper lookups of an explained evaluation.
+type dnsAnswerLog struct {
+	mu      sync.Mutex
+	answers []DNSAnswer
+}
+
+type dnsAnswerLogKey struct{}
+
+// recordDNSAnswer adds a lookup to the dnsAnswerLog of ctx, if any.
+func recordDNSAnswer(ctx context.Context, host string, addrs []string, err error) {
+	if l, ok := ctx.Value(dnsAnswerLogKey{}).(*dnsAnswerLog); ok {
+		l.mu.Lock()
+		l.answers = append(l.answers, DNSAnswer{Host: host, Addrs: addrs, Err: err})
+		l.mu.Unlock()
+	}
+}
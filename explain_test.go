@@ -0,0 +1,57 @@
+package pac_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/pactest"
+)
+
+// TestExplain tests that Explain reports the helper calls, DNS answers and
+// return statement behind a decision.
+func TestExplain(t *testing.T) {
+	server := newScriptServer(t, `function FindProxyForURL(url, host) {
+	if (dnsDomainIs(host, ".corp")) {
+		return "DIRECT";
+	}
+	for (var i = 0; i < 1; i++) {
+		if (isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0")) return "DIRECT";
+	}
+	return (host == "a.example.com") ? "PROXY a.example.com:3128" : "PROXY b.example.com:3128";
+}`)
+	defer server.Close()
+	proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{
+		Resolver:  pactest.NewResolver(map[string][]string{"www.example.com": {"93.184.215.14"}, "db.example.com": {"10.1.2.3"}}),
+		Overrides: []pac.OverrideRule{{Match: ".override.example", Result: "PROXY override.example.com:3128"}},
+	})
+
+	e, err := proxy.Explain(context.Background(), &url.URL{Scheme: "https", Host: "www.example.com", Path: "/"})
+	if err != nil {
+		t.Fatalf("Error explaining: %v", err)
+	}
+	want := `https://www.example.com/
+  source: script
+  line 2: dnsDomainIs("www.example.com", ".corp") = false
+  line 6: dnsResolve("www.example.com") = "93.184.215.14"
+  line 6: isInNet("93.184.215.14", "10.0.0.0", "255.0.0.0") = false
+  dns:    www.example.com = 93.184.215.14
+  return: line 8: return (host == "a.example.com") ? "PROXY a.example.com:3128" : "PROXY b.example.com:3128"
+  result: PROXY b.example.com:3128`
+	if got := e.String(); got != want {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+	if e.Checks[0].Matched || e.Checks[2].Matched {
+		t.Fatalf("Expected no check to match, got %+v", e.Checks)
+	}
+
+	e, err = proxy.Explain(context.Background(), &url.URL{Scheme: "https", Host: "db.example.com"})
+	if err != nil || e.Result != "DIRECT" || e.Return == nil || e.Return.Line != 6 || !e.Checks[2].Matched {
+		t.Fatalf("Expected the isInNet return on line 6 to fire, got %+v, %v", e, err)
+	}
+	e, err = proxy.Explain(context.Background(), &url.URL{Scheme: "https", Host: "x.override.example"})
+	if err != nil || e.Source != "override" || e.Result != "PROXY override.example.com:3128" || len(e.Checks) != 0 {
+		t.Fatalf("Expected the override to answer, got %+v, %v", e, err)
+	}
+}
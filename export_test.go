@@ -0,0 +1,9 @@
+package pac
+
+// Internals exported for the tests in package pac_test.
+var (
+	WPADCandidates        = wpadCandidates
+	NewCredentialCache    = newCredentialCache
+	ParseKeychainOutput   = parseKeychainOutput
+	ParseSecretToolOutput = parseSecretToolOutput
+)
@@ -0,0 +1,44 @@
+package pac
+
+import (
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// ErrExpvarPrefix is returned by NewPACProxy if ExpvarPrefix names an
+// expvar variable that is already published.
+var ErrExpvarPrefix = errors.New("expvar prefix already in use")
+
+// expvarMu makes the check and the publishing atomic; expvar.Publish panics
+// on duplicate names.
+var expvarMu sync.Mutex
+
+// publishExpvar publishes the core counters of p as one expvar map named
+// prefix. expvar variables cannot be removed, so the variable keeps
+// reporting the final counters after Close.
+func (p *PACProxy) publishExpvar(prefix string) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if expvar.Get(prefix) != nil {
+		return fmt.Errorf("%w: %s", ErrExpvarPrefix, prefix)
+	}
+	expvar.Publish(prefix, expvar.Func(p.expvarValue))
+	return nil
+}
+
+func (p *PACProxy) expvarValue() any {
+	stats := p.Stats()
+	script := p.script.Load()
+	return map[string]any{
+		"evaluations":         stats.Evaluations.Evaluations,
+		"errors":              stats.Evaluations.Errors,
+		"timeouts":            stats.Evaluations.Timeouts,
+		"decision_cache_hits": stats.Decisions.Hits,
+		"dns_cache_hits":      stats.DNS.Hits,
+		"script_cache_hits":   stats.Script.Hits,
+		"script_version":      hex.EncodeToString(script.hash[:8]),
+	}
+}
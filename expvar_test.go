@@ -0,0 +1,46 @@
+package pac_test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestExpvar tests that ExpvarPrefix publishes the core counters.
+func TestExpvar(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "loop.example.com") { while (true) {} }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+
+	config := &pac.PACProxyConfig{ScriptTimeout: 50 * time.Millisecond, ExpvarPrefix: "pac_test_expvar"}
+	proxy := newTestPACProxyFromURL(t, pacURL.String(), config)
+	for _, target := range []string{"http://example.com", "http://loop.example.com"} {
+		targetURL, _ := url.Parse(target)
+		_, _ = proxy.FindProxyStringForURL(targetURL)
+	}
+
+	var vars struct {
+		Evaluations   uint64 `json:"evaluations"`
+		Errors        uint64 `json:"errors"`
+		Timeouts      uint64 `json:"timeouts"`
+		ScriptVersion string `json:"script_version"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("pac_test_expvar").String()), &vars); err != nil {
+		t.Fatalf("Error decoding expvar: %v", err)
+	}
+	if vars.Evaluations != 2 || vars.Errors != 1 || vars.Timeouts != 1 || len(vars.ScriptVersion) != 16 {
+		t.Fatalf("Unexpected expvar counters: %+v", vars)
+	}
+
+	if _, err := pac.NewPACProxy(pacURL, config); !errors.Is(err, pac.ErrExpvarPrefix) {
+		t.Fatalf("Expected ErrExpvarPrefix for a reused prefix, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package pac
+
+import (
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// maxRangeLists bounds the parsed lists of inIpRangeList a runtime keeps.
+const maxRangeLists = 64
+
+// defineExtensionHelpers defines the helpers enabled by ExtensionHelpers:
+// isSubnetOf, matchesDomainSuffix, inIpRangeList and parseURL.
+// They are not part of the PAC standard, so only scripts written for them
+// should rely on them. Host arguments are resolved once, like isInNet does,
+// and match IPv4 and IPv6 in every CompatMode.
+func (r *GojaRuntime) defineExtensionHelpers(set func(name string, value any)) {
+	set("isSubnetOf", func(call goja.FunctionCall) goja.Value {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(call.Argument(1).String()))
+		if err != nil {
+			return r.ToValue(false)
+		}
+		addr, ok := r.resolveAddr(call.Argument(0).String())
+		return r.ToValue(ok && prefix.Contains(addr))
+	})
+
+	set("matchesDomainSuffix", func(call goja.FunctionCall) goja.Value {
+		return r.ToValue(matchesDomainSuffix(call.Argument(0).String(), jsStringList(call.Argument(1))))
+	})
+
+	set("inIpRangeList", func(call goja.FunctionCall) goja.Value {
+		ranges := r.ipRangeList(jsStringList(call.Argument(1)))
+		if len(ranges) == 0 {
+			return r.ToValue(false)
+		}
+		addr, ok := r.resolveAddr(call.Argument(0).String())
+		if !ok {
+			return r.ToValue(false)
+		}
+		for _, rg := range ranges {
+			if rg.contains(addr) {
+				return r.ToValue(true)
+			}
+		}
+		return r.ToValue(false)
+	})
+
+	set("parseURL", func(call goja.FunctionCall) goja.Value {
+		u, err := url.Parse(call.Argument(0).String())
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return goja.Null()
+		}
+		obj := r.NewObject()
+		scheme := strings.ToLower(u.Scheme)
+		_ = obj.Set("scheme", scheme)
+		_ = obj.Set("host", strings.ToLower(u.Hostname()))
+		_ = obj.Set("port", urlPort(scheme, u.Port()))
+		_ = obj.Set("path", u.EscapedPath())
+		return obj
+	})
+}
+
+// defaultPorts are the ports parseURL reports for URLs without one.
+var defaultPorts = map[string]int{"http": 80, "https": 443, "ws": 80, "wss": 443, "ftp": 21}
+
+// urlPort returns port as a number, the default port of scheme if it is
+// empty, or 0 if there is none.
+func urlPort(scheme, port string) int {
+	if port == "" {
+		return defaultPorts[scheme]
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// resolveAddr returns the address of an IP literal, bracketed for IPv6 as
+// in the host argument of CompatDefault, or the first address of a host
+// name.
+func (r *GojaRuntime) resolveAddr(host string) (netip.Addr, bool) {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	ip, err := r.resolveIP(host)
+	if err != nil || ip == nil {
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// ipRangeList parses a list of inIpRangeList, reusing the result for the
+// same list, since scripts pass the same literal on every call.
+func (r *GojaRuntime) ipRangeList(list []string) []ipRange {
+	key := strings.Join(list, ",")
+	if ranges, ok := r.rangeLists[key]; ok {
+		return ranges
+	}
+	var ranges []ipRange
+	for _, entry := range list {
+		if rg, ok := parseIPRange(entry); ok {
+			ranges = append(ranges, rg)
+		}
+	}
+	if r.rangeLists == nil || len(r.rangeLists) >= maxRangeLists {
+		r.rangeLists = make(map[string][]ipRange)
+	}
+	r.rangeLists[key] = ranges
+	return ranges
+}
+
+// jsStringList returns the strings of an array, or the entries of a string
+// separated by commas or whitespace.
+func jsStringList(v goja.Value) []string {
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	if items, ok := v.Export().([]any); ok {
+		list := make([]string, 0, len(items))
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return strings.FieldsFunc(v.String(), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// matchesDomainSuffix reports whether host is one of the domains or a
+// subdomain of one, ignoring case and leading and trailing dots.
+func matchesDomainSuffix(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipRange is an inclusive range of addresses of one family.
+type ipRange struct {
+	from, to netip.Addr
+}
+
+func (rg ipRange) contains(addr netip.Addr) bool {
+	return addr.BitLen() == rg.from.BitLen() && rg.from.Compare(addr) <= 0 && addr.Compare(rg.to) <= 0
+}
+
+// parseIPRange parses a CIDR prefix, a single address or a range
+// "first-last" of one family.
+func parseIPRange(entry string) (ipRange, bool) {
+	entry = strings.TrimSpace(entry)
+	if first, last, ok := strings.Cut(entry, "-"); ok {
+		from, err1 := netip.ParseAddr(strings.TrimSpace(first))
+		to, err2 := netip.ParseAddr(strings.TrimSpace(last))
+		from, to = from.Unmap(), to.Unmap()
+		if err1 != nil || err2 != nil || from.BitLen() != to.BitLen() || to.Less(from) {
+			return ipRange{}, false
+		}
+		return ipRange{from, to}, true
+	}
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return ipRange{}, false
+		}
+		prefix = prefix.Masked()
+		return ipRange{prefix.Addr(), lastAddr(prefix)}, true
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return ipRange{}, false
+	}
+	addr = addr.Unmap()
+	return ipRange{addr, addr}, true
+}
+
+// lastAddr returns the highest address of a masked prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
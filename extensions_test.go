@@ -0,0 +1,74 @@
+package pac_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/pactest"
+)
+
+// TestGojaRuntimeOptions tests the settings of NewGojaRuntimeWithOptions.
+func TestExtensionHelpers(t *testing.T) {
+	script := `function FindProxyForURL(url, host) {
+		if (matchesDomainSuffix(host, ["corp.example.com", ".example.internal"])) return "DIRECT";
+		if (inIpRangeList(host, "10.0.0.0/8, 192.168.1.10-192.168.1.20, fd00::/8")) return "PROXY range:1";
+		if (isSubnetOf(host, "172.16.0.0/12")) return "PROXY subnet:1";
+		return "PROXY default:1";
+	}`
+	pacServer := newScriptServer(t, script)
+	defer pacServer.Close()
+	resolver := pactest.NewResolver(map[string][]string{"lab.example.com": {"172.20.0.5"}, "db.example.com": {"192.168.1.15"}})
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{ExtensionHelpers: true, Resolver: resolver})
+	for host, want := range map[string]pac.ProxyString{
+		"WWW.Corp.Example.com": "DIRECT",
+		"corp.example.com":     "DIRECT",
+		"example.internal":     "DIRECT",
+		"notcorp.example.com":  "PROXY default:1",
+		"10.1.2.3":             "PROXY range:1",
+		"db.example.com":       "PROXY range:1",
+		"192.168.1.21":         "PROXY default:1",
+		"fd00::1":              "PROXY range:1",
+		"lab.example.com":      "PROXY subnet:1",
+		"unknown.example.org":  "PROXY default:1",
+	} {
+		targetURL := &url.URL{Scheme: "http", Host: host, Path: "/"}
+		if strings.Contains(host, ":") {
+			targetURL.Host = "[" + host + "]"
+		}
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil || got != want {
+			t.Fatalf("Expected %q for %s, got %q, %v", want, host, got, err)
+		}
+	}
+
+	// Without the flag the helpers are undefined.
+	proxy = newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{Resolver: resolver})
+	defer proxy.Close()
+	if _, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com"}); !errors.Is(err, pac.ErrEvaluatePAC) || !strings.Contains(err.Error(), "matchesDomainSuffix") {
+		t.Fatalf("Expected a ReferenceError without ExtensionHelpers, got %v", err)
+	}
+}
+
+func TestParseURLHelper(t *testing.T) {
+	vm := pac.NewGojaRuntimeWithOptions(pac.GojaRuntimeOptions{ExtensionHelpers: true})
+	if err := vm.DefinePACFunctions(); err != nil {
+		t.Fatalf("Error defining PAC functions: %v", err)
+	}
+	for rawURL, want := range map[string]string{
+		"https://[2001:DB8::1]/a%20b?q=1": `{"scheme":"https","host":"2001:db8::1","port":443,"path":"/a%20b"}`,
+		"HTTP://Example.com:8080/":        `{"scheme":"http","host":"example.com","port":8080,"path":"/"}`,
+		"ws://example.com":                `{"scheme":"ws","host":"example.com","port":80,"path":""}`,
+		"gopher://example.com/x":          `{"scheme":"gopher","host":"example.com","port":0,"path":"/x"}`,
+		"example.com/x":                   `null`,
+	} {
+		got, err := vm.RunString(fmt.Sprintf("JSON.stringify(parseURL(%q))", rawURL))
+		if err != nil || got.String() != want {
+			t.Fatalf("Expected %s for %s, got %v, %v", want, rawURL, got, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package pac
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// ProxyFilter decides whether a proxy returned by the PAC may be used.
+// Filtered proxies are dropped from the candidates, which guards against a
+// compromised PAC redirecting traffic to a foreign proxy. DIRECT entries are
+// passed to the filter as well.
+type ProxyFilter func(p Proxy) bool
+
+// AllowProxies returns a ProxyFilter that only keeps proxies whose host
+// matches list, written in the ParseBypassList syntax, e.g.
+// "10.0.0.0/8, .corp.example.com". DIRECT is always kept.
+func AllowProxies(list string) ProxyFilter {
+	allowed := ParseBypassList(list)
+	return func(p Proxy) bool {
+		return p.Type == ProxyDirect || allowed.Match(&url.URL{Host: p.Host})
+	}
+}
+
+// DenyProxies returns a ProxyFilter that drops proxies whose host matches
+// list, written in the ParseBypassList syntax. DIRECT is always kept.
+func DenyProxies(list string) ProxyFilter {
+	denied := ParseBypassList(list)
+	return func(p Proxy) bool {
+		return p.Type == ProxyDirect || !denied.Match(&url.URL{Host: p.Host})
+	}
+}
+
+// filterProxies applies the configured ProxyFilter to candidates.
+func (p *PACProxy) filterProxies(ctx context.Context, candidates []Proxy) ([]Proxy, error) {
+	if p.filter == nil {
+		return candidates, nil
+	}
+	kept := make([]Proxy, 0, len(candidates))
+	for _, c := range candidates {
+		if p.filter(c) {
+			kept = append(kept, c)
+			continue
+		}
+		p.logf(ctx, LogWarn, "proxy rejected by filter", "proxy", c.String())
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("%w: all proxies rejected by ProxyFilter", ErrNoValidProxy)
+	}
+	return kept, nil
+}
@@ -0,0 +1,138 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// The Fuzz functions are entry points for continuous fuzzing, e.g. with
+// OSS-Fuzz or a native fuzz test:
+//
+//	func FuzzProxyString(f *testing.F) {
+//		f.Fuzz(func(t *testing.T, data []byte) { pac.FuzzProxyString(data) })
+//	}
+//
+// They follow the go-fuzz convention: they panic if an invariant breaks
+// and return 1 for inputs that are worth keeping in the corpus, 0
+// otherwise.
+
+// FuzzProxyString parses data as a PAC result and checks that every
+// directive found survives a round trip through its string and text forms.
+func FuzzProxyString(data []byte) int {
+	ps := ProxyString(data)
+	proxies := ps.Proxies()
+	for _, p := range proxies {
+		again := ProxyString(p.String()).Proxies()
+		if len(again) != 1 || again[0] != p {
+			panic(fmt.Sprintf("directive %q reparses as %v", p.String(), again))
+		}
+		text, err := p.MarshalText()
+		if err != nil {
+			panic(err)
+		}
+		var decoded Proxy
+		if err := decoded.UnmarshalText(text); err != nil || decoded != p {
+			panic(fmt.Sprintf("directive %q decodes as %v, %v", text, decoded, err))
+		}
+		_, _ = p.URL()
+		_, _ = p.URLFor(&url.URL{Scheme: "wss", Host: "example.com"}, ProxySchemeMap{"wss": "https"})
+	}
+	_, _ = ps.Parse()
+	_, _ = ps.ParseFor(&url.URL{Scheme: "https", Host: "example.com"}, ProxySchemeMap{"https": "https"})
+	if len(proxies) == 0 {
+		return 0
+	}
+	return 1
+}
+
+// FuzzDateTimeArgs calls weekdayRange, dateRange and timeRange with the
+// comma separated arguments in data; numeric ones are passed as numbers.
+// The clock is derived from data.
+func FuzzDateTimeArgs(data []byte) int {
+	r := NewGojaRuntimeWithOptions(GojaRuntimeOptions{Now: func() time.Time { return time.Unix(int64(crc32.ChecksumIEEE(data)), 0) }})
+	if err := r.DefinePACFunctions(); err != nil {
+		panic(err)
+	}
+	var args []goja.Value
+	for _, token := range strings.Split(string(data), ",") {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(token), 64); err == nil {
+			args = append(args, r.ToValue(f))
+		} else {
+			args = append(args, r.ToValue(token))
+		}
+	}
+	matched := 0
+	for _, name := range []string{"weekdayRange", "dateRange", "timeRange"} {
+		fn, ok := goja.AssertFunction(r.Get(name))
+		if !ok {
+			panic(name + " is not defined")
+		}
+		result, err := fn(goja.Undefined(), args...)
+		if err != nil {
+			panic(fmt.Sprintf("%s: %v", name, err))
+		}
+		if result.ToBoolean() {
+			matched = 1
+		}
+	}
+	return matched
+}
+
+// FuzzPACScript serves data as the PAC script body to NewPACProxy and, if it
+// compiles, evaluates a few URLs with it. Helpers see no network: lookups
+// fail, and the clock and interface addresses are fixed.
+func FuzzPACScript(data []byte) int {
+	client := &http.Client{Transport: fuzzTransport(data)}
+	proxy, err := NewPACProxy(&url.URL{Scheme: "http", Host: "pac.fuzz", Path: "/proxy.pac"}, &PACProxyConfig{
+		Client:        client,
+		MaxScriptSize: 64 << 10,
+		ScriptTimeout: 100 * time.Millisecond,
+		Resolver:      fuzzResolver{},
+		Now:           func() time.Time { return time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC) },
+		InterfaceAddrs: func() ([]net.Addr, error) {
+			return []net.Addr{&net.IPNet{IP: net.IPv4(10, 1, 0, 7), Mask: net.CIDRMask(16, 32)}}, nil
+		},
+	})
+	if err != nil {
+		return 0
+	}
+	defer proxy.Close()
+	for _, raw := range []string{"https://www.example.com/path?q=1", "http://intranet/", "ws://10.1.2.3:8080/"} {
+		u, _ := url.Parse(raw)
+		if _, err := proxy.FindProxiesForURL(u); err != nil && !errors.Is(err, ErrEvaluatePAC) && !errors.Is(err, ErrConvertResult) &&
+			!errors.Is(err, ErrEmptyResult) && !errors.Is(err, ErrNoValidProxy) && !errors.Is(err, ErrPACScriptTimeout) && !errors.Is(err, ErrPACMemoryLimit) {
+			panic(fmt.Sprintf("unexpected error type %s: %v", reflect.TypeOf(err), err))
+		}
+	}
+	return 1
+}
+
+type fuzzTransport []byte
+
+func (t fuzzTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/x-ns-proxy-autoconfig"}},
+		Body:          io.NopCloser(strings.NewReader(string(t))),
+		ContentLength: int64(len(t)),
+		Request:       req,
+	}, nil
+}
+
+type fuzzResolver struct{}
+
+func (fuzzResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
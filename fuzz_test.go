@@ -0,0 +1,39 @@
+package pac_test
+
+import (
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// FuzzProxyString fuzzes the parsing of PAC results.
+func FuzzProxyString(f *testing.F) {
+	for _, seed := range []string{"DIRECT", "PROXY a:1; DIRECT", "socks5 b:1080;HTTPS c:443", "PROXY", ";;PROXY a b;"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) { pac.FuzzProxyString(data) })
+}
+
+// FuzzDateTimeArgs fuzzes the argument parsing of the PAC date and time
+// helpers.
+func FuzzDateTimeArgs(f *testing.F) {
+	for _, seed := range []string{"MON,FRI", "1,JAN,2024,31,DEC,2024", "9,0,17,30,GMT", "JAN,99,FEB,1e9", "0,0,0,0,0,0,0"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) { pac.FuzzDateTimeArgs(data) })
+}
+
+// FuzzPACScript fuzzes the handling of fetched PAC script bodies.
+func FuzzPACScript(f *testing.F) {
+	for _, seed := range []string{
+		`function FindProxyForURL(url, host) { return "DIRECT"; }`,
+		`function FindProxyForURL(url, host) { if (isInNet(dnsResolve(host), "10.0.0.0", "255.0.0.0")) return "DIRECT"; return "PROXY p:1"; }`,
+		`function FindProxyForURL(url, host) { return null; }`,
+		`function FindProxyForURL(url, host) { while (true) {} }`,
+		"\xef\xbb\xbffunction FindProxyForURL(u, h) { return weekdayRange('MON', 'FRI') ? 'PROXY a:1' : 'DIRECT'; }",
+		`FindProxyForURL = 1`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) { pac.FuzzPACScript(data) })
+}
@@ -0,0 +1,210 @@
+package pac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ErrInvalidRule is returned by GeneratePAC for rules it cannot express.
+var ErrInvalidRule = errors.New("invalid PAC rule")
+
+// PACRule is one rule of a generated PAC script. A destination matches if
+// it matches every condition that is set; a rule without conditions
+// matches everything.
+type PACRule struct {
+	// Domains match hosts equal to an entry or below it, e.g.
+	// "corp.example.com" matches corp.example.com and a.corp.example.com.
+	// A leading dot, ".corp.example.com", matches subdomains only, and
+	// entries with "*" or "?" are shExpMatch patterns.
+	Domains []string
+	// Nets match the IPv4 address of the host, resolved with dnsResolve if
+	// it is a name, e.g. "10.0.0.0/8".
+	Nets []string
+	// Days is a weekday or a weekday range, e.g. "SAT" or "MON-FRI".
+	Days string
+	// Hours is a time window, e.g. "08:00-18:00".
+	Hours string
+	// GMT evaluates Days and Hours in UTC instead of local time.
+	GMT bool
+	// Result is returned for matching destinations, e.g. "DIRECT" or
+	// "PROXY proxy.example.com:3128; DIRECT".
+	Result ProxyString
+}
+
+// GeneratePAC returns a minified PAC script that checks rules in order and
+// returns the Result of the first match, or fallback if none matches.
+// Hosts are compared in lower case and resolved at most once per lookup.
+func GeneratePAC(rules []PACRule, fallback ProxyString) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString(`function FindProxyForURL(url,host){var h=host.toLowerCase(),a;function ip(){if(a===undefined)a=dnsResolve(h)||"";return a}`)
+	for i, rule := range rules {
+		conds, err := ruleConditions(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %d: %v", ErrInvalidRule, i+1, err)
+		}
+		result, err := resultLiteral(rule.Result)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %d: %v", ErrInvalidRule, i+1, err)
+		}
+		if len(conds) == 0 {
+			b.WriteString("return " + result + "}")
+			return finishPAC(b.String())
+		}
+		b.WriteString("if(" + strings.Join(conds, "&&") + ")return " + result + ";")
+	}
+	result, err := resultLiteral(fallback)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fallback: %v", ErrInvalidRule, err)
+	}
+	b.WriteString("return " + result + "}")
+	return finishPAC(b.String())
+}
+
+// finishPAC compiles script as a last check that the generated code is
+// valid JavaScript.
+func finishPAC(script string) ([]byte, error) {
+	if _, err := goja.Compile("wpad.dat", script, false); err != nil {
+		return nil, fmt.Errorf("generated PAC does not compile: %v", err)
+	}
+	return []byte(script), nil
+}
+
+func ruleConditions(rule PACRule) ([]string, error) {
+	var conds []string
+	if len(rule.Domains) > 0 {
+		var alts []string
+		for _, d := range rule.Domains {
+			alt, err := domainCondition(d)
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, alt)
+		}
+		conds = append(conds, group(alts))
+	}
+	if len(rule.Nets) > 0 {
+		var alts []string
+		for _, n := range rule.Nets {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(n))
+			if err != nil {
+				return nil, fmt.Errorf("invalid net %q", n)
+			}
+			if !prefix.Addr().Is4() {
+				return nil, fmt.Errorf("net %q is not IPv4, which isInNet cannot match", n)
+			}
+			prefix = prefix.Masked()
+			mask := net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+			alts = append(alts, "isInNet(ip(),"+jsString(prefix.Addr().String())+","+jsString(mask)+")")
+		}
+		conds = append(conds, group(alts))
+	}
+	gmt := ""
+	if rule.GMT {
+		gmt = `,"GMT"`
+	}
+	if rule.Days != "" {
+		days, err := dayArgs(rule.Days)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, "weekdayRange("+days+gmt+")")
+	}
+	if rule.Hours != "" {
+		hours, err := hourArgs(rule.Hours)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, "timeRange("+hours+gmt+")")
+	}
+	return conds, nil
+}
+
+func domainCondition(domain string) (string, error) {
+	d := strings.ToLower(strings.TrimSpace(domain))
+	if d == "" || d == "." || strings.ContainsAny(d, " \t\"'\\/:") {
+		return "", fmt.Errorf("invalid domain %q", domain)
+	}
+	switch {
+	case strings.ContainsAny(d, "*?"):
+		return "shExpMatch(h," + jsString(d) + ")", nil
+	case strings.HasPrefix(d, "."):
+		return "dnsDomainIs(h," + jsString(d) + ")", nil
+	default:
+		return "(h==" + jsString(d) + "||dnsDomainIs(h," + jsString("."+d) + "))", nil
+	}
+}
+
+func dayArgs(days string) (string, error) {
+	first, last, isRange := strings.Cut(strings.ToUpper(strings.TrimSpace(days)), "-")
+	args := []string{first}
+	if isRange {
+		args = append(args, last)
+	}
+	for i, day := range args {
+		day = strings.TrimSpace(day)
+		if _, ok := weekdayNames[day]; !ok {
+			return "", fmt.Errorf("invalid days %q", days)
+		}
+		args[i] = jsString(day)
+	}
+	return strings.Join(args, ","), nil
+}
+
+func hourArgs(hours string) (string, error) {
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return "", fmt.Errorf("invalid hours %q, want HH:MM-HH:MM", hours)
+	}
+	var args []string
+	for _, clock := range []string{from, to} {
+		h, m, ok := strings.Cut(strings.TrimSpace(clock), ":")
+		hour, err1 := strconv.Atoi(h)
+		minute, err2 := strconv.Atoi(m)
+		if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+			return "", fmt.Errorf("invalid hours %q, want HH:MM-HH:MM", hours)
+		}
+		args = append(args, strconv.Itoa(hour), strconv.Itoa(minute))
+	}
+	return strings.Join(args, ","), nil
+}
+
+// resultLiteral returns the directives of result, normalized, as a
+// JavaScript string.
+func resultLiteral(result ProxyString) (string, error) {
+	var directives []string
+	for _, entry := range strings.Split(string(result), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		p, ok := parseDirective(entry)
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrNoValidProxy, result)
+		}
+		directives = append(directives, p.String())
+	}
+	if len(directives) == 0 {
+		return "", fmt.Errorf("%w: %q", ErrNoValidProxy, result)
+	}
+	return jsString(strings.Join(directives, "; ")), nil
+}
+
+func group(alts []string) string {
+	if len(alts) == 1 {
+		return alts[0]
+	}
+	return "(" + strings.Join(alts, "||") + ")"
+}
+
+// jsString quotes s as a JavaScript string literal. JSON strings are valid
+// JavaScript, and encoding/json escapes U+2028 and U+2029.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,61 @@
+package pac_test
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestGeneratePAC tests that generated PAC scripts decide like their rules.
+func TestGeneratePAC(t *testing.T) {
+	script, err := pac.GeneratePAC([]pac.PACRule{
+		{Domains: []string{"corp.example.com", ".lab.example", "*.internal"}, Result: "DIRECT"},
+		{Nets: []string{"10.0.0.0/8", "192.168.1.7/16"}, Result: "DIRECT"},
+		{Days: "SAT-SUN", GMT: true, Result: "PROXY weekend.example.com:3128"},
+		{Domains: []string{"example.org"}, Hours: "08:00-18:00", GMT: true, Result: "proxy office.example.com:3128;direct"},
+	}, "PROXY default.example.com:3128")
+	if err != nil {
+		t.Fatalf("Error generating PAC: %v", err)
+	}
+	if bytes.ContainsAny(script, "\n\t") {
+		t.Fatalf("Expected a minified script, got:\n%s", script)
+	}
+	server := newScriptServer(t, string(script))
+	defer server.Close()
+	now := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC) // Monday
+	proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{Now: func() time.Time { return now }})
+
+	for host, want := range map[string]pac.ProxyString{
+		"corp.example.com":    "DIRECT",
+		"A.Corp.Example.com":  "DIRECT",
+		"notcorp.example.com": "PROXY default.example.com:3128",
+		"lab.example":         "PROXY default.example.com:3128",
+		"x.lab.example":       "DIRECT",
+		"db.internal":         "DIRECT",
+		"10.1.2.3":            "DIRECT",
+		"192.168.200.1":       "DIRECT",
+		"192.169.0.1":         "PROXY default.example.com:3128",
+		"www.example.org":     "PROXY office.example.com:3128; DIRECT",
+	} {
+		got, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "https", Host: host})
+		if err != nil || got != want {
+			t.Errorf("%s: expected %q, got %q, %v", host, want, got, err)
+		}
+	}
+
+	for _, rule := range []pac.PACRule{
+		{Nets: []string{"fd00::/8"}, Result: "DIRECT"},
+		{Hours: "8-18", Result: "DIRECT"},
+		{Days: "MON-FUN", Result: "DIRECT"},
+		{Domains: []string{`a"b`}, Result: "DIRECT"},
+		{Domains: []string{"example.com"}, Result: "PROXY"},
+	} {
+		if _, err := pac.GeneratePAC([]pac.PACRule{rule}, "DIRECT"); !errors.Is(err, pac.ErrInvalidRule) {
+			t.Errorf("%+v: expected ErrInvalidRule, got %v", rule, err)
+		}
+	}
+}
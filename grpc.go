@@ -0,0 +1,20 @@
+package pac
+
+import (
+	"context"
+	"net"
+)
+
+// NewGRPCDialer returns a dial function for grpc.WithContextDialer that
+// evaluates the PAC for the target authority and tunnels through the selected
+// proxies like Dialer. The PAC sees the target as https://host:port.
+//
+// gRPC passes resolved addresses to the dialer; use the passthrough resolver
+// (e.g. "passthrough:///api.example.com:443") so the PAC sees the host name
+// instead of an IP address.
+func NewGRPCDialer(p *PACProxy) func(ctx context.Context, addr string) (net.Conn, error) {
+	d := &Dialer{PAC: p, Scheme: "https"}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
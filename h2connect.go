@@ -0,0 +1,330 @@
+package pac
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// h2Tunnels opens CONNECT tunnels as streams of HTTP/2 connections to each
+// https proxy, see Dialer.HTTP2.
+type h2Tunnels struct {
+	mu    sync.Mutex
+	conns map[string][]*h2ProxyConn
+	// dialing holds the connects in progress, so concurrent tunnels to a
+	// proxy wait for one new connection instead of each opening their own.
+	dialing map[string]*h2Connect
+	// http1 holds the proxies that did not negotiate HTTP/2; they are
+	// tunneled with HTTP/1.1 CONNECT from then on.
+	http1     map[string]bool
+	transport *http2.Transport
+}
+
+// h2ProxyConn is an HTTP/2 connection to a proxy.
+type h2ProxyConn struct {
+	cc            *http2.ClientConn
+	local, remote net.Addr
+}
+
+// h2Connect is a connect to a proxy in progress; done is closed when it
+// ends.
+type h2Connect struct {
+	done chan struct{}
+	err  error
+	// canceled reports that the connect failed because the context of the
+	// connecting tunnel ended, which waiters with a live context retry.
+	canceled bool
+}
+
+// dial opens a tunnel to addr through the https proxy at proxyURL, reusing
+// one of its HTTP/2 connections if it can take another stream.
+func (t *h2Tunnels) dial(ctx context.Context, forward ContextDialer, tlsConfig *tls.Config, proxyURL *url.URL, addr string, header http.Header) (net.Conn, error) {
+	host := proxyURL.Host
+	for {
+		t.mu.Lock()
+		if t.http1[host] {
+			t.mu.Unlock()
+			return dialConnect(ctx, forward, tlsConfig, proxyURL, addr, header)
+		}
+		if pc := t.reserve(host); pc != nil {
+			t.mu.Unlock()
+			return pc.tunnel(ctx, proxyURL, addr, header)
+		}
+		c := t.dialing[host]
+		if c == nil {
+			c = &h2Connect{done: make(chan struct{})}
+			if t.dialing == nil {
+				t.dialing = make(map[string]*h2Connect)
+			}
+			t.dialing[host] = c
+			t.mu.Unlock()
+			return t.connectAndTunnel(ctx, c, forward, tlsConfig, proxyURL, addr, header)
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.err != nil && !c.canceled {
+			return nil, c.err
+		}
+	}
+}
+
+// reserve returns a connection to host with a stream reserved for a
+// tunnel, nil if none can take one, and forgets closed connections. The
+// caller holds t.mu.
+func (t *h2Tunnels) reserve(host string) *h2ProxyConn {
+	conns := t.conns[host][:0]
+	var reserved *h2ProxyConn
+	for _, pc := range t.conns[host] {
+		if pc.cc.State().Closed {
+			continue
+		}
+		conns = append(conns, pc)
+		if reserved == nil && pc.cc.ReserveNewRequest() {
+			reserved = pc
+		}
+	}
+	clear(t.conns[host][len(conns):])
+	if len(conns) == 0 {
+		delete(t.conns, host)
+	} else {
+		t.conns[host] = conns
+	}
+	return reserved
+}
+
+// connectAndTunnel runs the connect c and publishes its result to the
+// waiters before opening the tunnel to addr.
+func (t *h2Tunnels) connectAndTunnel(ctx context.Context, c *h2Connect, forward ContextDialer, tlsConfig *tls.Config, proxyURL *url.URL, addr string, header http.Header) (net.Conn, error) {
+	host := proxyURL.Host
+	pc, http1Conn, err := t.connect(ctx, forward, tlsConfig, proxyURL)
+
+	t.mu.Lock()
+	delete(t.dialing, host)
+	switch {
+	case err != nil:
+		c.err, c.canceled = err, ctx.Err() != nil
+	case http1Conn != nil:
+		if t.http1 == nil {
+			t.http1 = make(map[string]bool)
+		}
+		t.http1[host] = true
+	default:
+		if t.conns == nil {
+			t.conns = make(map[string][]*h2ProxyConn)
+		}
+		t.conns[host] = append(t.conns[host], pc)
+	}
+	t.mu.Unlock()
+	close(c.done)
+
+	if err != nil {
+		return nil, err
+	}
+	if http1Conn != nil {
+		return connectOver(ctx, http1Conn, tlsConfig, proxyURL, addr, header)
+	}
+	return pc.tunnel(ctx, proxyURL, addr, header)
+}
+
+// connect dials a new connection to the proxy, offering HTTP/2 with ALPN,
+// and reserves a stream of it for the first tunnel. If the proxy chose
+// HTTP/1.1 it returns the TLS connection instead, for one HTTP/1.1 CONNECT.
+func (t *h2Tunnels) connect(ctx context.Context, forward ContextDialer, tlsConfig *tls.Config, proxyURL *url.URL) (*h2ProxyConn, net.Conn, error) {
+	conn, err := forward.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConn := tls.Client(conn, proxyTLSConfig(tlsConfig, proxyURL, http2.NextProtoTLS, "http/1.1"))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		return nil, tlsConn, nil
+	}
+
+	t.mu.Lock()
+	if t.transport == nil {
+		t.transport = &http2.Transport{IdleConnTimeout: defaultIdleConnTimeout, ReadIdleTimeout: 30 * time.Second}
+	}
+	transport := t.transport
+	t.mu.Unlock()
+	cc, err := transport.NewClientConn(tlsConn)
+	if err != nil {
+		tlsConn.Close()
+		return nil, nil, err
+	}
+	if !cc.ReserveNewRequest() {
+		cc.Close()
+		return nil, nil, fmt.Errorf("proxy %s accepts no streams", proxyURL.Host)
+	}
+	return &h2ProxyConn{cc: cc, local: conn.LocalAddr(), remote: conn.RemoteAddr()}, nil, nil
+}
+
+// closeIdle closes the proxy connections without tunnels.
+func (t *h2Tunnels) closeIdle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for host, conns := range t.conns {
+		open := conns[:0]
+		for _, pc := range conns {
+			state := pc.cc.State()
+			if state.Closed || state.StreamsActive == 0 && state.StreamsReserved == 0 && state.StreamsPending == 0 {
+				pc.cc.Close()
+				continue
+			}
+			open = append(open, pc)
+		}
+		clear(conns[len(open):])
+		if len(open) == 0 {
+			delete(t.conns, host)
+		} else {
+			t.conns[host] = open
+		}
+	}
+}
+
+// tunnel sends CONNECT for addr as a new stream. The stream outlives ctx,
+// which only bounds the handshake, like dialConnect.
+func (pc *h2ProxyConn) tunnel(ctx context.Context, proxyURL *url.URL, addr string, header http.Header) (net.Conn, error) {
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	body, w := io.Pipe()
+	req := (&http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: header.Clone(),
+		Body:   body,
+	}).WithContext(streamCtx)
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	resp, err := pc.cc.RoundTrip(req)
+	if !stop() && err == nil {
+		resp.Body.Close()
+		err = ctx.Err()
+	}
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("proxy %s refused CONNECT: %s", proxyURL.Host, resp.Status)
+	}
+	if err != nil {
+		cancel()
+		w.Close()
+		return nil, err
+	}
+	return &h2Tunnel{r: resp.Body, w: w, cancel: cancel, local: pc.local, remote: pc.remote}, nil
+}
+
+// h2Tunnel is a CONNECT tunnel over an HTTP/2 stream. Its addresses are
+// those of the connection to the proxy.
+//
+// A stream cannot resume an interrupted read or write, so its deadlines
+// are timers that end it: an expired read deadline cancels the stream, an
+// expired write deadline closes the writing side. Reads and writes then
+// fail with os.ErrDeadlineExceeded, even if the deadline is extended.
+type h2Tunnel struct {
+	r             io.ReadCloser
+	w             *io.PipeWriter
+	cancel        context.CancelFunc
+	local, remote net.Addr
+
+	mu                        sync.Mutex
+	readTimer, writeTimer     *time.Timer
+	readExpired, writeExpired atomic.Bool
+}
+
+func (c *h2Tunnel) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && c.readExpired.Load() {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+func (c *h2Tunnel) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil && (c.writeExpired.Load() || c.readExpired.Load()) {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// CloseWrite ends the stream towards the destination, keeping it readable.
+func (c *h2Tunnel) CloseWrite() error { return c.w.Close() }
+
+func (c *h2Tunnel) Close() error {
+	c.mu.Lock()
+	stopTimer(c.readTimer)
+	stopTimer(c.writeTimer)
+	c.mu.Unlock()
+	c.w.Close()
+	c.r.Close()
+	c.cancel()
+	return nil
+}
+
+func (c *h2Tunnel) LocalAddr() net.Addr  { return c.local }
+func (c *h2Tunnel) RemoteAddr() net.Addr { return c.remote }
+
+func (c *h2Tunnel) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *h2Tunnel) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readTimer = deadlineTimer(c.readTimer, t, &c.readExpired, func() {
+		// Closing the body resets the stream and interrupts a blocked Read,
+		// which the transport does not watch the stream context for.
+		c.r.Close()
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *h2Tunnel) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeTimer = deadlineTimer(c.writeTimer, t, &c.writeExpired, func() {
+		c.w.CloseWithError(os.ErrDeadlineExceeded)
+	})
+	return nil
+}
+
+// deadlineTimer stops timer and returns one that sets expired and calls
+// expire at t, or nil for the zero t.
+func deadlineTimer(timer *time.Timer, t time.Time, expired *atomic.Bool, expire func()) *time.Timer {
+	stopTimer(timer)
+	if t.IsZero() {
+		return nil
+	}
+	return time.AfterFunc(time.Until(t), func() {
+		expired.Store(true)
+		expire()
+	})
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
@@ -0,0 +1,180 @@
+package pac
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailedProxyTimeout = 5 * time.Minute
+	defaultFailureThreshold   = 1
+)
+
+// breakerState is the circuit breaker state of a single proxy endpoint.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type proxyState struct {
+	failures  int
+	state     breakerState
+	openUntil time.Time
+	probeAt   time.Time
+}
+
+// proxyHealth keeps a circuit breaker per proxy endpoint, like the
+// "bad proxy" list browsers keep. After threshold consecutive failures the
+// breaker opens and the proxy is skipped for timeout. Afterwards a single
+// request may probe it (half-open); its result closes or re-opens the breaker.
+type proxyHealth struct {
+	mu        sync.Mutex
+	timeout   time.Duration
+	threshold int
+	now       func() time.Time
+	proxies   map[Proxy]*proxyState
+}
+
+func newProxyHealth(timeout time.Duration, threshold int) *proxyHealth {
+	return &proxyHealth{
+		timeout:   timeout,
+		threshold: threshold,
+		now:       time.Now,
+		proxies:   make(map[Proxy]*proxyState),
+	}
+}
+
+func (h *proxyHealth) reportFailure(p Proxy) bool {
+	if h.timeout <= 0 || p.Type == ProxyDirect {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.proxies[p]
+	if !ok {
+		st = &proxyState{}
+		h.proxies[p] = st
+	}
+	st.failures++
+	if st.state == breakerHalfOpen || st.failures >= h.threshold {
+		st.state = breakerOpen
+		st.openUntil = h.now().Add(h.timeout)
+		return true
+	}
+	return false
+}
+
+func (h *proxyHealth) reportSuccess(p Proxy) {
+	h.mu.Lock()
+	delete(h.proxies, p)
+	h.mu.Unlock()
+}
+
+// available reports whether p may be used now without changing its state.
+// It must be called with h.mu held.
+func (h *proxyHealth) available(p Proxy, now time.Time) bool {
+	st, ok := h.proxies[p]
+	if !ok {
+		return true
+	}
+	switch st.state {
+	case breakerOpen:
+		return !now.Before(st.openUntil)
+	case breakerHalfOpen:
+		// One probe at a time; allow another one if the result never came back.
+		return !now.Before(st.probeAt.Add(h.timeout))
+	default:
+		return true
+	}
+}
+
+// dialing records that a connection through p is about to be attempted. If p
+// was due for a probe, this attempt becomes the probe and the breaker goes
+// half-open until its result is reported.
+func (h *proxyHealth) dialing(p Proxy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st, ok := h.proxies[p]
+	if !ok || st.state == breakerClosed {
+		return
+	}
+	now := h.now()
+	if h.available(p, now) {
+		st.state = breakerHalfOpen
+		st.probeAt = now
+	}
+}
+
+// order moves proxies with an open breaker behind the available candidates,
+// keeping the relative order of both groups. It does not claim probes; that
+// happens in dialing, once a candidate is actually tried.
+func (h *proxyHealth) order(candidates []Proxy) []Proxy {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.proxies) == 0 {
+		return candidates
+	}
+
+	now := h.now()
+	healthy := make([]Proxy, 0, len(candidates))
+	var bad []Proxy
+	for _, c := range candidates {
+		if !h.available(c, now) {
+			bad = append(bad, c)
+			continue
+		}
+		healthy = append(healthy, c)
+	}
+	return append(healthy, bad...)
+}
+
+// ReportProxyFailure records that connecting through proxy failed.
+// After FailureThreshold consecutive failures the proxy is moved behind the
+// other candidates until FailedProxyTimeout elapses; then one request probes it.
+func (p *PACProxy) ReportProxyFailure(proxy Proxy) {
+	p.reportProxyFailure(context.Background(), proxy)
+}
+
+// reportProxyFailure is ReportProxyFailure logging with the context of the
+// failed connection.
+func (p *PACProxy) reportProxyFailure(ctx context.Context, proxy Proxy) {
+	if p.health.reportFailure(proxy) {
+		p.logf(ctx, LogWarn, "proxy marked as failed", "proxy", proxy.String())
+	}
+}
+
+// ReportProxySuccess records that connecting through proxy succeeded.
+func (p *PACProxy) ReportProxySuccess(proxy Proxy) {
+	p.health.reportSuccess(proxy)
+}
+
+// healthState is the breaker state of one proxy endpoint as reported by
+// the debug handler.
+type healthState struct {
+	State     string    `json:"state"`
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"open_until,omitzero"`
+}
+
+// snapshot returns the endpoints with failures; all others are healthy.
+func (h *proxyHealth) snapshot() map[Proxy]healthState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[Proxy]healthState, len(h.proxies))
+	for p, st := range h.proxies {
+		hs := healthState{State: "closed", Failures: st.failures}
+		switch st.state {
+		case breakerOpen:
+			hs.State, hs.OpenUntil = "open", st.openUntil
+		case breakerHalfOpen:
+			hs.State = "half-open"
+		}
+		out[p] = hs
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package pac_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestReportProxyFailure tests that ProxyFunc skips proxies that recently failed.
+func TestReportProxyFailure(t *testing.T) {
+	pacServer := newPACServer(t, "PROXY a.example.com:1; PROXY b.example.com:2")
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	proxy.ReportProxyFailure(pac.Proxy{Type: pac.ProxyHTTP, Host: "a.example.com:1"})
+	proxyURL, err := proxy.ProxyFunc()(req)
+	if err != nil {
+		t.Fatalf("Error finding proxy: %v", err)
+	}
+	if proxyURL.Host != "b.example.com:2" {
+		t.Fatalf("Expected failed proxy to be skipped, got %s", proxyURL.Host)
+	}
+
+	proxy.ReportProxySuccess(pac.Proxy{Type: pac.ProxyHTTP, Host: "a.example.com:1"})
+	proxyURL, err = proxy.ProxyFunc()(req)
+	if err != nil {
+		t.Fatalf("Error finding proxy: %v", err)
+	}
+	if proxyURL.Host != "a.example.com:1" {
+		t.Fatalf("Expected recovered proxy to be used, got %s", proxyURL.Host)
+	}
+}
+
+// TestProxyCircuitBreaker tests that a proxy is skipped after consecutive failures and probed after the cooldown.
+func TestProxyCircuitBreaker(t *testing.T) {
+	pacServer := newPACServer(t, "PROXY a.example.com:1; PROXY b.example.com:2")
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		FailedProxyTimeout: 50 * time.Millisecond,
+		FailureThreshold:   2,
+	})
+	targetURL, _ := url.Parse("http://example.com")
+	bad := pac.Proxy{Type: pac.ProxyHTTP, Host: "a.example.com:1"}
+
+	first := func() string {
+		t.Helper()
+		proxies, err := proxy.FindProxiesForURL(targetURL)
+		if err != nil {
+			t.Fatalf("Error finding proxies: %v", err)
+		}
+		return proxies[0].Host
+	}
+
+	proxy.ReportProxyFailure(bad)
+	if host := first(); host != bad.Host {
+		t.Fatalf("Expected %s below threshold, got %s", bad.Host, host)
+	}
+	proxy.ReportProxyFailure(bad)
+	if host := first(); host != "b.example.com:2" {
+		t.Fatalf("Expected open breaker to skip %s, got %s", bad.Host, host)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	for range 2 {
+		if host := first(); host != bad.Host {
+			t.Fatalf("Expected lookups to leave the probe of %s unclaimed, got %s", bad.Host, host)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	if proxyURL, err := proxy.ProxyFunc()(req); err != nil || proxyURL.Host != bad.Host {
+		t.Fatalf("Expected half-open probe of %s, got %v, %v", bad.Host, proxyURL, err)
+	}
+	if host := first(); host != "b.example.com:2" {
+		t.Fatalf("Expected only one probe of %s, got %s", bad.Host, host)
+	}
+
+	proxy.ReportProxySuccess(bad)
+	if host := first(); host != bad.Host {
+		t.Fatalf("Expected closed breaker for %s, got %s", bad.Host, host)
+	}
+}
+
+// TestProxyCircuitBreakerUndialedProbe tests that a recovered proxy behind a
+// working one keeps its probe when the Dialer never gets to it.
+func TestProxyCircuitBreakerUndialedProbe(t *testing.T) {
+	connectProxy := newConnectProxy(t, nil)
+	defer connectProxy.Close()
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+	proxyHost := strings.TrimPrefix(connectProxy.URL, "http://")
+	bad := pac.Proxy{Type: pac.ProxyHTTP, Host: "a.example.com:1"}
+
+	proxy := newTestPACProxy(t, "PROXY "+proxyHost+"; PROXY "+bad.Host+"; PROXY b.example.com:2", &pac.PACProxyConfig{
+		FailedProxyTimeout: 50 * time.Millisecond,
+	})
+
+	proxy.ReportProxyFailure(bad)
+	time.Sleep(60 * time.Millisecond)
+
+	conn, err := pac.NewDialer(proxy).DialContext(context.Background(), "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	conn.Close()
+
+	targetURL, _ := url.Parse("http://" + echoServer.Addr().String())
+	proxies, err := proxy.FindProxiesForURL(targetURL)
+	if err != nil {
+		t.Fatalf("Error finding proxies: %v", err)
+	}
+	if len(proxies) != 3 || proxies[1] != bad {
+		t.Fatalf("Expected %s to stay second with its probe unclaimed, got %v", bad.Host, proxies)
+	}
+}
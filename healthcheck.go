@@ -0,0 +1,126 @@
+package pac
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// HealthCheckFunc probes a proxy endpoint and returns an error if it is unusable.
+type HealthCheckFunc func(ctx context.Context, proxy Proxy) error
+
+// TCPHealthCheck returns a HealthCheckFunc that opens and closes a TCP
+// connection to the proxy.
+func TCPHealthCheck() HealthCheckFunc {
+	var d net.Dialer
+	return func(ctx context.Context, proxy Proxy) error {
+		conn, err := d.DialContext(ctx, "tcp", proxy.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// healthChecker periodically probes every proxy seen in a PAC result and
+// feeds the outcome into the circuit breakers of proxyHealth.
+type healthChecker struct {
+	interval time.Duration
+	timeout  time.Duration
+	check    HealthCheckFunc
+	health   *proxyHealth
+
+	mu   sync.Mutex
+	seen map[Proxy]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newHealthChecker(interval, timeout time.Duration, check HealthCheckFunc, health *proxyHealth) *healthChecker {
+	if check == nil {
+		check = TCPHealthCheck()
+	}
+	c := &healthChecker{
+		interval: interval,
+		timeout:  timeout,
+		check:    check,
+		health:   health,
+		seen:     make(map[Proxy]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// observe registers the proxies of a PAC result for probing.
+func (c *healthChecker) observe(candidates []Proxy) {
+	now := time.Now()
+	c.mu.Lock()
+	for _, p := range candidates {
+		if p.Type != ProxyDirect {
+			c.seen[p] = now
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *healthChecker) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.probeAll()
+		}
+	}
+}
+
+func (c *healthChecker) probeAll() {
+	// Forget proxies the PAC has not returned for a while.
+	expiry := time.Now().Add(-10 * c.interval)
+	c.mu.Lock()
+	proxies := make([]Proxy, 0, len(c.seen))
+	for p, last := range c.seen {
+		if last.Before(expiry) {
+			delete(c.seen, p)
+			continue
+		}
+		proxies = append(proxies, p)
+	}
+	c.mu.Unlock()
+
+	for _, p := range proxies {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		if err := c.probe(p); err != nil {
+			c.health.reportFailure(p)
+			continue
+		}
+		c.health.reportSuccess(p)
+	}
+}
+
+func (c *healthChecker) probe(p Proxy) error {
+	if c.timeout <= 0 {
+		return c.check(context.Background(), p)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.check(ctx, p)
+}
+
+func (c *healthChecker) close() {
+	close(c.stop)
+	<-c.done
+}
@@ -0,0 +1,43 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestHealthCheck tests that proxies failing active health checks are skipped.
+func TestHealthCheck(t *testing.T) {
+	pacServer := newPACServer(t, "PROXY a.example.com:1; PROXY b.example.com:2")
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		HealthCheckInterval: 10 * time.Millisecond,
+		HealthCheck: func(_ context.Context, p pac.Proxy) error {
+			if p.Host == "a.example.com:1" {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	})
+	targetURL, _ := url.Parse("http://example.com")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		proxies, err := proxy.FindProxiesForURL(targetURL)
+		if err != nil {
+			t.Fatalf("Error finding proxies: %v", err)
+		}
+		if proxies[0].Host == "b.example.com:2" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected unhealthy proxy to be skipped, got %v", proxies)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,68 @@
+package pac
+
+import (
+	"context"
+
+	"github.com/dop251/goja"
+)
+
+// HelperCall describes one call of a PAC helper such as dnsResolve or
+// isInNet. Args and Result hold the exported JavaScript values, usually
+// strings and bools.
+type HelperCall struct {
+	Name   string
+	Args   []any
+	Result any
+	// Line is the line of the call in the PAC script, 0 if unknown.
+	Line int
+}
+
+type helperTraceKey struct{}
+
+// WithHelperTrace returns a context that makes the lookups evaluated with it
+// report every PAC helper call to fn, in order, e.g. to debug a PAC script.
+// Lookups answered without evaluating the script, from overrides, the bypass
+// list or the decision cache, report nothing. Scripts run by
+// EvaluatorCommand or EvaluatorWASM are not traced.
+func WithHelperTrace(ctx context.Context, fn func(HelperCall)) context.Context {
+	return context.WithValue(ctx, helperTraceKey{}, fn)
+}
+
+// helperTraced reports whether ctx has a WithHelperTrace function. Traced
+// lookups bypass the native matcher, which does not report helper calls.
+func helperTraced(ctx context.Context) bool {
+	_, ok := ctx.Value(helperTraceKey{}).(func(HelperCall))
+	return ok
+}
+
+// traced wraps the helper fn so that it reports its calls to the
+// WithHelperTrace function of the current evaluation, if any.
+func (r *GojaRuntime) traced(name string, fn func(goja.FunctionCall) goja.Value) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		result := fn(call)
+		if r.evalCtx == nil {
+			return result
+		}
+		trace, ok := r.evalCtx.Value(helperTraceKey{}).(func(HelperCall))
+		if !ok {
+			return result
+		}
+		args := make([]any, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			args[i] = arg.Export()
+		}
+		trace(HelperCall{Name: name, Args: args, Result: result.Export(), Line: r.callerLine()})
+		return result
+	}
+}
+
+// callerLine returns the script line of the JavaScript code calling the
+// current native function.
+func (r *GojaRuntime) callerLine() int {
+	for _, frame := range r.CaptureCallStack(2, nil) {
+		if line := frame.Position().Line; line > 0 {
+			return line
+		}
+	}
+	return 0
+}
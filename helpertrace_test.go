@@ -0,0 +1,34 @@
+package pac_test
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestWithHelperTrace tests that helper calls are reported to the trace.
+func TestWithHelperTrace(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (isPlainHostName(host) || shExpMatch(host, "*.corp.example.com")) { return "DIRECT"; }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+
+	var calls []pac.HelperCall
+	ctx := pac.WithHelperTrace(context.Background(), func(call pac.HelperCall) { calls = append(calls, call) })
+	targetURL, _ := url.Parse("http://example.com")
+	if _, err := proxy.FindProxyStringForURLContext(ctx, targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	want := []pac.HelperCall{
+		{Name: "isPlainHostName", Args: []any{"example.com"}, Result: false, Line: 2},
+		{Name: "shExpMatch", Args: []any{"example.com", "*.corp.example.com"}, Result: false, Line: 2},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("Expected %+v, got %+v", want, calls)
+	}
+}
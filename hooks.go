@@ -0,0 +1,62 @@
+package pac
+
+import (
+	"context"
+	"time"
+)
+
+// FetchEvent describes a download of the PAC script, passed to
+// PACProxyConfig.OnFetch.
+type FetchEvent struct {
+	URL string
+	// StatusCode is 0 if no response was received.
+	StatusCode int
+	Bytes      int
+	Duration   time.Duration
+	Err        error
+}
+
+// EvalEvent describes a lookup of FindProxyStringForURL and the methods
+// built on it, passed to PACProxyConfig.OnEval.
+type EvalEvent struct {
+	Scheme   string
+	Host     string
+	Result   ProxyString
+	Duration time.Duration
+	// CacheHit reports whether the result came from the decision cache.
+	CacheHit bool
+	Err      error
+}
+
+// ErrorEvent describes a failed operation, passed to PACProxyConfig.OnError.
+// Op is one of "fetch", "verify", "compile", "validate", "evaluate", "dial"
+// and "audit".
+type ErrorEvent struct {
+	Op  string
+	Err error
+}
+
+func (p *PACProxy) emitFetch(ctx context.Context, e FetchEvent) {
+	if p.onFetch != nil {
+		p.onFetch(ctx, e)
+	}
+	if e.Err != nil {
+		p.emitError(ctx, "fetch", e.Err)
+	}
+}
+
+func (p *PACProxy) emitEval(ctx context.Context, e EvalEvent) {
+	p.recent.record(e)
+	if p.onEval != nil {
+		p.onEval(ctx, e)
+	}
+	if e.Err != nil {
+		p.emitError(ctx, "evaluate", e.Err)
+	}
+}
+
+func (p *PACProxy) emitError(ctx context.Context, op string, err error) {
+	if p.onError != nil {
+		p.onError(ctx, ErrorEvent{Op: op, Err: err})
+	}
+}
@@ -0,0 +1,69 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestLifecycleHooks tests that OnFetch, OnEval and OnError are called.
+func TestLifecycleHooks(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "bad.example.com") { throw new Error("boom"); }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+
+	var (
+		mu      sync.Mutex
+		fetches []pac.FetchEvent
+		evals   []pac.EvalEvent
+		errs    []pac.ErrorEvent
+	)
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		DecisionCacheTTL: time.Minute,
+		OnFetch: func(_ context.Context, e pac.FetchEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetches = append(fetches, e)
+		},
+		OnEval: func(_ context.Context, e pac.EvalEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			evals = append(evals, e)
+		},
+		OnError: func(_ context.Context, e pac.ErrorEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, e)
+		},
+	})
+	for _, target := range []string{"http://example.com", "http://example.com", "http://bad.example.com"} {
+		targetURL, _ := url.Parse(target)
+		_, _ = proxy.FindProxyStringForURL(targetURL)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(fetches) != 1 || fetches[0].StatusCode != http.StatusOK || fetches[0].Bytes == 0 || fetches[0].Err != nil {
+		t.Fatalf("Unexpected fetch events: %+v", fetches)
+	}
+	if len(evals) != 3 {
+		t.Fatalf("Expected 3 evaluation events, got %+v", evals)
+	}
+	if evals[0].Host != "example.com" || evals[0].Result != "PROXY proxy.example.com:3128" || evals[0].CacheHit || !evals[1].CacheHit {
+		t.Fatalf("Unexpected evaluation events: %+v", evals)
+	}
+	if !errors.Is(evals[2].Err, pac.ErrEvaluatePAC) {
+		t.Fatalf("Expected ErrEvaluatePAC for bad.example.com, got %v", evals[2].Err)
+	}
+	if len(errs) != 1 || errs[0].Op != "evaluate" || !errors.Is(errs[0].Err, pac.ErrEvaluatePAC) {
+		t.Fatalf("Unexpected error events: %+v", errs)
+	}
+}
@@ -0,0 +1,62 @@
+package pac
+
+import (
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Precedence decides whether environment proxy settings or the PAC win in
+// CombinedProxyFunc.
+type Precedence int
+
+const (
+	// PreferEnv behaves like curl: hosts matching NO_PROXY go DIRECT, a proxy
+	// configured for the request's scheme is used as is and only the remaining
+	// requests consult the PAC.
+	PreferEnv Precedence = iota
+	// PreferPAC uses the PAC result and falls back to the environment
+	// settings when the PAC is unavailable or fails to evaluate.
+	PreferPAC
+)
+
+// CombinedProxyFunc merges HTTP_PROXY/HTTPS_PROXY/NO_PROXY style settings with
+// PAC results into one function usable as http.Transport.Proxy.
+// A nil env reads the environment via httpproxy.FromEnvironment; a nil p
+// uses the environment settings only.
+func CombinedProxyFunc(p *PACProxy, env *httpproxy.Config, precedence Precedence) func(*http.Request) (*url.URL, error) {
+	if env == nil {
+		env = httpproxy.FromEnvironment()
+	}
+	envProxy := env.ProxyFunc()
+
+	// probe has a proxy for every scheme so that a nil result can only mean
+	// the host is excluded by NO_PROXY.
+	probe := *env
+	probe.HTTPProxy, probe.HTTPSProxy = "probe.invalid:1", "probe.invalid:1"
+	bypassed := probe.ProxyFunc()
+
+	var pacProxy func(*http.Request) (*url.URL, error)
+	if p != nil {
+		pacProxy = p.ProxyFunc()
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if precedence == PreferPAC && pacProxy != nil {
+			if proxyURL, err := pacProxy(req); err == nil {
+				return proxyURL, nil
+			}
+			return envProxy(req.URL)
+		}
+
+		if u, err := bypassed(req.URL); err == nil && u == nil {
+			return nil, nil
+		}
+		proxyURL, err := envProxy(req.URL)
+		if err != nil || proxyURL != nil || pacProxy == nil {
+			return proxyURL, err
+		}
+		return pacProxy(req)
+	}
+}
@@ -0,0 +1,41 @@
+package pac
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ErrInsecurePACURL is returned in HTTPSOnly mode when the PAC URL, a
+// redirect target or the signature URL is not an https URL, and by
+// GetSecurePACURL when the OS hands out such a URL. Plain http to loopback
+// hosts is allowed.
+var ErrInsecurePACURL = errors.New("PAC URL is not https")
+
+// IsSecurePACURL reports whether u is an https URL or a plain http URL of a
+// loopback host, which never leaves the machine.
+func IsSecurePACURL(u *url.URL) bool {
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		if strings.EqualFold(host, "localhost") {
+			return true
+		}
+		addr, err := netip.ParseAddr(host)
+		return err == nil && addr.Unmap().IsLoopback()
+	}
+	return false
+}
+
+// checkSecureURL reports ErrInsecurePACURL if httpsOnly is set and u is not
+// secure.
+func checkSecureURL(u *url.URL, httpsOnly bool) error {
+	if httpsOnly && !IsSecurePACURL(u) {
+		return fmt.Errorf("%w: %s", ErrInsecurePACURL, u.Scheme+"://"+u.Host)
+	}
+	return nil
+}
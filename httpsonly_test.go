@@ -0,0 +1,43 @@
+package pac_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestHTTPSOnly tests that HTTPSOnly refuses plain HTTP PAC URLs and redirects
+// except to loopback hosts, and that GetSecurePACURL flags them.
+func TestHTTPSOnly(t *testing.T) {
+	local := newPACServer(t, "DIRECT")
+	defer local.Close()
+	localURL, _ := url.Parse(local.URL)
+	proxy, err := pac.NewPACProxy(localURL, &pac.PACProxyConfig{HTTPSOnly: true})
+	if err != nil {
+		t.Fatalf("Expected loopback HTTP to be allowed, got %v", err)
+	}
+	proxy.Close()
+
+	insecureURL, _ := url.Parse("http://wpad.example.com/wpad.dat")
+	if _, err := pac.NewPACProxy(insecureURL, &pac.PACProxyConfig{HTTPSOnly: true}); !errors.Is(err, pac.ErrInsecurePACURL) {
+		t.Fatalf("Expected ErrInsecurePACURL, got %v", err)
+	}
+
+	redirect := httptest.NewTLSServer(http.RedirectHandler(insecureURL.String(), http.StatusFound))
+	defer redirect.Close()
+	redirectURL, _ := url.Parse(redirect.URL)
+	if _, err := pac.NewPACProxy(redirectURL, &pac.PACProxyConfig{Client: redirect.Client(), HTTPSOnly: true}); !errors.Is(err, pac.ErrInsecurePACURL) {
+		t.Fatalf("Expected ErrInsecurePACURL for an HTTP redirect, got %v", err)
+	}
+
+	pac.SetTestPACURL(insecureURL.String())
+	defer pac.SetTestPACURL("")
+	got, err := pac.GetSecurePACURL()
+	if !errors.Is(err, pac.ErrInsecurePACURL) || got == nil || got.String() != insecureURL.String() {
+		t.Fatalf("Expected the insecure URL flagged with ErrInsecurePACURL, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,9 @@
+package pac
+
+// interfaceSettings are the PAC settings of one network interface.
+type interfaceSettings struct {
+	// pacURL is the PAC URL of the interface, empty if it has none.
+	pacURL string
+	// domains are the DNS search domains of the interface.
+	domains []string
+}
@@ -0,0 +1,132 @@
+//go:build !gopac_testhooks && darwin
+// +build !gopac_testhooks,darwin
+
+package pac
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// retrieveInterfaceSettings reads the PAC URL and search domains of the
+// network service bound to the interface name, e.g. en0 or a utun VPN
+// tunnel, from the SystemConfiguration dynamic store using scutil.
+func retrieveInterfaceSettings(name string) (interfaceSettings, error) {
+	out, err := runScutil("list State:/Network/Service/[^/]+/IPv4\nlist State:/Network/Service/[^/]+/IPv6\n")
+	if err != nil {
+		return interfaceSettings{}, err
+	}
+	var keys []string
+	for _, line := range strings.Split(out, "\n") {
+		if _, key, ok := strings.Cut(line, " = "); ok && strings.HasPrefix(line, "  subKey") {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+	}
+	dicts, err := scutilShow(keys...)
+	if err != nil {
+		return interfaceSettings{}, err
+	}
+	service := ""
+	for i, dict := range dicts {
+		if dict != nil && first(dict["InterfaceName"]) == name {
+			service = strings.TrimSuffix(strings.TrimSuffix(keys[i], "/IPv4"), "/IPv6")
+			break
+		}
+	}
+	if service == "" {
+		return interfaceSettings{}, fmt.Errorf("%w: no network service on interface %s", ErrPACURLNotFound, name)
+	}
+
+	// VPN clients publish their settings in the State: keys; the Setup:
+	// keys hold those configured in System Settings.
+	setup := "Setup:" + strings.TrimPrefix(service, "State:")
+	dicts, err = scutilShow(service+"/Proxies", setup+"/Proxies", service+"/DNS")
+	if err != nil {
+		return interfaceSettings{}, err
+	}
+	var s interfaceSettings
+	for _, proxies := range dicts[:2] {
+		if proxies != nil && first(proxies["ProxyAutoConfigEnable"]) == "1" {
+			s.pacURL = first(proxies["ProxyAutoConfigURLString"])
+			break
+		}
+	}
+	if dns := dicts[2]; dns != nil {
+		s.domains = append(dns["DomainName"], dns["SearchDomains"]...)
+	}
+	return s, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// runScutil runs scutil with the commands in input.
+func runScutil(input string) (string, error) {
+	cmd := exec.Command("scutil")
+	cmd.Stdin = strings.NewReader(input)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run scutil command: %w", err)
+	}
+	return out.String(), nil
+}
+
+// scutilShow returns the dictionaries of keys, nil for missing keys. The
+// values of a dictionary are keyed by name; arrays keep all their elements.
+func scutilShow(keys ...string) ([]map[string][]string, error) {
+	var input strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&input, "show %s\n", key)
+	}
+	out, err := runScutil(input.String())
+	if err != nil {
+		return nil, err
+	}
+	var dicts []map[string][]string
+	var dict map[string][]string
+	var array string
+	depth := 0
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case depth == 0 && strings.HasPrefix(line, "No such key"):
+			dicts = append(dicts, nil)
+		case depth == 0 && strings.HasSuffix(line, "{"):
+			dict = make(map[string][]string)
+			depth = 1
+		case line == "}":
+			depth--
+			array = ""
+			if depth == 0 {
+				dicts = append(dicts, dict)
+			}
+		default:
+			key, value, ok := strings.Cut(line, " : ")
+			if !ok || depth == 0 {
+				continue
+			}
+			switch {
+			case strings.HasSuffix(value, "{"):
+				depth++
+				if depth == 2 {
+					array = key
+				}
+			case depth == 1:
+				dict[key] = []string{value}
+			case depth == 2 && array != "":
+				dict[array] = append(dict[array], value)
+			}
+		}
+	}
+	if len(dicts) != len(keys) {
+		return nil, fmt.Errorf("failed to parse scutil output: got %d of %d keys", len(dicts), len(keys))
+	}
+	return dicts, nil
+}
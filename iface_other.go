@@ -0,0 +1,12 @@
+//go:build !gopac_testhooks && !darwin
+// +build !gopac_testhooks,!darwin
+
+package pac
+
+import "fmt"
+
+// retrieveInterfaceSettings reports ErrPACURLNotFound on platforms without
+// per-interface proxy settings.
+func retrieveInterfaceSettings(name string) (interfaceSettings, error) {
+	return interfaceSettings{}, fmt.Errorf("%w: per-interface PAC URLs are not supported on this platform", ErrPACURLNotFound)
+}
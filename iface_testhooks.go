@@ -0,0 +1,37 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	testInterfaces   = make(map[string]interfaceSettings)
+	testInterfacesMu sync.RWMutex
+)
+
+// SetTestInterface sets the PAC URL and search domains of the interface
+// name for DetectOptions.Interface in tests. Pass an empty pacURL and no
+// domains to remove it.
+func SetTestInterface(name, pacURL string, domains ...string) {
+	testInterfacesMu.Lock()
+	defer testInterfacesMu.Unlock()
+	if pacURL == "" && len(domains) == 0 {
+		delete(testInterfaces, name)
+		return
+	}
+	testInterfaces[name] = interfaceSettings{pacURL: pacURL, domains: domains}
+}
+
+func retrieveInterfaceSettings(name string) (interfaceSettings, error) {
+	testInterfacesMu.RLock()
+	s, ok := testInterfaces[name]
+	testInterfacesMu.RUnlock()
+	if !ok {
+		return interfaceSettings{}, fmt.Errorf("%w: no network service on interface %s", ErrPACURLNotFound, name)
+	}
+	return s, nil
+}
@@ -0,0 +1,66 @@
+package pac
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrDefaultTransport is returned when http.DefaultTransport is not an
+// *http.Transport and therefore has no Proxy field to install into.
+var ErrDefaultTransport = errors.New("http.DefaultTransport is not an *http.Transport")
+
+// installMu serializes installs and restores of http.DefaultTransport.
+var installMu sync.Mutex
+
+// InstallDefaultTransport sets the Proxy of http.DefaultTransport to
+// p.ProxyFunc(), so http.DefaultClient and http.Get use the PAC. The returned
+// function restores the previous Proxy. Call both before and after issuing
+// requests through the default transport, not concurrently with them.
+func InstallDefaultTransport(p *PACProxy) (restore func(), err error) {
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	tr, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, ErrDefaultTransport
+	}
+	previous := tr.Proxy
+	tr.Proxy = p.ProxyFunc()
+	tr.CloseIdleConnections()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			installMu.Lock()
+			defer installMu.Unlock()
+			tr.Proxy = previous
+			tr.CloseIdleConnections()
+		})
+	}, nil
+}
+
+// InstallSystemPAC detects the system PAC URL, builds a PACProxy with cfg and
+// installs it onto http.DefaultTransport, making the process resolve proxies
+// like the browser does. The returned function restores the previous Proxy
+// and closes the PACProxy.
+func InstallSystemPAC(cfg *PACProxyConfig) (restore func(), err error) {
+	pacURL, err := GetPACURL()
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPACProxy(pacURL, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PAC proxy: %w", err)
+	}
+	restoreTransport, err := InstallDefaultTransport(p)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return func() {
+		restoreTransport()
+		p.Close()
+	}, nil
+}
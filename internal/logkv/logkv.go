@@ -0,0 +1,40 @@
+// Package logkv converts the key/value arguments passed to pac.Logger.
+package logkv
+
+import "fmt"
+
+// BadKey is used for values without a string key, as log/slog does.
+const BadKey = "!BADKEY"
+
+// Each calls fn for every key/value pair in args. Non-string keys and a
+// trailing value without a key are reported under BadKey.
+func Each(args []any, fn func(key string, value any)) {
+	for i := 0; i < len(args); i++ {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			fn(BadKey, args[i])
+			continue
+		}
+		fn(key, args[i+1])
+		i++
+	}
+}
+
+// Error returns the first error value in args, e.g. the "err" attribute.
+func Error(args []any) error {
+	var found error
+	Each(args, func(_ string, value any) {
+		if err, ok := value.(error); ok && found == nil {
+			found = err
+		}
+	})
+	return found
+}
+
+// String formats a value for loggers that only accept strings.
+func String(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,430 @@
+package pac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ErrEvaluatorProcess is returned when the isolated evaluator configured
+// with PACProxyConfig.EvaluatorCommand or EvaluatorWASM cannot be started or
+// dies.
+var ErrEvaluatorProcess = errors.New("PAC evaluator process failed")
+
+// evaluatorMessage is exchanged as one JSON line over the stdio of the
+// evaluator process. The parent sends "compile" and "eval" requests and
+// answers "lookup" requests the evaluator makes while running the script;
+// the evaluator finishes each request with a "result".
+type evaluatorMessage struct {
+	Op          string   `json:"op"`
+	Source      string   `json:"source,omitempty"`
+	Sandbox     bool     `json:"sandbox,omitempty"`
+	Compat      int      `json:"compat,omitempty"`
+	Extensions  bool     `json:"extensions,omitempty"`
+	MemoryLimit int64    `json:"memory_limit,omitempty"`
+	EntryPoints []string `json:"entry_points,omitempty"`
+	EntryPoint  string   `json:"entry_point,omitempty"`
+	ClientVar   string   `json:"client_var,omitempty"`
+	ClientArg   bool     `json:"client_arg,omitempty"`
+	ClientIP    string   `json:"client_ip,omitempty"`
+	Now         int64    `json:"now,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Host        string   `json:"host,omitempty"`
+	Addrs       []string `json:"addrs,omitempty"`
+	// Kind is the type of an evaluation result: "string", "null",
+	// "undefined" or "other".
+	Kind    string `json:"kind,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Defined bool   `json:"defined,omitempty"`
+	Lookups int    `json:"lookups,omitempty"`
+	// Code classifies Err: "compile", "evaluate" or "memory". Line and
+	// Column locate it in the script, if known.
+	Code   string `json:"code,omitempty"`
+	Err    string `json:"err,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// ServeEvaluator runs the evaluator side of PACProxyConfig.EvaluatorCommand:
+// it compiles and evaluates PAC scripts as requested on in and answers on
+// out, usually os.Stdin and os.Stdout. DNS lookups of the PAC helpers are
+// forwarded to the parent, so its DNSFilter, DNSCache and AuditDNS apply.
+// ServeEvaluator returns nil once in is closed.
+func ServeEvaluator(in io.Reader, out io.Writer) error {
+	s := &evaluatorServer{dec: json.NewDecoder(in), enc: json.NewEncoder(out)}
+	for {
+		var req evaluatorMessage
+		if err := s.dec.Decode(&req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var resp evaluatorMessage
+		switch req.Op {
+		case "compile":
+			resp = s.compile(req)
+		case "eval":
+			resp = s.eval(req)
+		default:
+			resp = evaluatorMessage{Code: "evaluate", Err: "unknown op " + req.Op}
+		}
+		resp.Op = "result"
+		if err := s.enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+type evaluatorServer struct {
+	dec         *json.Decoder
+	enc         *json.Encoder
+	vm          *GojaRuntime
+	memoryLimit int64
+	allocs      allocationGuard
+	entryPoints []string
+	clientVar   string
+	clientArg   bool
+}
+
+func (s *evaluatorServer) compile(req evaluatorMessage) evaluatorMessage {
+	vm := NewGojaRuntimeWithOptions(GojaRuntimeOptions{CompatMode: CompatMode(req.Compat), ExtensionHelpers: req.Extensions})
+	vm.resolve = s.lookup
+	err := vm.DefinePACFunctions()
+	if err == nil && req.Sandbox {
+		err = vm.Sandbox()
+	}
+	if err == nil {
+		_, err = vm.RunString(req.Source)
+	}
+	if err != nil {
+		loadErr := newLoadError(req.Source, err)
+		return evaluatorMessage{Code: "compile", Err: err.Error(), Line: loadErr.Line, Column: loadErr.Column}
+	}
+	s.vm = vm
+	s.memoryLimit = req.MemoryLimit
+	s.entryPoints = entryPoints(req.EntryPoints)
+	s.clientVar, s.clientArg = req.ClientVar, req.ClientArg
+	entry, _ := entryPoint(vm, s.entryPoints)
+	return evaluatorMessage{Defined: entry != "", EntryPoint: entry}
+}
+
+func (s *evaluatorServer) eval(req evaluatorMessage) evaluatorMessage {
+	if s.vm == nil {
+		return evaluatorMessage{Code: "evaluate", Err: "no script compiled"}
+	}
+	_, fn := entryPoint(s.vm, s.entryPoints)
+	if fn == nil {
+		return evaluatorMessage{Code: "evaluate", Err: undefinedEntryPoint(s.entryPoints)}
+	}
+
+	s.vm.dnsLookups = 0
+	stop := func() {}
+	if s.memoryLimit > 0 {
+		vm := s.vm
+		stop = s.allocs.watch(s.memoryLimit, func() { vm.Interrupt(ErrPACMemoryLimit) })
+	}
+	if req.Now != 0 {
+		s.vm.evalCtx = withEvalTime(context.Background(), time.Unix(0, req.Now))
+		defer func() { s.vm.evalCtx = nil }()
+	}
+	args, err := passClientIP(s.vm, s.clientVar, s.clientArg, req.ClientIP, []goja.Value{s.vm.ToValue(req.URL), s.vm.ToValue(req.Host)})
+	var value goja.Value
+	if err == nil {
+		value, err = fn(goja.Undefined(), args...)
+	}
+	stop()
+	s.vm.ClearInterrupt()
+
+	resp := evaluatorMessage{Lookups: s.vm.dnsLookups}
+	var interrupted *goja.InterruptedError
+	switch {
+	case errors.As(err, &interrupted) && interrupted.Value() == ErrPACMemoryLimit:
+		resp.Code, resp.Err = "memory", err.Error()
+	case err != nil:
+		resp.Code, resp.Err = "evaluate", err.Error()
+		resp.Line, resp.Column = jsPosition(err)
+	case goja.IsUndefined(value):
+		resp.Kind = "undefined"
+	case goja.IsNull(value):
+		resp.Kind = "null"
+	default:
+		if str, ok := value.Export().(string); ok {
+			resp.Kind, resp.Value = "string", str
+		} else {
+			resp.Kind = "other"
+		}
+	}
+	return resp
+}
+
+// lookup asks the parent to resolve host.
+func (s *evaluatorServer) lookup(host string) ([]string, error) {
+	if err := s.enc.Encode(evaluatorMessage{Op: "lookup", Host: host}); err != nil {
+		return nil, err
+	}
+	var resp evaluatorMessage
+	if err := s.dec.Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Err != "" {
+		return nil, errors.New(resp.Err)
+	}
+	return resp.Addrs, nil
+}
+
+// evaluatorProcess is a running evaluator, an OS process or a WASM
+// instance, serving ServeEvaluator on its stdio.
+type evaluatorProcess struct {
+	stdin  io.WriteCloser
+	stdout io.Reader
+	// kill stops the evaluator, wait returns once it is gone.
+	kill func()
+	wait func()
+}
+
+// execEvaluator returns a launcher running command as an OS process.
+func execEvaluator(command []string) func() (*evaluatorProcess, error) {
+	return func() (*evaluatorProcess, error) {
+		cmd := exec.Command(command[0], command[1:]...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &evaluatorProcess{
+			stdin:  stdin,
+			stdout: stdout,
+			kill:   func() { _ = cmd.Process.Kill() },
+			wait:   func() { _ = cmd.Wait() },
+		}, nil
+	}
+}
+
+// isolatedVM runs a PAC script in an evaluator. The evaluator is started on
+// demand and restarted, recompiling the script, after it was killed on a
+// timeout or died. Its fields are guarded by pacScript.mu.
+type isolatedVM struct {
+	launch      func() (*evaluatorProcess, error)
+	source      string
+	sandbox     bool
+	compat      CompatMode
+	extensions  bool
+	memoryLimit int64
+	entryPoints []string
+	clientVar   string
+	clientArg   bool
+	timeout     time.Duration
+	lookup      func(ctx context.Context, host string) ([]string, error)
+
+	proc *evaluatorProcess
+	enc  *json.Encoder
+	dec  *json.Decoder
+	// entry is the entry point the evaluator found, "" if none.
+	entry string
+	// retired is set once the script was replaced or the PACProxy closed;
+	// late evaluations then stop the process when they are done.
+	retired bool
+	// conv creates the goja values handed back to evaluate.
+	conv *goja.Runtime
+}
+
+// start launches the evaluator and compiles the script in it.
+func (v *isolatedVM) start(ctx context.Context) error {
+	proc, err := v.launch()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEvaluatorProcess, err)
+	}
+	v.proc, v.enc, v.dec = proc, json.NewEncoder(proc.stdin), json.NewDecoder(proc.stdout)
+
+	resp, err := v.roundTrip(ctx, evaluatorMessage{Op: "compile", Source: v.source, Sandbox: v.sandbox, Compat: int(v.compat), Extensions: v.extensions, MemoryLimit: v.memoryLimit, EntryPoints: v.entryPoints, ClientVar: v.clientVar, ClientArg: v.clientArg})
+	if err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		v.stop()
+		return &EvalError{Load: true, Line: resp.Line, Column: resp.Column, Err: errors.New(resp.Err)}
+	}
+	v.entry = resp.EntryPoint
+	if v.entry == "" && resp.Defined {
+		// An evaluator that predates EntryPoints.
+		v.entry = defaultEntryPoint
+	}
+	return nil
+}
+
+// eval calls FindProxyForURL in the evaluator process. at, if not zero,
+// replaces the current time.
+func (v *isolatedVM) eval(ctx context.Context, targetURL, host, client string, at time.Time) (goja.Value, int, error) {
+	if v.proc == nil {
+		if err := v.start(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+	if v.retired {
+		defer v.stop()
+	}
+	req := evaluatorMessage{Op: "eval", URL: targetURL, Host: host, ClientIP: client}
+	if !at.IsZero() {
+		req.Now = at.UnixNano()
+	}
+	resp, err := v.roundTrip(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case resp.Code == "memory":
+		return nil, resp.Lookups, ErrPACMemoryLimit
+	case resp.Err != "":
+		return nil, resp.Lookups, &EvalError{Line: resp.Line, Column: resp.Column, Err: errors.New(resp.Err)}
+	}
+	if v.conv == nil {
+		v.conv = goja.New()
+	}
+	switch resp.Kind {
+	case "undefined":
+		return goja.Undefined(), resp.Lookups, nil
+	case "null":
+		return goja.Null(), resp.Lookups, nil
+	case "string":
+		return v.conv.ToValue(resp.Value), resp.Lookups, nil
+	default:
+		return v.conv.ToValue(struct{}{}), resp.Lookups, nil
+	}
+}
+
+// roundTrip sends req and answers the evaluator's DNS lookups until it
+// returns a result. On a timeout, a done ctx or a broken pipe the process
+// is killed and will be restarted by the next evaluation.
+func (v *isolatedVM) roundTrip(ctx context.Context, req evaluatorMessage) (evaluatorMessage, error) {
+	reason := make(chan error, 1)
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		var timeout <-chan time.Time
+		if v.timeout > 0 {
+			timer := time.NewTimer(v.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+			reason <- ErrPACScriptTimeout
+		case <-ctx.Done():
+			reason <- ctx.Err()
+		case <-done:
+			return
+		}
+		v.proc.kill()
+	}()
+
+	resp, err := v.exchange(ctx, req)
+	close(done)
+	<-watched
+	select {
+	case r := <-reason:
+		v.stop()
+		return evaluatorMessage{}, r
+	default:
+	}
+	if err != nil {
+		v.stop()
+		return evaluatorMessage{}, fmt.Errorf("%w: %v", ErrEvaluatorProcess, err)
+	}
+	return resp, nil
+}
+
+func (v *isolatedVM) exchange(ctx context.Context, req evaluatorMessage) (evaluatorMessage, error) {
+	if err := v.enc.Encode(req); err != nil {
+		return evaluatorMessage{}, err
+	}
+	for {
+		var msg evaluatorMessage
+		if err := v.dec.Decode(&msg); err != nil {
+			return evaluatorMessage{}, err
+		}
+		if msg.Op != "lookup" {
+			return msg, nil
+		}
+		answer := evaluatorMessage{Op: "lookup"}
+		addrs, err := v.lookup(ctx, msg.Host)
+		if err != nil {
+			answer.Err = err.Error()
+		}
+		answer.Addrs = addrs
+		if err := v.enc.Encode(answer); err != nil {
+			return evaluatorMessage{}, err
+		}
+	}
+}
+
+// stop kills the evaluator, if running.
+func (v *isolatedVM) stop() {
+	if v.proc == nil {
+		return
+	}
+	v.proc.kill()
+	v.proc.wait()
+	v.proc, v.enc, v.dec = nil, nil, nil
+}
+
+// helperLookup resolves a PAC helper lookup for an evaluator process like
+// GojaRuntime does for in-process scripts.
+func (p *PACProxy) helperLookup(ctx context.Context, host string) ([]string, error) {
+	if !p.allowDNSLookup(ctx, host) {
+		return nil, errDNSLookupDenied
+	}
+	return p.dnsCache.lookup(host, func(host string) ([]string, error) {
+		return resolveHost(ctx, p.resolver, host, p.dnsTimeout)
+	})
+}
+
+// evalIsolated evaluates targetURL in the script's evaluator process.
+func (p *PACProxy) evalIsolated(ctx context.Context, script *pacScript, targetURL *url.URL) (goja.Value, int, error) {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	urlArg, hostArg := p.compat.scriptArgs(targetURL)
+	at, _ := ctx.Value(evalTimeKey{}).(time.Time)
+	return script.isolated.eval(ctx, urlArg, hostArg, p.clientIP(ctx), at)
+}
+
+// release frees the runtime of the script once running evaluations are
+// done, for Close; later in-process evaluations return ErrClosed.
+func (s *pacScript) release() {
+	if s == nil {
+		return
+	}
+	s.close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vm = nil
+}
+
+// close stops the evaluator process of an isolated script once running
+// evaluations are done; later evaluations use a short-lived process.
+func (s *pacScript) close() {
+	if s == nil || s.isolated == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isolated.retired = true
+	s.isolated.stop()
+}
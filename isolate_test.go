@@ -0,0 +1,58 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestEvaluatorHelperProcess is not a real test: TestEvaluatorCommand runs
+// the test binary with it as the evaluator process.
+func TestEvaluatorHelperProcess(t *testing.T) {
+	if !slices.Contains(os.Args, "pac-evaluator") {
+		t.Skip("evaluator process for TestEvaluatorCommand")
+	}
+	if err := pac.ServeEvaluator(os.Stdin, os.Stdout); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// TestEvaluatorCommand tests evaluating the PAC script in a separate process.
+func TestEvaluatorCommand(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "loop.example.com") { while (true) {} }
+		if (host == "dns.example.com") { return "PROXY " + isResolvable("localhost") + "-" + isResolvable("blocked.invalid") + ":1"; }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		EvaluatorCommand: []string{os.Args[0], "-test.run=^TestEvaluatorHelperProcess$", "--", "pac-evaluator"},
+		ScriptTimeout:    time.Second,
+		DNSFilter:        pac.DenyDNS(".invalid"),
+	})
+
+	for _, tc := range []struct {
+		host string
+		want pac.ProxyString
+		err  error
+	}{
+		{"example.com", "PROXY proxy.example.com:3128", nil},
+		{"dns.example.com", "PROXY true-false:1", nil},
+		{"loop.example.com", "", pac.ErrPACScriptTimeout},
+		// The evaluator is restarted after it was killed.
+		{"example.org", "PROXY proxy.example.com:3128", nil},
+	} {
+		targetURL, _ := url.Parse("http://" + tc.host)
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Fatalf("%s: expected %q, %v, got %q, %v", tc.host, tc.want, tc.err, got, err)
+		}
+	}
+}
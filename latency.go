@@ -0,0 +1,93 @@
+package pac
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+const latencySmoothing = 0.3
+
+type latencySample struct {
+	avg time.Duration
+	at  time.Time
+}
+
+// proxyLatency keeps a moving average of the dial latency per proxy and
+// prefers faster proxies among the candidates of one PAC result.
+type proxyLatency struct {
+	mu      sync.Mutex
+	maxAge  time.Duration
+	now     func() time.Time
+	proxies map[Proxy]latencySample
+}
+
+func newProxyLatency(maxAge time.Duration) *proxyLatency {
+	if maxAge <= 0 {
+		return nil
+	}
+	return &proxyLatency{
+		maxAge:  maxAge,
+		now:     time.Now,
+		proxies: make(map[Proxy]latencySample),
+	}
+}
+
+// observe adds a dial latency measured for p.
+func (l *proxyLatency) observe(p Proxy, latency time.Duration) {
+	if l == nil || latency <= 0 || p.Type == ProxyDirect {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	s, ok := l.proxies[p]
+	if ok && now.Sub(s.at) < l.maxAge {
+		latency = s.avg + time.Duration(latencySmoothing*float64(latency-s.avg))
+	}
+	l.proxies[p] = latencySample{avg: latency, at: now}
+}
+
+// order sorts the candidates with a fresh measurement by latency. They only
+// swap positions among each other; DIRECT entries and proxies without a fresh
+// measurement keep the position the PAC and the Selector gave them.
+func (l *proxyLatency) order(candidates []Proxy) []Proxy {
+	if l == nil || len(candidates) < 2 {
+		return candidates
+	}
+	l.mu.Lock()
+	now := l.now()
+	var (
+		positions []int
+		measured  []Proxy
+		latencies = make(map[Proxy]time.Duration)
+	)
+	for i, c := range candidates {
+		s, ok := l.proxies[c]
+		if !ok || c.Type == ProxyDirect {
+			continue
+		}
+		if now.Sub(s.at) >= l.maxAge {
+			delete(l.proxies, c)
+			continue
+		}
+		positions = append(positions, i)
+		measured = append(measured, c)
+		latencies[c] = s.avg
+	}
+	l.mu.Unlock()
+	if len(measured) < 2 {
+		return candidates
+	}
+
+	slices.SortStableFunc(measured, func(a, b Proxy) int {
+		return cmp.Compare(latencies[a], latencies[b])
+	})
+	ordered := slices.Clone(candidates)
+	for i, pos := range positions {
+		ordered[pos] = measured[i]
+	}
+	return ordered
+}
@@ -1,6 +1,11 @@
 package pac
 
-import "context"
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
 
 // LogLevel represents a logging severity.
 type LogLevel int
@@ -58,6 +63,126 @@ func RedactKeysHook(keys ...string) LogHook {
 	}
 }
 
+// RedactURLsHook reduces the values of "url" keys to scheme and host, so
+// credentials, tokens and paths in target and PAC URLs do not reach the
+// logs. PACProxy applies it unless PACProxyConfig.LogFullURLs is set.
+func RedactURLsHook() LogHook {
+	return func(_ context.Context, _ LogLevel, msg string, args ...any) (string, []any, bool) {
+		var redacted []any
+		for i := 0; i+1 < len(args); i += 2 {
+			if key, ok := args[i].(string); !ok || key != "url" {
+				continue
+			}
+			s, ok := args[i+1].(string)
+			if !ok {
+				continue
+			}
+			u, err := url.Parse(s)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			if redacted == nil {
+				redacted = make([]any, len(args))
+				copy(redacted, args)
+			}
+			redacted[i+1] = u.Scheme + "://" + u.Host
+		}
+		if redacted == nil {
+			return msg, args, true
+		}
+		return msg, redacted, true
+	}
+}
+
+// SampleHook passes the first and then every n-th debug and info entry per
+// message, so per-evaluation logging can stay on in high-QPS services.
+// Warnings and errors always pass. n <= 1 passes everything.
+func SampleHook(n int) LogHook {
+	var (
+		mu     sync.Mutex
+		counts = make(map[string]int)
+	)
+	return func(_ context.Context, level LogLevel, msg string, args ...any) (string, []any, bool) {
+		if n <= 1 || level > LogInfo {
+			return msg, args, true
+		}
+		mu.Lock()
+		c := counts[msg]
+		counts[msg] = c + 1
+		mu.Unlock()
+		return msg, args, c%n == 0
+	}
+}
+
+// RateLimitHook passes debug and info entries at up to perSecond per
+// message, with bursts of up to burst entries (token bucket). Warnings and
+// errors always pass.
+func RateLimitHook(perSecond float64, burst int) LogHook {
+	type bucket struct {
+		tokens float64
+		last   time.Time
+	}
+	var (
+		mu      sync.Mutex
+		buckets = make(map[string]*bucket)
+	)
+	return func(_ context.Context, level LogLevel, msg string, args ...any) (string, []any, bool) {
+		if level > LogInfo {
+			return msg, args, true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		b, ok := buckets[msg]
+		if !ok {
+			b = &bucket{tokens: float64(burst), last: now}
+			buckets[msg] = b
+		}
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+		b.last = now
+		if b.tokens < 1 {
+			return msg, args, false
+		}
+		b.tokens--
+		return msg, args, true
+	}
+}
+
+// ChainHooks runs hooks in order, e.g. sampling before redaction. An entry
+// dropped by one hook is not passed to the following ones.
+func ChainHooks(hooks ...LogHook) LogHook {
+	return func(ctx context.Context, level LogLevel, msg string, args ...any) (string, []any, bool) {
+		for _, hook := range hooks {
+			if hook == nil {
+				continue
+			}
+			var ok bool
+			msg, args, ok = hook(ctx, level, msg, args...)
+			if !ok {
+				return msg, args, false
+			}
+		}
+		return msg, args, true
+	}
+}
+
+// withLogContext returns a hook appending the key-value pairs extract
+// returns for the entry's context before running hook.
+func withLogContext(extract func(ctx context.Context) []any, hook LogHook) LogHook {
+	if extract == nil {
+		return hook
+	}
+	return func(ctx context.Context, level LogLevel, msg string, args ...any) (string, []any, bool) {
+		if kv := extract(ctx); len(kv) > 0 {
+			args = append(args[:len(args):len(args)], kv...)
+		}
+		if hook == nil {
+			return msg, args, true
+		}
+		return hook(ctx, level, msg, args...)
+	}
+}
+
 func logf(ctx context.Context, l Logger, hook LogHook, level LogLevel, msg string, args ...any) {
 	if l == nil {
 		return
@@ -81,3 +206,42 @@ func toLower(s string) string {
 	}
 	return string(b)
 }
+
+// logging is the Logger and LogHook of a PACProxy. It is replaced as a whole
+// by SetLogger and SetLogHook.
+type logging struct {
+	logger Logger
+	// hook is the LogHook with the LogContext pairs added.
+	hook LogHook
+}
+
+// logHook returns hook preceded by URL redaction, unless disabled, and
+// LogContext.
+func (p *PACProxy) logHook(hook LogHook) LogHook {
+	if !p.logFullURLs {
+		hook = ChainHooks(RedactURLsHook(), hook)
+	}
+	return withLogContext(p.logContext, hook)
+}
+
+func (p *PACProxy) logf(ctx context.Context, level LogLevel, msg string, args ...any) {
+	l := p.logging.Load()
+	logf(ctx, l.logger, l.hook, level, msg, args...)
+}
+
+// SetLogger replaces the Logger of a live PACProxy, e.g. to raise the
+// verbosity during an incident. nil disables logging. It is safe to call
+// concurrently with lookups.
+func (p *PACProxy) SetLogger(l Logger) {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	p.logging.Store(&logging{logger: l, hook: p.logging.Load().hook})
+}
+
+// SetLogHook replaces the LogHook of a live PACProxy. LogContext and URL
+// redaction still apply. It is safe to call concurrently with lookups.
+func (p *PACProxy) SetLogHook(hook LogHook) {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+	p.logging.Store(&logging{logger: p.logging.Load().logger, hook: p.logHook(hook)})
+}
@@ -0,0 +1,177 @@
+package pac_test
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestLogSampling tests the sampling and rate limiting log hooks.
+func TestLogSampling(t *testing.T) {
+	passed := func(hook pac.LogHook, level pac.LogLevel, n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if _, _, ok := hook(context.Background(), level, "PAC evaluation result"); ok {
+				count++
+			}
+		}
+		return count
+	}
+
+	if got := passed(pac.SampleHook(3), pac.LogDebug, 7); got != 3 {
+		t.Fatalf("Expected SampleHook(3) to pass 3 of 7 entries, got %d", got)
+	}
+	if got := passed(pac.RateLimitHook(0.001, 2), pac.LogDebug, 5); got != 2 {
+		t.Fatalf("Expected RateLimitHook to pass a burst of 2 entries, got %d", got)
+	}
+	if got := passed(pac.RateLimitHook(0.001, 2), pac.LogError, 5); got != 5 {
+		t.Fatalf("Expected errors to bypass the rate limit, got %d", got)
+	}
+
+	hook := pac.ChainHooks(pac.SampleHook(2), pac.RedactKeysHook("url"))
+	if _, args, ok := hook(context.Background(), pac.LogDebug, "msg", "url", "http://example.com"); !ok || args[1] != "[REDACTED]" {
+		t.Fatalf("Expected the first entry to pass redacted, got %v %v", args, ok)
+	}
+	if _, _, ok := hook(context.Background(), pac.LogDebug, "msg", "url", "http://example.com"); ok {
+		t.Fatal("Expected the second entry to be sampled out")
+	}
+}
+
+type requestIDKey struct{}
+
+// TestLogContext tests that LogContext adds values of the caller's context to log entries.
+func TestLogContext(t *testing.T) {
+	pacServer := newPACServer(t, "DIRECT")
+	defer pacServer.Close()
+
+	var (
+		mu  sync.Mutex
+		ids []any
+	)
+	logger := pac.LoggerFunc(func(_ context.Context, _ pac.LogLevel, msg string, args ...any) {
+		if msg != "PAC evaluation result" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for i := 0; i+1 < len(args); i += 2 {
+			if args[i] == "request_id" {
+				ids = append(ids, args[i+1])
+			}
+		}
+	})
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		Logger: logger,
+		LogContext: func(ctx context.Context) []any {
+			if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+				return []any{"request_id", id}
+			}
+			return nil
+		},
+		LogHook: pac.RedactKeysHook("url"),
+	})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-42")
+	targetURL, _ := url.Parse("http://example.com")
+	if _, err := proxy.FindProxyStringForURLContext(ctx, targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+	if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(ids, []any{"req-42"}) {
+		t.Fatalf("Expected request_id req-42 on the first entry only, got %v", ids)
+	}
+}
+
+// requestIDResolver records the request ID of the contexts it resolves with.
+type requestIDResolver struct {
+	mu  sync.Mutex
+	ids []any
+}
+
+func (r *requestIDResolver) LookupHost(ctx context.Context, _ string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, ctx.Value(requestIDKey{}))
+	return []string{"10.0.0.1"}, nil
+}
+
+// TestSetLogger tests that the Logger and LogHook can be replaced on a live PACProxy.
+func TestSetLogger(t *testing.T) {
+	pacServer := newPACServer(t, "DIRECT")
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+
+	var count atomic.Int32
+	proxy.SetLogger(pac.LoggerFunc(func(context.Context, pac.LogLevel, string, ...any) { count.Add(1) }))
+	targetURL, _ := url.Parse("http://example.com")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = proxy.FindProxyStringForURL(targetURL)
+		}()
+	}
+	proxy.SetLogHook(pac.SampleHook(1))
+	wg.Wait()
+	if count.Load() == 0 {
+		t.Fatal("Expected entries to be logged after SetLogger")
+	}
+
+	proxy.SetLogHook(func(context.Context, pac.LogLevel, string, ...any) (string, []any, bool) { return "", nil, false })
+	before := count.Load()
+	_, _ = proxy.FindProxyStringForURL(targetURL)
+	if count.Load() != before {
+		t.Fatal("Expected the new LogHook to drop all entries")
+	}
+}
+
+// TestLogURLRedaction tests that logged URLs are reduced to scheme and host unless LogFullURLs is set.
+func TestLogURLRedaction(t *testing.T) {
+	pacServer := newPACServer(t, "DIRECT")
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL + "/proxy.pac?token=secret")
+	targetURL, _ := url.Parse("https://example.com/path?token=secret")
+
+	for _, full := range []bool{false, true} {
+		var (
+			mu   sync.Mutex
+			urls = map[string]any{}
+		)
+		logger := pac.LoggerFunc(func(_ context.Context, _ pac.LogLevel, msg string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			for i := 0; i+1 < len(args); i += 2 {
+				if args[i] == "url" {
+					urls[msg] = args[i+1]
+				}
+			}
+		})
+		proxy := newTestPACProxyFromURL(t, pacURL.String(), &pac.PACProxyConfig{Logger: logger, LogFullURLs: full})
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+		proxy.Close()
+
+		mu.Lock()
+		wantTarget, wantPAC := "https://example.com", pacURL.Scheme+"://"+pacURL.Host
+		if full {
+			wantTarget, wantPAC = targetURL.String(), pacURL.String()
+		}
+		if urls["PAC evaluation result"] != wantTarget || urls["fetching PAC script"] != wantPAC {
+			t.Fatalf("LogFullURLs %v: unexpected logged URLs %v", full, urls)
+		}
+		mu.Unlock()
+	}
+}
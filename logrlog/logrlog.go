@@ -0,0 +1,36 @@
+// Package logrlog adapts a github.com/go-logr/logr logger to pac.Logger.
+package logrlog
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/internal/logkv"
+)
+
+// DebugVerbosity is the logr verbosity used for pac.LogDebug.
+const DebugVerbosity = 1
+
+// New returns a pac.Logger writing to l. logr only knows info and error
+// messages: pac.LogDebug is logged at V(DebugVerbosity), pac.LogWarn as info
+// with a "level" of "warn" and pac.LogError through Error, passing the
+// "err" value as the error.
+func New(l logr.Logger) pac.Logger {
+	return pac.LoggerFunc(func(_ context.Context, level pac.LogLevel, msg string, args ...any) {
+		kv := make([]any, 0, len(args)+2)
+		logkv.Each(args, func(key string, value any) {
+			kv = append(kv, key, value)
+		})
+		switch level {
+		case pac.LogDebug:
+			l.V(DebugVerbosity).Info(msg, kv...)
+		case pac.LogWarn:
+			l.Info(msg, append(kv, "level", "warn")...)
+		case pac.LogError:
+			l.Error(logkv.Error(args), msg, kv...)
+		default:
+			l.Info(msg, kv...)
+		}
+	})
+}
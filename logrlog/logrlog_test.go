@@ -0,0 +1,34 @@
+package logrlog_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/logrlog"
+)
+
+// TestNew tests level mapping and key/value conversion.
+func TestNew(t *testing.T) {
+	var lines []string
+	logger := logrlog.New(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 0}))
+
+	logger.Log(context.Background(), pac.LogDebug, "dropped")
+	logger.Log(context.Background(), pac.LogWarn, "proxy marked as failed", "proxy", "PROXY a:1")
+	logger.Log(context.Background(), pac.LogError, "PAC evaluation failed", "err", errors.New("boom"))
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %v", len(lines), lines)
+	}
+	if !strings.Contains(lines[0], `"proxy"="PROXY a:1"`) || !strings.Contains(lines[0], `"level"="warn"`) {
+		t.Fatalf("Unexpected warn line: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"error"="boom"`) {
+		t.Fatalf("Unexpected error line: %s", lines[1])
+	}
+}
@@ -0,0 +1,36 @@
+// Package logruslog adapts a github.com/sirupsen/logrus logger to pac.Logger.
+package logruslog
+
+import (
+	"context"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/internal/logkv"
+	"github.com/sirupsen/logrus"
+)
+
+// New returns a pac.Logger writing to l. Levels map to the logrus level of
+// the same name, key/value pairs become fields and the context is attached
+// to the entry for hooks. Error values are logged under logrus.ErrorKey.
+func New(l logrus.FieldLogger) pac.Logger {
+	return pac.LoggerFunc(func(ctx context.Context, level pac.LogLevel, msg string, args ...any) {
+		fields := make(logrus.Fields, (len(args)+1)/2)
+		logkv.Each(args, func(key string, value any) {
+			if _, ok := value.(error); ok && key == "err" {
+				key = logrus.ErrorKey
+			}
+			fields[key] = value
+		})
+		entry := l.WithFields(fields).WithContext(ctx)
+		switch level {
+		case pac.LogDebug:
+			entry.Debug(msg)
+		case pac.LogWarn:
+			entry.Warn(msg)
+		case pac.LogError:
+			entry.Error(msg)
+		default:
+			entry.Info(msg)
+		}
+	})
+}
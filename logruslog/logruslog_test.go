@@ -0,0 +1,34 @@
+package logruslog_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/logruslog"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// TestNew tests level mapping and field conversion.
+func TestNew(t *testing.T) {
+	l, hook := test.NewNullLogger()
+	logger := logruslog.New(l)
+
+	logger.Log(context.Background(), pac.LogError, "PAC evaluation failed", "url", "http://example.com", "err", errors.New("boom"))
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatalf("Expected a log entry")
+	}
+	if entry.Level != logrus.ErrorLevel || entry.Message != "PAC evaluation failed" {
+		t.Fatalf("Unexpected entry: %v %q", entry.Level, entry.Message)
+	}
+	if entry.Data["url"] != "http://example.com" {
+		t.Fatalf("Unexpected fields: %v", entry.Data)
+	}
+	if err, ok := entry.Data[logrus.ErrorKey].(error); !ok || err.Error() != "boom" {
+		t.Fatalf("Expected error under %q, got %v", logrus.ErrorKey, entry.Data)
+	}
+}
@@ -0,0 +1,99 @@
+package pac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ErrMachineProxyNotFound is returned by GetMachineProxy if no machine-wide
+// proxy is configured.
+var ErrMachineProxyNotFound = errors.New("machine proxy not found")
+
+// GetMachineProxy returns the machine-wide proxy: on Windows the WinHTTP
+// proxy set with netsh winhttp set proxy, which is all that services
+// running as SYSTEM see, and on Android the global HTTP proxy, e.g. pushed
+// by an MDM. It is a final fallback when no per-user PAC exists: pass it
+// to CombinedProxyFunc, with a nil PACProxy if there is no PAC at all. The
+// bypass list becomes NoProxy; the WinHTTP <local> entry, for host names
+// without dots, has no NoProxy equivalent and is dropped. Other platforms
+// return ErrMachineProxyNotFound.
+func GetMachineProxy() (*httpproxy.Config, error) {
+	return retrieveMachineProxy()
+}
+
+// winHTTPMachineProxy converts the WinHttpSettings registry value.
+func winHTTPMachineProxy(data []byte) (*httpproxy.Config, error) {
+	proxy, bypass, err := parseWinHTTPSettings(data)
+	if err != nil {
+		return nil, err
+	}
+	return winHTTPConfig(proxy, bypass), nil
+}
+
+// winHTTPProxyFlag is set in the flags of WinHttpSettings if a proxy is
+// configured; without it the settings mean direct access.
+const winHTTPProxyFlag = 0x2
+
+// parseWinHTTPSettings decodes the WinHttpSettings registry value: a
+// version, a change counter and flags, followed by the proxy and the bypass
+// list, each as a length-prefixed string, all little endian.
+func parseWinHTTPSettings(data []byte) (proxy, bypass string, err error) {
+	if len(data) < 12 {
+		return "", "", fmt.Errorf("%w: WinHttpSettings too short", ErrMachineProxyNotFound)
+	}
+	if binary.LittleEndian.Uint32(data[8:12])&winHTTPProxyFlag == 0 {
+		return "", "", fmt.Errorf("%w: WinHTTP uses direct access", ErrMachineProxyNotFound)
+	}
+	rest := data[12:]
+	next := func() (string, bool) {
+		if len(rest) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(rest)
+		if uint64(n) > uint64(len(rest)-4) {
+			return "", false
+		}
+		s := string(rest[4 : 4+n])
+		rest = rest[4+n:]
+		return s, true
+	}
+	proxy, ok := next()
+	if !ok || strings.TrimSpace(proxy) == "" {
+		return "", "", fmt.Errorf("%w: WinHttpSettings has no proxy", ErrMachineProxyNotFound)
+	}
+	bypass, _ = next()
+	return proxy, bypass, nil
+}
+
+// winHTTPConfig converts a WinHTTP proxy, either host:port or per scheme
+// as "http=host:port;https=host:port", and bypass list to a Config.
+func winHTTPConfig(proxy, bypass string) *httpproxy.Config {
+	cfg := &httpproxy.Config{}
+	for _, entry := range strings.FieldsFunc(proxy, isWinHTTPSeparator) {
+		scheme, addr, ok := strings.Cut(entry, "=")
+		switch {
+		case !ok:
+			cfg.HTTPProxy, cfg.HTTPSProxy = entry, entry
+		case strings.EqualFold(scheme, "http"):
+			cfg.HTTPProxy = addr
+		case strings.EqualFold(scheme, "https"):
+			cfg.HTTPSProxy = addr
+		}
+	}
+	var noProxy []string
+	for _, entry := range strings.FieldsFunc(bypass, isWinHTTPSeparator) {
+		if !strings.EqualFold(entry, "<local>") {
+			noProxy = append(noProxy, entry)
+		}
+	}
+	cfg.NoProxy = strings.Join(noProxy, ",")
+	return cfg
+}
+
+func isWinHTTPSeparator(r rune) bool {
+	return r == ';' || r == ' ' || r == '\t'
+}
@@ -0,0 +1,41 @@
+//go:build !gopac_testhooks && android
+// +build !gopac_testhooks,android
+
+package pac
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// retrieveMachineProxy reads the global HTTP proxy from Android using the
+// settings command.
+func retrieveMachineProxy() (*httpproxy.Config, error) {
+	host, err := androidGlobalSetting("global_http_proxy_host")
+	if err != nil {
+		return nil, err
+	}
+	port, err := androidGlobalSetting("global_http_proxy_port")
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		// Older releases and adb keep only http_proxy, as host:port.
+		proxy, err := androidGlobalSetting("http_proxy")
+		if err != nil {
+			return nil, err
+		}
+		host, port, _ = strings.Cut(proxy, ":")
+	}
+	if host == "" || port == "" || port == "0" {
+		return nil, ErrMachineProxyNotFound
+	}
+	exclusions, err := androidGlobalSetting("global_http_proxy_exclusion_list")
+	if err != nil {
+		return nil, err
+	}
+	proxy := net.JoinHostPort(host, port)
+	return &httpproxy.Config{HTTPProxy: proxy, HTTPSProxy: proxy, NoProxy: exclusions}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !gopac_testhooks && !android && !windows
+// +build !gopac_testhooks,!android,!windows
+
+package pac
+
+import (
+	"fmt"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// retrieveMachineProxy reports ErrMachineProxyNotFound on platforms without
+// a machine-wide proxy setting.
+func retrieveMachineProxy() (*httpproxy.Config, error) {
+	return nil, fmt.Errorf("%w: no machine proxy on this platform", ErrMachineProxyNotFound)
+}
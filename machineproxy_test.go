@@ -0,0 +1,63 @@
+package pac_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"golang.org/x/net/http/httpproxy"
+)
+
+func TestGetMachineProxy(t *testing.T) {
+	winHTTPSettings := func(flags uint32, proxy, bypass string) []byte {
+		data := binary.LittleEndian.AppendUint32(nil, 0x28)
+		data = binary.LittleEndian.AppendUint32(data, 1)
+		data = binary.LittleEndian.AppendUint32(data, flags)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(proxy)))
+		data = append(data, proxy...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(bypass)))
+		return append(data, bypass...)
+	}
+	t.Cleanup(func() { pac.SetTestWinHTTPSettings(nil) })
+
+	if _, err := pac.GetMachineProxy(); !errors.Is(err, pac.ErrMachineProxyNotFound) {
+		t.Fatalf("Expected ErrMachineProxyNotFound without settings, got %v", err)
+	}
+	pac.SetTestWinHTTPSettings(winHTTPSettings(1, "", ""))
+	if _, err := pac.GetMachineProxy(); !errors.Is(err, pac.ErrMachineProxyNotFound) {
+		t.Fatalf("Expected ErrMachineProxyNotFound for direct access, got %v", err)
+	}
+	pac.SetTestWinHTTPSettings(winHTTPSettings(3, "proxy.corp.example.com:8080", "<local>;*.corp.example.com;10.0.0.0/8"))
+	cfg, err := pac.GetMachineProxy()
+	if err != nil {
+		t.Fatalf("Error getting machine proxy: %v", err)
+	}
+	want := &httpproxy.Config{HTTPProxy: "proxy.corp.example.com:8080", HTTPSProxy: "proxy.corp.example.com:8080", NoProxy: "*.corp.example.com,10.0.0.0/8"}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("Expected %+v, got %+v", want, cfg)
+	}
+
+	pac.SetTestWinHTTPSettings(winHTTPSettings(3, "http=web.example.com:80;https=tls.example.com:443", ""))
+	if cfg, err = pac.GetMachineProxy(); err != nil {
+		t.Fatalf("Error getting machine proxy: %v", err)
+	}
+	proxyFunc := pac.CombinedProxyFunc(nil, cfg, pac.PreferPAC)
+	for target, wantProxy := range map[string]string{
+		"http://example.org/":  "http://web.example.com:80",
+		"https://example.org/": "http://tls.example.com:443",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if proxyURL, err := proxyFunc(req); err != nil || proxyURL.String() != wantProxy {
+			t.Fatalf("Expected %s for %s, got %v, %v", wantProxy, target, proxyURL, err)
+		}
+	}
+
+	pac.SetTestWinHTTPSettings(winHTTPSettings(3, "proxy:8080", "")[:20])
+	if _, err := pac.GetMachineProxy(); !errors.Is(err, pac.ErrMachineProxyNotFound) {
+		t.Fatalf("Expected ErrMachineProxyNotFound for truncated settings, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import (
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	testWinHTTPSettings   []byte
+	testWinHTTPSettingsMu sync.RWMutex
+)
+
+// SetTestWinHTTPSettings sets the WinHttpSettings registry value
+// GetMachineProxy reads in tests. Pass nil to reset to "not found".
+func SetTestWinHTTPSettings(data []byte) {
+	testWinHTTPSettingsMu.Lock()
+	testWinHTTPSettings = data
+	testWinHTTPSettingsMu.Unlock()
+}
+
+func retrieveMachineProxy() (*httpproxy.Config, error) {
+	testWinHTTPSettingsMu.RLock()
+	data := testWinHTTPSettings
+	testWinHTTPSettingsMu.RUnlock()
+	if data == nil {
+		return nil, ErrMachineProxyNotFound
+	}
+	return winHTTPMachineProxy(data)
+}
@@ -0,0 +1,30 @@
+//go:build !gopac_testhooks && windows
+// +build !gopac_testhooks,windows
+
+package pac
+
+import (
+	"fmt"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/sys/windows/registry"
+)
+
+// retrieveMachineProxy reads the WinHTTP settings written by netsh winhttp
+// set proxy from the registry.
+func retrieveMachineProxy() (*httpproxy.Config, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings\Connections`, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry key: %w", err)
+	}
+	defer key.Close()
+
+	data, _, err := key.GetBinaryValue("WinHttpSettings")
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, ErrMachineProxyNotFound
+		}
+		return nil, fmt.Errorf("failed to get registry value: %w", err)
+	}
+	return winHTTPMachineProxy(data)
+}
@@ -0,0 +1,255 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownProfile is returned by Manager for a profile that was not added.
+var ErrUnknownProfile = errors.New("unknown PAC profile")
+
+// ManagerConfig holds the caches a Manager shares between its profiles.
+// Profiles that set their own cache keep it. JavaScript runtimes and
+// evaluator processes are not shared: each holds the compiled script of its
+// profile, so every loaded profile has its own.
+type ManagerConfig struct {
+	// DNSCache caches helper lookups across profiles.
+	DNSCache *DNSCache
+	// DecisionCache holds the decisions of all profiles with a
+	// DecisionCacheTTL. Decisions are keyed by script and by the options
+	// that change its results, such as CompatMode, EntryPoints,
+	// ExtensionHelpers and EmptyResult, so profiles only share them if
+	// they evaluate the same script the same way. Profiles with their own
+	// Resolver, DNSFilter or NewRuntime should set their own cache.
+	DecisionCache Store
+	// ScriptCache holds the scripts of all profiles, keyed by PAC URL.
+	ScriptCache Store
+}
+
+// Manager holds a PACProxy per profile, e.g. per tenant or VPN, for
+// gateway-style services that resolve proxies for many PAC URLs. A profile
+// is loaded on first use and then refreshes on its own, following its
+// RefreshInterval. A Manager is safe for concurrent use.
+type Manager struct {
+	shared   ManagerConfig
+	mu       sync.Mutex
+	profiles map[string]*managedProfile
+	closed   bool
+}
+
+type managedProfile struct {
+	pacURL *url.URL
+	config PACProxyConfig
+	// mu guards the fields below. It is not held while loading, so Add and
+	// Remove do not wait for a fetch; proxy is nil until the first
+	// successful load.
+	mu      sync.Mutex
+	loading *profileLoad
+	proxy   *PACProxy
+	closed  bool
+}
+
+// profileLoad is a load of a profile in progress. Callers that find one
+// wait for done instead of loading the profile again.
+type profileLoad struct {
+	done  chan struct{}
+	proxy *PACProxy
+	err   error
+	// canceled reports that the load failed because the context of the
+	// loading caller ended, which waiters with a live context retry.
+	canceled bool
+}
+
+// NewManager returns a Manager sharing the caches of config, which may be
+// nil.
+func NewManager(config *ManagerConfig) *Manager {
+	m := &Manager{profiles: make(map[string]*managedProfile)}
+	if config != nil {
+		m.shared = *config
+	}
+	return m
+}
+
+// Add registers the profile name with its PAC URL and configuration, which
+// may be nil, replacing and closing a profile of the same name. The PAC
+// script is not fetched until the profile is used.
+func (m *Manager) Add(name string, pacURL *url.URL, config *PACProxyConfig) error {
+	profile := &managedProfile{pacURL: pacURL}
+	if config != nil {
+		profile.config = *config
+	}
+	if profile.config.DNSCache == nil {
+		profile.config.DNSCache = m.shared.DNSCache
+	}
+	if profile.config.DecisionCache == nil {
+		profile.config.DecisionCache = m.shared.DecisionCache
+	}
+	if profile.config.ScriptCache == nil {
+		profile.config.ScriptCache = m.shared.ScriptCache
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	old := m.profiles[name]
+	m.profiles[name] = profile
+	m.mu.Unlock()
+	return old.close()
+}
+
+// Remove closes and forgets the profile name.
+func (m *Manager) Remove(name string) error {
+	m.mu.Lock()
+	profile, ok := m.profiles[name]
+	delete(m.profiles, name)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	}
+	return profile.close()
+}
+
+// Profiles returns the names of the profiles, sorted.
+func (m *Manager) Profiles() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.profiles))
+	for name := range m.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Proxy returns the PACProxy of the profile name, loading it with ctx if
+// it is not loaded yet. Concurrent callers share one load and stop waiting
+// for it when their ctx is done. A failed load is retried by the next call.
+func (m *Manager) Proxy(ctx context.Context, name string) (*PACProxy, error) {
+	m.mu.Lock()
+	profile, ok := m.profiles[name]
+	closed := m.closed
+	m.mu.Unlock()
+	switch {
+	case closed:
+		return nil, ErrClosed
+	case !ok:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	}
+
+	for {
+		profile.mu.Lock()
+		if profile.closed {
+			// Replaced or removed meanwhile.
+			profile.mu.Unlock()
+			return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+		}
+		if proxy := profile.proxy; proxy != nil {
+			profile.mu.Unlock()
+			return proxy, nil
+		}
+		load := profile.loading
+		loader := load == nil
+		if loader {
+			load = &profileLoad{done: make(chan struct{})}
+			profile.loading = load
+		}
+		profile.mu.Unlock()
+
+		if loader {
+			profile.load(ctx, name, load)
+		}
+		select {
+		case <-load.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if load.err == nil {
+			return load.proxy, nil
+		}
+		if loader || !load.canceled {
+			return nil, load.err
+		}
+	}
+}
+
+// load runs load with ctx and publishes its result. A profile closed while
+// loading closes the new PACProxy right away.
+func (p *managedProfile) load(ctx context.Context, name string, load *profileLoad) {
+	proxy, err := NewPACProxyContext(ctx, p.pacURL, &p.config)
+	p.mu.Lock()
+	p.loading = nil
+	switch {
+	case err != nil:
+		load.err, load.canceled = err, ctx.Err() != nil
+	case p.closed:
+		proxy.Close()
+		load.err = fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	default:
+		p.proxy, load.proxy = proxy, proxy
+	}
+	p.mu.Unlock()
+	close(load.done)
+}
+
+// FindProxyStringForURLContext evaluates targetURL with the profile name.
+func (m *Manager) FindProxyStringForURLContext(ctx context.Context, name string, targetURL *url.URL) (ProxyString, error) {
+	proxy, err := m.Proxy(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return proxy.FindProxyStringForURLContext(ctx, targetURL)
+}
+
+// ProxyFunc returns a function for http.Transport.Proxy that routes each
+// request with the profile returned by profile, e.g. from a header or the
+// authenticated tenant.
+func (m *Manager) ProxyFunc(profile func(*http.Request) string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxy, err := m.Proxy(req.Context(), profile(req))
+		if err != nil {
+			return nil, err
+		}
+		return proxy.ProxyFunc()(req)
+	}
+}
+
+// Close closes the loaded profiles and returns the first error. Later calls
+// of Proxy return ErrClosed.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	profiles := m.profiles
+	m.profiles = make(map[string]*managedProfile)
+	m.closed = true
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, profile := range profiles {
+		if err := profile.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// close closes the PACProxy of the profile, if loaded; nil profiles are
+// ignored.
+func (p *managedProfile) close() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	p.closed = true
+	proxy := p.proxy
+	p.mu.Unlock()
+	if proxy == nil {
+		return nil
+	}
+	return proxy.Close()
+}
@@ -0,0 +1,200 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestManager tests that a Manager loads profiles lazily, shares its caches
+// and closes the profiles it drops.
+func TestManager(t *testing.T) {
+	var fetches atomic.Int32
+	newServer := func(result string) *httptest.Server {
+		script := fmt.Sprintf(`function FindProxyForURL(url, host) { return "%s"; }`, result)
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fetches.Add(1)
+			_, _ = io.WriteString(w, script)
+		}))
+	}
+	acme, globex := newServer("PROXY acme.example.com:3128"), newServer("DIRECT")
+	defer acme.Close()
+	defer globex.Close()
+	acmeURL, _ := url.Parse(acme.URL)
+	globexURL, _ := url.Parse(globex.URL)
+
+	decisions := pac.NewMemoryStore(0)
+	m := pac.NewManager(&pac.ManagerConfig{DecisionCache: decisions})
+	defer m.Close()
+	for name, u := range map[string]*url.URL{"acme": acmeURL, "globex": globexURL} {
+		if err := m.Add(name, u, &pac.PACProxyConfig{DecisionCacheTTL: time.Minute}); err != nil {
+			t.Fatalf("Error adding %s: %v", name, err)
+		}
+	}
+	if n := fetches.Load(); n != 0 {
+		t.Fatalf("Expected no fetch before first use, got %d", n)
+	}
+	if got := m.Profiles(); !reflect.DeepEqual(got, []string{"acme", "globex"}) {
+		t.Fatalf("Expected profiles acme and globex, got %v", got)
+	}
+
+	target, _ := url.Parse("http://www.example.com/")
+	proxyFunc := m.ProxyFunc(func(req *http.Request) string { return req.Header.Get("X-Tenant") })
+	for name, want := range map[string]string{"acme": "http://acme.example.com:3128", "globex": "<nil>"} {
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodGet, target.String(), nil)
+			req.Header.Set("X-Tenant", name)
+			got, err := proxyFunc(req)
+			if err != nil || fmt.Sprint(got) != want {
+				t.Fatalf("%s: expected proxy %s, got %v, %v", name, want, got, err)
+			}
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("Expected one fetch per profile, got %d", n)
+	}
+	if size := decisions.Stats().Size; size != 2 {
+		t.Fatalf("Expected both profiles in the shared decision cache, got %d entries", size)
+	}
+
+	if _, err := m.Proxy(context.Background(), "initech"); !errors.Is(err, pac.ErrUnknownProfile) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrUnknownProfile, err)
+	}
+	acmeProxy, _ := m.Proxy(context.Background(), "acme")
+	if err := m.Remove("acme"); err != nil {
+		t.Fatalf("Error removing acme: %v", err)
+	}
+	if _, err := acmeProxy.FindProxyStringForURL(target); !errors.Is(err, pac.ErrClosed) {
+		t.Fatalf("Expected the removed profile to be closed, got %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Error closing manager: %v", err)
+	}
+	if _, err := m.FindProxyStringForURLContext(context.Background(), "globex", target); !errors.Is(err, pac.ErrClosed) {
+		t.Fatalf("Expected error %v after Close, got %v", pac.ErrClosed, err)
+	}
+}
+
+// TestManagerConcurrentLoad tests that concurrent callers share one load of
+// a profile, give up on it with their context and do not block Add or
+// Remove.
+func TestManagerConcurrentLoad(t *testing.T) {
+	var fetches atomic.Int32
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		started <- struct{}{}
+		select {
+		case <-release:
+			_, _ = io.WriteString(w, `function FindProxyForURL(url, host) { return "DIRECT"; }`)
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	m := pac.NewManager(nil)
+	defer m.Close()
+	_ = m.Add("slow", serverURL, nil)
+	_ = m.Add("other", serverURL, nil)
+
+	// The first caller gives up while loading; the others keep waiting and
+	// load again with their own context.
+	loaderCtx, cancelLoader := context.WithCancel(context.Background())
+	loaderErr := make(chan error, 1)
+	go func() {
+		_, err := m.Proxy(loaderCtx, "slow")
+		loaderErr <- err
+	}()
+	<-started
+
+	proxies := make(chan *pac.PACProxy, 3)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxy, err := m.Proxy(context.Background(), "slow")
+			if err != nil {
+				t.Errorf("Error loading the shared profile: %v", err)
+			}
+			proxies <- proxy
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.Proxy(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a waiter to stop at its deadline, got %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = m.Remove("other")
+		_ = m.Add("other", serverURL, nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Add and Remove not to wait for a load")
+	}
+
+	cancelLoader()
+	if err := <-loaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the canceled loader to fail with %v, got %v", context.Canceled, err)
+	}
+	<-started
+	close(release)
+	wg.Wait()
+	close(proxies)
+	var first *pac.PACProxy
+	for proxy := range proxies {
+		if first == nil {
+			first = proxy
+		}
+		if proxy == nil || proxy != first {
+			t.Fatalf("Expected all waiters to get the same proxy, got %p and %p", first, proxy)
+		}
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("Expected one fetch per load, got %d", n)
+	}
+}
+
+// TestManagerDecisionCacheOptions tests that profiles running the same script
+// with different evaluation options do not read each other's decisions from
+// the shared DecisionCache.
+func TestManagerDecisionCacheOptions(t *testing.T) {
+	server := newScriptServer(t, `
+		function FindProxyForURL(url, host) { return "PROXY plain.example.com:3128"; }
+		function FindProxyForURLEx(url, host) { return "PROXY ex.example.com:3128"; }`)
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	m := pac.NewManager(&pac.ManagerConfig{DecisionCache: pac.NewMemoryStore(0)})
+	defer m.Close()
+	_ = m.Add("plain", serverURL, &pac.PACProxyConfig{DecisionCacheTTL: time.Minute})
+	_ = m.Add("ex", serverURL, &pac.PACProxyConfig{DecisionCacheTTL: time.Minute, EntryPoints: []string{"FindProxyForURLEx"}})
+
+	target, _ := url.Parse("http://www.example.com/")
+	for range 2 {
+		for name, want := range map[string]pac.ProxyString{"plain": "PROXY plain.example.com:3128", "ex": "PROXY ex.example.com:3128"} {
+			if got, err := m.FindProxyStringForURLContext(context.Background(), name, target); err != nil || got != want {
+				t.Fatalf("%s: expected %q, got %q, %v", name, want, got, err)
+			}
+		}
+	}
+}
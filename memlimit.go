@@ -0,0 +1,76 @@
+package pac
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"sync"
+)
+
+const allocsMetric = "/gc/heap/allocs:bytes"
+
+// heapAllocs returns the bytes allocated on the heap since the process
+// started.
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: allocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// allocationGuard enforces ScriptMemoryLimit in the evaluator helper. goja
+// does not account memory per runtime, but the helper process runs nothing
+// besides the script, so its allocations are the script's. It counts the
+// bytes allocated since the evaluation started, collected garbage included,
+// not the live heap. The guard checks
+// after every garbage collection, which an allocating script triggers over
+// and over, and costs nothing between evaluations.
+type allocationGuard struct {
+	mu        sync.Mutex
+	armed     bool
+	limit     uint64
+	start     uint64
+	interrupt func() // set while an evaluation is watched
+}
+
+// watch calls interrupt once more than limit bytes were allocated, until
+// the returned function is called. After that, interrupt is not called.
+func (g *allocationGuard) watch(limit int64, interrupt func()) (stop func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.armed {
+		g.armed = true
+		g.afterGC()
+	}
+	g.limit, g.start, g.interrupt = uint64(limit), heapAllocs(), interrupt
+	return func() {
+		g.mu.Lock()
+		g.interrupt = nil
+		g.mu.Unlock()
+	}
+}
+
+// gcSentinel is unreachable as soon as it is allocated, so its finalizer
+// runs after the next garbage collection.
+type gcSentinel struct {
+	g *allocationGuard
+}
+
+// afterGC checks the allocations after the next garbage collection, and
+// again after each one following it.
+func (g *allocationGuard) afterGC() {
+	runtime.SetFinalizer(&gcSentinel{g: g}, func(s *gcSentinel) {
+		s.g.check()
+		s.g.afterGC()
+	})
+}
+
+func (g *allocationGuard) check() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.interrupt != nil && heapAllocs()-g.start > g.limit {
+		g.interrupt()
+		g.interrupt = nil
+	}
+}
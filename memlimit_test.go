@@ -0,0 +1,60 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestScriptMemoryLimit tests that evaluations allocating beyond ScriptMemoryLimit are interrupted.
+func TestScriptMemoryLimit(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "hog.example.com") {
+			var hog = [];
+			while (true) { hog.push(new Array(100000).fill(host)); }
+		}
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		ScriptTimeout:     30 * time.Second,
+		ScriptMemoryLimit: 64 << 20,
+		EvaluatorCommand:  []string{os.Args[0], "-test.run=^TestEvaluatorHelperProcess$", "--", "pac-evaluator"},
+	})
+
+	hogURL, _ := url.Parse("http://hog.example.com")
+	start := time.Now()
+	if _, err := proxy.FindProxyStringForURL(hogURL); !errors.Is(err, pac.ErrPACMemoryLimit) {
+		t.Fatalf("Expected ErrPACMemoryLimit, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Expected the evaluation to be interrupted quickly, took %v", elapsed)
+	}
+
+	targetURL, _ := url.Parse("http://example.com")
+	if got, err := proxy.FindProxyStringForURL(targetURL); err != nil || got != "DIRECT" {
+		t.Fatalf("Expected DIRECT after the interrupted evaluation, got %q, %v", got, err)
+	}
+}
+
+// TestScriptMemoryLimitConfig tests that ScriptMemoryLimit without
+// EvaluatorCommand is rejected instead of silently ignored.
+func TestScriptMemoryLimitConfig(t *testing.T) {
+	pacServer := newPACServer(t, "DIRECT")
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+
+	for name, cfg := range map[string]*pac.PACProxyConfig{
+		"in-process": {ScriptMemoryLimit: 64 << 20},
+		"wasm":       {ScriptMemoryLimit: 64 << 20, EvaluatorWASM: []byte("\x00asm")},
+	} {
+		if _, err := pac.NewPACProxy(pacURL, cfg); !errors.Is(err, pac.ErrInvalidConfig) {
+			t.Errorf("%s: expected %v, got %v", name, pac.ErrInvalidConfig, err)
+		}
+	}
+}
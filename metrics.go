@@ -0,0 +1,95 @@
+package pac
+
+import (
+	"sync"
+	"time"
+)
+
+// ProxyMetrics holds the connection counters of one proxy endpoint.
+type ProxyMetrics struct {
+	// Selections counts how often the proxy was chosen for a connection
+	// attempt or returned by ProxyFunc.
+	Selections    uint64
+	DialSuccesses uint64
+	DialFailures  uint64
+	// DialLatency is the summed time of successful dials; reused
+	// connections do not add to it.
+	DialLatency time.Duration
+	// LatencySamples is the number of dials summed up in DialLatency.
+	LatencySamples uint64
+}
+
+// AverageDialLatency returns the mean latency of successful dials, or 0 if
+// none was measured.
+func (m ProxyMetrics) AverageDialLatency() time.Duration {
+	if m.LatencySamples == 0 {
+		return 0
+	}
+	return m.DialLatency / time.Duration(m.LatencySamples)
+}
+
+// proxyMetrics collects ProxyMetrics per proxy endpoint.
+type proxyMetrics struct {
+	mu      sync.Mutex
+	proxies map[Proxy]*ProxyMetrics
+	sink    MetricsSink
+}
+
+func newProxyMetrics(sink MetricsSink) *proxyMetrics {
+	return &proxyMetrics{proxies: make(map[Proxy]*ProxyMetrics), sink: sink}
+}
+
+// entry returns the metrics of p. The caller must hold m.mu.
+func (m *proxyMetrics) entry(p Proxy) *ProxyMetrics {
+	e, ok := m.proxies[p]
+	if !ok {
+		e = &ProxyMetrics{}
+		m.proxies[p] = e
+	}
+	return e
+}
+
+func (m *proxyMetrics) selected(p Proxy) {
+	observe(m.sink, MetricSelections, 1, "proxy", p.String())
+	m.mu.Lock()
+	m.entry(p).Selections++
+	m.mu.Unlock()
+}
+
+// dialed records the outcome of a dial through p. latency is ignored for
+// failures and when the connection was reused (latency 0).
+func (m *proxyMetrics) dialed(p Proxy, latency time.Duration, err error) {
+	observe(m.sink, MetricDials, 1, "proxy", p.String(), "outcome", outcome(err))
+	if err == nil && latency > 0 {
+		observe(m.sink, MetricDialSeconds, latency.Seconds(), "proxy", p.String())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(p)
+	if err != nil {
+		e.DialFailures++
+		return
+	}
+	e.DialSuccesses++
+	if latency > 0 {
+		e.DialLatency += latency
+		e.LatencySamples++
+	}
+}
+
+func (m *proxyMetrics) snapshot() map[Proxy]ProxyMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[Proxy]ProxyMetrics, len(m.proxies))
+	for p, e := range m.proxies {
+		out[p] = *e
+	}
+	return out
+}
+
+// ProxyMetrics returns a snapshot of the connection metrics per proxy
+// endpoint, DIRECT included, as recorded by ProxyFunc, Transport and Dialer.
+func (p *PACProxy) ProxyMetrics() map[Proxy]ProxyMetrics {
+	return p.metrics.snapshot()
+}
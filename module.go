@@ -0,0 +1,64 @@
+package pac
+
+import (
+	"regexp"
+	"strings"
+)
+
+// exportDecl matches an export statement in front of a declaration.
+var exportDecl = regexp.MustCompile(`^export\s+((?:async\s+)?function\b|const\b|let\b|var\b|class\b)`)
+
+// exportDefault matches a default export.
+var exportDefault = regexp.MustCompile(`^export\s+default\s+`)
+
+// exportList matches an export list, which may re-export from a module.
+var exportList = regexp.MustCompile(`^export\s*\{([^}]*)\}\s*(from\b.*)?;?\s*$`)
+
+// importStmt matches an import statement, but not a dynamic import().
+var importStmt = regexp.MustCompile(`^import(?:\s+[\w*{'"]|\s*[*{'"])`)
+
+// shimModuleSyntax rewrites the ES module syntax of generated PAC scripts,
+// which goja cannot run as a script, into plain declarations. It works on
+// lines that start with an import or export statement:
+//
+//	export function FindProxyForURL(url, host) {...}  the declaration
+//	export default (url, host) => {...}               var FindProxyForURL = ...
+//	export { choose as FindProxyForURL };             var FindProxyForURL = choose;
+//	import ... from "...";                            removed
+//
+// Other export lists are removed. Lines keep their numbers, so errors still
+// point into the original script.
+func shimModuleSyntax(source string) string {
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(trimmed)]
+		switch {
+		case exportDefault.MatchString(trimmed):
+			lines[i] = indent + exportDefault.ReplaceAllString(trimmed, "var FindProxyForURL = ")
+		case exportDecl.MatchString(trimmed):
+			lines[i] = indent + exportDecl.ReplaceAllString(trimmed, "$1")
+		case exportList.MatchString(trimmed):
+			lines[i] = exportedEntryPoint(exportList.FindStringSubmatch(trimmed))
+		case importStmt.MatchString(trimmed):
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// exportedEntryPoint returns the binding of FindProxyForURL for an export
+// list exporting another name as FindProxyForURL or as default, "" if it
+// exports none. Re-exports from other modules are dropped.
+func exportedEntryPoint(m []string) string {
+	if m[2] != "" {
+		return ""
+	}
+	for _, item := range strings.Split(m[1], ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 3 && fields[1] == "as" && (fields[2] == "FindProxyForURL" || fields[2] == "default") && fields[0] != "FindProxyForURL" {
+			return "var FindProxyForURL = " + fields[0] + ";"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+func TestModuleSyntax(t *testing.T) {
+	evaluator := []string{os.Args[0], "-test.run=^TestEvaluatorHelperProcess$", "--", "pac-evaluator"}
+	for name, script := range map[string]string{
+		"export": `import { helper } from "./helper.js";
+			var importantHost = "example.com";
+			export function FindProxyForURL(url, host) { return "PROXY " + importantHost + ":1"; }`,
+		"export const":   `export const FindProxyForURL = (url, host) => "PROXY " + host + ":1";`,
+		"export default": `export default function(url, host) { return "PROXY " + host + ":1"; }`,
+		"export list": `function choose(url, host) { return "PROXY " + host + ":1"; }
+			export { choose as FindProxyForURL };`,
+	} {
+		pacServer := newScriptServer(t, script)
+		pacURL, _ := url.Parse(pacServer.URL)
+		for _, command := range [][]string{nil, evaluator} {
+			proxy, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{ModuleSyntax: true, EvaluatorCommand: command})
+			if err != nil {
+				t.Fatalf("%s: Error creating PAC proxy: %v", name, err)
+			}
+			got, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com", Path: "/"})
+			proxy.Close()
+			if err != nil || got != "PROXY example.com:1" {
+				t.Fatalf("%s, evaluator %v: Expected PROXY example.com:1, got %q, %v", name, command != nil, got, err)
+			}
+		}
+
+		// Without the flag the script does not load.
+		if _, err := pac.NewPACProxy(pacURL, nil); !errors.Is(err, pac.ErrExecutePACScript) {
+			t.Fatalf("%s: Expected ErrExecutePACScript without ModuleSyntax, got %v", name, err)
+		}
+		pacServer.Close()
+	}
+
+	// Lexical bindings need no rewriting.
+	for _, script := range []string{
+		`const FindProxyForURL = (url, host) => "PROXY " + host + ":1";`,
+		`let FindProxyForURL = function(url, host) { return "PROXY " + host + ":1"; };`,
+	} {
+		pacServer := newScriptServer(t, script)
+		pacURL, _ := url.Parse(pacServer.URL)
+		proxy, err := pac.NewPACProxy(pacURL, nil)
+		if err != nil {
+			t.Fatalf("Error creating PAC proxy for %s: %v", script, err)
+		}
+		got, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com", Path: "/"})
+		proxy.Close()
+		pacServer.Close()
+		if err != nil || got != "PROXY example.com:1" {
+			t.Fatalf("Expected PROXY example.com:1 for %s, got %q, %v", script, got, err)
+		}
+	}
+
+	// Rewritten lines keep their numbers.
+	proxy := newScriptPACProxy(t, "import x from \"x\";\nexport function FindProxyForURL(url, host) {\n\treturn undefinedHelper();\n}", &pac.PACProxyConfig{ModuleSyntax: true})
+	var evalErr *pac.EvalError
+	if _, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com"}); !errors.As(err, &evalErr) || evalErr.Line != 3 {
+		t.Fatalf("Expected an EvalError on line 3, got %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package pac
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+// nativeMatcher is FindProxyForURL compiled to Go. compileNative only
+// accepts scripts whose sole top-level statement is FindProxyForURL and
+// whose body is made of if/else chains and string literal returns, with
+// conditions over side-effect-free helpers, DNS lookups aside, and string
+// comparisons. Everything else runs in the JavaScript engine. Matchers
+// are immutable and safe for concurrent use.
+type nativeMatcher struct {
+	body nativeStmt
+}
+
+// nativeEnv is the state of one native evaluation.
+type nativeEnv struct {
+	ctx       context.Context
+	p         *PACProxy
+	url, host string
+	lookups   int
+}
+
+// nativeStmt runs a statement and reports whether it returned.
+type nativeStmt func(e *nativeEnv) (result nativeResult, returned bool)
+
+// nativeResult is a returned string, or null or undefined if !defined.
+type nativeResult struct {
+	value   string
+	defined bool
+}
+
+type nativeCond func(e *nativeEnv) bool
+
+type nativeString func(e *nativeEnv) string
+
+// nativeHelpers are the helpers a native matcher may call. Parameters
+// shadowing them disable compilation.
+var nativeHelpers = map[string]bool{
+	"isPlainHostName": true, "dnsDomainIs": true, "localHostOrDomainIs": true, "shExpMatch": true,
+	"isResolvable": true, "isInNet": true, "dnsDomainLevels": true,
+}
+
+// eval runs the matcher for targetURL like evalLocal runs the script.
+func (m *nativeMatcher) eval(ctx context.Context, p *PACProxy, targetURL *url.URL) (nativeResult, int) {
+	e := &nativeEnv{ctx: ctx, p: p}
+	e.url, e.host = p.compat.scriptArgs(targetURL)
+	result, _ := m.body(e)
+	return result, e.lookups
+}
+
+func (e *nativeEnv) lookup(host string) ([]string, error) {
+	e.lookups++
+	return e.p.helperLookup(e.ctx, host)
+}
+
+// resolveIP is GojaRuntime.resolveIP for native matchers.
+func (e *nativeEnv) resolveIP(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	addrs, err := e.lookup(host)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	return net.ParseIP(addrs[0])
+}
+
+// compileNative returns the native matcher of source, nil if source uses
+// anything it cannot compile.
+func compileNative(source string) *nativeMatcher {
+	prog, err := parser.ParseFile(nil, "", source, 0)
+	if err != nil {
+		return nil
+	}
+	var fn *ast.FunctionLiteral
+	for _, st := range prog.Body {
+		switch st := st.(type) {
+		case *ast.FunctionDeclaration:
+			if fn != nil || st.Function.Name == nil || st.Function.Name.Name != "FindProxyForURL" {
+				return nil
+			}
+			fn = st.Function
+		case *ast.EmptyStatement:
+		case *ast.ExpressionStatement:
+			if _, ok := st.Expression.(*ast.StringLiteral); !ok {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	if fn == nil || fn.Async || fn.Generator || len(fn.DeclarationList) > 0 {
+		return nil
+	}
+	params := fn.ParameterList
+	if len(params.List) != 2 || params.Rest != nil {
+		return nil
+	}
+	var names [2]string
+	for i, b := range params.List {
+		id, ok := b.Target.(*ast.Identifier)
+		if !ok || b.Initializer != nil || nativeHelpers[string(id.Name)] {
+			return nil
+		}
+		names[i] = string(id.Name)
+	}
+	if names[0] == names[1] {
+		return nil
+	}
+	c := &nativeCompiler{url: names[0], host: names[1]}
+	body, ok := c.stmt(fn.Body)
+	if !ok {
+		return nil
+	}
+	return &nativeMatcher{body: body}
+}
+
+type nativeCompiler struct {
+	url, host string
+}
+
+func (c *nativeCompiler) stmt(st ast.Statement) (nativeStmt, bool) {
+	switch st := st.(type) {
+	case *ast.BlockStatement:
+		list := make([]nativeStmt, 0, len(st.List))
+		for _, s := range st.List {
+			compiled, ok := c.stmt(s)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, compiled)
+		}
+		return func(e *nativeEnv) (nativeResult, bool) {
+			for _, s := range list {
+				if result, returned := s(e); returned {
+					return result, true
+				}
+			}
+			return nativeResult{}, false
+		}, true
+	case *ast.IfStatement:
+		test, ok := c.cond(st.Test)
+		if !ok {
+			return nil, false
+		}
+		then, ok := c.stmt(st.Consequent)
+		if !ok {
+			return nil, false
+		}
+		otherwise := func(*nativeEnv) (nativeResult, bool) { return nativeResult{}, false }
+		if st.Alternate != nil {
+			if otherwise, ok = c.stmt(st.Alternate); !ok {
+				return nil, false
+			}
+		}
+		return func(e *nativeEnv) (nativeResult, bool) {
+			if test(e) {
+				return then(e)
+			}
+			return otherwise(e)
+		}, true
+	case *ast.ReturnStatement:
+		var result nativeResult
+		switch arg := st.Argument.(type) {
+		case nil, *ast.NullLiteral:
+		case *ast.StringLiteral:
+			result = nativeResult{value: arg.Value.String(), defined: true}
+		default:
+			return nil, false
+		}
+		return func(*nativeEnv) (nativeResult, bool) { return result, true }, true
+	case *ast.EmptyStatement:
+		return func(*nativeEnv) (nativeResult, bool) { return nativeResult{}, false }, true
+	case *ast.ExpressionStatement:
+		// Directives such as "use strict".
+		if _, ok := st.Expression.(*ast.StringLiteral); ok {
+			return func(*nativeEnv) (nativeResult, bool) { return nativeResult{}, false }, true
+		}
+	}
+	return nil, false
+}
+
+func (c *nativeCompiler) cond(expr ast.Expression) (nativeCond, bool) {
+	switch expr := expr.(type) {
+	case *ast.BooleanLiteral:
+		v := expr.Value
+		return func(*nativeEnv) bool { return v }, true
+	case *ast.UnaryExpression:
+		if expr.Operator != token.NOT || expr.Postfix {
+			return nil, false
+		}
+		operand, ok := c.cond(expr.Operand)
+		if !ok {
+			return nil, false
+		}
+		return func(e *nativeEnv) bool { return !operand(e) }, true
+	case *ast.BinaryExpression:
+		return c.binary(expr)
+	case *ast.CallExpression:
+		return c.call(expr)
+	}
+	return nil, false
+}
+
+func (c *nativeCompiler) binary(expr *ast.BinaryExpression) (nativeCond, bool) {
+	switch expr.Operator {
+	case token.LOGICAL_AND, token.LOGICAL_OR:
+		left, ok := c.cond(expr.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := c.cond(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		if expr.Operator == token.LOGICAL_AND {
+			return func(e *nativeEnv) bool { return left(e) && right(e) }, true
+		}
+		return func(e *nativeEnv) bool { return left(e) || right(e) }, true
+	}
+
+	if left, ok := c.str(expr.Left); ok {
+		right, ok := c.str(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		switch expr.Operator {
+		case token.EQUAL, token.STRICT_EQUAL:
+			return func(e *nativeEnv) bool { return left(e) == right(e) }, true
+		case token.NOT_EQUAL, token.STRICT_NOT_EQUAL:
+			return func(e *nativeEnv) bool { return left(e) != right(e) }, true
+		}
+		return nil, false
+	}
+
+	left, ok := c.num(expr.Left)
+	if !ok {
+		return nil, false
+	}
+	right, ok := c.num(expr.Right)
+	if !ok {
+		return nil, false
+	}
+	switch expr.Operator {
+	case token.EQUAL, token.STRICT_EQUAL:
+		return func(e *nativeEnv) bool { return left(e) == right(e) }, true
+	case token.NOT_EQUAL, token.STRICT_NOT_EQUAL:
+		return func(e *nativeEnv) bool { return left(e) != right(e) }, true
+	case token.LESS:
+		return func(e *nativeEnv) bool { return left(e) < right(e) }, true
+	case token.LESS_OR_EQUAL:
+		return func(e *nativeEnv) bool { return left(e) <= right(e) }, true
+	case token.GREATER:
+		return func(e *nativeEnv) bool { return left(e) > right(e) }, true
+	case token.GREATER_OR_EQUAL:
+		return func(e *nativeEnv) bool { return left(e) >= right(e) }, true
+	}
+	return nil, false
+}
+
+// call compiles the boolean helpers.
+func (c *nativeCompiler) call(expr *ast.CallExpression) (nativeCond, bool) {
+	name, args, ok := c.helperCall(expr)
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case name == "isPlainHostName" && len(args) == 1:
+		return func(e *nativeEnv) bool { return isPlainHostName(args[0](e)) }, true
+	case name == "isResolvable" && len(args) == 1:
+		return func(e *nativeEnv) bool { _, err := e.lookup(args[0](e)); return err == nil }, true
+	case name == "dnsDomainIs" && len(args) == 2:
+		return func(e *nativeEnv) bool { return dnsDomainIs(args[0](e), args[1](e)) }, true
+	case name == "localHostOrDomainIs" && len(args) == 2:
+		return func(e *nativeEnv) bool { return localHostOrDomainIs(args[0](e), args[1](e)) }, true
+	case name == "shExpMatch" && len(args) == 2:
+		return func(e *nativeEnv) bool { return e.p.compat.shExpMatch(args[0](e), args[1](e)) }, true
+	case name == "isInNet" && len(args) == 3:
+		return func(e *nativeEnv) bool {
+			ip := e.resolveIP(args[0](e))
+			return ip != nil && e.p.compat.ipInNet(ip, args[1](e), args[2](e))
+		}, true
+	}
+	return nil, false
+}
+
+// helperCall returns the helper and the string arguments of expr.
+func (c *nativeCompiler) helperCall(expr *ast.CallExpression) (string, []nativeString, bool) {
+	callee, ok := expr.Callee.(*ast.Identifier)
+	if !ok || !nativeHelpers[string(callee.Name)] {
+		return "", nil, false
+	}
+	args := make([]nativeString, len(expr.ArgumentList))
+	for i, arg := range expr.ArgumentList {
+		if args[i], ok = c.str(arg); !ok {
+			return "", nil, false
+		}
+	}
+	return string(callee.Name), args, true
+}
+
+// str compiles the url and host parameters and string literals.
+func (c *nativeCompiler) str(expr ast.Expression) (nativeString, bool) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		switch string(expr.Name) {
+		case c.url:
+			return func(e *nativeEnv) string { return e.url }, true
+		case c.host:
+			return func(e *nativeEnv) string { return e.host }, true
+		}
+	case *ast.StringLiteral:
+		s := expr.Value.String()
+		return func(*nativeEnv) string { return s }, true
+	}
+	return nil, false
+}
+
+// num compiles dnsDomainLevels calls and number literals.
+func (c *nativeCompiler) num(expr ast.Expression) (func(e *nativeEnv) float64, bool) {
+	switch expr := expr.(type) {
+	case *ast.NumberLiteral:
+		var n float64
+		switch v := expr.Value.(type) {
+		case int64:
+			n = float64(v)
+		case float64:
+			n = v
+		default:
+			return nil, false
+		}
+		return func(*nativeEnv) float64 { return n }, true
+	case *ast.CallExpression:
+		name, args, ok := c.helperCall(expr)
+		if !ok || name != "dnsDomainLevels" || len(args) != 1 {
+			return nil, false
+		}
+		return func(e *nativeEnv) float64 { return float64(dnsDomainLevels(args[0](e))) }, true
+	}
+	return nil, false
+}
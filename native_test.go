@@ -0,0 +1,109 @@
+package pac_test
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/pactest"
+)
+
+// TestNativeMatcher tests that simple scripts compiled to Go decide and
+// resolve like the JavaScript engine, and that other scripts are not compiled.
+func TestNativeMatcher(t *testing.T) {
+	script := `"use strict";
+	function FindProxyForURL(u, h) {
+		if (isPlainHostName(h) || dnsDomainIs(h, ".corp.example.com") || h === "corp.example.com") {
+			return "DIRECT";
+		} else if (shExpMatch(u, "*://*.internal/*") && !localHostOrDomainIs(h, "www.internal")) {
+			return "PROXY internal.example.com:3128";
+		}
+		if (isInNet(h, "10.0.0.0", "255.0.0.0") || (isResolvable(h) && isInNet(h, "192.168.0.0", "255.255.0.0"))) {
+			return "DIRECT";
+		}
+		if (dnsDomainLevels(h) > 2) {
+			return null;
+		}
+		return "PROXY default.example.com:3128";
+	}`
+	server := newScriptServer(t, script)
+	defer server.Close()
+	hosts := []string{"intranet", "a.corp.example.com", "corp.example.com", "db.internal", "www.internal",
+		"10.1.2.3", "lan.example.com", "www.example.com", "a.b.example.com"}
+
+	find := func(disable bool) ([]string, []string, int32) {
+		resolver := pactest.NewResolver(map[string][]string{"lan.example.com": {"192.168.1.7"}, "www.example.com": {"93.184.215.14"}})
+		var compiled atomic.Int32
+		proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{
+			Resolver:             resolver,
+			DisableNativeMatcher: disable,
+			EmptyResult:          pac.EmptyResultDirect,
+			Logger: pac.LoggerFunc(func(_ context.Context, _ pac.LogLevel, msg string, _ ...any) {
+				if msg == "PAC script compiled to native matcher" {
+					compiled.Add(1)
+				}
+			}),
+		})
+		var results []string
+		for _, host := range hosts {
+			got, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "https", Host: host, Path: "/"})
+			if err != nil {
+				t.Fatalf("%s: error finding proxy: %v", host, err)
+			}
+			results = append(results, host+" "+string(got))
+		}
+		return results, resolver.Lookups(), compiled.Load()
+	}
+	native, nativeLookups, compiled := find(false)
+	js, jsLookups, jsCompiled := find(true)
+	if compiled != 1 || jsCompiled != 0 {
+		t.Fatalf("Expected the script to be compiled once natively and not when disabled, got %d and %d", compiled, jsCompiled)
+	}
+	if !reflect.DeepEqual(native, js) {
+		t.Fatalf("Native results differ from JavaScript:\n%q\n%q", native, js)
+	}
+	if !reflect.DeepEqual(nativeLookups, jsLookups) {
+		t.Fatalf("Native lookups %q differ from JavaScript %q", nativeLookups, jsLookups)
+	}
+	want := []string{"intranet DIRECT", "a.corp.example.com DIRECT", "corp.example.com DIRECT",
+		"db.internal PROXY internal.example.com:3128", "www.internal PROXY default.example.com:3128",
+		"10.1.2.3 DIRECT", "lan.example.com DIRECT", "www.example.com PROXY default.example.com:3128", "a.b.example.com DIRECT"}
+	if !reflect.DeepEqual(native, want) {
+		t.Fatalf("Expected %q, got %q", want, native)
+	}
+
+	// Helper traces need the JavaScript engine.
+	proxy := newTestPACProxyFromURL(t, server.URL, nil)
+	var calls []string
+	ctx := pac.WithHelperTrace(context.Background(), func(c pac.HelperCall) { calls = append(calls, c.Name) })
+	if _, err := proxy.FindProxyStringForURLContext(ctx, &url.URL{Scheme: "https", Host: "intranet"}); err != nil {
+		t.Fatalf("Error finding proxy: %v", err)
+	}
+	if !slices.Equal(calls, []string{"isPlainHostName"}) {
+		t.Fatalf("Expected the helper calls to be traced, got %q", calls)
+	}
+
+	for _, script := range []string{
+		`function FindProxyForURL(url, host) { var h = host; return "DIRECT"; }`,
+		`function FindProxyForURL(url, host) { return myIpAddress() == "10.0.0.1" ? "DIRECT" : "PROXY a:1"; }`,
+		`function FindProxyForURL(url, shExpMatch) { if (shExpMatch(url, "*")) return "DIRECT"; }`,
+		`var x = 1; function FindProxyForURL(url, host) { return "DIRECT"; }`,
+	} {
+		server := newScriptServer(t, script)
+		var compiled atomic.Int32
+		proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{Logger: pac.LoggerFunc(func(_ context.Context, _ pac.LogLevel, msg string, _ ...any) {
+			if msg == "PAC script compiled to native matcher" {
+				compiled.Add(1)
+			}
+		})})
+		proxy.Close()
+		server.Close()
+		if compiled.Load() != 0 {
+			t.Errorf("Expected %s not to be compiled natively", script)
+		}
+	}
+}
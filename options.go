@@ -0,0 +1,72 @@
+package pac
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures a PACProxy on top of the PACProxyConfig passed to
+// NewPACProxy. Unlike the config fields, an Option always means what it
+// says: WithScriptTimeout(0) disables the timeout instead of selecting the
+// default.
+type Option func(*PACProxyConfig)
+
+// WithClient sets the HTTP client that fetches the PAC script.
+func WithClient(client *http.Client) Option {
+	return func(cfg *PACProxyConfig) { cfg.Client = client }
+}
+
+// WithScriptTimeout limits each script evaluation to d; 0 means no limit.
+func WithScriptTimeout(d time.Duration) Option {
+	return func(cfg *PACProxyConfig) { cfg.ScriptTimeout = explicitDuration(d) }
+}
+
+// WithDNSLookupTimeout limits each helper DNS lookup to d; 0 means no limit.
+func WithDNSLookupTimeout(d time.Duration) Option {
+	return func(cfg *PACProxyConfig) { cfg.DNSLookupTimeout = explicitDuration(d) }
+}
+
+// WithMaxScriptSize limits the PAC script to n bytes; 0 means no limit.
+func WithMaxScriptSize(n int64) Option {
+	return func(cfg *PACProxyConfig) {
+		if n == 0 {
+			n = -1
+		}
+		cfg.MaxScriptSize = n
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger Logger) Option {
+	return func(cfg *PACProxyConfig) { cfg.Logger = logger }
+}
+
+// WithCache caches decisions for ttl in store, or in a MemoryStore if store
+// is nil; a ttl of 0 disables the decision cache.
+func WithCache(store Store, ttl time.Duration) Option {
+	return func(cfg *PACProxyConfig) { cfg.DecisionCache, cfg.DecisionCacheTTL = store, ttl }
+}
+
+// explicitDuration maps 0, which selects a default in PACProxyConfig, to
+// the negative value that means no limit.
+func explicitDuration(d time.Duration) time.Duration {
+	if d == 0 {
+		return -1
+	}
+	return d
+}
+
+// applyOptions returns config with opts applied to a copy of it.
+func applyOptions(config *PACProxyConfig, opts []Option) *PACProxyConfig {
+	if len(opts) == 0 {
+		return config
+	}
+	cfg := PACProxyConfig{}
+	if config != nil {
+		cfg = *config
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &cfg
+}
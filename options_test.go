@@ -0,0 +1,69 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestOptions tests that options apply on top of the config and that their
+// zero values mean no limit rather than the default.
+func TestOptions(t *testing.T) {
+	script := `var n = 0;
+	function FindProxyForURL(url, host) {
+		if (host == "loop.example.com") { var end = Date.now() + 100; while (Date.now() < end) {} }
+		n++;
+		return "PROXY p" + n + ".example.com:3128";
+	}`
+	pacServer := newScriptServer(t, script)
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+
+	var logged atomic.Int64
+	logger := pac.LoggerFunc(func(context.Context, pac.LogLevel, string, ...any) { logged.Add(1) })
+	config := &pac.PACProxyConfig{ScriptTimeout: 20 * time.Millisecond, MaxScriptSize: 10}
+	proxy, err := pac.NewPACProxy(pacURL, config,
+		pac.WithClient(&http.Client{Timeout: 10 * time.Second}),
+		pac.WithMaxScriptSize(0),
+		pac.WithLogger(logger),
+		pac.WithCache(nil, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("Error creating PAC proxy: %v", err)
+	}
+	if config.MaxScriptSize != 10 || config.DecisionCacheTTL != 0 {
+		t.Fatalf("Options modified the config: %+v", config)
+	}
+	if logged.Load() == 0 {
+		t.Fatal("Expected the logger of WithLogger to be used")
+	}
+
+	for _, target := range []string{"http://example.com/a", "http://example.com/b"} {
+		targetURL, _ := url.Parse(target)
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil || got != "PROXY p1.example.com:3128" {
+			t.Fatalf("%s: expected cached PROXY p1.example.com:3128, got %q, %v", target, got, err)
+		}
+	}
+	loopURL, _ := url.Parse("http://loop.example.com/")
+	if _, err := proxy.FindProxyStringForURL(loopURL); !errors.Is(err, pac.ErrPACScriptTimeout) {
+		t.Fatalf("Expected error %v from the config timeout, got %v", pac.ErrPACScriptTimeout, err)
+	}
+
+	proxy, err = pac.NewPACProxy(pacURL, config, pac.WithMaxScriptSize(0), pac.WithScriptTimeout(0))
+	if err != nil {
+		t.Fatalf("Error creating PAC proxy: %v", err)
+	}
+	if _, err := proxy.FindProxyStringForURL(loopURL); err != nil {
+		t.Fatalf("Expected WithScriptTimeout(0) to remove the timeout, got %v", err)
+	}
+	if _, err := pac.NewPACProxy(pacURL, nil, pac.WithMaxScriptSize(10)); !errors.Is(err, pac.ErrPACScriptTooLarge) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrPACScriptTooLarge, err)
+	}
+}
@@ -0,0 +1,64 @@
+package pac
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// OverrideRule routes matching destinations to a fixed result without
+// evaluating the PAC script.
+type OverrideRule struct {
+	// Match is a single entry in BypassList syntax, e.g. "api.example.com",
+	// ".corp.example", "10.0.0.0/8" or "*.lab.*".
+	Match string
+	// Result is returned instead of the PAC result, e.g. "DIRECT" or
+	// "PROXY fallback.example.com:3128".
+	Result ProxyString
+}
+
+type compiledOverride struct {
+	rule   bypassRule
+	result ProxyString
+}
+
+func compileOverrides(rules []OverrideRule) ([]compiledOverride, error) {
+	compiled := make([]compiledOverride, 0, len(rules))
+	for _, r := range rules {
+		rule, ok := parseBypassRule(r.Match)
+		if !ok {
+			return nil, fmt.Errorf("invalid override match %q", r.Match)
+		}
+		if len(r.Result.Proxies()) == 0 {
+			return nil, fmt.Errorf("%w: override result %q", ErrNoValidProxy, r.Result)
+		}
+		compiled = append(compiled, compiledOverride{rule: rule, result: r.Result})
+	}
+	return compiled, nil
+}
+
+// SetOverrides replaces the override rules. Rules are checked in order before
+// the bypass list and the PAC script; the first match wins.
+func (p *PACProxy) SetOverrides(rules []OverrideRule) error {
+	compiled, err := compileOverrides(rules)
+	if err != nil {
+		return err
+	}
+	p.overrides.Store(&compiled)
+	p.logf(context.Background(), LogInfo, "PAC overrides updated", "rules", len(compiled))
+	return nil
+}
+
+func (p *PACProxy) matchOverride(target *url.URL) (ProxyString, bool) {
+	overrides := p.overrides.Load()
+	if overrides == nil || len(*overrides) == 0 {
+		return "", false
+	}
+	host, port, ip := targetHostPort(target)
+	for _, o := range *overrides {
+		if o.rule.matches(host, port, ip) {
+			return o.result, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,167 @@
+package pactest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"go.yaml.in/yaml/v3"
+)
+
+// Case is one row of a decision table: the proxy string a PAC must return
+// for URL. Want is compared directive by directive, ignoring whitespace, so
+// "PROXY a:1;DIRECT" matches "PROXY a:1; DIRECT".
+type Case struct {
+	// Name is the subtest name of the row in Run; it defaults to URL.
+	Name string `yaml:"name,omitempty"`
+	URL  string `yaml:"url"`
+	Want string `yaml:"want"`
+}
+
+func (c Case) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.URL
+}
+
+// Mismatch is a Case the PAC did not decide as expected.
+type Mismatch struct {
+	Case Case
+	// Got is the proxy string returned, empty if Err is set.
+	Got string
+	// Err is why the URL could not be evaluated.
+	Err error
+}
+
+// String describes the mismatch with a diff of the directives, e.g.
+//
+//	https://www.example.com/
+//	  want: PROXY a.example.com:3128; DIRECT
+//	  got:  PROXY b.example.com:3128; DIRECT
+//	  diff: #1 want "PROXY a.example.com:3128", got "PROXY b.example.com:3128"
+func (m Mismatch) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, m.Case.URL)
+	want := directives(m.Case.Want)
+	fmt.Fprintf(&b, "  want: %s\n", strings.Join(want, "; "))
+	if m.Err != nil {
+		fmt.Fprintf(&b, "  err:  %v", m.Err)
+		return b.String()
+	}
+	got := directives(m.Got)
+	fmt.Fprintf(&b, "  got:  %s", strings.Join(got, "; "))
+	for i := range max(len(want), len(got)) {
+		switch {
+		case i >= len(got):
+			fmt.Fprintf(&b, "\n  diff: #%d missing %q", i+1, want[i])
+		case i >= len(want):
+			fmt.Fprintf(&b, "\n  diff: #%d extra %q", i+1, got[i])
+		case want[i] != got[i]:
+			fmt.Fprintf(&b, "\n  diff: #%d want %q, got %q", i+1, want[i], got[i])
+		}
+	}
+	return b.String()
+}
+
+// directives splits a proxy string into its directives with normalized
+// whitespace and upper-case keywords.
+func directives(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = strings.ToUpper(fields[0])
+		list = append(list, strings.Join(fields, " "))
+	}
+	return list
+}
+
+// ParseCases parses a YAML decision table, a list of rows such as
+//
+//	# decisions.yaml
+//	- url: https://intranet.corp/
+//	  want: DIRECT
+//	- name: internet via the office proxy
+//	  url: https://www.example.com/
+//	  want: PROXY proxy.example.com:3128; DIRECT
+func ParseCases(data []byte) ([]Case, error) {
+	var cases []Case
+	if err := yaml.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("pactest: parse decision table: %w", err)
+	}
+	for i, c := range cases {
+		if c.URL == "" {
+			return nil, fmt.Errorf("pactest: decision table row %d has no url", i+1)
+		}
+	}
+	return cases, nil
+}
+
+// LoadCases reads the YAML decision table at path, see ParseCases.
+func LoadCases(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cases, err := ParseCases(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cases, nil
+}
+
+// Check evaluates every case against proxy and returns the mismatches in
+// table order.
+func Check(ctx context.Context, proxy *pac.PACProxy, cases []Case) []Mismatch {
+	var mismatches []Mismatch
+	for _, c := range cases {
+		if m, ok := check(ctx, proxy, c); !ok {
+			mismatches = append(mismatches, m)
+		}
+	}
+	return mismatches
+}
+
+func check(ctx context.Context, proxy *pac.PACProxy, c Case) (Mismatch, bool) {
+	u, err := url.Parse(c.URL)
+	if err == nil && u.Host == "" {
+		err = fmt.Errorf("invalid URL %q", c.URL)
+	}
+	if err != nil {
+		return Mismatch{Case: c, Err: err}, false
+	}
+	result, err := proxy.FindProxyStringForURLContext(ctx, u)
+	if err != nil {
+		return Mismatch{Case: c, Err: err}, false
+	}
+	got := string(result)
+	return Mismatch{Case: c, Got: got}, strings.Join(directives(got), ";") == strings.Join(directives(c.Want), ";")
+}
+
+// Run runs every case against proxy as a subtest of t, reporting each
+// mismatch with a diff:
+//
+//	func TestPAC(t *testing.T) {
+//		cases, err := pactest.LoadCases("testdata/decisions.yaml")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		pactest.Run(t, proxy, cases)
+//	}
+func Run(t *testing.T, proxy *pac.PACProxy, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.name(), func(t *testing.T) {
+			if m, ok := check(t.Context(), proxy, c); !ok {
+				t.Error(m.String())
+			}
+		})
+	}
+}
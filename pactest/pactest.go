@@ -0,0 +1,216 @@
+// Package pactest provides deterministic stand-ins for the environment a PAC
+// script sees, so code that depends on a PACProxy can be unit-tested:
+//
+//	resolver := pactest.NewResolver(map[string][]string{"intranet.corp": {"10.1.2.3"}})
+//	clock := pactest.NewClock(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+//	server := pactest.NewServer(script)
+//	proxy, err := pac.NewPACProxy(server.URL(), &pac.PACProxyConfig{
+//		Client:         server.Client(),
+//		Resolver:       resolver,
+//		Now:            clock.Now,
+//		InterfaceAddrs: pactest.InterfaceAddrs("10.1.0.7/16"),
+//	})
+//
+// Scripts run by EvaluatorCommand or EvaluatorWASM use the clock and
+// interface addresses of their own process; only lookups go through the
+// Resolver.
+package pactest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver is a pac.Resolver answering from a fixed host to address map.
+// Hosts that are not in the map do not resolve.
+type Resolver struct {
+	mu      sync.Mutex
+	hosts   map[string][]string
+	lookups []string
+}
+
+// NewResolver returns a Resolver answering from hosts, which may be nil.
+func NewResolver(hosts map[string][]string) *Resolver {
+	r := &Resolver{hosts: make(map[string][]string)}
+	for host, addrs := range hosts {
+		r.Set(host, addrs...)
+	}
+	return r
+}
+
+// Set makes host resolve to addrs, or not resolve if addrs is empty.
+func (r *Resolver) Set(host string, addrs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if len(addrs) == 0 {
+		delete(r.hosts, host)
+		return
+	}
+	r.hosts[host] = append([]string(nil), addrs...)
+}
+
+// LookupHost implements pac.Resolver.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups = append(r.lookups, host)
+	addrs, ok := r.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return append([]string(nil), addrs...), nil
+}
+
+// Lookups returns the hosts looked up so far, in order.
+func (r *Resolver) Lookups() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lookups...)
+}
+
+// Clock is a clock that only moves when told to. Its Now method fits
+// PACProxyConfig.Now.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// InterfaceAddrs returns a function for PACProxyConfig.InterfaceAddrs that
+// reports addrs, each an IP address or CIDR prefix such as "10.1.0.7/16".
+// It panics on malformed addresses.
+func InterfaceAddrs(addrs ...string) func() ([]net.Addr, error) {
+	list := make([]net.Addr, len(addrs))
+	for i, addr := range addrs {
+		if ip, ipnet, err := net.ParseCIDR(addr); err == nil {
+			list[i] = &net.IPNet{IP: ip, Mask: ipnet.Mask}
+			continue
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			panic(fmt.Sprintf("pactest: invalid interface address %q", addr))
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		list[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	return func() ([]net.Addr, error) {
+		return append([]net.Addr(nil), list...), nil
+	}
+}
+
+// Server serves a PAC script from memory, without opening a socket, to the
+// client returned by Client.
+type Server struct {
+	mu       sync.Mutex
+	script   string
+	status   int
+	requests int
+}
+
+// NewServer returns a Server serving script.
+func NewServer(script string) *Server {
+	return &Server{script: script, status: http.StatusOK}
+}
+
+// URL returns the PAC URL of the server, to be fetched with Client.
+func (s *Server) URL() *url.URL {
+	return &url.URL{Scheme: "http", Host: "pac.test", Path: "/proxy.pac"}
+}
+
+// Client returns a client that answers every request from the server.
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: s}
+}
+
+// SetScript replaces the script served.
+func (s *Server) SetScript(script string) {
+	s.mu.Lock()
+	s.script = script
+	s.mu.Unlock()
+}
+
+// SetStatus makes the server answer with status and no body, e.g. to test
+// fetch failures, until it is set back to http.StatusOK.
+func (s *Server) SetStatus(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+// Requests returns the number of requests served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// RoundTrip implements http.RoundTripper.
+func (s *Server) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.requests++
+	status, script := s.status, s.script
+	s.mu.Unlock()
+
+	header := make(http.Header)
+	body := ""
+	if status == http.StatusOK {
+		header.Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		body = script
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package pactest_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/pactest"
+)
+
+const script = `function FindProxyForURL(url, host) {
+	if (isInNet(host, "10.0.0.0", "255.0.0.0")) {
+		return "DIRECT";
+	}
+	if (!weekdayRange("MON", "FRI", "GMT")) {
+		return "PROXY weekend.example.com:3128";
+	}
+	if (isInNet(myIpAddress(), "10.1.0.0", "255.255.0.0")) {
+		return "PROXY office.example.com:3128";
+	}
+	return "PROXY remote.example.com:3128";
+}`
+
+// TestPACProxy tests that a PACProxy wired to the fakes is deterministic.
+func TestPACProxy(t *testing.T) {
+	resolver := pactest.NewResolver(map[string][]string{"intranet.corp": {"10.1.2.3"}})
+	resolver.Set("www.example.com", "93.184.215.14")
+	monday := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	clock := pactest.NewClock(monday)
+	server := pactest.NewServer(script)
+	proxy, err := pac.NewPACProxy(server.URL(), &pac.PACProxyConfig{
+		Client:         server.Client(),
+		Resolver:       resolver,
+		Now:            clock.Now,
+		InterfaceAddrs: pactest.InterfaceAddrs("127.0.0.1/8", "10.1.0.7/16"),
+	})
+	if err != nil {
+		t.Fatalf("Error creating PACProxy: %v", err)
+	}
+	defer proxy.Close()
+
+	find := func(raw string) pac.ProxyString {
+		t.Helper()
+		u, _ := url.Parse(raw)
+		result, err := proxy.FindProxyStringForURL(u)
+		if err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", raw, err)
+		}
+		return result
+	}
+	if got := find("http://intranet.corp/"); got != "DIRECT" {
+		t.Fatalf("Expected DIRECT for the intranet, got %q", got)
+	}
+	if got := find("https://www.example.com/"); got != "PROXY office.example.com:3128" {
+		t.Fatalf("Expected the office proxy, got %q", got)
+	}
+	clock.Advance(5 * 24 * time.Hour)
+	if got := find("https://www.example.com/"); got != "PROXY weekend.example.com:3128" {
+		t.Fatalf("Expected the weekend proxy on Saturday, got %q", got)
+	}
+	if got := find("https://unknown.example.com/"); got != "PROXY weekend.example.com:3128" {
+		t.Fatalf("Expected an unresolvable host to be proxied, got %q", got)
+	}
+	want := []string{"intranet.corp", "www.example.com", "www.example.com", "unknown.example.com"}
+	if got := resolver.Lookups(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected lookups %q, got %q", want, got)
+	}
+
+	server.SetScript(`function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	if changed, err := proxy.Reload(context.Background()); err != nil || !changed {
+		t.Fatalf("Expected the new script to be loaded, got %v, %v", changed, err)
+	}
+	if got := find("https://www.example.com/"); got != "DIRECT" {
+		t.Fatalf("Expected the new script to be used, got %q", got)
+	}
+	server.SetStatus(http.StatusServiceUnavailable)
+	if _, err := proxy.Reload(context.Background()); err == nil {
+		t.Fatalf("Expected reloading to fail with status 503")
+	}
+	if server.Requests() != 3 {
+		t.Fatalf("Expected 3 requests, got %d", server.Requests())
+	}
+}
+
+// TestDecisionTable tests that decision tables from YAML run as subtests and
+// that mismatches are described with a diff.
+func TestDecisionTable(t *testing.T) {
+	server := pactest.NewServer(`function FindProxyForURL(url, host) {
+		if (dnsDomainIs(host, ".corp")) {
+			return "DIRECT";
+		}
+		return "PROXY a.example.com:3128; DIRECT";
+	}`)
+	proxy, err := pac.NewPACProxy(server.URL(), &pac.PACProxyConfig{Client: server.Client()})
+	if err != nil {
+		t.Fatalf("Error creating PACProxy: %v", err)
+	}
+	defer proxy.Close()
+
+	cases, err := pactest.ParseCases([]byte(`
+- url: https://intranet.corp/
+  want: DIRECT
+- name: internet
+  url: https://www.example.com/
+  want: proxy a.example.com:3128;DIRECT
+`))
+	if err != nil {
+		t.Fatalf("Error parsing decision table: %v", err)
+	}
+	if len(cases) != 2 || cases[1].Name != "internet" {
+		t.Fatalf("Unexpected cases: %+v", cases)
+	}
+	pactest.Run(t, proxy, cases)
+
+	mismatches := pactest.Check(context.Background(), proxy, []pactest.Case{
+		{URL: "https://intranet.corp/", Want: "DIRECT"},
+		{URL: "https://www.example.com/", Want: "PROXY b.example.com:3128"},
+		{Name: "relative", URL: "/path", Want: "DIRECT"},
+	})
+	if len(mismatches) != 2 {
+		t.Fatalf("Expected 2 mismatches, got %d: %v", len(mismatches), mismatches)
+	}
+	want := `https://www.example.com/
+  want: PROXY b.example.com:3128
+  got:  PROXY a.example.com:3128; DIRECT
+  diff: #1 want "PROXY b.example.com:3128", got "PROXY a.example.com:3128"
+  diff: #2 extra "DIRECT"`
+	if got := mismatches[0].String(); got != want {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+	if mismatches[1].Err == nil {
+		t.Fatalf("Expected an error for a URL without host")
+	}
+
+	if _, err := pactest.ParseCases([]byte("- want: DIRECT\n")); err == nil {
+		t.Fatalf("Expected an error for a row without url")
+	}
+}
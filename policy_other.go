@@ -0,0 +1,12 @@
+//go:build !gopac_testhooks && !windows
+// +build !gopac_testhooks,!windows
+
+package pac
+
+import "fmt"
+
+// retrievePolicyPACURL reports ErrPACURLNotFound on platforms whose machine
+// policies are part of the system setting.
+func retrievePolicyPACURL() (string, error) {
+	return "", fmt.Errorf("%w: no machine policy on this platform", ErrPACURLNotFound)
+}
@@ -0,0 +1,29 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import "sync"
+
+var (
+	testPolicyPACURL   string
+	testPolicyPACURLMu sync.RWMutex
+)
+
+// SetTestPolicyPACURL overrides the machine policy PAC URL lookup for
+// tests. Pass an empty string to reset to "not found".
+func SetTestPolicyPACURL(pacURL string) {
+	testPolicyPACURLMu.Lock()
+	testPolicyPACURL = pacURL
+	testPolicyPACURLMu.Unlock()
+}
+
+func retrievePolicyPACURL() (string, error) {
+	testPolicyPACURLMu.RLock()
+	pacURL := testPolicyPACURL
+	testPolicyPACURLMu.RUnlock()
+	if pacURL == "" {
+		return "", ErrPACURLNotFound
+	}
+	return pacURL, nil
+}
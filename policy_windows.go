@@ -0,0 +1,40 @@
+//go:build !gopac_testhooks && windows
+// +build !gopac_testhooks,windows
+
+package pac
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// policyKeys hold machine-wide PAC URLs: the one set by group policy and
+// the machine settings used when ProxySettingsPerUser is 0.
+var policyKeys = []string{
+	`SOFTWARE\Policies\Microsoft\Windows\CurrentVersion\Internet Settings`,
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\Internet Settings`,
+}
+
+// retrievePolicyPACURL retrieves the machine-wide PAC URL from the Windows
+// registry.
+func retrievePolicyPACURL() (string, error) {
+	for _, path := range policyKeys {
+		key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+		if err != nil {
+			if err == registry.ErrNotExist {
+				continue
+			}
+			return "", fmt.Errorf("failed to open registry key: %w", err)
+		}
+		pacURL, _, err := key.GetStringValue("AutoConfigURL")
+		key.Close()
+		if err != nil && err != registry.ErrNotExist {
+			return "", fmt.Errorf("failed to get registry value: %w", err)
+		}
+		if pacURL != "" {
+			return pacURL, nil
+		}
+	}
+	return "", ErrPACURLNotFound
+}
@@ -2,15 +2,24 @@ package pac
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"runtime/pprof"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dop251/goja"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Custom error types
@@ -22,6 +31,20 @@ var (
 	ErrConvertResult     = errors.New("error converting result to string")
 	ErrPACScriptTimeout  = errors.New("PAC script execution timed out")
 	ErrPACScriptTooLarge = errors.New("PAC script exceeds maximum size")
+	ErrEmptyResult       = errors.New("PAC script returned an empty result")
+	ErrPACMemoryLimit    = errors.New("PAC script exceeded the memory limit")
+	ErrClosed            = errors.New("PAC proxy is closed")
+	ErrInvalidConfig     = errors.New("invalid PAC proxy configuration")
+)
+
+// EmptyResultPolicy controls how empty or null PAC results are handled.
+type EmptyResultPolicy int
+
+const (
+	// EmptyResultError reports empty or null results as ErrEmptyResult.
+	EmptyResultError EmptyResultPolicy = iota
+	// EmptyResultDirect treats empty or null results as DIRECT, like browsers do.
+	EmptyResultDirect
 )
 
 const (
@@ -31,146 +54,600 @@ const (
 	defaultMaxScriptSize    = 1 << 20 // 1 MiB
 )
 
+// defaultEvalSchemes maps WebSocket URLs to their HTTP equivalent before
+// evaluation, as browsers do.
+var defaultEvalSchemes = map[string]string{"ws": "http", "wss": "https"}
+
 // PACProxy holds the PAC script, the JavaScript VM and custom HTTP client
 type PACProxy struct {
-	script string
-	vm     JSRuntime
-	mu     sync.Mutex
-	client *http.Client
-
-	scriptTimeout time.Duration
-	logger        Logger
-	logHook       LogHook
+	script          atomic.Pointer[pacScript]
+	pacURL          string
+	client          *http.Client
+	tlsPins         []string
+	httpsOnly       bool
+	scriptSHA256    string
+	scriptKey       ed25519.PublicKey
+	signatureURL    string
+	maxScriptSize   int64
+	dnsTimeout      time.Duration
+	dnsCache        *DNSCache
+	dnsFilter       DNSFilter
+	resolver        Resolver
+	now             func() time.Time
+	interfaceAddrs  func() ([]net.Addr, error)
+	refreshInterval time.Duration
+	refreshMin      time.Duration
+	refreshMax      time.Duration
+	fetchLifetime   atomic.Int64
+	nextRefresh     atomic.Int64
+	refreshing      atomic.Bool
+	reloadMu        sync.Mutex
+	bg              *background
+	scriptCache     Store
+	scriptCacheTTL  time.Duration
+	decisions       Store
+	decisionTTL     time.Duration
+	decisionFile    string
+	decisionStats   cacheCounters
+	scriptStats     cacheCounters
+	evalStats       evalCounters
+
+	scriptTimeout   time.Duration
+	memoryLimit     int64
+	sandbox         bool
+	disableNative   bool
+	newRuntime      func() JSRuntime
+	launchEvaluator func() (*evaluatorProcess, error)
+	wasm            *wasmEvaluator
+	slowEval        time.Duration
+	proxySchemes    ProxySchemeMap
+	evalSchemes     map[string]string
+	emptyResult     EmptyResultPolicy
+	compat          CompatMode
+	extensions      bool
+	moduleSyntax    bool
+	entryPoints     []string
+	clientGlobal    string
+	clientArg       bool
+	evalFingerprint string
+	selector        Selector
+	affinity        *proxyAffinity
+	latency         *proxyLatency
+	health          *proxyHealth
+	checker         *healthChecker
+	metrics         *proxyMetrics
+	decisionCounts  *decisionCounts
+	recent          *recentEvals
+	detection       *Detection
+	bypass          *BypassList
+	overrides       atomic.Pointer[[]compiledOverride]
+	credentials     CredentialProvider
+	filter          ProxyFilter
+	closeOnce       sync.Once
+	logMu           sync.Mutex
+	logging         atomic.Pointer[logging]
+	logContext      func(ctx context.Context) []any
+	logFullURLs     bool
+	onFetch         func(context.Context, FetchEvent)
+	onEval          func(context.Context, EvalEvent)
+	onError         func(context.Context, ErrorEvent)
+	audit           AuditFunc
+	auditDNS        bool
+	sink            MetricsSink
+	reported        cacheReport
+	tracer          trace.Tracer
 }
 
 // PACProxyConfig holds configuration options for Proxy
 type PACProxyConfig struct {
-	Client           *http.Client
-	MaxScriptSize    int64
-	ScriptTimeout    time.Duration
-	DNSLookupTimeout time.Duration
-	HTTPTimeout      time.Duration
-	Logger           Logger
-	LogHook          LogHook
+	Client                *http.Client
+	MaxScriptSize         int64
+	ScriptTimeout         time.Duration
+	ScriptMemoryLimit     int64 // total bytes allocated by one evaluation, not live memory; needs EvaluatorCommand
+	Sandbox               bool
+	DisableNativeMatcher  bool
+	NewRuntime            func() JSRuntime
+	EvaluatorCommand      []string
+	EvaluatorWASM         []byte
+	EvaluatorMemoryLimit  int64
+	EvaluatorWASMCacheDir string
+	SlowEvalThreshold     time.Duration
+	DNSLookupTimeout      time.Duration
+	DNSCacheTTL           time.Duration
+	DNSCache              *DNSCache
+	DNSFilter             DNSFilter
+	Resolver              Resolver
+	Now                   func() time.Time
+	InterfaceAddrs        func() ([]net.Addr, error)
+	HTTPTimeout           time.Duration
+	FetchDenyNets         []netip.Prefix
+	HTTPSOnly             bool
+	TLSPins               []string
+	ScriptSHA256          string
+	ScriptPublicKey       ed25519.PublicKey
+	ScriptSignatureURL    string
+	RefreshInterval       time.Duration
+	RefreshMinInterval    time.Duration
+	RefreshMaxInterval    time.Duration
+	ScriptCache           Store
+	ScriptCacheTTL        time.Duration
+	DecisionCacheTTL      time.Duration
+	DecisionCache         Store
+	DecisionCacheFile     string
+	DecisionStatsByHost   bool
+	ProxySchemes          ProxySchemeMap
+	EvalSchemes           map[string]string
+	EmptyResult           EmptyResultPolicy
+	CompatMode            CompatMode
+	ExtensionHelpers      bool
+	ModuleSyntax          bool
+	EntryPoints           []string
+	ClientIPGlobal        string
+	ClientIPArgument      bool
+	Bypass                *BypassList
+	Overrides             []OverrideRule
+	Credentials           CredentialProvider
+	ProxyFilter           ProxyFilter
+	Selector              Selector
+	AffinityTTL           time.Duration
+	LatencyMaxAge         time.Duration
+	FailedProxyTimeout    time.Duration
+	FailureThreshold      int
+	HealthCheck           HealthCheckFunc
+	HealthCheckInterval   time.Duration
+	HealthCheckTimeout    time.Duration
+	Logger                Logger
+	LogHook               LogHook
+	LogContext            func(ctx context.Context) []any
+	LogFullURLs           bool
+	OnFetch               func(ctx context.Context, e FetchEvent)
+	OnEval                func(ctx context.Context, e EvalEvent)
+	OnError               func(ctx context.Context, e ErrorEvent)
+	Audit                 AuditFunc
+	AuditDNS              bool
+	Metrics               MetricsSink
+	TracerProvider        trace.TracerProvider
+	ExpvarPrefix          string
+	Detection             *Detection
 }
 
-// NewPACProxy creates a new Proxy instance with the given configuration
-func NewPACProxy(pacURL *url.URL, config *PACProxyConfig) (*PACProxy, error) {
-	cfg := normalizePACProxyConfig(config)
-	client := cfg.Client
-	ctx := context.Background()
+// NewPACProxy creates a new Proxy instance with the given configuration,
+// which may be nil, and the options applied on top of it.
+func NewPACProxy(pacURL *url.URL, config *PACProxyConfig, opts ...Option) (*PACProxy, error) {
+	return NewPACProxyContext(context.Background(), pacURL, config, opts...)
+}
+
+// NewPACProxyContext is like NewPACProxy but bounds fetching, verifying and
+// compiling the script, including DNS lookups of its top-level code, by
+// ctx and logs with it. ctx does not limit the lifetime of the PACProxy.
+func NewPACProxyContext(ctx context.Context, pacURL *url.URL, config *PACProxyConfig, opts ...Option) (*PACProxy, error) {
+	cfg := normalizePACProxyConfig(applyOptions(config, opts))
 	pacURLStr := pacURL.String()
+	if cfg.ScriptMemoryLimit > 0 && len(cfg.EvaluatorCommand) == 0 {
+		// Only a helper process runs nothing but the script, so only there
+		// can its allocations be told apart from the application's.
+		return nil, fmt.Errorf("%w: ScriptMemoryLimit needs EvaluatorCommand", ErrInvalidConfig)
+	}
+	if err := checkSecureURL(pacURL, cfg.HTTPSOnly); err != nil {
+		return nil, &FetchError{URL: pacURLStr, Err: err}
+	}
+
+	if cfg.ScriptPublicKey != nil && cfg.ScriptSignatureURL == "" {
+		cfg.ScriptSignatureURL = pacURLStr + ".sig"
+	}
 
-	logf(ctx, cfg.Logger, cfg.LogHook, LogInfo, "fetching PAC script", "url", pacURLStr)
+	p := &PACProxy{
+		pacURL:          pacURLStr,
+		client:          cfg.Client,
+		tlsPins:         cfg.TLSPins,
+		httpsOnly:       cfg.HTTPSOnly,
+		scriptSHA256:    cfg.ScriptSHA256,
+		scriptKey:       cfg.ScriptPublicKey,
+		signatureURL:    cfg.ScriptSignatureURL,
+		maxScriptSize:   cfg.MaxScriptSize,
+		dnsTimeout:      cfg.DNSLookupTimeout,
+		dnsCache:        cfg.DNSCache,
+		dnsFilter:       cfg.DNSFilter,
+		resolver:        cfg.Resolver,
+		now:             cfg.Now,
+		interfaceAddrs:  cfg.InterfaceAddrs,
+		refreshInterval: cfg.RefreshInterval,
+		refreshMin:      cfg.RefreshMinInterval,
+		refreshMax:      cfg.RefreshMaxInterval,
+		bg:              newBackground(),
+		scriptCache:     cfg.ScriptCache,
+		scriptCacheTTL:  cfg.ScriptCacheTTL,
+		decisions:       cfg.DecisionCache,
+		decisionTTL:     cfg.DecisionCacheTTL,
+		decisionFile:    cfg.DecisionCacheFile,
+		scriptTimeout:   cfg.ScriptTimeout,
+		sandbox:         cfg.Sandbox,
+		disableNative:   cfg.DisableNativeMatcher,
+		newRuntime:      cfg.NewRuntime,
+		slowEval:        cfg.SlowEvalThreshold,
+		proxySchemes:    cfg.ProxySchemes,
+		evalSchemes:     cfg.EvalSchemes,
+		emptyResult:     cfg.EmptyResult,
+		compat:          cfg.CompatMode,
+		extensions:      cfg.ExtensionHelpers,
+		moduleSyntax:    cfg.ModuleSyntax,
+		entryPoints:     entryPoints(cfg.EntryPoints),
+		clientGlobal:    cfg.ClientIPGlobal,
+		clientArg:       cfg.ClientIPArgument,
+		evalFingerprint: evalFingerprint(&cfg),
+		selector:        cfg.Selector,
+		affinity:        newProxyAffinity(cfg.AffinityTTL),
+		latency:         newProxyLatency(cfg.LatencyMaxAge),
+		bypass:          cfg.Bypass,
+		credentials:     cfg.Credentials,
+		filter:          cfg.ProxyFilter,
+		health:          newProxyHealth(cfg.FailedProxyTimeout, cfg.FailureThreshold),
+		metrics:         newProxyMetrics(cfg.Metrics),
+		decisionCounts:  newDecisionCounts(cfg.DecisionStatsByHost),
+		recent:          &recentEvals{},
+		detection:       cfg.Detection,
+		logContext:      cfg.LogContext,
+		logFullURLs:     cfg.LogFullURLs,
+		onFetch:         cfg.OnFetch,
+		onEval:          cfg.OnEval,
+		onError:         cfg.OnError,
+		audit:           cfg.Audit,
+		auditDNS:        cfg.AuditDNS,
+		sink:            cfg.Metrics,
+		tracer:          newTracer(cfg.TracerProvider),
+	}
 
-	// Fetch the PAC script from the provided URL
-	resp, err := client.Get(pacURLStr)
+	p.logging.Store(&logging{logger: cfg.Logger, hook: p.logHook(cfg.LogHook)})
+	switch {
+	case len(cfg.EvaluatorCommand) > 0:
+		p.launchEvaluator, p.memoryLimit = execEvaluator(cfg.EvaluatorCommand), cfg.ScriptMemoryLimit
+	case cfg.EvaluatorWASM != nil:
+		w, err := newWASMEvaluator(ctx, cfg.EvaluatorWASM, cfg.EvaluatorMemoryLimit, cfg.EvaluatorWASMCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		p.wasm, p.launchEvaluator = w, w.launch
+	}
+	p.fetchLifetime.Store(-1)
+	script, err := p.loadScript(ctx)
 	if err != nil {
-		logf(ctx, cfg.Logger, cfg.LogHook, LogError, "fetch PAC script failed", "url", pacURLStr, "err", err)
-		return nil, fmt.Errorf("%w: %v", ErrFetchPACScript, err)
+		p.wasm.close()
+		return nil, err
+	}
+	p.script.Store(script)
+	p.scheduleRefresh()
+	p.loadDecisions(ctx)
+	p.logf(ctx, LogInfo, "PAC script loaded", "url", pacURLStr, "bytes", len(script.source))
+
+	if len(cfg.Overrides) > 0 {
+		if err := p.SetOverrides(cfg.Overrides); err != nil {
+			script.close()
+			p.wasm.close()
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
+	if cfg.ExpvarPrefix != "" {
+		if err := p.publishExpvar(cfg.ExpvarPrefix); err != nil {
+			script.close()
+			p.wasm.close()
+			return nil, err
+		}
+	}
+	if cfg.HealthCheckInterval > 0 {
+		p.checker = newHealthChecker(cfg.HealthCheckInterval, cfg.HealthCheckTimeout, cfg.HealthCheck, p.health)
+	}
+	return p, nil
+}
+
+// Close stops background work such as health checks and script refreshes,
+// interrupts evaluations in progress, which return ErrClosed, releases the
+// script runtime and writes the decision cache to DecisionCacheFile, if
+// configured. Later lookups return ErrClosed. It is safe to call Close more
+// than once.
+func (p *PACProxy) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		if p.checker != nil {
+			p.checker.close()
+		}
+		p.bg.close()
+		// A Reload in progress sees the closed background and keeps its
+		// new script to itself once it gets reloadMu.
+		p.reloadMu.Lock()
+		p.script.Load().release()
+		p.reloadMu.Unlock()
+		p.wasm.close()
+		err = p.saveDecisions()
+	})
+	return err
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logf(ctx, cfg.Logger, cfg.LogHook, LogError, "fetch PAC script failed", "url", pacURLStr, "status", resp.StatusCode)
-		return nil, fmt.Errorf("%w: status code %d", ErrFetchPACScript, resp.StatusCode)
+// FindProxyForURL evaluates the PAC script to find the proxy for a given URL
+func (p *PACProxy) FindProxyStringForURL(targetURL *url.URL) (ProxyString, error) {
+	return p.FindProxyStringForURLContext(context.Background(), targetURL)
+}
+
+// FindProxyStringForURLContext is like FindProxyStringForURL but bounds the
+// evaluation, including DNS lookups of PAC helpers, by ctx. If ctx is done
+// first, the script is interrupted and ctx.Err() is returned.
+func (p *PACProxy) FindProxyStringForURLContext(ctx context.Context, targetURL *url.URL) (ProxyString, error) {
+	start := time.Now()
+	ctx = p.withDNSQueryLog(ctx)
+	script := p.script.Load()
+	result, err := p.findProxyString(ctx, script, targetURL)
+	if p.audit != nil {
+		var chosen []Proxy
+		if err == nil {
+			chosen = result.Proxies()
+		}
+		p.auditDecision(ctx, start, script, targetURL, result, chosen, err)
 	}
+	return result, err
+}
 
-	if cfg.MaxScriptSize > 0 && resp.ContentLength > cfg.MaxScriptSize {
-		logf(ctx, cfg.Logger, cfg.LogHook, LogError, "PAC script too large", "url", pacURLStr, "content_length", resp.ContentLength, "max_size", cfg.MaxScriptSize)
-		return nil, ErrPACScriptTooLarge
+// FindProxyForURLAt evaluates the PAC script for targetURL as if the time
+// were t, so that weekdayRange, dateRange and timeRange answer for t, e.g.
+// to check what the script does during a maintenance window ahead of time.
+// EvalSchemes, overrides and the bypass list apply. The decision cache is
+// neither read nor written, since its decisions are for the current time.
+func (p *PACProxy) FindProxyForURLAt(ctx context.Context, targetURL *url.URL, t time.Time) (ProxyString, error) {
+	if p.bg.done() {
+		return "", ErrClosed
 	}
+	targetURL = p.evalURL(targetURL)
+	if result, ok := p.presetDecision(ctx, targetURL); ok {
+		return result, nil
+	}
+	return p.evaluate(withEvalTime(ctx, t), p.script.Load(), targetURL)
+}
 
-	// Read the PAC script with size limits
-	script, err := readPACScript(resp.Body, cfg.MaxScriptSize)
-	if err != nil {
-		logf(ctx, cfg.Logger, cfg.LogHook, LogError, "read PAC script failed", "url", pacURLStr, "err", err)
-		return nil, fmt.Errorf("%w: %v", ErrReadPACScript, err)
+// presetDecision answers a lookup for the mapped targetURL from the overrides
+// or the bypass list, without the script.
+func (p *PACProxy) presetDecision(ctx context.Context, targetURL *url.URL) (ProxyString, bool) {
+	if result, ok := p.matchOverride(targetURL); ok {
+		p.logf(ctx, LogDebug, "PAC override matched", "url", targetURL.String(), "proxy", string(result))
+		return result, true
+	}
+	if p.bypass.Match(targetURL) {
+		p.logf(ctx, LogDebug, "PAC bypassed", "url", targetURL.String())
+		return "DIRECT", true
 	}
+	return "", false
+}
+
+// findProxyString answers a lookup from the overrides, the bypass list, the
+// decision cache or by evaluating script.
+func (p *PACProxy) findProxyString(ctx context.Context, script *pacScript, targetURL *url.URL) (result ProxyString, err error) {
+	p.maybeRefresh()
+	targetURL = p.evalURL(targetURL)
+	targetURLStr := targetURL.String()
 
-	// Create a new JavaScript runtime and define standard PAC functions
-	vm := NewGojaRuntime()
-	vm.SetDNSLookupTimeout(cfg.DNSLookupTimeout)
-	vm.DefinePACFunctions()
-	if runtimeErr := vmDefineError(vm); runtimeErr != nil {
-		logf(ctx, cfg.Logger, cfg.LogHook, LogError, "define PAC functions failed", "err", runtimeErr)
-		return nil, fmt.Errorf("%w: %v", ErrExecutePACScript, runtimeErr)
+	ctx, span := p.startSpan(ctx, "pac.evaluate", attribute.String("pac.host", targetURL.Hostname()))
+	start := time.Now()
+	cacheHit := false
+	defer func() {
+		p.emitEval(ctx, EvalEvent{Scheme: targetURL.Scheme, Host: targetURL.Hostname(), Result: result, Duration: time.Since(start), CacheHit: cacheHit, Err: err})
+		proxies := result.Proxies()
+		if err == nil && len(proxies) > 0 {
+			p.decisionCounts.record(targetURL.Hostname(), proxies[0])
+		}
+		span.SetAttributes(attribute.Bool("pac.cache_hit", cacheHit), attribute.String("pac.result_type", resultType(proxies)))
+		endSpan(span, err)
+	}()
+	if p.bg.done() {
+		return "", ErrClosed
 	}
 
-	// Execute the PAC script in the JavaScript runtime
-	err = runWithTimeout(vm, cfg.ScriptTimeout, func() error {
-		_, runErr := vm.RunString(string(script))
-		return runErr
-	})
-	if err != nil {
-		logf(ctx, cfg.Logger, cfg.LogHook, LogError, "execute PAC script failed", "url", pacURLStr, "err", err)
-		return nil, fmt.Errorf("%w: %v", ErrExecutePACScript, err)
+	if result, ok := p.presetDecision(ctx, targetURL); ok {
+		return result, nil
 	}
 
-	logf(ctx, cfg.Logger, cfg.LogHook, LogInfo, "PAC script loaded", "url", pacURLStr, "bytes", len(script))
+	client := p.clientIP(ctx)
+	if result, ok := p.cachedDecision(script, targetURL, client); ok {
+		p.logf(ctx, LogDebug, "PAC decision cache hit", "url", targetURLStr, "proxy", string(result))
+		cacheHit = true
+		p.decisionCounts.cacheHit(targetURL.Hostname())
+		return result, nil
+	}
 
-	return &PACProxy{
-		script:        string(script),
-		vm:            vm,
-		client:        client,
-		scriptTimeout: cfg.ScriptTimeout,
-		logger:        cfg.Logger,
-		logHook:       cfg.LogHook,
-	}, nil
+	evalStart := time.Now()
+	result, err = p.evaluate(ctx, script, targetURL)
+	p.evalStats.record(err)
+	p.observeEval(time.Since(evalStart), err)
+	p.decisionCounts.evaluated(targetURL.Hostname(), time.Since(evalStart), err)
+	if err != nil {
+		return "", err
+	}
+	p.cacheDecision(script, targetURL, client, result)
+	return result, nil
 }
 
-func vmDefineError(vm JSRuntime) error {
-	if gr, ok := vm.(*GojaRuntime); ok {
-		return gr.defineErr
+// evaluate runs FindProxyForURL of script for targetURL.
+func (p *PACProxy) evaluate(ctx context.Context, script *pacScript, targetURL *url.URL) (ProxyString, error) {
+	if p.bg.done() {
+		return "", ErrClosed
 	}
-	return nil
-}
+	callerCtx := ctx
+	ctx, stop := p.bg.bind(ctx)
+	defer stop()
 
-// FindProxyForURL evaluates the PAC script to find the proxy for a given URL
-func (p *PACProxy) FindProxyStringForURL(targetURL *url.URL) (ProxyString, error) {
-	ctx := context.Background()
 	targetURLStr := targetURL.String()
+	start := time.Now()
+	var (
+		result     goja.Value
+		native     nativeResult
+		dnsLookups int
+		err        error
+	)
+	useNative := script.native != nil && !helperTraced(ctx)
+	switch {
+	case useNative:
+		err = ctx.Err()
+		if err == nil {
+			native, dnsLookups = script.native.eval(ctx, p, targetURL)
+		}
+	case script.isolated != nil:
+		result, dnsLookups, err = p.evalIsolated(ctx, script, targetURL)
+	default:
+		result, dnsLookups, err = p.evalLocal(ctx, script, targetURL)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("pac.dns_lookups", dnsLookups), attribute.Bool("pac.native", useNative))
+	if elapsed := time.Since(start); p.slowEval > 0 && elapsed > p.slowEval {
+		p.logf(ctx, LogWarn, "slow PAC evaluation", "host", targetURL.Hostname(), "duration", elapsed, "dns_lookups", dnsLookups)
+	}
+	if err != nil && p.bg.done() && callerCtx.Err() == nil {
+		err = ErrClosed
+	}
+	var timeout *TimeoutError
+	if errors.Is(err, ErrPACScriptTimeout) && !errors.As(err, &timeout) {
+		err = &TimeoutError{Elapsed: time.Since(start)}
+	}
+	if err != nil {
+		p.logf(ctx, LogError, "PAC evaluation failed", "url", targetURLStr, "err", err)
+		return "", err
+	}
 
-	result, err := p.evalWithTimeout(func() (goja.Value, error) {
-		// Call the JavaScript function FindProxyForURL with the URL and host as parameters
-		fn, ok := goja.AssertFunction(p.vm.Get("FindProxyForURL"))
-		if !ok {
+	var proxyStr string
+	if useNative {
+		if !native.defined {
+			return p.handleEmptyResult(ctx, targetURLStr)
+		}
+		proxyStr = native.value
+	} else {
+		if goja.IsNull(result) || goja.IsUndefined(result) {
+			return p.handleEmptyResult(ctx, targetURLStr)
+		}
+		var ok bool
+		if proxyStr, ok = result.Export().(string); !ok {
+			p.logf(ctx, LogError, "PAC evaluation returned non-string", "url", targetURLStr)
+			return "", ErrConvertResult
+		}
+	}
+	if strings.TrimSpace(proxyStr) == "" {
+		return p.handleEmptyResult(ctx, targetURLStr)
+	}
+
+	p.logf(ctx, LogDebug, "PAC evaluation result", "url", targetURLStr, "proxy", proxyStr)
+	return ProxyString(proxyStr), nil
+}
+
+// evalLocal evaluates targetURL in the script's in-process runtime and
+// returns the number of helper DNS lookups.
+func (p *PACProxy) evalLocal(ctx context.Context, script *pacScript, targetURL *url.URL) (goja.Value, int, error) {
+	dnsLookups := 0
+	result, err := p.evalWithTimeout(ctx, script, func(vm JSRuntime) (goja.Value, error) {
+		defer func() { dnsLookups = vmDNSLookups(vm) }()
+
+		// Call the entry point, FindProxyForURL by default, with the URL and host as parameters
+		_, fn := entryPoint(vm, p.entryPoints)
+		if fn == nil {
 			return nil, ErrEvaluatePAC
 		}
 
-		value, callErr := fn(goja.Undefined(), p.vm.ToValue(targetURL.String()), p.vm.ToValue(targetURL.Host))
+		// Label the goroutine so CPU profiles attribute goja time to PAC
+		// evaluation and the destination host.
+		var (
+			value   goja.Value
+			callErr error
+		)
+		labels := pprof.Labels("pac_host", targetURL.Hostname(), "script_hash", hex.EncodeToString(script.hash[:8]))
+		urlArg, hostArg := p.compat.scriptArgs(targetURL)
+		args, err := passClientIP(vm, p.clientGlobal, p.clientArg, p.clientIP(ctx), []goja.Value{vm.ToValue(urlArg), vm.ToValue(hostArg)})
+		if err != nil {
+			return nil, newEvalError(false, err)
+		}
+		pprof.Do(ctx, labels, func(context.Context) {
+			// Label the context of the helpers too, e.g. for resolvers.
+			if gr := asGojaRuntime(vm); gr != nil && gr.evalCtx != nil {
+				helperCtx := gr.evalCtx
+				gr.evalCtx = pprof.WithLabels(helperCtx, labels)
+				defer func() { gr.evalCtx = helperCtx }()
+			}
+			value, callErr = fn(goja.Undefined(), args...)
+		})
 		if callErr != nil {
-			return nil, fmt.Errorf("%w: %v", ErrEvaluatePAC, callErr)
+			return nil, newEvalError(false, callErr)
 		}
 
 		return value, nil
 	})
-	if err != nil {
-		logf(ctx, p.logger, p.logHook, LogError, "PAC evaluation failed", "url", targetURLStr, "err", err)
-		return "", err
+	return result, dnsLookups, err
+}
+
+func (p *PACProxy) handleEmptyResult(ctx context.Context, targetURLStr string) (ProxyString, error) {
+	if p.emptyResult == EmptyResultDirect || p.compat.browser() {
+		p.logf(ctx, LogDebug, "PAC evaluation returned empty result, using DIRECT", "url", targetURLStr)
+		return "DIRECT", nil
 	}
+	p.logf(ctx, LogError, "PAC evaluation returned empty result", "url", targetURLStr)
+	return "", ErrEmptyResult
+}
 
-	proxyStr, ok := result.Export().(string)
-	if !ok {
-		logf(ctx, p.logger, p.logHook, LogError, "PAC evaluation returned non-string", "url", targetURLStr)
-		return "", ErrConvertResult
+// FindProxiesForURL evaluates the PAC script for targetURL and returns the
+// candidates in the order chosen by the configured Selector.
+func (p *PACProxy) FindProxiesForURL(targetURL *url.URL) ([]Proxy, error) {
+	return p.FindProxiesForURLContext(context.Background(), targetURL)
+}
+
+// FindProxiesForURLContext is like FindProxiesForURL but bounds the
+// evaluation by ctx.
+func (p *PACProxy) FindProxiesForURLContext(ctx context.Context, targetURL *url.URL) (proxies []Proxy, err error) {
+	start := time.Now()
+	ctx = p.withDNSQueryLog(ctx)
+	script := p.script.Load()
+	proxyStr, err := p.findProxyString(ctx, script, targetURL)
+	defer func() { p.auditDecision(ctx, start, script, targetURL, proxyStr, proxies, err) }()
+	if err != nil {
+		return nil, err
 	}
 
-	logf(ctx, p.logger, p.logHook, LogDebug, "PAC evaluation result", "url", targetURLStr, "proxy", proxyStr)
-	return ProxyString(proxyStr), nil
+	proxies = proxyStr.Proxies()
+	if len(proxies) == 0 {
+		return nil, ErrNoValidProxy
+	}
+	proxies, err = p.filterProxies(ctx, proxies)
+	if err != nil {
+		return nil, err
+	}
+	if p.checker != nil {
+		p.checker.observe(proxies)
+	}
+	proxies = p.latency.order(p.selector.Select(targetURL, proxies))
+	return p.health.order(p.affinity.apply(targetURL, proxies)), nil
 }
 
-// PACProxyFunc returns a function that can be used as the Proxy parameter in http.Transport
+// PACProxyFunc returns a function that can be used as the Proxy parameter in http.Transport.
+// The evaluation is bounded by the request's context.
 func (p *PACProxy) ProxyFunc() func(*http.Request) (*url.URL, error) {
 	return func(req *http.Request) (*url.URL, error) {
-		proxyStr, err := p.FindProxyStringForURL(req.URL)
+		proxies, err := p.FindProxiesForURLContext(req.Context(), req.URL)
+		if err != nil {
+			return nil, err
+		}
+		if len(proxies) == 0 {
+			return nil, ErrNoValidProxy
+		}
+		p.metrics.selected(proxies[0])
+
+		proxyURL, err := proxies[0].URLFor(p.evalURL(req.URL), p.proxySchemes)
 		if err != nil {
 			return nil, err
 		}
+		p.health.dialing(proxies[0])
+		return p.withCredentials(proxyURL), nil
+	}
+}
 
-		ps := ProxyString(proxyStr)
-		return ps.Parse()
+// evalURL returns targetURL with its scheme mapped by EvalSchemes, the URL
+// the PAC script gets to see.
+func (p *PACProxy) evalURL(targetURL *url.URL) *url.URL {
+	scheme, ok := p.evalSchemes[strings.ToLower(targetURL.Scheme)]
+	if !ok {
+		return targetURL
 	}
+	mapped := *targetURL
+	mapped.Scheme = scheme
+	return &mapped
 }
 
 type pacEvalResult struct {
@@ -178,43 +655,107 @@ type pacEvalResult struct {
 	err   error
 }
 
-func (p *PACProxy) evalWithTimeout(fn func() (goja.Value, error)) (goja.Value, error) {
-	if p.scriptTimeout <= 0 {
-		p.mu.Lock()
-		defer p.mu.Unlock()
-		return fn()
-	}
-
+// evalWithTimeout runs fn on the script's VM while holding its lock. fn is interrupted
+// when the script timeout elapses or ctx is done.
+func (p *PACProxy) evalWithTimeout(ctx context.Context, script *pacScript, fn func(vm JSRuntime) (goja.Value, error)) (goja.Value, error) {
 	resultCh := make(chan pacEvalResult, 1)
 	started := make(chan struct{})
 
+	// finished guards against interrupting the VM after fn returned, which
+	// would leave the interrupt pending for the next evaluation.
+	var (
+		imu      sync.Mutex
+		finished bool
+	)
+
 	go func() {
-		p.mu.Lock()
+		script.mu.Lock()
+		defer script.mu.Unlock()
 		close(started)
-		value, err := fn()
-		p.mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			resultCh <- pacEvalResult{err: err}
+			return
+		}
+		if script.vm == nil {
+			// Released by Close; there is nothing to interrupt.
+			imu.Lock()
+			finished = true
+			imu.Unlock()
+			resultCh <- pacEvalResult{err: ErrClosed}
+			return
+		}
+
+		vmSetContext(script.vm, ctx)
+		value, err := fn(script.vm)
+		vmSetContext(script.vm, nil)
+
+		imu.Lock()
+		finished = true
+		imu.Unlock()
+		vmClearInterrupt(script.vm)
 		resultCh <- pacEvalResult{value: value, err: err}
 	}()
 
-	<-started
-	timer := time.NewTimer(p.scriptTimeout)
-	defer timer.Stop()
+	select {
+	case <-started:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var timeout <-chan time.Time
+	if p.scriptTimeout > 0 {
+		timer := time.NewTimer(p.scriptTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
+	var reason error
 	select {
 	case res := <-resultCh:
 		return res.value, normalizePACError(res.err)
-	case <-timer.C:
-		select {
-		case res := <-resultCh:
-			return res.value, normalizePACError(res.err)
-		default:
-		}
-		p.vm.Interrupt(ErrPACScriptTimeout)
-		res := <-resultCh
-		if res.err == nil {
-			res.err = ErrPACScriptTimeout
+	case <-timeout:
+		reason = ErrPACScriptTimeout
+	case <-ctx.Done():
+		reason = ctx.Err()
+	}
+
+	imu.Lock()
+	interrupted := !finished
+	if interrupted {
+		script.vm.Interrupt(reason)
+	}
+	imu.Unlock()
+
+	res := <-resultCh
+	if interrupted && res.err != nil {
+		return res.value, reason
+	}
+	return res.value, normalizePACError(res.err)
+}
+
+// vmSetContext hands the evaluation context to runtimes that support it, so
+// PAC helpers such as dnsResolve honor its deadline.
+func vmSetContext(vm JSRuntime, ctx context.Context) {
+	if gr := asGojaRuntime(vm); gr != nil {
+		gr.evalCtx = ctx
+		if ctx != nil {
+			gr.dnsLookups = 0
 		}
-		return res.value, normalizePACError(res.err)
+	}
+}
+
+// vmDNSLookups returns the number of helper DNS lookups since the last
+// vmSetContext, for runtimes that count them.
+func vmDNSLookups(vm JSRuntime) int {
+	if gr := asGojaRuntime(vm); gr != nil {
+		return gr.dnsLookups
+	}
+	return 0
+}
+
+func vmClearInterrupt(vm JSRuntime) {
+	if c, ok := vm.(interface{ ClearInterrupt() }); ok {
+		c.ClearInterrupt()
 	}
 }
 
@@ -248,9 +789,61 @@ func normalizePACProxyConfig(config *PACProxyConfig) PACProxyConfig {
 		cfg.MaxScriptSize = 0
 	}
 
+	if cfg.FailedProxyTimeout == 0 {
+		cfg.FailedProxyTimeout = defaultFailedProxyTimeout
+	} else if cfg.FailedProxyTimeout < 0 {
+		cfg.FailedProxyTimeout = 0
+	}
+
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+
+	if cfg.HealthCheckTimeout == 0 {
+		cfg.HealthCheckTimeout = defaultHealthCheckTimeout
+	} else if cfg.HealthCheckTimeout < 0 {
+		cfg.HealthCheckTimeout = 0
+	}
+
 	if cfg.Client == nil {
 		cfg.Client = &http.Client{Timeout: cfg.HTTPTimeout}
 	}
+	if len(cfg.FetchDenyNets) > 0 || len(cfg.TLSPins) > 0 || cfg.HTTPSOnly {
+		cfg.Client = guardClient(cfg.Client, cfg.FetchDenyNets, cfg.TLSPins, cfg.HTTPSOnly)
+	}
+
+	if cfg.Selector == nil {
+		cfg.Selector = FirstSelector()
+	}
+
+	if cfg.RefreshMinInterval <= 0 {
+		cfg.RefreshMinInterval = defaultRefreshMinInterval
+	}
+	if cfg.RefreshMaxInterval <= 0 {
+		cfg.RefreshMaxInterval = defaultRefreshMaxInterval
+	}
+
+	if cfg.ScriptCacheTTL <= 0 {
+		cfg.ScriptCacheTTL = defaultScriptCacheTTL
+	}
+
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+
+	if cfg.DNSCache == nil && cfg.DNSCacheTTL > 0 {
+		cfg.DNSCache = NewDNSCache(cfg.DNSCacheTTL, defaultDNSCacheSize)
+	}
+
+	if cfg.DecisionCacheTTL <= 0 {
+		cfg.DecisionCache = nil
+	} else if cfg.DecisionCache == nil {
+		cfg.DecisionCache = NewMemoryStore(defaultDecisionCacheSize)
+	}
+
+	if cfg.EvalSchemes == nil {
+		cfg.EvalSchemes = defaultEvalSchemes
+	}
 
 	return cfg
 }
@@ -271,8 +864,10 @@ func readPACScript(r io.Reader, maxSize int64) ([]byte, error) {
 	return data, nil
 }
 
-func runWithTimeout(vm JSRuntime, timeout time.Duration, fn func() error) error {
-	if timeout <= 0 {
+// runWithTimeout runs fn on vm, interrupting it when timeout elapses or ctx
+// is done.
+func runWithTimeout(ctx context.Context, vm JSRuntime, timeout time.Duration, fn func() error) error {
+	if timeout <= 0 && ctx.Done() == nil {
 		return normalizePACError(fn())
 	}
 
@@ -281,25 +876,34 @@ func runWithTimeout(vm JSRuntime, timeout time.Duration, fn func() error) error
 		resultCh <- fn()
 	}()
 
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
 
+	var reason error
 	select {
 	case err := <-resultCh:
 		return normalizePACError(err)
-	case <-timer.C:
-		select {
-		case err := <-resultCh:
-			return normalizePACError(err)
-		default:
-		}
-		vm.Interrupt(ErrPACScriptTimeout)
-		err := <-resultCh
-		if err == nil {
-			return ErrPACScriptTimeout
-		}
+	case <-timeoutCh:
+		reason = ErrPACScriptTimeout
+	case <-ctx.Done():
+		reason = ctx.Err()
+	}
+	select {
+	case err := <-resultCh:
 		return normalizePACError(err)
+	default:
+	}
+	vm.Interrupt(reason)
+	err := <-resultCh
+	vmClearInterrupt(vm)
+	if err == nil {
+		return reason
 	}
+	return normalizePACError(err)
 }
 
 func normalizePACError(err error) error {
@@ -308,8 +912,9 @@ func normalizePACError(err error) error {
 	}
 	var interrupted *goja.InterruptedError
 	if errors.As(err, &interrupted) {
-		if interrupted.Value() == ErrPACScriptTimeout {
-			return ErrPACScriptTimeout
+		switch reason := interrupted.Value(); reason {
+		case ErrPACScriptTimeout, context.Canceled, context.DeadlineExceeded:
+			return reason.(error)
 		}
 	}
 	return err
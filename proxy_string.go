@@ -2,6 +2,7 @@ package pac
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"strings"
 )
@@ -14,30 +15,177 @@ var (
 // ProxyString represents a proxy string
 type ProxyString string
 
+// ProxyType is the kind of a single PAC directive.
+type ProxyType int
+
+const (
+	ProxyDirect ProxyType = iota
+	ProxyHTTP
+	ProxyHTTPS
+	ProxySOCKS4
+	ProxySOCKS5
+)
+
+// Proxy is a single directive of a PAC result, e.g. "PROXY host:port".
+type Proxy struct {
+	Type ProxyType
+	// Host is the host:port of the proxy. It is empty for DIRECT.
+	Host string
+}
+
+// ProxySchemeMap maps a target URL scheme (e.g. "https") to the URL scheme
+// used for PROXY directives when the target has that scheme.
+// Targets without an entry use "http".
+type ProxySchemeMap map[string]string
+
+var directiveTypes = map[string]ProxyType{
+	"DIRECT": ProxyDirect,
+	"PROXY":  ProxyHTTP,
+	"HTTP":   ProxyHTTP,
+	"HTTPS":  ProxyHTTPS,
+	"SOCKS":  ProxySOCKS5,
+	"SOCKS4": ProxySOCKS4,
+	"SOCKS5": ProxySOCKS5,
+}
+
+// Proxies returns all valid directives of the proxy string in order.
+// Unknown directives are skipped.
+func (ps ProxyString) Proxies() []Proxy {
+	var proxies []Proxy
+	for _, entry := range strings.Split(string(ps), ";") {
+		if proxy, ok := parseDirective(entry); ok {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+func parseDirective(entry string) (Proxy, bool) {
+	fields := strings.Fields(entry)
+	if len(fields) == 0 {
+		return Proxy{}, false
+	}
+	typ, ok := directiveTypes[strings.ToUpper(fields[0])]
+	if !ok {
+		return Proxy{}, false
+	}
+	if typ == ProxyDirect {
+		return Proxy{Type: ProxyDirect}, len(fields) == 1
+	}
+	if len(fields) != 2 {
+		return Proxy{}, false
+	}
+	return Proxy{Type: typ, Host: fields[1]}, true
+}
+
 // Parse parses the proxy string and returns the appropriate proxy URL.
 // If multiple proxies are contained in ProxyString, first one is returned.
 func (ps ProxyString) Parse() (*url.URL, error) {
-	proxies := strings.Split(string(ps), ";")
-	for _, proxy := range proxies {
-		proxy = strings.TrimSpace(proxy)
-		if strings.HasPrefix(proxy, "DIRECT") {
-			return nil, nil
-		}
-		if strings.HasPrefix(proxy, "PROXY") {
-			proxyURL, err := url.Parse("http://" + strings.TrimPrefix(proxy, "PROXY "))
-			if err != nil {
-				return nil, err
-			}
-			return proxyURL, nil
-		}
-		if strings.HasPrefix(proxy, "SOCKS") {
-			proxyURL, err := url.Parse("socks5://" + strings.TrimPrefix(proxy, "SOCKS "))
-			if err != nil {
-				return nil, err
+	return ps.ParseFor(nil, nil)
+}
+
+// ParseFor is like Parse but maps PROXY directives according to the scheme
+// of target. A nil target or schemes map behaves like Parse.
+func (ps ProxyString) ParseFor(target *url.URL, schemes ProxySchemeMap) (*url.URL, error) {
+	proxies := ps.Proxies()
+	if len(proxies) == 0 {
+		return nil, ErrNoValidProxy
+	}
+	return proxies[0].URLFor(target, schemes)
+}
+
+// URL returns the URL of the proxy, or nil for DIRECT.
+func (p Proxy) URL() (*url.URL, error) {
+	return p.URLFor(nil, nil)
+}
+
+// URLFor returns the URL of the proxy for requests to target, or nil for DIRECT.
+// PROXY directives use the scheme configured for the target's scheme in schemes.
+func (p Proxy) URLFor(target *url.URL, schemes ProxySchemeMap) (*url.URL, error) {
+	var scheme string
+	switch p.Type {
+	case ProxyDirect:
+		return nil, nil
+	case ProxyHTTP:
+		scheme = "http"
+		if target != nil {
+			if s, ok := schemes[strings.ToLower(target.Scheme)]; ok && s != "" {
+				scheme = s
 			}
-			return proxyURL, nil
 		}
+	case ProxyHTTPS:
+		scheme = "https"
+	case ProxySOCKS4:
+		scheme = "socks4"
+	case ProxySOCKS5:
+		scheme = "socks5"
+	default:
+		return nil, ErrNoValidProxy
+	}
+	return url.Parse(scheme + "://" + p.Host)
+}
+
+// String returns the PAC keyword of the type, e.g. "PROXY".
+func (t ProxyType) String() string {
+	switch t {
+	case ProxyDirect:
+		return "DIRECT"
+	case ProxyHTTP:
+		return "PROXY"
+	case ProxyHTTPS:
+		return "HTTPS"
+	case ProxySOCKS4:
+		return "SOCKS4"
+	case ProxySOCKS5:
+		return "SOCKS5"
+	default:
+		return fmt.Sprintf("ProxyType(%d)", int(t))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t ProxyType) MarshalText() ([]byte, error) {
+	if t < ProxyDirect || t > ProxySOCKS5 {
+		return nil, fmt.Errorf("%w: unknown proxy type %d", ErrNoValidProxy, int(t))
 	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// It accepts any PAC keyword, case-insensitively.
+func (t *ProxyType) UnmarshalText(text []byte) error {
+	typ, ok := directiveTypes[strings.ToUpper(strings.TrimSpace(string(text)))]
+	if !ok {
+		return fmt.Errorf("%w: unknown proxy type %q", ErrNoValidProxy, text)
+	}
+	*t = typ
+	return nil
+}
 
-	return nil, ErrNoValidProxy
+// String returns the proxy as a PAC directive, e.g. "PROXY host:port".
+func (p Proxy) String() string {
+	if p.Type == ProxyDirect {
+		return p.Type.String()
+	}
+	return p.Type.String() + " " + p.Host
+}
+
+// MarshalText implements encoding.TextMarshaler.
+// Proxies are encoded as PAC directives, also in JSON.
+func (p Proxy) MarshalText() ([]byte, error) {
+	if _, err := p.Type.MarshalText(); err != nil {
+		return nil, err
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// It accepts a single PAC directive, e.g. "SOCKS5 host:port".
+func (p *Proxy) UnmarshalText(text []byte) error {
+	proxy, ok := parseDirective(string(text))
+	if !ok {
+		return fmt.Errorf("%w: invalid directive %q", ErrNoValidProxy, text)
+	}
+	*p = proxy
+	return nil
 }
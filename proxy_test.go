@@ -1,11 +1,20 @@
 package pac_test
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"reflect"
+	"runtime/pprof"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,13 +23,45 @@ import (
 
 func newPACServer(t *testing.T, proxyString string) *httptest.Server {
 	t.Helper()
-	script := fmt.Sprintf(`function FindProxyForURL(url, host) { return "%s"; }`, proxyString)
+	return newScriptServer(t, fmt.Sprintf(`function FindProxyForURL(url, host) { return "%s"; }`, proxyString))
+}
+
+func newScriptServer(t *testing.T, script string) *httptest.Server {
+	t.Helper()
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
 		_, _ = io.WriteString(w, script)
 	}))
 }
 
+// newTestPACProxy returns a PACProxy for a script returning proxyString.
+func newTestPACProxy(t *testing.T, proxyString string, config *pac.PACProxyConfig) *pac.PACProxy {
+	t.Helper()
+	pacServer := newPACServer(t, proxyString)
+	t.Cleanup(pacServer.Close)
+	return newTestPACProxyFromURL(t, pacServer.URL, config)
+}
+
+// newScriptPACProxy returns a PACProxy for script.
+func newScriptPACProxy(t *testing.T, script string, config *pac.PACProxyConfig) *pac.PACProxy {
+	t.Helper()
+	pacServer := newScriptServer(t, script)
+	t.Cleanup(pacServer.Close)
+	return newTestPACProxyFromURL(t, pacServer.URL, config)
+}
+
+// newTestPACProxyFromURL returns a PACProxy for the PAC script at rawURL.
+func newTestPACProxyFromURL(t *testing.T, rawURL string, config *pac.PACProxyConfig) *pac.PACProxy {
+	t.Helper()
+	pacURL, _ := url.Parse(rawURL)
+	proxy, err := pac.NewPACProxy(pacURL, config)
+	if err != nil {
+		t.Fatalf("Error creating PAC proxy: %v", err)
+	}
+	t.Cleanup(func() { _ = proxy.Close() })
+	return proxy
+}
+
 // TestGetURL tests the GetURL function to ensure it correctly retrieves the PAC URL.
 func TestGetPACURL(t *testing.T) {
 	pacServer := newPACServer(t, "DIRECT")
@@ -66,10 +107,7 @@ func TestFindProxyStringForURL(t *testing.T) {
 	}
 
 	// Call NewProxy to create a new Proxy instance
-	proxy, err := pac.NewPACProxy(pacURL, config)
-	if err != nil {
-		t.Fatalf("Error creating Proxy instance: %v", err)
-	}
+	proxy := newTestPACProxyFromURL(t, pacURL.String(), config)
 
 	// Define a sample target URL for testing
 	targetURL, err := url.Parse("http://example.com")
@@ -118,6 +156,16 @@ func TestParse(t *testing.T) {
 			expectedURL: "socks5://socks.example.com:1080",
 			expectedErr: nil,
 		},
+		{
+			proxyStr:    "SOCKS5 socks.example.com:1080; DIRECT",
+			expectedURL: "socks5://socks.example.com:1080",
+			expectedErr: nil,
+		},
+		{
+			proxyStr:    "INVALID proxy.example.com:8080; HTTPS secure.example.com:443",
+			expectedURL: "https://secure.example.com:443",
+			expectedErr: nil,
+		},
 		{
 			proxyStr:    "INVALID proxy.example.com:8080",
 			expectedURL: "",
@@ -143,6 +191,37 @@ func TestParse(t *testing.T) {
 	}
 }
 
+// TestParseFor tests that PROXY directives are mapped according to the target scheme.
+func TestParseFor(t *testing.T) {
+	schemes := pac.ProxySchemeMap{"https": "https"}
+	ps := pac.ProxyString("PROXY proxy.example.com:8080; SOCKS socks.example.com:1080")
+
+	tests := []struct {
+		target      string
+		expectedURL string
+	}{
+		{target: "http://example.com", expectedURL: "http://proxy.example.com:8080"},
+		{target: "https://example.com", expectedURL: "https://proxy.example.com:8080"},
+		{target: "ftp://example.com", expectedURL: "http://proxy.example.com:8080"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			target, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatalf("Failed to parse target URL: %v", err)
+			}
+			proxyURL, err := ps.ParseFor(target, schemes)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if proxyURL.String() != test.expectedURL {
+				t.Fatalf("Expected URL %s, got %s", test.expectedURL, proxyURL.String())
+			}
+		})
+	}
+}
+
 // TestNewProxy tests the NewProxy function to ensure it correctly creates a Proxy instance.
 func TestNewPACProxy(t *testing.T) {
 	pacServer := newPACServer(t, "DIRECT")
@@ -194,3 +273,332 @@ func TestNewPACProxy(t *testing.T) {
 
 	t.Logf("Response: %s\n", body)
 }
+
+// TestEmptyResultPolicy tests that empty and null PAC results follow the configured policy.
+func TestEmptyResultPolicy(t *testing.T) {
+	scripts := map[string]string{
+		"empty": `function FindProxyForURL(url, host) { return ""; }`,
+		"null":  `function FindProxyForURL(url, host) { return null; }`,
+	}
+	targetURL, _ := url.Parse("http://example.com")
+
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			pacServer := newScriptServer(t, script)
+			defer pacServer.Close()
+
+			proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+			if _, err := proxy.FindProxyStringForURL(targetURL); !errors.Is(err, pac.ErrEmptyResult) {
+				t.Fatalf("Expected error %v, got %v", pac.ErrEmptyResult, err)
+			}
+
+			proxy = newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{EmptyResult: pac.EmptyResultDirect})
+			proxyStr, err := proxy.FindProxyStringForURL(targetURL)
+			if err != nil {
+				t.Fatalf("Error finding proxy for URL: %v", err)
+			}
+			if proxyStr != "DIRECT" {
+				t.Fatalf("Expected proxy string DIRECT, got %s", proxyStr)
+			}
+		})
+	}
+}
+
+// TestProxyJSON tests that proxies round-trip through JSON as PAC directives.
+func TestProxyJSON(t *testing.T) {
+	proxies := pac.ProxyString("PROXY a:1; SOCKS b:2; DIRECT").Proxies()
+
+	data, err := json.Marshal(proxies)
+	if err != nil {
+		t.Fatalf("Error marshaling proxies: %v", err)
+	}
+	if string(data) != `["PROXY a:1","SOCKS5 b:2","DIRECT"]` {
+		t.Fatalf("Unexpected JSON: %s", data)
+	}
+
+	var decoded []pac.Proxy
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error unmarshaling proxies: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, proxies) {
+		t.Fatalf("Expected %v, got %v", proxies, decoded)
+	}
+
+	var proxy pac.Proxy
+	if err := proxy.UnmarshalText([]byte("BOGUS a:1")); !errors.Is(err, pac.ErrNoValidProxy) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrNoValidProxy, err)
+	}
+}
+
+// TestProxyFuncContext tests that the request context bounds the PAC evaluation.
+func TestProxyFuncContext(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "slow.example.com") { while (true) {} }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{ScriptTimeout: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://slow.example.com", nil)
+
+	start := time.Now()
+	if _, err := proxy.ProxyFunc()(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Evaluation took %v, expected it to stop at the context deadline", elapsed)
+	}
+
+	targetURL, _ := url.Parse("http://fast.example.com")
+	proxyStr, err := proxy.FindProxyStringForURL(targetURL)
+	if err != nil {
+		t.Fatalf("Error finding proxy for URL after cancellation: %v", err)
+	}
+	if proxyStr != "DIRECT" {
+		t.Fatalf("Expected proxy string DIRECT, got %s", proxyStr)
+	}
+}
+
+// TestEvalSchemes tests that target schemes are mapped before the PAC script sees the URL.
+func TestEvalSchemes(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (url.substring(0, 6) == "https:") { return "PROXY secure.example.com:3128"; }
+		if (url.substring(0, 5) == "http:") { return "PROXY plain.example.com:3128"; }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	tests := []struct {
+		name    string
+		schemes map[string]string
+		target  string
+		want    pac.ProxyString
+	}{
+		{"default wss", nil, "wss://example.com/socket", "PROXY secure.example.com:3128"},
+		{"default ws", nil, "ws://example.com/socket", "PROXY plain.example.com:3128"},
+		{"default ftp", nil, "ftp://example.com/file", "DIRECT"},
+		{"custom ftp", map[string]string{"ftp": "http"}, "ftp://example.com/file", "PROXY plain.example.com:3128"},
+		{"disabled", map[string]string{}, "wss://example.com/socket", "DIRECT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{EvalSchemes: tt.schemes})
+			targetURL, _ := url.Parse(tt.target)
+			got, err := proxy.FindProxyStringForURL(targetURL)
+			if err != nil {
+				t.Fatalf("Error finding proxy for URL: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Expected proxy string %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestClose tests that Close interrupts evaluations in progress and that
+// later lookups fail with ErrClosed.
+func TestClose(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		while (host == "loop.example.com") {}
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+
+	proxy, err := pac.NewPACProxy(pacURL, nil, pac.WithScriptTimeout(0))
+	if err != nil {
+		t.Fatalf("Error creating PAC proxy: %v", err)
+	}
+	loopURL, _ := url.Parse("http://loop.example.com/")
+	done := make(chan error, 1)
+	go func() {
+		_, err := proxy.FindProxyStringForURL(loopURL)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Error closing PAC proxy: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, pac.ErrClosed) {
+			t.Fatalf("Expected error %v, got %v", pac.ErrClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not interrupt the evaluation")
+	}
+
+	targetURL, _ := url.Parse("http://example.com/")
+	if _, err := proxy.FindProxyStringForURL(targetURL); !errors.Is(err, pac.ErrClosed) {
+		t.Fatalf("Expected error %v after Close, got %v", pac.ErrClosed, err)
+	}
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Error closing PAC proxy twice: %v", err)
+	}
+}
+
+// TestSlowEvalThreshold tests that evaluations exceeding SlowEvalThreshold are logged at warn level.
+func TestSlowEvalThreshold(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "slow.example.com") {
+			isResolvable("localhost");
+			var end = Date.now() + 50;
+			while (Date.now() < end) {}
+		}
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	var (
+		mu   sync.Mutex
+		slow []map[string]any
+	)
+	logger := pac.LoggerFunc(func(_ context.Context, level pac.LogLevel, msg string, args ...any) {
+		if level != pac.LogWarn || msg != "slow PAC evaluation" {
+			return
+		}
+		fields := map[string]any{}
+		for i := 0; i+1 < len(args); i += 2 {
+			fields[args[i].(string)] = args[i+1]
+		}
+		mu.Lock()
+		slow = append(slow, fields)
+		mu.Unlock()
+	})
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{SlowEvalThreshold: 20 * time.Millisecond, Logger: logger})
+	for _, target := range []string{"http://fast.example.com", "http://slow.example.com"} {
+		targetURL, _ := url.Parse(target)
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", target, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(slow) != 1 || slow[0]["host"] != "slow.example.com" || slow[0]["dns_lookups"] != 1 {
+		t.Fatalf("Expected one slow evaluation of slow.example.com with one DNS lookup, got %v", slow)
+	}
+	if d, _ := slow[0]["duration"].(time.Duration); d < 20*time.Millisecond {
+		t.Fatalf("Expected the logged duration to exceed the threshold, got %v", slow[0]["duration"])
+	}
+}
+
+func TestFindProxyForURLAt(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (weekdayRange("SUN", "GMT") && timeRange(2, 4, "GMT")) return "PROXY maintenance:1";
+		return "PROXY regular:1";
+	}`)
+	defer pacServer.Close()
+	target := &url.URL{Scheme: "http", Host: "example.com", Path: "/"}
+	monday := func() time.Time { return time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC) }
+	sunday := time.Date(2024, time.January, 7, 3, 30, 0, 0, time.UTC)
+	evaluator := []string{os.Args[0], "-test.run=^TestEvaluatorHelperProcess$", "--", "pac-evaluator"}
+
+	for _, command := range [][]string{nil, evaluator} {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{Now: monday, DecisionCacheTTL: time.Minute, EvaluatorCommand: command})
+		if got, err := proxy.FindProxyStringForURL(target); err != nil || got != "PROXY regular:1" {
+			t.Fatalf("Expected PROXY regular:1 now, got %q, %v", got, err)
+		}
+		if got, err := proxy.FindProxyForURLAt(context.Background(), target, sunday); err != nil || got != "PROXY maintenance:1" {
+			t.Fatalf("Expected PROXY maintenance:1 on Sunday with evaluator %v, got %q, %v", command != nil, got, err)
+		}
+		// The cached decision for now is kept.
+		if got, err := proxy.FindProxyStringForURL(target); err != nil || got != "PROXY regular:1" {
+			t.Fatalf("Expected PROXY regular:1 after FindProxyForURLAt, got %q, %v", got, err)
+		}
+		proxy.Close()
+	}
+}
+
+// TestFindProxyForURLAtSchemes tests that FindProxyForURLAt maps the target
+// scheme like other lookups and fails after Close.
+func TestFindProxyForURLAtSchemes(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (url.substring(0, 5) == "http:") { return "PROXY plain.example.com:3128"; }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+	target, _ := url.Parse("ws://example.com/socket")
+	at := time.Date(2024, time.January, 7, 3, 30, 0, 0, time.UTC)
+
+	if got, err := proxy.FindProxyForURLAt(context.Background(), target, at); err != nil || got != "PROXY plain.example.com:3128" {
+		t.Fatalf("Expected the ws URL to be evaluated as http, got %q, %v", got, err)
+	}
+	proxy.Close()
+	if _, err := proxy.FindProxyForURLAt(context.Background(), target, at); !errors.Is(err, pac.ErrClosed) {
+		t.Fatalf("Expected ErrClosed after Close, got %v", err)
+	}
+}
+
+// TestNewPACProxyContext tests that the context of NewPACProxyContext
+// reaches the fetch, the top-level code of the script and its DNS lookups.
+func TestNewPACProxyContext(t *testing.T) {
+	pacServer := newScriptServer(t, `var gateway = dnsResolve("gateway.example.com");
+	function FindProxyForURL(url, host) { return "PROXY " + gateway + ":3128"; }`)
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+
+	resolver := &requestIDResolver{}
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-7")
+	proxy, err := pac.NewPACProxyContext(ctx, pacURL, &pac.PACProxyConfig{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("Error creating PAC proxy: %v", err)
+	}
+	defer proxy.Close()
+	if !reflect.DeepEqual(resolver.ids, []any{"req-7"}) {
+		t.Fatalf("Expected the top-level lookup with request_id req-7, got %v", resolver.ids)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pac.NewPACProxyContext(canceled, pacURL, nil); !errors.Is(err, pac.ErrFetchPACScript) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a canceled fetch, got %v", err)
+	}
+
+	loopServer := newScriptServer(t, `while (true) {}
+	function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	defer loopServer.Close()
+	loopURL, _ := url.Parse(loopServer.URL)
+	deadline, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = pac.NewPACProxyContext(deadline, loopURL, nil, pac.WithScriptTimeout(0))
+	if !errors.Is(err, pac.ErrExecutePACScript) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the script to stop at the deadline, got %v", err)
+	}
+}
+
+// labelResolver records the pprof labels of the contexts it resolves with.
+type labelResolver struct {
+	mu     sync.Mutex
+	labels []string
+}
+
+func (r *labelResolver) LookupHost(ctx context.Context, _ string) ([]string, error) {
+	host, _ := pprof.Label(ctx, "pac_host")
+	hash, _ := pprof.Label(ctx, "script_hash")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.labels = append(r.labels, host+" "+hash)
+	return []string{"10.0.0.1"}, nil
+}
+
+// TestEvalProfileLabels tests that evaluations run with the pac_host and script_hash pprof labels, as seen by the helpers.
+func TestEvalProfileLabels(t *testing.T) {
+	script := `function FindProxyForURL(url, host) { return "PROXY " + dnsResolve(host) + ":3128"; }`
+	resolver := &labelResolver{}
+	proxy := newScriptPACProxy(t, script, &pac.PACProxyConfig{Resolver: resolver})
+	targetURL, _ := url.Parse("http://example.com/")
+	if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+		t.Fatalf("Error finding proxy for URL: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(script))
+	want := []string{"example.com " + hex.EncodeToString(sum[:8])}
+	if !reflect.DeepEqual(resolver.labels, want) {
+		t.Fatalf("Expected helper labels %v, got %v", want, resolver.labels)
+	}
+}
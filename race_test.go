@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package pac_test
+
+// raceEnabled reports whether the tests run with the race detector.
+const raceEnabled = true
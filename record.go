@@ -0,0 +1,129 @@
+package pac
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// RecordedDecision is a decision captured by a Recorder.
+type RecordedDecision struct {
+	Scheme, Host string
+	Result       ProxyString
+}
+
+// Recorder captures the decisions of a PACProxy in production so that
+// Replay can compare a new script against them. Each distinct scheme, host
+// and result is written once, as a line of tab separated fields:
+//
+//	https	www.example.com	PROXY proxy.example.com:3128; DIRECT
+//
+// Install its OnEval method as PACProxyConfig.OnEval. A Recorder is safe
+// for concurrent use.
+type Recorder struct {
+	mu   sync.Mutex
+	w    *bufio.Writer
+	seen map[RecordedDecision]struct{}
+	err  error
+}
+
+// NewRecorder returns a Recorder writing to w. Call Flush before closing w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: bufio.NewWriter(w), seen: make(map[RecordedDecision]struct{})}
+}
+
+// OnEval records the decision of e; failed lookups are not recorded.
+func (r *Recorder) OnEval(_ context.Context, e EvalEvent) {
+	if e.Err != nil || e.Host == "" {
+		return
+	}
+	d := RecordedDecision{Scheme: e.Scheme, Host: e.Host, Result: e.Result}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.seen[d]; ok || r.err != nil {
+		return
+	}
+	r.seen[d] = struct{}{}
+	_, r.err = fmt.Fprintf(r.w, "%s\t%s\t%s\n", d.Scheme, d.Host, strings.Join(strings.Fields(string(d.Result)), " "))
+}
+
+// Flush writes buffered decisions and returns the first write error.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// ReadRecording parses the decisions written by a Recorder, skipping blank
+// lines and # comments.
+func ReadRecording(r io.Reader) ([]RecordedDecision, error) {
+	var decisions []RecordedDecision
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 3)
+		if len(fields) != 3 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("recording line %d: want scheme, host and result separated by tabs", line)
+		}
+		decisions = append(decisions, RecordedDecision{Scheme: fields[0], Host: fields[1], Result: ProxyString(fields[2])})
+	}
+	return decisions, scanner.Err()
+}
+
+// ReplayDiff is a recorded decision that a script decides differently.
+type ReplayDiff struct {
+	RecordedDecision
+	// Got is the new result, empty if Err is set.
+	Got ProxyString
+	Err error
+}
+
+// Replay re-evaluates every recorded scheme and host with proxy, e.g. one
+// loaded with a candidate script, and returns the decisions that changed,
+// in recording order. Results are compared directive by directive, so
+// "PROXY a:1;DIRECT" equals "PROXY a:1; DIRECT". Evaluations see the URL
+// scheme://host/, so scripts that depend on the port or path may differ
+// from production. Only a done ctx stops the replay.
+func Replay(ctx context.Context, proxy *PACProxy, decisions []RecordedDecision) ([]ReplayDiff, error) {
+	var diffs []ReplayDiff
+	for _, d := range decisions {
+		host := d.Host
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		got, err := proxy.FindProxyStringForURLContext(ctx, &url.URL{Scheme: d.Scheme, Host: host, Path: "/"})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return diffs, ctxErr
+		}
+		if err != nil {
+			diffs = append(diffs, ReplayDiff{RecordedDecision: d, Err: err})
+		} else if normalizeResult(got) != normalizeResult(d.Result) {
+			diffs = append(diffs, ReplayDiff{RecordedDecision: d, Got: got})
+		}
+	}
+	return diffs, nil
+}
+
+// normalizeResult returns the directives of result in canonical form.
+func normalizeResult(result ProxyString) string {
+	proxies := result.Proxies()
+	if len(proxies) == 0 {
+		return strings.Join(strings.Fields(string(result)), " ")
+	}
+	s := make([]string, len(proxies))
+	for i, p := range proxies {
+		s[i] = p.String()
+	}
+	return strings.Join(s, "; ")
+}
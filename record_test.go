@@ -0,0 +1,64 @@
+package pac_test
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestRecordReplay tests that a Recorder captures distinct decisions via
+// OnEval and that Replay reports the ones a new script changes.
+func TestRecordReplay(t *testing.T) {
+	server := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (dnsDomainIs(host, ".corp")) return "DIRECT";
+		if (url.substring(0, 5) == "http:") return "PROXY plain.example.com:3128";
+		return "PROXY a.example.com:3128;DIRECT";
+	}`)
+	defer server.Close()
+	var file bytes.Buffer
+	recorder := pac.NewRecorder(&file)
+	proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{OnEval: recorder.OnEval})
+	for _, raw := range []string{"https://a.corp/x", "https://a.corp/y", "https://www.example.com/", "http://www.example.com/", "https://[fd00::1]:8443/"} {
+		u, _ := url.Parse(raw)
+		if _, err := proxy.FindProxyStringForURL(u); err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", raw, err)
+		}
+	}
+	proxy.Close()
+	if err := recorder.Flush(); err != nil {
+		t.Fatalf("Error flushing recorder: %v", err)
+	}
+	want := "https\ta.corp\tDIRECT\n" +
+		"https\twww.example.com\tPROXY a.example.com:3128;DIRECT\n" +
+		"http\twww.example.com\tPROXY plain.example.com:3128\n" +
+		"https\tfd00::1\tPROXY a.example.com:3128;DIRECT\n"
+	if file.String() != want {
+		t.Fatalf("Expected recording:\n%s\ngot:\n%s", want, file.String())
+	}
+
+	decisions, err := pac.ReadRecording(strings.NewReader("# header\n\n" + file.String()))
+	if err != nil || len(decisions) != 4 {
+		t.Fatalf("Expected 4 decisions, got %v, %v", decisions, err)
+	}
+	candidate := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (dnsDomainIs(host, ".corp")) return "DIRECT";
+		return "PROXY a.example.com:3128; DIRECT";
+	}`)
+	defer candidate.Close()
+	next := newTestPACProxyFromURL(t, candidate.URL, nil)
+	diffs, err := pac.Replay(context.Background(), next, decisions)
+	if err != nil {
+		t.Fatalf("Error replaying: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Scheme != "http" || diffs[0].Got != "PROXY a.example.com:3128; DIRECT" {
+		t.Fatalf("Expected only the plain HTTP decision to change, got %+v", diffs)
+	}
+
+	if _, err := pac.ReadRecording(strings.NewReader("https www.example.com DIRECT\n")); err == nil {
+		t.Fatalf("Expected an error for a line without tabs")
+	}
+}
@@ -0,0 +1,144 @@
+package pac
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// background tracks the goroutines a PACProxy starts, so that Close can stop
+// them and wait for them to return.
+type background struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newBackground() *background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &background{ctx: ctx, cancel: cancel}
+}
+
+// start runs fn in a new goroutine unless the background was closed. The
+// context passed to fn is canceled by close.
+func (b *background) start(fn func(ctx context.Context)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+	}()
+	return true
+}
+
+// done reports whether the background was closed.
+func (b *background) done() bool {
+	return b.ctx.Err() != nil
+}
+
+// bind returns a copy of ctx that is also canceled by close, so that Close
+// interrupts evaluations in progress.
+func (b *background) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(b.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (b *background) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cancel()
+	b.wg.Wait()
+}
+
+// maybeRefresh starts a background refresh of the PAC script when
+// RefreshInterval elapsed. Lookups never wait for it: they keep using the
+// current script until the new one is compiled and validated.
+func (p *PACProxy) maybeRefresh() {
+	if p.refreshInterval <= 0 || time.Now().UnixNano() < p.nextRefresh.Load() {
+		return
+	}
+	if !p.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	started := p.bg.start(func(ctx context.Context) {
+		defer p.refreshing.Store(false)
+		if _, err := p.reload(ctx); err != nil {
+			p.logf(ctx, LogWarn, "PAC refresh failed, keeping current script", "url", p.pacURL, "err", err)
+		}
+		p.scheduleRefresh()
+	})
+	if !started {
+		p.refreshing.Store(false)
+	}
+}
+
+func (p *PACProxy) scheduleRefresh() {
+	if p.refreshInterval > 0 {
+		p.nextRefresh.Store(time.Now().Add(p.refreshDelay()).UnixNano())
+	}
+}
+
+// Reload fetches the PAC script from the PAC URL again and, if its content
+// changed, compiles and validates it and swaps it in atomically. Lookups in
+// progress finish with the previous script. Reload reports whether the
+// script changed; on error the current script stays in use.
+func (p *PACProxy) Reload(ctx context.Context) (changed bool, err error) {
+	changed, err = p.reload(ctx)
+	if err == nil {
+		p.scheduleRefresh()
+	}
+	return changed, err
+}
+
+// reload fetches the PAC script and, if it changed, compiles and validates
+// it before swapping it in. It reports whether the script changed.
+func (p *PACProxy) reload(ctx context.Context) (bool, error) {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	if p.bg.done() {
+		return false, ErrClosed
+	}
+
+	source, err := p.fetchVerifiedScript(ctx)
+	if err != nil {
+		return false, err
+	}
+	if sha256.Sum256(source) == p.script.Load().hash {
+		// Renew the cached copy so other processes keep using it.
+		p.storeCachedScript(source)
+		p.logf(ctx, LogDebug, "PAC script unchanged", "url", p.pacURL)
+		return false, nil
+	}
+
+	script, err := p.compileScript(ctx, source)
+	if err != nil {
+		return false, err
+	}
+	if err := script.validate(p.entryPoints); err != nil {
+		script.close()
+		p.emitError(ctx, "validate", err)
+		return false, err
+	}
+	if p.bg.done() {
+		// Close ran meanwhile and waits for reloadMu to release the
+		// current script; the new one would never be released.
+		script.close()
+		return false, ErrClosed
+	}
+	p.script.Swap(script).close()
+	p.storeCachedScript(source)
+	p.logf(ctx, LogInfo, "PAC script updated", "url", p.pacURL, "bytes", len(source))
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestRefreshInterval tests that a changed script is swapped in by a background refresh
+// and that a broken script never replaces a working one.
+func TestRefreshInterval(t *testing.T) {
+	var script atomic.Value
+	script.Store(`function FindProxyForURL(url, host) { return "PROXY old.example.com:3128"; }`)
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, script.Load().(string))
+	}))
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{RefreshInterval: 10 * time.Millisecond})
+	targetURL, _ := url.Parse("http://example.com")
+
+	waitFor := func(want pac.ProxyString) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got, err := proxy.FindProxyStringForURL(targetURL)
+			if err != nil {
+				t.Fatalf("Error finding proxy for URL: %v", err)
+			}
+			if got == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected proxy string %s, got %s", want, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("PROXY old.example.com:3128")
+	script.Store(`function FindProxyForURL(url, host) { return "PROXY new.example.com:3128"; }`)
+	waitFor("PROXY new.example.com:3128")
+
+	script.Store(`function FindProxyForURL(url, host) {`)
+	time.Sleep(50 * time.Millisecond)
+	waitFor("PROXY new.example.com:3128")
+}
+
+// TestReload tests that Reload swaps in a changed script and reports whether it changed.
+func TestReload(t *testing.T) {
+	var script atomic.Value
+	script.Store(`function FindProxyForURL(url, host) { return "PROXY old.example.com:3128"; }`)
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, script.Load().(string))
+	}))
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+	targetURL, _ := url.Parse("http://example.com")
+
+	if changed, err := proxy.Reload(context.Background()); err != nil || changed {
+		t.Fatalf("Expected unchanged script, got changed=%v err=%v", changed, err)
+	}
+
+	script.Store(`function FindProxyForURL(url, host) { return "PROXY new.example.com:3128"; }`)
+	if changed, err := proxy.Reload(context.Background()); err != nil || !changed {
+		t.Fatalf("Expected changed script, got changed=%v err=%v", changed, err)
+	}
+	if got, _ := proxy.FindProxyStringForURL(targetURL); got != "PROXY new.example.com:3128" {
+		t.Fatalf("Expected proxy string PROXY new.example.com:3128, got %s", got)
+	}
+
+	script.Store(`function FindProxyForURL(url, host) {`)
+	if _, err := proxy.Reload(context.Background()); !errors.Is(err, pac.ErrExecutePACScript) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrExecutePACScript, err)
+	}
+	if got, _ := proxy.FindProxyStringForURL(targetURL); got != "PROXY new.example.com:3128" {
+		t.Fatalf("Expected the previous script to stay in use, got %s", got)
+	}
+}
+
+// TestReloadClose tests that a Reload running into Close returns ErrClosed
+// instead of swapping in a script that nothing releases.
+func TestReloadClose(t *testing.T) {
+	var fetches atomic.Int32
+	fetching, release := make(chan struct{}), make(chan struct{})
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		result := "DIRECT"
+		if fetches.Add(1) > 1 {
+			close(fetching)
+			<-release
+			result = "PROXY new.example.com:3128"
+		}
+		_, _ = io.WriteString(w, `function FindProxyForURL(url, host) { return "`+result+`"; }`)
+	}))
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+	proxy, err := pac.NewPACProxy(pacURL, nil)
+	if err != nil {
+		t.Fatalf("Error creating proxy: %v", err)
+	}
+
+	reloaded := make(chan error, 1)
+	go func() {
+		_, err := proxy.Reload(context.Background())
+		reloaded <- err
+	}()
+	<-fetching
+	closed := make(chan error, 1)
+	go func() { closed <- proxy.Close() }()
+	targetURL, _ := url.Parse("http://example.com")
+	for {
+		if _, err := proxy.FindProxyStringForURL(targetURL); errors.Is(err, pac.ErrClosed) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := <-reloaded; !errors.Is(err, pac.ErrClosed) {
+		t.Fatalf("Expected the Reload overlapping Close to fail with %v, got %v", pac.ErrClosed, err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Error closing proxy: %v", err)
+	}
+	if _, err := proxy.Reload(context.Background()); !errors.Is(err, pac.ErrClosed) {
+		t.Fatalf("Expected Reload after Close to fail with %v, got %v", pac.ErrClosed, err)
+	}
+}
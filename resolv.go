@@ -0,0 +1,29 @@
+package pac
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// resolvConfSearchDomains returns the search domains of the first readable
+// resolv.conf in paths, from its search and domain lines.
+func resolvConfSearchDomains(paths []string) []string {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		var domains []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 1 && (fields[0] == "search" || fields[0] == "domain") {
+				domains = append(domains, fields[1:]...)
+			}
+		}
+		f.Close()
+		return domains
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !gopac_testhooks
+// +build !gopac_testhooks
+
+package pac
+
+// resolvConfFiles are read for search domains. systemd-resolved writes the
+// domains of all links, including those pushed by VPNs, to the first; the
+// second may be its stub or a plain resolv.conf.
+var resolvConfFiles = []string{"/run/systemd/resolve/resolv.conf", "/etc/resolv.conf"}
+
+// systemSearchDomains returns the DNS search domains of the host.
+func systemSearchDomains() []string {
+	return resolvConfSearchDomains(resolvConfFiles)
+}
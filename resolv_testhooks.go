@@ -0,0 +1,26 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import "sync"
+
+var (
+	testResolvConf   string
+	testResolvConfMu sync.RWMutex
+)
+
+// SetTestResolvConf sets the resolv.conf DetectPACURL reads search domains
+// from in tests. Pass an empty string to reset to none.
+func SetTestResolvConf(path string) {
+	testResolvConfMu.Lock()
+	testResolvConf = path
+	testResolvConfMu.Unlock()
+}
+
+func systemSearchDomains() []string {
+	testResolvConfMu.RLock()
+	path := testResolvConf
+	testResolvConfMu.RUnlock()
+	return resolvConfSearchDomains([]string{path})
+}
@@ -15,7 +15,7 @@ import (
 type JSRuntime interface {
 	Set(name string, value interface{}) error
 	RunString(script string) (goja.Value, error)
-	DefinePACFunctions()
+	DefinePACFunctions() error
 	Get(name string) goja.Value
 	ToValue(value interface{}) goja.Value
 	Interrupt(v interface{})
@@ -25,15 +25,125 @@ type JSRuntime interface {
 type GojaRuntime struct {
 	*goja.Runtime
 	dnsTimeout time.Duration
-	defineErr  error
+	// evalCtx bounds helper DNS lookups during an evaluation.
+	evalCtx context.Context
+	// dnsCache is shared by the runtimes of one or more PACProxy.
+	dnsCache *DNSCache
+	// allowLookup, if set, vets each helper lookup (DNSFilter).
+	allowLookup func(ctx context.Context, host string) bool
+	// resolve, if set, replaces the DNS resolver, e.g. in an evaluator
+	// process that forwards lookups to its parent.
+	resolve func(host string) ([]string, error)
+	// resolver, now and interfaceAddrs back the DNS, date and
+	// myIpAddress helpers.
+	resolver       Resolver
+	now            func() time.Time
+	interfaceAddrs func() ([]net.Addr, error)
+	// compat selects browser helper semantics.
+	compat CompatMode
+	// dnsLookups counts the helper lookups of the current evaluation.
+	dnsLookups int
+	// helpers are the names defined by DefinePACFunctions.
+	helpers []string
+	// disabled are the helpers DefinePACFunctions leaves out; disableDNS
+	// fails every helper lookup.
+	disabled   map[string]bool
+	disableDNS bool
+	// extensions enables the helpers of defineExtensionHelpers, whose
+	// parsed range lists are kept in rangeLists.
+	extensions bool
+	rangeLists map[string][]ipRange
+	// timers is the last id handed out by the timer shims.
+	timers int
 }
 
+// gojaRuntime is implemented by GojaRuntime and by types embedding it, so
+// that PACProxy configures custom runtimes built on it like its own.
+type gojaRuntime interface {
+	gojaRuntime() *GojaRuntime
+}
+
+func (r *GojaRuntime) gojaRuntime() *GojaRuntime { return r }
+
+// asGojaRuntime returns the GojaRuntime of vm, nil if it is not built on
+// one.
+func asGojaRuntime(vm JSRuntime) *GojaRuntime {
+	if gr, ok := vm.(gojaRuntime); ok {
+		return gr.gojaRuntime()
+	}
+	return nil
+}
+
+// maxCallStackSize bounds the JavaScript call depth, as browsers do. Without
+// it, recursion through native functions such as Array.prototype.map grows
+// the Go stack until the process dies, which no timeout or recover stops.
+const maxCallStackSize = 10000
+
 // NewGojaRuntime creates a new GojaRuntime instance
 func NewGojaRuntime() *GojaRuntime {
-	return &GojaRuntime{
-		Runtime:    goja.New(),
+	return NewGojaRuntimeWithOptions(GojaRuntimeOptions{})
+}
+
+// GojaRuntimeOptions configures a GojaRuntime. The zero value is the
+// configuration of NewGojaRuntime.
+type GojaRuntimeOptions struct {
+	// DNSLookupTimeout bounds each helper lookup; 0 selects the default of
+	// 2s and a negative value removes the limit.
+	DNSLookupTimeout time.Duration
+	// Resolver resolves helper lookups, net.DefaultResolver if nil.
+	Resolver Resolver
+	// DNSCache, if set, caches helper lookups.
+	DNSCache *DNSCache
+	// Now is the clock of the date and time helpers, time.Now if nil.
+	Now func() time.Time
+	// InterfaceAddrs is the source of myIpAddress, net.InterfaceAddrs if
+	// nil.
+	InterfaceAddrs func() ([]net.Addr, error)
+	CompatMode     CompatMode
+	// DisableDNS makes every helper lookup fail, so isResolvable is false,
+	// dnsResolve returns "" and isInNet only matches IP literals.
+	DisableDNS bool
+	// DisableHelpers are PAC helpers, e.g. "myIpAddress", that
+	// DefinePACFunctions leaves undefined.
+	DisableHelpers []string
+	// ExtensionHelpers makes DefinePACFunctions also define isSubnetOf,
+	// matchesDomainSuffix, inIpRangeList and parseURL.
+	ExtensionHelpers bool
+}
+
+// NewGojaRuntimeWithOptions creates a GojaRuntime configured by opts.
+func NewGojaRuntimeWithOptions(opts GojaRuntimeOptions) *GojaRuntime {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(maxCallStackSize)
+	r := &GojaRuntime{
+		Runtime:    vm,
 		dnsTimeout: defaultDNSLookupTimeout,
-	}
+		dnsCache:   opts.DNSCache,
+		compat:     opts.CompatMode,
+		disableDNS: opts.DisableDNS,
+		extensions: opts.ExtensionHelpers,
+	}
+	if opts.DNSLookupTimeout > 0 {
+		r.dnsTimeout = opts.DNSLookupTimeout
+	} else if opts.DNSLookupTimeout < 0 {
+		r.dnsTimeout = 0
+	}
+	r.SetResolver(opts.Resolver)
+	r.SetClock(opts.Now)
+	r.SetInterfaceAddrs(opts.InterfaceAddrs)
+	if len(opts.DisableHelpers) > 0 {
+		r.disabled = make(map[string]bool, len(opts.DisableHelpers))
+		for _, name := range opts.DisableHelpers {
+			r.disabled[name] = true
+		}
+	}
+	return r
+}
+
+// Resolver resolves the hosts looked up by the PAC helpers. *net.Resolver
+// implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
 }
 
 // SetDNSLookupTimeout sets the timeout for DNS lookups executed by PAC helpers.
@@ -41,14 +151,89 @@ func (r *GojaRuntime) SetDNSLookupTimeout(timeout time.Duration) {
 	r.dnsTimeout = timeout
 }
 
-func (r *GojaRuntime) lookupHost(host string) ([]string, error) {
-	if r.dnsTimeout <= 0 {
-		return net.LookupHost(host)
+// SetResolver sets the resolver of the PAC DNS helpers, nil restoring
+// net.DefaultResolver.
+func (r *GojaRuntime) SetResolver(resolver Resolver) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	r.resolver = resolver
+}
+
+// SetClock sets the clock of weekdayRange, dateRange and timeRange, nil
+// restoring time.Now.
+func (r *GojaRuntime) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	r.now = now
+}
+
+type evalTimeKey struct{}
+
+// withEvalTime returns a copy of ctx whose evaluations see t as the current
+// time, see FindProxyForURLAt.
+func withEvalTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, evalTimeKey{}, t)
+}
+
+// currentTime returns the time of the current evaluation: the time set by
+// withEvalTime or the clock.
+func (r *GojaRuntime) currentTime() time.Time {
+	if t, ok := r.lookupContext().Value(evalTimeKey{}).(time.Time); ok {
+		return t
 	}
+	return r.now()
+}
+
+// SetInterfaceAddrs sets the source of the myIpAddress addresses, nil
+// restoring net.InterfaceAddrs.
+func (r *GojaRuntime) SetInterfaceAddrs(addrs func() ([]net.Addr, error)) {
+	if addrs == nil {
+		addrs = net.InterfaceAddrs
+	}
+	r.interfaceAddrs = addrs
+}
+
+// SetCompatMode makes the helpers follow the semantics of mode.
+func (r *GojaRuntime) SetCompatMode(mode CompatMode) {
+	r.compat = mode
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), r.dnsTimeout)
+func (r *GojaRuntime) lookupHost(host string) (addrs []string, err error) {
+	r.dnsLookups++
+	defer func() { recordDNSAnswer(r.lookupContext(), host, addrs, err) }()
+	if r.disableDNS || r.allowLookup != nil && !r.allowLookup(r.lookupContext(), host) {
+		return nil, errDNSLookupDenied
+	}
+	if r.resolve != nil {
+		return r.dnsCache.lookup(host, r.resolve)
+	}
+	return r.dnsCache.lookup(host, r.resolveHost)
+}
+
+// lookupContext returns the context of the current evaluation.
+func (r *GojaRuntime) lookupContext() context.Context {
+	if r.evalCtx == nil {
+		return context.Background()
+	}
+	return r.evalCtx
+}
+
+func (r *GojaRuntime) resolveHost(host string) ([]string, error) {
+	return resolveHost(r.lookupContext(), r.resolver, host, r.dnsTimeout)
+}
+
+// resolveHost looks up host with resolver, bounded by ctx and timeout if
+// positive.
+func resolveHost(ctx context.Context, resolver Resolver, host string, timeout time.Duration) ([]string, error) {
+	if timeout <= 0 {
+		return resolver.LookupHost(ctx, host)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	return net.DefaultResolver.LookupHost(ctx, host)
+	return resolver.LookupHost(ctx, host)
 }
 
 func (r *GojaRuntime) resolveIP(host string) (net.IP, error) {
@@ -62,41 +247,50 @@ func (r *GojaRuntime) resolveIP(host string) (net.IP, error) {
 	return net.ParseIP(addrs[0]), nil
 }
 
-func (r *GojaRuntime) set(name string, value interface{}) {
-	if r.defineErr != nil {
-		return
+// define sets the helper name unless it is disabled.
+func (r *GojaRuntime) define(name string, value any) error {
+	if r.disabled[name] {
+		return nil
+	}
+	if fn, ok := value.(func(goja.FunctionCall) goja.Value); ok {
+		value = r.traced(name, fn)
 	}
 	if err := r.Set(name, value); err != nil {
-		r.defineErr = err
+		return err
 	}
+	r.helpers = append(r.helpers, name)
+	return nil
 }
 
-// DefinePACFunctions defines standard PAC functions in the JavaScript runtime
-func (r *GojaRuntime) DefinePACFunctions() {
-	r.set("isPlainHostName", func(call goja.FunctionCall) goja.Value {
-		host := call.Argument(0).String()
-		return r.ToValue(!strings.Contains(host, "."))
+// DefinePACFunctions defines standard PAC functions in the JavaScript
+// runtime, except the disabled ones, and returns the first error.
+func (r *GojaRuntime) DefinePACFunctions() error {
+	var err error
+	set := func(name string, value any) {
+		if err == nil {
+			err = r.define(name, value)
+		}
+	}
+
+	set("isPlainHostName", func(call goja.FunctionCall) goja.Value {
+		return r.ToValue(isPlainHostName(call.Argument(0).String()))
 	})
 
-	r.set("dnsDomainIs", func(call goja.FunctionCall) goja.Value {
-		host := call.Argument(0).String()
-		domain := call.Argument(1).String()
-		return r.ToValue(strings.HasSuffix(host, domain))
+	set("dnsDomainIs", func(call goja.FunctionCall) goja.Value {
+		return r.ToValue(dnsDomainIs(call.Argument(0).String(), call.Argument(1).String()))
 	})
 
-	r.set("localHostOrDomainIs", func(call goja.FunctionCall) goja.Value {
-		host := call.Argument(0).String()
-		hostdom := call.Argument(1).String()
-		return r.ToValue(host == hostdom || strings.HasSuffix(hostdom, "."+host))
+	set("localHostOrDomainIs", func(call goja.FunctionCall) goja.Value {
+		return r.ToValue(localHostOrDomainIs(call.Argument(0).String(), call.Argument(1).String()))
 	})
 
-	r.set("isResolvable", func(call goja.FunctionCall) goja.Value {
+	set("isResolvable", func(call goja.FunctionCall) goja.Value {
 		host := call.Argument(0).String()
 		_, err := r.lookupHost(host)
 		return r.ToValue(err == nil)
 	})
 
-	r.set("isInNet", func(call goja.FunctionCall) goja.Value {
+	set("isInNet", func(call goja.FunctionCall) goja.Value {
 		host := call.Argument(0).String()
 		pattern := call.Argument(1).String()
 		mask := call.Argument(2).String()
@@ -104,76 +298,35 @@ func (r *GojaRuntime) DefinePACFunctions() {
 		if err != nil || ip == nil {
 			return r.ToValue(false)
 		}
-		pat := net.ParseIP(pattern)
-		m := net.ParseIP(mask)
-		if ip == nil || pat == nil || m == nil {
-			return r.ToValue(false)
-		}
-		if ip4 := ip.To4(); ip4 != nil {
-			pat4 := pat.To4()
-			m4 := m.To4()
-			if pat4 == nil || m4 == nil {
-				return r.ToValue(false)
-			}
-			for i := 0; i < 4; i++ {
-				if (ip4[i] & m4[i]) != (pat4[i] & m4[i]) {
-					return r.ToValue(false)
-				}
-			}
-			return r.ToValue(true)
-		}
-
-		ip16 := ip.To16()
-		pat16 := pat.To16()
-		m16 := m.To16()
-		if ip16 == nil || pat16 == nil || m16 == nil {
-			return r.ToValue(false)
-		}
-		for i := 0; i < 16; i++ {
-			if (ip16[i] & m16[i]) != (pat16[i] & m16[i]) {
-				return r.ToValue(false)
-			}
-		}
-		return r.ToValue(true)
+		return r.ToValue(r.compat.ipInNet(ip, pattern, mask))
 	})
 
-	r.set("dnsResolve", func(call goja.FunctionCall) goja.Value {
+	set("dnsResolve", func(call goja.FunctionCall) goja.Value {
 		host := call.Argument(0).String()
 		addrs, err := r.lookupHost(host)
-		if err != nil || len(addrs) == 0 {
+		if err != nil {
 			return r.ToValue("")
 		}
-		return r.ToValue(addrs[0])
+		return r.ToValue(r.compat.dnsResolve(addrs))
 	})
 
-	r.set("myIpAddress", func(call goja.FunctionCall) goja.Value {
-		addrs, err := net.InterfaceAddrs()
+	set("myIpAddress", func(call goja.FunctionCall) goja.Value {
+		addrs, err := r.interfaceAddrs()
 		if err != nil {
-			return r.ToValue("")
-		}
-		for _, addr := range addrs {
-			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-				if ipnet.IP.To4() != nil {
-					return r.ToValue(ipnet.IP.String())
-				}
-			}
+			addrs = nil
 		}
-		return r.ToValue("")
+		return r.ToValue(r.compat.myIpAddress(addrs))
 	})
 
-	r.set("dnsDomainLevels", func(call goja.FunctionCall) goja.Value {
-		host := call.Argument(0).String()
-		return r.ToValue(strings.Count(host, "."))
+	set("dnsDomainLevels", func(call goja.FunctionCall) goja.Value {
+		return r.ToValue(dnsDomainLevels(call.Argument(0).String()))
 	})
 
-	r.set("shExpMatch", func(call goja.FunctionCall) goja.Value {
-		str := call.Argument(0).String()
-		pat := call.Argument(1).String()
-		matched, _ := path.Match(pat, str)
-		return r.ToValue(matched)
+	set("shExpMatch", func(call goja.FunctionCall) goja.Value {
+		return r.ToValue(r.compat.shExpMatch(call.Argument(0).String(), call.Argument(1).String()))
 	})
 
-	r.set("weekdayRange", func(call goja.FunctionCall) goja.Value {
+	set("weekdayRange", func(call goja.FunctionCall) goja.Value {
 		args, loc := splitArgsAndLocation(call.Arguments)
 		if len(args) == 0 || len(args) > 2 {
 			return r.ToValue(false)
@@ -182,7 +335,7 @@ func (r *GojaRuntime) DefinePACFunctions() {
 		if !ok {
 			return r.ToValue(false)
 		}
-		now := time.Now().In(loc).Weekday()
+		now := r.currentTime().In(loc).Weekday()
 		if len(args) == 1 {
 			return r.ToValue(now == wd1)
 		}
@@ -196,23 +349,91 @@ func (r *GojaRuntime) DefinePACFunctions() {
 		return r.ToValue(now >= wd1 || now <= wd2)
 	})
 
-	r.set("dateRange", func(call goja.FunctionCall) goja.Value {
+	set("dateRange", func(call goja.FunctionCall) goja.Value {
 		args, loc := splitArgsAndLocation(call.Arguments)
 		if len(args) == 0 {
 			return r.ToValue(false)
 		}
-		now := time.Now().In(loc)
+		now := r.currentTime().In(loc)
 		return r.ToValue(dateRangeMatches(args, now, loc))
 	})
 
-	r.set("timeRange", func(call goja.FunctionCall) goja.Value {
+	set("timeRange", func(call goja.FunctionCall) goja.Value {
 		args, loc := splitArgsAndLocation(call.Arguments)
 		if len(args) == 0 {
 			return r.ToValue(false)
 		}
-		now := time.Now().In(loc)
+		now := r.currentTime().In(loc)
 		return r.ToValue(timeRangeMatches(args, now))
 	})
+
+	if r.extensions {
+		r.defineExtensionHelpers(set)
+	}
+	if r.compat.browser() {
+		r.defineTimerShims(set)
+	}
+	return err
+}
+
+// The PAC helpers without side effects, shared by GojaRuntime and the
+// native matcher.
+
+func isPlainHostName(host string) bool {
+	return !strings.Contains(host, ".")
+}
+
+func dnsDomainIs(host, domain string) bool {
+	return strings.HasSuffix(host, domain)
+}
+
+func localHostOrDomainIs(host, hostdom string) bool {
+	return host == hostdom || strings.HasSuffix(hostdom, "."+host)
+}
+
+func dnsDomainLevels(host string) int {
+	return strings.Count(host, ".")
+}
+
+func shExpMatch(str, pat string) bool {
+	matched, _ := path.Match(pat, str)
+	return matched
+}
+
+// ipInNet reports whether ip matches pattern under mask, both IP addresses
+// of the same family as ip.
+func ipInNet(ip net.IP, pattern, mask string) bool {
+	pat := net.ParseIP(pattern)
+	m := net.ParseIP(mask)
+	if ip == nil || pat == nil || m == nil {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		pat4 := pat.To4()
+		m4 := m.To4()
+		if pat4 == nil || m4 == nil {
+			return false
+		}
+		for i := 0; i < 4; i++ {
+			if (ip4[i] & m4[i]) != (pat4[i] & m4[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	ip16 := ip.To16()
+	pat16 := pat.To16()
+	m16 := m.To16()
+	if ip16 == nil || pat16 == nil || m16 == nil {
+		return false
+	}
+	for i := 0; i < 16; i++ {
+		if (ip16[i] & m16[i]) != (pat16[i] & m16[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 var weekdayNames = map[string]time.Weekday{
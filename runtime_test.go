@@ -0,0 +1,115 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/pactest"
+)
+
+// countingRuntime is a custom runtime built on GojaRuntime that counts the
+// PAC helper definitions and adds a corpProxy global.
+type countingRuntime struct {
+	*pac.GojaRuntime
+	defined *atomic.Int32
+}
+
+func (r countingRuntime) DefinePACFunctions() error {
+	r.defined.Add(1)
+	if err := r.GojaRuntime.DefinePACFunctions(); err != nil {
+		return err
+	}
+	return r.Set("corpProxy", func(name string) string { return "PROXY " + name + ".corp.example.com:3128" })
+}
+
+// TestNewRuntime tests that NewRuntime supplies the runtime of the script
+// and that runtimes built on GojaRuntime get the helper configuration.
+func TestNewRuntime(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (isResolvable(host)) { return corpProxy("internal"); }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	var defined atomic.Int32
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		NewRuntime: func() pac.JSRuntime { return countingRuntime{pac.NewGojaRuntime(), &defined} },
+		Resolver:   pactest.NewResolver(map[string][]string{"intranet.example.com": {"10.0.0.8"}}),
+	})
+	if defined.Load() != 1 {
+		t.Fatalf("Expected NewRuntime to be called once, got %d", defined.Load())
+	}
+
+	for target, want := range map[string]pac.ProxyString{
+		"http://intranet.example.com/": "PROXY internal.corp.example.com:3128",
+		"http://www.example.com/":      "DIRECT",
+	} {
+		targetURL, _ := url.Parse(target)
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if err != nil || got != want {
+			t.Fatalf("%s: expected %s, got %q, %v", target, want, got, err)
+		}
+	}
+}
+
+func TestGojaRuntimeOptions(t *testing.T) {
+	resolver := pactest.NewResolver(map[string][]string{"www.example.com": {"93.184.215.14"}})
+	monday := func() time.Time { return time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC) }
+	run := func(opts pac.GojaRuntimeOptions, script string) any {
+		t.Helper()
+		vm := pac.NewGojaRuntimeWithOptions(opts)
+		if err := vm.DefinePACFunctions(); err != nil {
+			t.Fatalf("Error defining PAC functions: %v", err)
+		}
+		value, err := vm.RunString(script)
+		if err != nil {
+			t.Fatalf("Error running %s: %v", script, err)
+		}
+		return value.Export()
+	}
+
+	opts := pac.GojaRuntimeOptions{
+		Resolver:       resolver,
+		Now:            monday,
+		CompatMode:     pac.CompatChromium,
+		DisableHelpers: []string{"myIpAddress"},
+	}
+	tests := []struct {
+		script string
+		want   any
+	}{
+		{`dnsResolve("www.example.com")`, "93.184.215.14"},
+		{`weekdayRange("MON")`, true},
+		{`shExpMatch("http://a/b", "http://*")`, true},
+		{`typeof myIpAddress`, "undefined"},
+	}
+	for _, tt := range tests {
+		if got := run(opts, tt.script); got != tt.want {
+			t.Fatalf("%s: expected %v, got %v", tt.script, tt.want, got)
+		}
+	}
+
+	opts.DisableDNS = true
+	if got := run(opts, `dnsResolve("www.example.com") + "," + isResolvable("www.example.com") + "," + isInNet("10.1.2.3", "10.0.0.0", "255.0.0.0")`); got != ",false,true" {
+		t.Fatalf("Expected no DNS with DisableDNS, got %v", got)
+	}
+}
+
+// TestCallStackLimit tests that runaway recursion through native functions
+// fails the evaluation instead of overflowing the Go stack, even without a
+// script timeout.
+func TestCallStackLimit(t *testing.T) {
+	server := newScriptServer(t, `function FindProxyForURL(url, host) {
+		function f() { return [1].map(f); }
+		return f();
+	}`)
+	defer server.Close()
+	proxy := newTestPACProxyFromURL(t, server.URL, &pac.PACProxyConfig{ScriptTimeout: -1})
+	if _, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "https", Host: "example.com"}); !errors.Is(err, pac.ErrEvaluatePAC) {
+		t.Fatalf("Expected ErrEvaluatePAC, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package pac
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// sandboxScript replaces eval and the Function constructors, reachable
+// through the constructor property of any function, with functions that
+// throw, and makes the PAC helpers read-only. %s is the JSON list of helper
+// names.
+const sandboxScript = `(function(helpers) {
+	var global = this;
+	function disabled() { throw new TypeError("disabled in the PAC sandbox"); }
+	function lock(obj, name) {
+		Object.defineProperty(obj, name, {value: disabled, writable: false, configurable: false});
+	}
+	var protos = [Function.prototype];
+	try { protos.push(Object.getPrototypeOf(new Function("return function*() {}")())); } catch (e) {}
+	try { protos.push(Object.getPrototypeOf(new Function("return async function() {}")())); } catch (e) {}
+	try { protos.push(Object.getPrototypeOf(new Function("return async function*() {}")())); } catch (e) {}
+	for (var i = 0; i < protos.length; i++) {
+		lock(protos[i], "constructor");
+	}
+	lock(global, "Function");
+	lock(global, "eval");
+	for (var j = 0; j < helpers.length; j++) {
+		var name = helpers[j];
+		Object.freeze(global[name]);
+		Object.defineProperty(global, name, {writable: false, configurable: false});
+	}
+}).call(this, %s);`
+
+// Sandbox restricts the runtime before a PAC script runs in it: eval and
+// the Function constructor throw, so the script cannot compile strings it
+// fetched or built, and the PAC helpers defined by DefinePACFunctions can
+// neither be replaced nor modified. Call it after DefinePACFunctions.
+func (r *GojaRuntime) Sandbox() error {
+	helpers, err := json.Marshal(r.helpers)
+	if err != nil {
+		return err
+	}
+	if _, err := r.RunString(fmt.Sprintf(sandboxScript, helpers)); err != nil {
+		return fmt.Errorf("sandbox runtime: %w", err)
+	}
+	return nil
+}
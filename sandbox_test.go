@@ -0,0 +1,44 @@
+package pac_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestSandbox tests that the sandbox disables eval and the Function constructor and protects the helpers.
+func TestSandbox(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		var escaped = [];
+		try { eval("1"); escaped.push("eval"); } catch (e) {}
+		try { Function("return 1")(); escaped.push("Function"); } catch (e) {}
+		try { (function() {}).constructor("return 1")(); escaped.push("constructor"); } catch (e) {}
+		try { (function*() {}).constructor("yield 1"); escaped.push("generator"); } catch (e) {}
+		try { isPlainHostName = function() { return false; }; } catch (e) {}
+		try { shExpMatch.polluted = true; } catch (e) {}
+		if (isPlainHostName("intranet") !== true) { escaped.push("helper"); }
+		if (shExpMatch.polluted) { escaped.push("pollution"); }
+		return escaped.length ? "PROXY " + escaped.join("-") + ":1" : "DIRECT";
+	}`)
+	defer pacServer.Close()
+	targetURL, _ := url.Parse("http://example.com")
+
+	for _, tc := range []struct {
+		sandbox bool
+		want    pac.ProxyString
+	}{
+		{false, "PROXY eval-Function-constructor-generator-helper-pollution:1"},
+		{true, "DIRECT"},
+	} {
+		proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{Sandbox: tc.sandbox})
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		proxy.Close()
+		if err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+		if got != tc.want {
+			t.Fatalf("Sandbox %v: expected %s, got %s", tc.sandbox, tc.want, got)
+		}
+	}
+}
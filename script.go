@@ -0,0 +1,311 @@
+package pac
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// pacScript is a compiled PAC script together with the runtime evaluating it.
+type pacScript struct {
+	source string
+	hash   [sha256.Size]byte
+	vm     JSRuntime
+	// entry is the entry point found in the script, "" if none; see
+	// EntryPoints.
+	entry string
+	// readsURL reports whether the entry point may read its url argument,
+	// see scriptReadsURL.
+	readsURL bool
+	// decisionPrefix starts the keys of its decisions, see decisionKey.
+	decisionPrefix string
+	// isolated replaces vm if the script runs in an evaluator process.
+	isolated *isolatedVM
+	// native, if set, evaluates the script in Go; see compileNative.
+	native *nativeMatcher
+	// mu serializes evaluations; the runtime is not safe for concurrent use.
+	mu sync.Mutex
+}
+
+// fetchScript downloads the PAC script from the PAC URL.
+func (p *PACProxy) fetchScript(ctx context.Context) (script []byte, err error) {
+	ctx, span := p.startSpan(ctx, "pac.fetch", attribute.String("pac.url", p.pacURL))
+	start := time.Now()
+	status := 0
+	defer func() {
+		elapsed := time.Since(start)
+		observe(p.sink, MetricFetchSeconds, elapsed.Seconds(), "outcome", outcome(err))
+		p.emitFetch(ctx, FetchEvent{URL: p.pacURL, StatusCode: status, Bytes: len(script), Duration: elapsed, Err: err})
+		endSpan(span, err)
+	}()
+	p.logf(ctx, LogInfo, "fetching PAC script", "url", p.pacURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.pacURL, nil)
+	if err != nil {
+		return nil, &FetchError{URL: p.pacURL, Err: err}
+	}
+	if err := checkSecureURL(req.URL, p.httpsOnly); err != nil {
+		p.logf(ctx, LogError, "PAC URL disallowed", "url", p.pacURL, "err", err)
+		return nil, &FetchError{URL: p.pacURL, Err: err}
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.logf(ctx, LogError, "fetch PAC script failed", "url", p.pacURL, "err", err)
+		return nil, &FetchError{URL: p.pacURL, Err: err}
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	if err := checkTLSPins(resp.TLS, p.tlsPins); err != nil {
+		p.logf(ctx, LogError, "PAC server certificate rejected", "url", p.pacURL, "err", err)
+		return nil, &FetchError{URL: p.pacURL, StatusCode: status, Err: err}
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		p.logf(ctx, LogError, "fetch PAC script failed", "url", p.pacURL, "status", resp.StatusCode)
+		return nil, &FetchError{URL: p.pacURL, StatusCode: status}
+	}
+
+	if p.maxScriptSize > 0 && resp.ContentLength > p.maxScriptSize {
+		p.logf(ctx, LogError, "PAC script too large", "url", p.pacURL, "content_length", resp.ContentLength, "max_size", p.maxScriptSize)
+		return nil, ErrPACScriptTooLarge
+	}
+
+	// Read the PAC script with size limits
+	script, err = readPACScript(resp.Body, p.maxScriptSize)
+	if err != nil {
+		p.logf(ctx, LogError, "read PAC script failed", "url", p.pacURL, "err", err)
+		return nil, fmt.Errorf("%w: %v", ErrReadPACScript, err)
+	}
+
+	lifetime, ok := cacheLifetime(resp.Header, time.Now())
+	if !ok {
+		lifetime = -1
+	}
+	p.fetchLifetime.Store(int64(lifetime))
+	span.SetAttributes(attribute.Int("pac.script.bytes", len(script)))
+	return script, nil
+}
+
+// compileScript runs source in a new runtime with the PAC functions defined.
+func (p *PACProxy) compileScript(ctx context.Context, source []byte) (script *pacScript, err error) {
+	ctx, span := p.startSpan(ctx, "pac.compile", attribute.Int("pac.script.bytes", len(source)))
+	defer func() {
+		if err != nil {
+			p.emitError(ctx, "compile", err)
+		}
+		endSpan(span, err)
+	}()
+
+	if p.moduleSyntax {
+		source = []byte(shimModuleSyntax(string(source)))
+	}
+	if p.launchEvaluator != nil {
+		script, err = p.compileIsolated(ctx, source)
+		if err == nil {
+			script.native = p.compileNative(ctx, script.entry, source)
+			script.readsURL = scriptReadsURL(script.source, script.entry)
+			script.decisionPrefix = p.decisionPrefix(script.hash)
+		}
+		return script, err
+	}
+
+	vm, err := p.compileLocal(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	entry, _ := entryPoint(vm, p.entryPoints)
+	script = &pacScript{
+		source: string(source),
+		hash:   sha256.Sum256(source),
+		vm:     vm,
+		entry:  entry,
+		native: p.compileNative(ctx, entry, source),
+	}
+	script.readsURL = scriptReadsURL(script.source, entry)
+	script.decisionPrefix = p.decisionPrefix(script.hash)
+	return script, nil
+}
+
+// compileLocal runs source in a new in-process runtime configured like the
+// PACProxy.
+func (p *PACProxy) compileLocal(ctx context.Context, source []byte) (JSRuntime, error) {
+	// Create a new JavaScript runtime and define standard PAC functions
+	var vm JSRuntime
+	if p.newRuntime != nil {
+		vm = p.newRuntime()
+	} else {
+		vm = NewGojaRuntime()
+	}
+	gr := asGojaRuntime(vm)
+	if gr != nil {
+		gr.SetDNSLookupTimeout(p.dnsTimeout)
+		gr.dnsCache = p.dnsCache
+		gr.allowLookup = p.allowDNSLookup
+		gr.SetResolver(p.resolver)
+		gr.SetClock(p.now)
+		gr.SetInterfaceAddrs(p.interfaceAddrs)
+		gr.SetCompatMode(p.compat)
+		gr.extensions = p.extensions
+	}
+	if runtimeErr := vm.DefinePACFunctions(); runtimeErr != nil {
+		p.logf(ctx, LogError, "define PAC functions failed", "err", runtimeErr)
+		return nil, fmt.Errorf("%w: %v", ErrExecutePACScript, runtimeErr)
+	}
+	if p.sandbox {
+		if gr == nil {
+			return nil, fmt.Errorf("%w: Sandbox needs a runtime built on GojaRuntime", ErrExecutePACScript)
+		}
+		if err := gr.Sandbox(); err != nil {
+			p.logf(ctx, LogError, "sandbox PAC runtime failed", "err", err)
+			return nil, fmt.Errorf("%w: %v", ErrExecutePACScript, err)
+		}
+	}
+
+	// Execute the PAC script in the JavaScript runtime
+	vmSetContext(vm, ctx)
+	err := runWithTimeout(ctx, vm, p.scriptTimeout, func() error {
+		_, runErr := vm.RunString(string(source))
+		return runErr
+	})
+	vmSetContext(vm, nil)
+	if err != nil {
+		p.logf(ctx, LogError, "execute PAC script failed", "url", p.pacURL, "err", err)
+		if errors.Is(err, ErrPACScriptTimeout) {
+			return nil, fmt.Errorf("%w: %v", ErrExecutePACScript, err)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return nil, fmt.Errorf("%w: %w", ErrExecutePACScript, err)
+		}
+		return nil, newLoadError(string(source), err)
+	}
+	return vm, nil
+}
+
+// compileNative returns the native matcher of a compiled script, nil if it
+// is disabled or the script is not simple enough. NewRuntime disables it,
+// since a custom runtime may redefine the helpers, and so do an entry
+// point other than FindProxyForURL and passing the client IP.
+func (p *PACProxy) compileNative(ctx context.Context, entry string, source []byte) *nativeMatcher {
+	if p.disableNative || p.newRuntime != nil || entry != defaultEntryPoint || p.passesClientIP() {
+		return nil
+	}
+	m := compileNative(string(source))
+	if m != nil {
+		p.logf(ctx, LogDebug, "PAC script compiled to native matcher", "url", p.pacURL)
+	}
+	return m
+}
+
+// compileIsolated starts an evaluator process running source.
+func (p *PACProxy) compileIsolated(ctx context.Context, source []byte) (*pacScript, error) {
+	vm := &isolatedVM{
+		launch:      p.launchEvaluator,
+		source:      string(source),
+		sandbox:     p.sandbox,
+		compat:      p.compat,
+		extensions:  p.extensions,
+		memoryLimit: p.memoryLimit,
+		entryPoints: p.entryPoints,
+		clientVar:   p.clientGlobal,
+		clientArg:   p.clientArg,
+		timeout:     p.scriptTimeout,
+		lookup:      p.helperLookup,
+	}
+	if err := vm.start(ctx); err != nil {
+		p.logf(ctx, LogError, "execute PAC script failed", "url", p.pacURL, "err", err)
+		if errors.Is(err, ErrExecutePACScript) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrExecutePACScript, err)
+	}
+	return &pacScript{
+		source:   string(source),
+		hash:     sha256.Sum256(source),
+		entry:    vm.entry,
+		isolated: vm,
+	}, nil
+}
+
+// validate reports an error if the script defines none of the entry points
+// names.
+func (s *pacScript) validate(names []string) error {
+	if s.entry == "" {
+		return fmt.Errorf("%w: %s", ErrExecutePACScript, undefinedEntryPoint(names))
+	}
+	return nil
+}
+
+// storeLocker is implemented by stores that can serialize PAC downloads
+// across processes, like DiskCache.
+type storeLocker interface {
+	lock(key string) (unlock func(), ok bool)
+}
+
+// loadScript fetches and compiles the PAC script, going through the script
+// cache if one is configured.
+func (p *PACProxy) loadScript(ctx context.Context) (*pacScript, error) {
+	c := p.scriptCache
+	if c == nil {
+		source, err := p.fetchVerifiedScript(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return p.compileScript(ctx, source)
+	}
+
+	if script, ok := p.loadCachedScript(ctx); ok {
+		return script, nil
+	}
+	if l, ok := c.(storeLocker); ok {
+		if unlock, ok := l.lock(p.pacURL); ok {
+			defer unlock()
+			// Another process may have downloaded the script meanwhile.
+			if script, ok := p.loadCachedScript(ctx); ok {
+				return script, nil
+			}
+		}
+	}
+
+	source, err := p.fetchVerifiedScript(ctx)
+	if err != nil {
+		return nil, err
+	}
+	script, err := p.compileScript(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	p.storeCachedScript(source)
+	return script, nil
+}
+
+func (p *PACProxy) loadCachedScript(ctx context.Context) (*pacScript, bool) {
+	source, ok := p.scriptCache.Get(p.pacURL)
+	p.scriptStats.record(ok)
+	p.observeCache("script", ok)
+	if !ok {
+		return nil, false
+	}
+	if err := p.verifyScript(ctx, source); err != nil {
+		return nil, false
+	}
+	script, err := p.compileScript(ctx, source)
+	if err != nil {
+		return nil, false
+	}
+	p.logf(ctx, LogDebug, "PAC script loaded from script cache", "url", p.pacURL)
+	return script, true
+}
+
+func (p *PACProxy) storeCachedScript(source []byte) {
+	if p.scriptCache != nil {
+		p.scriptCache.Set(p.pacURL, source, p.scriptCacheTTL)
+		p.observeCaches()
+	}
+}
@@ -0,0 +1,116 @@
+package pac
+
+import (
+	"math/rand/v2"
+	"net/url"
+	"sync/atomic"
+)
+
+// Selector orders the proxy candidates of a PAC result.
+// The first returned candidate is used by ProxyFunc, the others are fallbacks.
+// Implementations must be safe for concurrent use.
+type Selector interface {
+	Select(target *url.URL, candidates []Proxy) []Proxy
+}
+
+// SelectorFunc adapts a function to the Selector interface.
+type SelectorFunc func(target *url.URL, candidates []Proxy) []Proxy
+
+// Select calls the underlying function.
+func (f SelectorFunc) Select(target *url.URL, candidates []Proxy) []Proxy {
+	return f(target, candidates)
+}
+
+// FirstSelector keeps the order returned by the PAC script.
+func FirstSelector() Selector {
+	return SelectorFunc(func(_ *url.URL, candidates []Proxy) []Proxy {
+		return candidates
+	})
+}
+
+// RoundRobinSelector rotates the proxies of each result on every call.
+// DIRECT entries keep their position.
+func RoundRobinSelector() Selector {
+	var next atomic.Uint64
+	return SelectorFunc(func(_ *url.URL, candidates []Proxy) []Proxy {
+		return reorderProxies(candidates, func(proxies []Proxy) {
+			n := int((next.Add(1) - 1) % uint64(len(proxies)))
+			rotated := append(append([]Proxy{}, proxies[n:]...), proxies[:n]...)
+			copy(proxies, rotated)
+		})
+	})
+}
+
+// RandomSelector shuffles the proxies of each result.
+// DIRECT entries keep their position.
+func RandomSelector() Selector {
+	return SelectorFunc(func(_ *url.URL, candidates []Proxy) []Proxy {
+		return reorderProxies(candidates, func(proxies []Proxy) {
+			rand.Shuffle(len(proxies), func(i, j int) {
+				proxies[i], proxies[j] = proxies[j], proxies[i]
+			})
+		})
+	})
+}
+
+// WeightedSelector orders the proxies of each result randomly, preferring
+// proxies with a higher weight. Weights are keyed by the proxy's host:port;
+// proxies without an entry have weight 1, proxies with a weight <= 0 go last.
+// DIRECT entries keep their position.
+func WeightedSelector(weights map[string]int) Selector {
+	return SelectorFunc(func(_ *url.URL, candidates []Proxy) []Proxy {
+		return reorderProxies(candidates, func(proxies []Proxy) {
+			weightedShuffle(proxies, func(p Proxy) int {
+				if w, ok := weights[p.Host]; ok {
+					return w
+				}
+				return 1
+			})
+		})
+	})
+}
+
+func weightedShuffle(proxies []Proxy, weight func(Proxy) int) {
+	for i := range proxies {
+		total := 0
+		for _, p := range proxies[i:] {
+			total += max(weight(p), 0)
+		}
+		if total == 0 {
+			return
+		}
+		pick := rand.IntN(total)
+		for j := i; j < len(proxies); j++ {
+			pick -= max(weight(proxies[j]), 0)
+			if pick < 0 {
+				proxies[i], proxies[j] = proxies[j], proxies[i]
+				break
+			}
+		}
+	}
+}
+
+// reorderProxies copies candidates and lets reorder permute the non-DIRECT
+// entries in place, leaving DIRECT entries where the PAC script put them.
+func reorderProxies(candidates []Proxy, reorder func(proxies []Proxy)) []Proxy {
+	var proxies []Proxy
+	for _, c := range candidates {
+		if c.Type != ProxyDirect {
+			proxies = append(proxies, c)
+		}
+	}
+	if len(proxies) < 2 {
+		return candidates
+	}
+	reorder(proxies)
+
+	out := make([]Proxy, len(candidates))
+	for i, c := range candidates {
+		if c.Type == ProxyDirect {
+			out[i] = c
+			continue
+		}
+		out[i], proxies = proxies[0], proxies[1:]
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package pac_test
+
+import (
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestRoundRobinSelector tests that proxies are rotated while DIRECT keeps its position.
+func TestRoundRobinSelector(t *testing.T) {
+	candidates := pac.ProxyString("PROXY a:1; PROXY b:2; PROXY c:3; DIRECT").Proxies()
+	selector := pac.RoundRobinSelector()
+
+	expected := []string{"a:1", "b:2", "c:3", "a:1"}
+	for i, host := range expected {
+		selected := selector.Select(nil, candidates)
+		if selected[0].Host != host {
+			t.Fatalf("Call %d: expected first proxy %s, got %s", i, host, selected[0].Host)
+		}
+		if selected[3].Type != pac.ProxyDirect {
+			t.Fatalf("Call %d: expected DIRECT to stay last, got %v", i, selected[3])
+		}
+	}
+
+	if candidates[0].Host != "a:1" {
+		t.Fatalf("Expected candidates to be left unchanged, got %v", candidates)
+	}
+}
+
+// TestWeightedSelector tests that proxies without weight are never preferred over weighted ones.
+func TestWeightedSelector(t *testing.T) {
+	candidates := pac.ProxyString("PROXY a:1; PROXY b:2").Proxies()
+	selector := pac.WeightedSelector(map[string]int{"a:1": 0, "b:2": 5})
+
+	for i := 0; i < 20; i++ {
+		selected := selector.Select(nil, candidates)
+		if selected[0].Host != "b:2" || selected[1].Host != "a:1" {
+			t.Fatalf("Expected b:2 before a:1, got %v", selected)
+		}
+	}
+}
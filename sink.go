@@ -0,0 +1,132 @@
+package pac
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// MetricsSink receives measurements of a PACProxy, so any metrics backend
+// can be attached without this package depending on one. labels are
+// key-value pairs, e.g. "outcome", "ok". Observe is called synchronously
+// and must be safe for concurrent use.
+type MetricsSink interface {
+	Observe(name string, value float64, labels ...string)
+}
+
+// MetricsSinkFunc adapts a function to the MetricsSink interface.
+type MetricsSinkFunc func(name string, value float64, labels ...string)
+
+// Observe calls the underlying function.
+func (f MetricsSinkFunc) Observe(name string, value float64, labels ...string) {
+	f(name, value, labels...)
+}
+
+// Names of the measurements passed to MetricsSink. Counters are observed
+// with their increment, 1 for single events, durations in seconds and
+// gauges with their current value.
+const (
+	// MetricEvaluations counts runs of FindProxyForURL, labeled with
+	// "outcome" ("ok", "error" or "timeout").
+	MetricEvaluations = "pac_evaluations_total"
+	// MetricEvaluationSeconds is the duration of FindProxyForURL runs,
+	// labeled like MetricEvaluations.
+	MetricEvaluationSeconds = "pac_evaluation_duration_seconds"
+	// MetricFetchSeconds is the duration of PAC downloads, labeled with
+	// "outcome" ("ok" or "error").
+	MetricFetchSeconds = "pac_fetch_duration_seconds"
+	// MetricCacheLookups counts lookups in the decision and script cache,
+	// labeled with "cache" ("decision" or "script") and "outcome" ("hit"
+	// or "miss").
+	MetricCacheLookups = "pac_cache_lookups_total"
+	// MetricCacheEvictions counts entries evicted from a cache, labeled
+	// with "cache" ("dns", "decision" or "script").
+	MetricCacheEvictions = "pac_cache_evictions_total"
+	// MetricCacheEntries is a gauge of the number of entries of a cache,
+	// labeled like MetricCacheEvictions.
+	MetricCacheEntries = "pac_cache_entries"
+	// MetricSelections counts how often a proxy endpoint was chosen,
+	// labeled with "proxy".
+	MetricSelections = "pac_proxy_selections_total"
+	// MetricDials counts connection attempts through a proxy endpoint,
+	// labeled with "proxy" and "outcome" ("ok" or "error").
+	MetricDials = "pac_proxy_dials_total"
+	// MetricDialSeconds is the latency of successful new connections,
+	// labeled with "proxy".
+	MetricDialSeconds = "pac_proxy_dial_duration_seconds"
+)
+
+func observe(sink MetricsSink, name string, value float64, labels ...string) {
+	if sink != nil {
+		sink.Observe(name, value, labels...)
+	}
+}
+
+// outcome returns the "outcome" label of an operation that returned err.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrPACScriptTimeout):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func (p *PACProxy) observeEval(d time.Duration, err error) {
+	observe(p.sink, MetricEvaluations, 1, "outcome", outcome(err))
+	observe(p.sink, MetricEvaluationSeconds, d.Seconds(), "outcome", outcome(err))
+	p.observeCaches()
+}
+
+func (p *PACProxy) observeCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	observe(p.sink, MetricCacheLookups, 1, "cache", cache, "outcome", result)
+}
+
+// cacheReport holds the cache statistics last reported to the MetricsSink.
+type cacheReport struct {
+	mu   sync.Mutex
+	last Stats
+}
+
+// observeCaches reports what the caches count themselves, as the increments
+// since the last report: the lookups in the DNS cache, which the PAC helpers
+// make, and the evictions and sizes of all caches, for stores implementing
+// StatsStore. It is called after evaluations and cache writes. A DNSCache
+// shared by several PACProxy instances is reported by each of them.
+func (p *PACProxy) observeCaches() {
+	if p.sink == nil {
+		return
+	}
+	p.reported.mu.Lock()
+	defer p.reported.mu.Unlock()
+	stats, last := p.Stats(), p.reported.last
+	p.reported.last = stats
+
+	if n := stats.DNS.Hits - last.DNS.Hits; n > 0 {
+		p.sink.Observe(MetricCacheLookups, float64(n), "cache", "dns", "outcome", "hit")
+	}
+	if n := stats.DNS.Misses - last.DNS.Misses; n > 0 {
+		p.sink.Observe(MetricCacheLookups, float64(n), "cache", "dns", "outcome", "miss")
+	}
+	for _, c := range []struct {
+		name       string
+		stats, was CacheStats
+	}{
+		{"dns", stats.DNS, last.DNS},
+		{"decision", stats.Decisions, last.Decisions},
+		{"script", stats.Script, last.Script},
+	} {
+		if n := c.stats.Evictions - c.was.Evictions; n > 0 {
+			p.sink.Observe(MetricCacheEvictions, float64(n), "cache", c.name)
+		}
+		if c.stats.Size != c.was.Size {
+			p.sink.Observe(MetricCacheEntries, float64(c.stats.Size), "cache", c.name)
+		}
+	}
+}
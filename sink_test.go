@@ -0,0 +1,72 @@
+package pac_test
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestMetricsSink tests that fetches, evaluations, cache lookups, evictions and sizes and proxy selections are reported to the MetricsSink.
+func TestMetricsSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		observed []string
+	)
+	sink := pac.MetricsSinkFunc(func(name string, value float64, labels ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		observed = append(observed, name+"{"+strings.Join(labels, ",")+"} "+strconv.FormatFloat(value, 'f', -1, 64))
+	})
+	proxy := newScriptPACProxy(t, `function FindProxyForURL(url, host) { dnsResolve(host); return "PROXY proxy.example.com:3128"; }`, &pac.PACProxyConfig{
+		DecisionCacheTTL: time.Minute,
+		DNSCache:         pac.NewDNSCache(time.Minute, 1),
+		Resolver:         &requestIDResolver{},
+		Metrics:          sink,
+	})
+	for _, rawURL := range []string{"http://a.example.com", "http://a.example.com", "http://b.example.com"} {
+		targetURL, _ := url.Parse(rawURL)
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://a.example.com", nil)
+	if _, err := proxy.ProxyFunc()(req); err != nil {
+		t.Fatalf("Error selecting proxy: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, o := range observed {
+		if strings.HasPrefix(o, pac.MetricFetchSeconds) || strings.HasPrefix(o, pac.MetricEvaluationSeconds) {
+			observed[i] = o[:strings.LastIndexByte(o, ' ')]
+		}
+	}
+	want := []string{
+		pac.MetricFetchSeconds + "{outcome,ok}",
+		pac.MetricCacheLookups + "{cache,decision,outcome,miss} 1",
+		pac.MetricEvaluations + "{outcome,ok} 1",
+		pac.MetricEvaluationSeconds + "{outcome,ok}",
+		pac.MetricCacheLookups + "{cache,dns,outcome,miss} 1",
+		pac.MetricCacheEntries + "{cache,dns} 1",
+		pac.MetricCacheEntries + "{cache,decision} 1",
+		pac.MetricCacheLookups + "{cache,decision,outcome,hit} 1",
+		pac.MetricCacheLookups + "{cache,decision,outcome,miss} 1",
+		pac.MetricEvaluations + "{outcome,ok} 1",
+		pac.MetricEvaluationSeconds + "{outcome,ok}",
+		pac.MetricCacheLookups + "{cache,dns,outcome,miss} 1",
+		pac.MetricCacheEvictions + "{cache,dns} 1",
+		pac.MetricCacheEntries + "{cache,decision} 2",
+		pac.MetricCacheLookups + "{cache,decision,outcome,hit} 1",
+		pac.MetricSelections + "{proxy,PROXY proxy.example.com:3128} 1",
+	}
+	if !reflect.DeepEqual(observed, want) {
+		t.Fatalf("Expected observations\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(observed, "\n"))
+	}
+}
@@ -0,0 +1,95 @@
+package pac
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// SOCKSAuth returns the credentials for a SOCKS proxy, or nil for none.
+// For SOCKS4 only the user name is sent.
+type SOCKSAuth func(p Proxy) *proxy.Auth
+
+// dialSOCKS5 connects to addr through a SOCKS5 proxy.
+func dialSOCKS5(ctx context.Context, forward ContextDialer, p Proxy, auth *proxy.Auth, network, addr string) (net.Conn, error) {
+	socks, err := proxy.SOCKS5("tcp", p.Host, auth, forwardDialer{forward})
+	if err != nil {
+		return nil, err
+	}
+	return socks.(proxy.ContextDialer).DialContext(ctx, network, addr)
+}
+
+// dialSOCKS4 connects to addr through a SOCKS4 proxy, using SOCKS4a to let
+// the proxy resolve host names.
+func dialSOCKS4(ctx context.Context, forward ContextDialer, p Proxy, auth *proxy.Auth, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+
+	req := []byte{4, 1, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(port))
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		ip = net.IPv4(0, 0, 0, 1).To4()
+	}
+	req = append(req, ip...)
+	if auth != nil {
+		req = append(req, auth.User...)
+	}
+	req = append(req, 0)
+	if net.ParseIP(host).To4() == nil {
+		req = append(req, host...)
+		req = append(req, 0)
+	}
+
+	conn, err := forward.DialContext(ctx, "tcp", p.Host)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	err = socks4Handshake(conn, req)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func socks4Handshake(conn net.Conn, req []byte) error {
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var resp [8]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[0] != 0 {
+		return errors.New("invalid SOCKS4 response")
+	}
+	if resp[1] != 0x5a {
+		return fmt.Errorf("SOCKS4 request rejected (code %#x)", resp[1])
+	}
+	return nil
+}
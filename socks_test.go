@@ -0,0 +1,205 @@
+package pac_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"golang.org/x/net/proxy"
+)
+
+// newSOCKSServer starts a SOCKS4a/SOCKS5 server. If user is set, SOCKS5
+// clients must authenticate with user and password.
+func newSOCKSServer(t *testing.T, user, password string) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS(conn, user, password)
+		}
+	}()
+	return ln
+}
+
+func serveSOCKS(conn net.Conn, user, password string) {
+	defer conn.Close()
+	var version [1]byte
+	if _, err := io.ReadFull(conn, version[:]); err != nil {
+		return
+	}
+	var addr string
+	var ok bool
+	switch version[0] {
+	case 4:
+		addr, ok = readSOCKS4Request(conn)
+	case 5:
+		addr, ok = readSOCKS5Request(conn, user, password)
+	}
+	if !ok {
+		return
+	}
+	upstream, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	if version[0] == 4 {
+		_, _ = conn.Write([]byte{0, 0x5a, 0, 0, 0, 0, 0, 0})
+	} else {
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	}
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func readSOCKS4Request(conn net.Conn) (string, bool) {
+	var hdr [7]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[0] != 1 {
+		return "", false
+	}
+	port := binary.BigEndian.Uint16(hdr[1:3])
+	host := net.IP(hdr[3:7]).String()
+	if _, ok := readCString(conn); !ok {
+		return "", false
+	}
+	if hdr[3] == 0 && hdr[4] == 0 && hdr[5] == 0 {
+		name, ok := readCString(conn)
+		if !ok {
+			return "", false
+		}
+		host = name
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), true
+}
+
+func readCString(conn net.Conn) (string, bool) {
+	var b [1]byte
+	var s []byte
+	for {
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return "", false
+		}
+		if b[0] == 0 {
+			return string(s), true
+		}
+		s = append(s, b[0])
+	}
+}
+
+func readSOCKS5Request(conn net.Conn, user, password string) (string, bool) {
+	var n [1]byte
+	if _, err := io.ReadFull(conn, n[:]); err != nil {
+		return "", false
+	}
+	methods := make([]byte, n[0])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", false
+	}
+	if user == "" {
+		_, _ = conn.Write([]byte{5, 0})
+	} else {
+		_, _ = conn.Write([]byte{5, 2})
+		var ver, ulen [1]byte
+		_, _ = io.ReadFull(conn, ver[:])
+		_, _ = io.ReadFull(conn, ulen[:])
+		u := make([]byte, ulen[0])
+		_, _ = io.ReadFull(conn, u)
+		var plen [1]byte
+		_, _ = io.ReadFull(conn, plen[:])
+		pw := make([]byte, plen[0])
+		_, _ = io.ReadFull(conn, pw)
+		if string(u) != user || string(pw) != password {
+			_, _ = conn.Write([]byte{1, 1})
+			return "", false
+		}
+		_, _ = conn.Write([]byte{1, 0})
+	}
+
+	var hdr [4]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[1] != 1 {
+		return "", false
+	}
+	var host string
+	switch hdr[3] {
+	case 1:
+		ip := make([]byte, 4)
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		var l [1]byte
+		_, _ = io.ReadFull(conn, l[:])
+		name := make([]byte, l[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return "", false
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", false
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), true
+}
+
+// TestDialerSOCKS5Auth tests that the dialer authenticates against SOCKS5 proxies.
+func TestDialerSOCKS5Auth(t *testing.T) {
+	socksServer := newSOCKSServer(t, "alice", "secret")
+	defer socksServer.Close()
+	echoServer := newEchoServer(t)
+	defer echoServer.Close()
+
+	dialer := pac.NewDialer(newTestPACProxy(t, "SOCKS5 "+socksServer.Addr().String(), nil))
+	if _, err := dialer.DialContext(context.Background(), "tcp", echoServer.Addr().String()); err == nil {
+		t.Fatalf("Expected dial without credentials to fail")
+	}
+
+	dialer = pac.NewDialer(newTestPACProxy(t, "SOCKS5 "+socksServer.Addr().String(), nil))
+	dialer.SOCKSAuth = func(pac.Proxy) *proxy.Auth {
+		return &proxy.Auth{User: "alice", Password: "secret"}
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", echoServer.Addr().String())
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+	echo(t, conn)
+}
+
+// TestTransportSOCKS4 tests that the transport sends requests through SOCKS4 candidates.
+func TestTransportSOCKS4(t *testing.T) {
+	socksServer := newSOCKSServer(t, "", "")
+	defer socksServer.Close()
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer targetServer.Close()
+
+	client := pac.NewClient(newTestPACProxy(t, "SOCKS4 "+socksServer.Addr().String(), nil))
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(targetServer.URL)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Fatalf("Expected body ok, got %q", body)
+	}
+}
@@ -0,0 +1,191 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrFetchDisallowed is returned when a connection for the PAC URL or a
+// redirect target goes to an address in PACProxyConfig.FetchDenyNets.
+var ErrFetchDisallowed = errors.New("PAC URL resolves to a disallowed address")
+
+// DefaultFetchDenyNets returns the ranges a PAC script should never be
+// fetched from: loopback, link-local (including cloud metadata endpoints
+// such as 169.254.169.254), unspecified and multicast addresses. Private
+// ranges are not included, as WPAD servers usually live in them.
+func DefaultFetchDenyNets() []netip.Prefix {
+	return []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("169.254.0.0/16"),
+		netip.MustParsePrefix("224.0.0.0/4"),
+		netip.MustParsePrefix("::/128"),
+		netip.MustParsePrefix("::1/128"),
+		netip.MustParsePrefix("fe80::/10"),
+		netip.MustParsePrefix("ff00::/8"),
+	}
+}
+
+// fetchProxiedKey marks the context of a guarded request that goes through
+// a proxy. The transport then only connects to the proxy, which the
+// application configured itself and which is not checked.
+type fetchProxiedKey struct{}
+
+// denyTransport checks each connection a guarded client opens to a PAC
+// server against nets as it is dialed, against the address actually
+// connected to. Checking a separate lookup instead would let a name resolve
+// to an allowed address for the check and to a denied one for the dial.
+type denyTransport struct {
+	*http.Transport
+}
+
+// newDenyTransport returns a copy of rt, or of http.DefaultTransport with
+// its own dialer if rt is nil, that refuses connections to nets. A
+// RoundTripper that is not an *http.Transport cannot be guarded and fails
+// every request.
+func newDenyTransport(rt http.RoundTripper, nets []netip.Prefix) http.RoundTripper {
+	ownDialer := rt == nil
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	base, ok := rt.(*http.Transport)
+	if !ok {
+		return failingTransport{fmt.Errorf("%w: cannot check the connections of a %T, FetchDenyNets needs an *http.Transport", ErrFetchDisallowed, rt)}
+	}
+	tr := base.Clone()
+	if ownDialer {
+		tr.DialContext = nil
+	}
+	switch {
+	case tr.DialContext != nil:
+		tr.DialContext = checkedDial(tr.DialContext, nets)
+	case tr.Dial != nil:
+		dial := tr.Dial
+		tr.Dial = nil
+		tr.DialContext = checkedDial(func(_ context.Context, network, addr string) (net.Conn, error) {
+			return dial(network, addr)
+		}, nets)
+	default:
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if ctx.Value(fetchProxiedKey{}) != nil {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			d := *dialer
+			d.Control = func(_, address string, _ syscall.RawConn) error {
+				return checkDialAddr(addr, address, nets)
+			}
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	switch {
+	case tr.DialTLSContext != nil:
+		tr.DialTLSContext = checkedDial(tr.DialTLSContext, nets)
+	case tr.DialTLS != nil:
+		dial := tr.DialTLS
+		tr.DialTLS = nil
+		tr.DialTLSContext = checkedDial(func(_ context.Context, network, addr string) (net.Conn, error) {
+			return dial(network, addr)
+		}, nets)
+	}
+	return denyTransport{tr}
+}
+
+// RoundTrip marks requests that tr sends through a proxy before passing
+// them on.
+func (t denyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Proxy != nil {
+		proxyURL, err := t.Proxy(req)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			req = req.WithContext(context.WithValue(req.Context(), fetchProxiedKey{}, true))
+		}
+	}
+	return t.Transport.RoundTrip(req)
+}
+
+// checkedDial wraps a custom dial function of the transport, whose socket
+// cannot be checked before it connects, and closes connections whose remote
+// address is in nets.
+func checkedDial(dial func(ctx context.Context, network, addr string) (net.Conn, error), nets []netip.Prefix) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil || ctx.Value(fetchProxiedKey{}) != nil {
+			return conn, err
+		}
+		if err := checkDialAddr(addr, conn.RemoteAddr().String(), nets); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// checkDialAddr reports ErrFetchDisallowed if remote, the address a dial
+// of addr connects to, is in nets or is not an IP address at all.
+func checkDialAddr(addr, remote string, nets []netip.Prefix) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ap, err := netip.ParseAddrPort(remote)
+	if err != nil {
+		return fmt.Errorf("%w: %s connects to %s, which is not an IP address", ErrFetchDisallowed, host, remote)
+	}
+	ip := ap.Addr().Unmap().WithZone("")
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrFetchDisallowed, host, ip)
+		}
+	}
+	return nil
+}
+
+// failingTransport fails every request with err.
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
+
+// guardClient returns a copy of client that refuses connections to nets and
+// checks the certificate of each redirect response against pins and redirect
+// targets against httpsOnly before following them.
+func guardClient(client *http.Client, nets []netip.Prefix, pins []string, httpsOnly bool) *http.Client {
+	guarded := *client
+	if len(nets) > 0 {
+		guarded.Transport = newDenyTransport(client.Transport, nets)
+	}
+	next := client.CheckRedirect
+	guarded.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.Response != nil {
+			if err := checkTLSPins(req.Response.TLS, pins); err != nil {
+				return err
+			}
+		}
+		if err := checkSecureURL(req.URL, httpsOnly); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &guarded
+}
@@ -0,0 +1,121 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestFetchDenyNets tests that PAC URLs and redirect targets in FetchDenyNets are rejected.
+func TestFetchDenyNets(t *testing.T) {
+	pacServer := newPACServer(t, "DIRECT")
+	defer pacServer.Close()
+	pacURL, _ := url.Parse(pacServer.URL)
+
+	_, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{FetchDenyNets: pac.DefaultFetchDenyNets()})
+	if !errors.Is(err, pac.ErrFetchDisallowed) || !errors.Is(err, pac.ErrFetchPACScript) {
+		t.Fatalf("Expected ErrFetchDisallowed for a loopback PAC URL, got %v", err)
+	}
+
+	port := pacURL.Port()
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://127.0.0.2:"+port+"/proxy.pac", http.StatusFound)
+	}))
+	defer redirector.Close()
+	redirectURL, _ := url.Parse(redirector.URL)
+	deny := []netip.Prefix{netip.MustParsePrefix("127.0.0.2/32")}
+	if _, err := pac.NewPACProxy(redirectURL, &pac.PACProxyConfig{FetchDenyNets: deny}); !errors.Is(err, pac.ErrFetchDisallowed) {
+		t.Fatalf("Expected ErrFetchDisallowed for a denied redirect target, got %v", err)
+	}
+
+	proxy, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{FetchDenyNets: deny})
+	if err != nil {
+		t.Fatalf("Expected an allowed PAC URL to load, got %v", err)
+	}
+	proxy.Close()
+}
+
+// rebindingResolver answers the first lookup of a name with an allowed
+// address and every later one with loopback, like a DNS rebinding attack.
+type rebindingResolver struct {
+	mu      sync.Mutex
+	lookups int
+}
+
+func (r *rebindingResolver) lookup(host string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.lookups == 1 {
+		return "192.0.2.1"
+	}
+	return "127.0.0.1"
+}
+
+// TestFetchDenyNetsRebinding tests that FetchDenyNets checks the address the
+// fetch connects to rather than an earlier lookup of the same name.
+func TestFetchDenyNetsRebinding(t *testing.T) {
+	pacServer := newPACServer(t, "DIRECT")
+	defer pacServer.Close()
+	serverURL, _ := url.Parse(pacServer.URL)
+	pacURL, _ := url.Parse("http://pac.example:" + serverURL.Port() + "/proxy.pac")
+
+	resolver := &rebindingResolver{}
+	// This lookup stands in for a check ahead of the request, which saw an
+	// allowed address.
+	if addr := resolver.lookup("pac.example"); addr != "192.0.2.1" {
+		t.Fatalf("Expected the check to see 192.0.2.1, got %s", addr)
+	}
+	transport := &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, net.JoinHostPort(resolver.lookup(host), port))
+	}}
+	_, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{
+		Client:        &http.Client{Transport: transport},
+		FetchDenyNets: pac.DefaultFetchDenyNets(),
+	})
+	if !errors.Is(err, pac.ErrFetchDisallowed) || !errors.Is(err, pac.ErrFetchPACScript) {
+		t.Fatalf("Expected ErrFetchDisallowed for a name rebound to loopback, got %v", err)
+	}
+
+	// Without a custom dialer the name is resolved by the dial itself.
+	localURL, _ := url.Parse("http://localhost:" + serverURL.Port() + "/proxy.pac")
+	if _, err := pac.NewPACProxy(localURL, &pac.PACProxyConfig{FetchDenyNets: pac.DefaultFetchDenyNets()}); !errors.Is(err, pac.ErrFetchDisallowed) {
+		t.Fatalf("Expected ErrFetchDisallowed for localhost, got %v", err)
+	}
+}
+
+// TestFetchDenyNetsProxy tests that a proxy the client sends the fetch
+// through is not checked against FetchDenyNets.
+func TestFetchDenyNetsProxy(t *testing.T) {
+	forward := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "pac.example" {
+			http.Error(w, "unexpected host", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		w.Write([]byte(`function FindProxyForURL(url, host) { return "DIRECT"; }`))
+	}))
+	defer forward.Close()
+	forwardURL, _ := url.Parse(forward.URL)
+
+	pacURL, _ := url.Parse("http://pac.example/proxy.pac")
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(forwardURL)}}
+	proxy, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{Client: client, FetchDenyNets: pac.DefaultFetchDenyNets()})
+	if err != nil {
+		t.Fatalf("Expected the fetch through a loopback proxy to succeed, got %v", err)
+	}
+	proxy.Close()
+}
@@ -0,0 +1,96 @@
+package pac
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// CacheStats holds the counters and the size of one cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Size is the current number of entries.
+	Size int
+}
+
+// EvalStats holds the counters of PAC script evaluations. Lookups answered
+// by an override, the bypass list or the decision cache are not counted.
+type EvalStats struct {
+	Evaluations uint64
+	// Errors counts failed evaluations, timeouts included.
+	Errors   uint64
+	Timeouts uint64
+}
+
+// Stats holds the statistics of the caches and evaluations of a PACProxy.
+type Stats struct {
+	DNS         CacheStats
+	Decisions   CacheStats
+	Script      CacheStats
+	Evaluations EvalStats
+}
+
+// StatsStore is implemented by stores that report their evictions and size,
+// like MemoryStore. PACProxy.Stats includes them for such stores.
+type StatsStore interface {
+	Store
+	Stats() CacheStats
+}
+
+// cacheCounters counts the hits and misses of a Store as seen by PACProxy.
+type cacheCounters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func (c *cacheCounters) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+func (c *cacheCounters) stats(store Store) CacheStats {
+	stats := CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if s, ok := store.(StatsStore); ok {
+		storeStats := s.Stats()
+		stats.Evictions, stats.Size = storeStats.Evictions, storeStats.Size
+	}
+	return stats
+}
+
+// evalCounters counts PAC script evaluations.
+type evalCounters struct {
+	evaluations atomic.Uint64
+	errors      atomic.Uint64
+	timeouts    atomic.Uint64
+}
+
+func (c *evalCounters) record(err error) {
+	c.evaluations.Add(1)
+	if err != nil {
+		c.errors.Add(1)
+		if errors.Is(err, ErrPACScriptTimeout) {
+			c.timeouts.Add(1)
+		}
+	}
+}
+
+func (c *evalCounters) stats() EvalStats {
+	return EvalStats{Evaluations: c.evaluations.Load(), Errors: c.errors.Load(), Timeouts: c.timeouts.Load()}
+}
+
+// Stats returns the hit, miss and eviction counters and the sizes of the DNS
+// cache, the decision cache and the script cache. Evictions and sizes of the
+// decision and script cache are only known for stores implementing
+// StatsStore. Evaluations counts the runs of FindProxyForURL.
+func (p *PACProxy) Stats() Stats {
+	return Stats{
+		DNS:         p.dnsCache.Stats(),
+		Decisions:   p.decisionStats.stats(p.decisions),
+		Script:      p.scriptStats.stats(p.scriptCache),
+		Evaluations: p.evalStats.stats(),
+	}
+}
@@ -0,0 +1,37 @@
+package pac_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestStats tests the hit, miss and size counters of the DNS and decision caches.
+func TestStats(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (dnsResolve("localhost")) { return "DIRECT"; }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{DNSCacheTTL: time.Minute, DecisionCacheTTL: time.Minute})
+	for _, target := range []string{"http://a.example.com", "http://b.example.com", "http://a.example.com"} {
+		targetURL, _ := url.Parse(target)
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", target, err)
+		}
+	}
+
+	stats := proxy.Stats()
+	if stats.DNS.Hits != 1 || stats.DNS.Misses != 1 || stats.DNS.Size != 1 {
+		t.Fatalf("Unexpected DNS cache stats: %+v", stats.DNS)
+	}
+	if stats.Decisions.Hits != 1 || stats.Decisions.Misses != 2 || stats.Decisions.Size != 2 {
+		t.Fatalf("Unexpected decision cache stats: %+v", stats.Decisions)
+	}
+	if stats.Evaluations.Evaluations != 2 || stats.Evaluations.Errors != 0 {
+		t.Fatalf("Unexpected evaluation stats: %+v", stats.Evaluations)
+	}
+}
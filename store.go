@@ -0,0 +1,126 @@
+package pac
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDecisionCacheSize = 10000
+
+// Store is a key-value cache with per-entry expiry. It backs the script
+// cache (PACProxyConfig.ScriptCache) and the decision cache
+// (PACProxyConfig.DecisionCache), so both can live in Redis, BoltDB or any
+// other shared cache. Implementations must be safe for concurrent use and
+// treat expired entries as missing.
+type Store interface {
+	Get(key string) (value []byte, ok bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is an in-memory Store holding up to a fixed number of entries.
+// When it is full, expired entries are dropped first, then arbitrary ones.
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	now        func() time.Time
+	entries    map[string]memoryEntry
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+}
+
+var _ StatsStore = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a MemoryStore for up to maxEntries entries.
+// maxEntries <= 0 uses 10000.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultDecisionCacheSize
+	}
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]memoryEntry),
+	}
+}
+
+// Get returns the value stored for key unless it expired.
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		s.misses++
+		return nil, false
+	}
+	if !s.now().Before(e.expires) {
+		delete(s.entries, key)
+		s.misses++
+		return nil, false
+	}
+	s.hits++
+	return e.value, true
+}
+
+// Set stores value for key until ttl elapses.
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+}
+
+// Delete removes key.
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+}
+
+// evict makes room for one entry. It must be called with s.mu held.
+func (s *MemoryStore) evict(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+			s.evictions++
+		}
+	}
+	for k := range s.entries {
+		if len(s.entries) < s.maxEntries {
+			return
+		}
+		delete(s.entries, k)
+		s.evictions++
+	}
+}
+
+// Stats returns the counters and the number of entries of the store.
+func (s *MemoryStore) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return CacheStats{Hits: s.hits, Misses: s.misses, Evictions: s.evictions, Size: len(s.entries)}
+}
+
+// persisted returns the unexpired entries whose key starts with prefix.
+func (s *MemoryStore) persisted(prefix string) []persistedDecision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var out []persistedDecision
+	for k, e := range s.entries {
+		if strings.HasPrefix(k, prefix) && now.Before(e.expires) {
+			out = append(out, persistedDecision{Key: k, Result: string(e.value), Expires: e.expires})
+		}
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package pac
+
+import "github.com/dop251/goja"
+
+// defineTimerShims defines setTimeout, setInterval, clearTimeout and
+// clearInterval for the browser modes of CompatMode. Some vendor scripts
+// call them at top level, e.g. to refresh state in a browser, and would not
+// load otherwise. There is no event loop between evaluations, so the
+// callbacks never run; the set functions return increasing ids for the
+// clear functions, which do nothing.
+func (r *GojaRuntime) defineTimerShims(set func(name string, value any)) {
+	start := func(goja.FunctionCall) goja.Value {
+		r.timers++
+		return r.ToValue(r.timers)
+	}
+	cancel := func(goja.FunctionCall) goja.Value {
+		return goja.Undefined()
+	}
+	set("setTimeout", start)
+	set("setInterval", start)
+	set("clearTimeout", cancel)
+	set("clearInterval", cancel)
+}
@@ -0,0 +1,40 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+func TestTimerShims(t *testing.T) {
+	server := newScriptServer(t, `var state = "initial";
+	setTimeout(function() { state = "timeout"; }, 0);
+	var id = setInterval(function() { state = "interval"; }, 1000);
+	clearInterval(id);
+	clearTimeout(setTimeout("state = 'string'", 0));
+	function FindProxyForURL(url, host) {
+		return "PROXY " + state + "-" + id + ":1";
+	}`)
+	defer server.Close()
+	pacURL, _ := url.Parse(server.URL)
+
+	for _, mode := range []pac.CompatMode{pac.CompatChromium, pac.CompatFirefox, pac.CompatWinHTTP} {
+		proxy, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{CompatMode: mode})
+		if err != nil {
+			t.Fatalf("%v: Error creating PAC proxy: %v", mode, err)
+		}
+		got, err := proxy.FindProxyStringForURL(&url.URL{Scheme: "http", Host: "example.com", Path: "/"})
+		proxy.Close()
+		if err != nil || got != "PROXY initial-2:1" {
+			t.Fatalf("%v: Expected PROXY initial-2:1, got %q, %v", mode, got, err)
+		}
+	}
+
+	// CompatDefault keeps the standard PAC environment.
+	if _, err := pac.NewPACProxy(pacURL, nil); !errors.Is(err, pac.ErrExecutePACScript) || !strings.Contains(err.Error(), "setTimeout") {
+		t.Fatalf("Expected a ReferenceError for setTimeout in CompatDefault, got %v", err)
+	}
+}
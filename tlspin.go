@@ -0,0 +1,35 @@
+package pac
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ErrTLSPin is returned when the PAC server's certificate chain matches
+// none of PACProxyConfig.TLSPins, or the PAC is not fetched over TLS.
+var ErrTLSPin = errors.New("PAC server certificate does not match the pinned keys")
+
+// checkTLSPins reports ErrTLSPin unless a certificate of the verified chain
+// in state matches one of pins, the base64 SHA-256 of either the
+// certificate's SubjectPublicKeyInfo or the whole DER certificate.
+func checkTLSPins(state *tls.ConnectionState, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	if state == nil {
+		return fmt.Errorf("%w: not a TLS connection", ErrTLSPin)
+	}
+	for _, cert := range state.PeerCertificates {
+		spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		der := sha256.Sum256(cert.Raw)
+		for _, pin := range pins {
+			if pin == base64.StdEncoding.EncodeToString(spki[:]) || pin == base64.StdEncoding.EncodeToString(der[:]) {
+				return nil
+			}
+		}
+	}
+	return ErrTLSPin
+}
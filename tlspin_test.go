@@ -0,0 +1,43 @@
+package pac_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestTLSPins tests that the PAC server certificate is checked against TLSPins.
+func TestTLSPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	}))
+	defer server.Close()
+	pacURL, _ := url.Parse(server.URL)
+	spki := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(spki[:])
+
+	proxy, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{Client: server.Client(), TLSPins: []string{pin}})
+	if err != nil {
+		t.Fatalf("Expected the pinned server to be accepted, got %v", err)
+	}
+	proxy.Close()
+
+	other := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	if _, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{Client: server.Client(), TLSPins: []string{other}}); !errors.Is(err, pac.ErrTLSPin) {
+		t.Fatalf("Expected ErrTLSPin for a mismatching pin, got %v", err)
+	}
+
+	plain := newPACServer(t, "DIRECT")
+	defer plain.Close()
+	plainURL, _ := url.Parse(plain.URL)
+	if _, err := pac.NewPACProxy(plainURL, &pac.PACProxyConfig{TLSPins: []string{pin}}); !errors.Is(err, pac.ErrTLSPin) {
+		t.Fatalf("Expected ErrTLSPin for a plain HTTP PAC URL, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package pac
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/phlipse/go-pac"
+
+// newTracer returns the tracer of tp, or of the global TracerProvider if tp
+// is nil.
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+func (p *PACProxy) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return p.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// resultType returns the type of the first of the parsed result proxies,
+// e.g. "DIRECT" or "PROXY", or "" if there is none.
+func resultType(proxies []Proxy) string {
+	if len(proxies) == 0 {
+		return ""
+	}
+	return proxies[0].Type.String()
+}
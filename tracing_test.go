@@ -0,0 +1,56 @@
+package pac_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracing tests that fetch, compile and evaluation are traced.
+func TestTracing(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (isResolvable("localhost")) { return "PROXY proxy.example.com:3128"; }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		DecisionCacheTTL: time.Minute,
+		TracerProvider:   sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	})
+	targetURL, _ := url.Parse("http://example.com/path")
+	for i := 0; i < 2; i++ {
+		if _, err := proxy.FindProxyStringForURL(targetURL); err != nil {
+			t.Fatalf("Error finding proxy for URL: %v", err)
+		}
+	}
+
+	var evals []map[attribute.Key]attribute.Value
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+		if span.Name() == "pac.evaluate" {
+			attrs := map[attribute.Key]attribute.Value{}
+			for _, kv := range span.Attributes() {
+				attrs[kv.Key] = kv.Value
+			}
+			evals = append(evals, attrs)
+		}
+	}
+	if !names["pac.fetch"] || !names["pac.compile"] || len(evals) != 2 {
+		t.Fatalf("Unexpected spans: %v, %d evaluations", names, len(evals))
+	}
+	if evals[0]["pac.host"].AsString() != "example.com" || evals[0]["pac.result_type"].AsString() != "PROXY" ||
+		evals[0]["pac.dns_lookups"].AsInt64() != 1 || evals[0]["pac.cache_hit"].AsBool() {
+		t.Fatalf("Unexpected attributes of the first evaluation: %v", evals[0])
+	}
+	if !evals[1]["pac.cache_hit"].AsBool() {
+		t.Fatalf("Expected the second evaluation to hit the decision cache: %v", evals[1])
+	}
+}
@@ -0,0 +1,246 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDialTimeout           = 10 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second
+	defaultIdleConnTimeout       = 90 * time.Second
+)
+
+// Transport is an http.RoundTripper that sends each request through the
+// candidates a PACProxy returns for its URL. If connecting through a candidate
+// fails before the request was sent, the next candidate is tried; an error is
+// only returned once every candidate failed.
+type Transport struct {
+	// PAC evaluates the PAC script for each request.
+	PAC *PACProxy
+	// Base is cloned for every candidate. Its Proxy field is replaced.
+	// nil uses a clone of http.DefaultTransport.
+	Base *http.Transport
+	// Dialer connects through SOCKS candidates, including SOCKS4 and
+	// authenticated proxies, and through https proxies if its HTTP2 is set.
+	// nil uses NewDialer(PAC).
+	Dialer *Dialer
+	// Fallback decides whether to send the request directly after all
+	// proxies failed.
+	Fallback FallbackPolicy
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewHTTPTransport returns an *http.Transport that uses p.ProxyFunc and
+// bounded dial, TLS handshake and response header timeouts.
+func NewHTTPTransport(p *PACProxy) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = p.ProxyFunc()
+	tr.DialContext = (&net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	tr.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	tr.ResponseHeaderTimeout = defaultResponseHeaderTimeout
+	tr.IdleConnTimeout = defaultIdleConnTimeout
+	return tr
+}
+
+// NewTransport returns a failover Transport whose candidate transports use
+// the timeouts of NewHTTPTransport.
+func NewTransport(p *PACProxy) *Transport {
+	return &Transport{PAC: p, Base: NewHTTPTransport(p)}
+}
+
+// NewClient returns an *http.Client that sends requests through NewTransport.
+func NewClient(p *PACProxy) *http.Client {
+	return &http.Client{Transport: NewTransport(p)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	candidates, err := t.PAC.FindProxiesForURLContext(req.Context(), req.URL)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	var errs []error
+	sent := 0
+	for _, candidate := range withFallback(candidates, t.Fallback) {
+		proxyURL, err := candidate.URLFor(t.PAC.evalURL(req.URL), t.PAC.proxySchemes)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+			continue
+		}
+
+		attempt, err := t.attemptRequest(req, sent)
+		if err != nil {
+			return nil, err
+		}
+		sent++
+		t.PAC.metrics.selected(candidate)
+		t.PAC.health.dialing(candidate)
+		resp, conn, err := t.transportFor(candidate, proxyURL).roundTrip(attempt)
+		if conn.connected {
+			t.PAC.metrics.dialed(candidate, conn.latency, nil)
+			t.PAC.latency.observe(candidate, conn.latency)
+		}
+		if err == nil {
+			t.PAC.affinity.succeeded(req.URL, candidate)
+			t.PAC.ReportProxySuccess(candidate)
+			return resp, nil
+		}
+		if conn.connected || req.Context().Err() != nil {
+			// The request may have reached the server; do not resend it.
+			return nil, err
+		}
+		t.PAC.metrics.dialed(candidate, 0, err)
+		t.PAC.emitError(req.Context(), "dial", fmt.Errorf("%s: %w", candidate, err))
+		t.PAC.affinity.failed(req.URL, candidate)
+		t.PAC.reportProxyFailure(req.Context(), candidate)
+		errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+	}
+	if sent == 0 {
+		// No inner transport took the request, so none closed its body.
+		closeBody(req)
+	}
+	return nil, fmt.Errorf("%w: %w", ErrAllProxiesFailed, errors.Join(errs...))
+}
+
+// attemptRequest returns the request used for the n-th attempt, rewinding the
+// body for retries.
+func (t *Transport) attemptRequest(req *http.Request, n int) (*http.Request, error) {
+	if n == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("%w: request body cannot be rewound for retry", ErrAllProxiesFailed)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	attempt := req.Clone(req.Context())
+	attempt.Body = body
+	return attempt, nil
+}
+
+type candidateTransport struct {
+	*http.Transport
+}
+
+// connInfo describes the connection used by a candidate round trip.
+type connInfo struct {
+	// connected reports whether a connection to the proxy or server was
+	// established, after which retrying is no longer safe.
+	connected bool
+	// latency is the time until a new connection was established; it is 0
+	// for reused connections.
+	latency time.Duration
+}
+
+// roundTrip sends req and reports the connection it used.
+func (ct candidateTransport) roundTrip(req *http.Request) (*http.Response, connInfo, error) {
+	var (
+		mu   sync.Mutex
+		info connInfo
+	)
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		GotConn: func(gotConn httptrace.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			info.connected = true
+			if !gotConn.Reused {
+				info.latency = time.Since(start)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := ct.RoundTrip(req)
+	mu.Lock()
+	defer mu.Unlock()
+	return resp, info, err
+}
+
+// transportFor returns the cached transport for a candidate. HTTP(S)
+// proxies use the transport's own proxy support, SOCKS proxies are dialed by
+// the Dialer and DIRECT has no proxy.
+func (t *Transport) transportFor(candidate Proxy, proxyURL *url.URL) candidateTransport {
+	key := candidate.String()
+	if proxyURL != nil {
+		key = proxyURL.String()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.transports[key]; ok {
+		return candidateTransport{tr}
+	}
+	if t.transports == nil {
+		t.transports = make(map[string]*http.Transport)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	tr := base.Clone()
+	tr.Proxy = nil
+	switch candidate.Type {
+	case ProxyDirect:
+	case ProxySOCKS4, ProxySOCKS5:
+		dialer := t.Dialer
+		if dialer == nil {
+			dialer = NewDialer(t.PAC)
+		}
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.dialVia(ctx, candidate, network, addr, nil)
+		}
+	default:
+		if t.Dialer != nil && t.Dialer.HTTP2 && proxyURL.Scheme == "https" {
+			// Tunnel every request, so they share the HTTP/2 connection.
+			tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return t.Dialer.dialConnect(ctx, t.PAC.withCredentials(proxyURL), addr)
+			}
+			break
+		}
+		// Look up credentials per request so rotated passwords are picked up.
+		tr.Proxy = func(*http.Request) (*url.URL, error) {
+			return t.PAC.withCredentials(proxyURL), nil
+		}
+	}
+	t.transports[key] = tr
+	return candidateTransport{tr}
+}
+
+// CloseIdleConnections closes idle connections of all candidate transports.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tr := range t.transports {
+		tr.CloseIdleConnections()
+	}
+	if t.Dialer != nil {
+		t.Dialer.CloseIdleConnections()
+	}
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,198 @@
+package pac_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestTransportFailover tests that a request is retried through the next candidate when a proxy is unreachable.
+func TestTransportFailover(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer targetServer.Close()
+
+	proxy := newTestPACProxy(t, "PROXY "+closedAddr(t)+"; DIRECT", nil)
+	client := pac.NewClient(proxy)
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Post(targetServer.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading response body: %v", err)
+	}
+	if string(body) != "hello" {
+		t.Fatalf("Expected body hello, got %q", body)
+	}
+}
+
+// TestTransportAllFailed tests that an error is only returned once every candidate failed.
+func TestTransportAllFailed(t *testing.T) {
+	proxy := newTestPACProxy(t, "PROXY "+closedAddr(t)+"; PROXY "+closedAddr(t), nil)
+	client := &http.Client{Transport: &pac.Transport{PAC: proxy}}
+
+	_, err := client.Get("http://example.com")
+	if !errors.Is(err, pac.ErrAllProxiesFailed) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrAllProxiesFailed, err)
+	}
+}
+
+// trackedBody is a request body that records whether it was closed.
+type trackedBody struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+// TestTransportAllFailedClosesBody tests that the request body is closed
+// when no candidate got as far as sending the request.
+func TestTransportAllFailedClosesBody(t *testing.T) {
+	proxy := newTestPACProxy(t, "PROXY %zz:1; PROXY [::1:80", nil)
+	body := &trackedBody{Reader: strings.NewReader("hello")}
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", body)
+
+	if _, err := (&pac.Transport{PAC: proxy}).RoundTrip(req); !errors.Is(err, pac.ErrAllProxiesFailed) {
+		t.Fatalf("Expected error %v, got %v", pac.ErrAllProxiesFailed, err)
+	}
+	if !body.closed.Load() {
+		t.Fatal("Expected the request body to be closed")
+	}
+}
+
+// TestInstallSystemPAC tests that the system PAC is installed onto and removed from http.DefaultTransport.
+func TestInstallSystemPAC(t *testing.T) {
+	pacServer := newPACServer(t, "PROXY 127.0.0.1:3128")
+	defer pacServer.Close()
+	pac.SetTestPACURL(pacServer.URL)
+	t.Cleanup(func() {
+		pac.SetTestPACURL("")
+	})
+
+	restore, err := pac.InstallSystemPAC(nil)
+	if err != nil {
+		t.Fatalf("Error installing system PAC: %v", err)
+	}
+	defer restore()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	tr := http.DefaultTransport.(*http.Transport)
+	proxyURL, err := tr.Proxy(req)
+	if err != nil {
+		t.Fatalf("Error resolving proxy: %v", err)
+	}
+	if proxyURL == nil || proxyURL.Host != "127.0.0.1:3128" {
+		t.Fatalf("Expected proxy 127.0.0.1:3128, got %v", proxyURL)
+	}
+
+	restore()
+	if proxyURL, _ := tr.Proxy(req); proxyURL != nil && proxyURL.Host == "127.0.0.1:3128" {
+		t.Fatalf("Expected the previous Proxy after restore, got %v", proxyURL)
+	}
+}
+
+// TestProxyMetrics tests that selections and dial outcomes are recorded per proxy endpoint.
+func TestProxyMetrics(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer targetServer.Close()
+
+	failing := closedAddr(t)
+	proxy := newTestPACProxy(t, "PROXY "+failing+"; DIRECT", nil)
+	client := pac.NewClient(proxy)
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(targetServer.URL)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	resp.Body.Close()
+
+	metrics := proxy.ProxyMetrics()
+	failed := metrics[pac.Proxy{Type: pac.ProxyHTTP, Host: failing}]
+	if failed.Selections != 1 || failed.DialFailures != 1 || failed.DialSuccesses != 0 {
+		t.Fatalf("Unexpected metrics for failing proxy: %+v", failed)
+	}
+	direct := metrics[pac.Proxy{Type: pac.ProxyDirect}]
+	if direct.Selections != 1 || direct.DialSuccesses != 1 || direct.DialFailures != 0 {
+		t.Fatalf("Unexpected metrics for DIRECT: %+v", direct)
+	}
+	if direct.AverageDialLatency() <= 0 {
+		t.Fatalf("Expected a dial latency for DIRECT, got %v", direct.AverageDialLatency())
+	}
+}
+
+// TestTransportFallbackDirect tests that FallbackDirect connects directly once every proxy failed.
+func TestTransportFallbackDirect(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "direct")
+	}))
+	defer targetServer.Close()
+
+	proxy := newTestPACProxy(t, "PROXY "+closedAddr(t), nil)
+	client := &http.Client{Transport: &pac.Transport{PAC: proxy, Fallback: pac.FallbackDirect}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(targetServer.URL)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "direct" {
+		t.Fatalf("Expected body direct, got %q", body)
+	}
+}
+
+// TestTransportHTTP2 tests that requests through an https proxy are tunneled over one HTTP/2 connection when the dialer enables it.
+func TestTransportHTTP2(t *testing.T) {
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer targetServer.Close()
+
+	var conns atomic.Int32
+	proxyServer := newTLSConnectProxy(t, true, &conns)
+	roots := x509.NewCertPool()
+	roots.AddCert(proxyServer.Certificate())
+
+	proxy := newTestPACProxy(t, "HTTPS "+proxyServer.Listener.Addr().String(), nil)
+	client := &http.Client{Transport: &pac.Transport{
+		PAC:    proxy,
+		Base:   &http.Transport{DisableKeepAlives: true},
+		Dialer: &pac.Dialer{PAC: proxy, HTTP2: true, TLSConfig: &tls.Config{RootCAs: roots}},
+	}}
+	defer client.CloseIdleConnections()
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(targetServer.URL)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hello" {
+			t.Fatalf("Expected body hello, got %q", body)
+		}
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("Expected 1 proxy connection, got %d", got)
+	}
+}
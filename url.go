@@ -28,3 +28,18 @@ func GetPACURL() (*url.URL, error) {
 
 	return parsedURL, nil
 }
+
+// GetSecurePACURL is like GetPACURL but flags insecure URLs: if the OS PAC
+// URL is neither https nor a loopback http URL, it is returned together with
+// an error wrapping ErrInsecurePACURL, so callers decide instead of silently
+// using it.
+func GetSecurePACURL() (*url.URL, error) {
+	pacURL, err := GetPACURL()
+	if err != nil {
+		return nil, err
+	}
+	if !IsSecurePACURL(pacURL) {
+		return pacURL, fmt.Errorf("%w: %s", ErrInsecurePACURL, pacURL.Scheme+"://"+pacURL.Host)
+	}
+	return pacURL, nil
+}
@@ -0,0 +1,36 @@
+//go:build !gopac_testhooks && android
+// +build !gopac_testhooks,android
+
+package pac
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// retrievePACURL retrieves the global PAC URL from Android using the
+// settings command. Device owners and MDMs set it with the global proxy.
+func retrievePACURL() (string, error) {
+	pacURL, err := androidGlobalSetting("global_proxy_pac_url")
+	if err != nil {
+		return "", err
+	}
+	if pacURL == "" {
+		return "", ErrPACURLNotFound
+	}
+	return pacURL, nil
+}
+
+// androidGlobalSetting returns a global setting, empty if it is unset.
+func androidGlobalSetting(name string) (string, error) {
+	out, err := exec.Command("settings", "get", "global", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run settings command: %w", err)
+	}
+	value := strings.TrimSpace(string(out))
+	if value == "null" {
+		return "", nil
+	}
+	return value, nil
+}
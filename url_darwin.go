@@ -1,5 +1,5 @@
-//go:build !unit && darwin
-// +build !unit,darwin
+//go:build !gopac_testhooks && darwin
+// +build !gopac_testhooks,darwin
 
 package pac
 
@@ -1,5 +1,5 @@
-//go:build !unit && linux
-// +build !unit,linux
+//go:build !gopac_testhooks && linux && !android
+// +build !gopac_testhooks,linux,!android
 
 package pac
 
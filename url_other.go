@@ -0,0 +1,10 @@
+//go:build !gopac_testhooks && !linux && !darwin && !windows
+// +build !gopac_testhooks,!linux,!darwin,!windows
+
+package pac
+
+// retrievePACURL reports ErrPACURLNotFound on platforms without a known
+// system proxy configuration, e.g. wasip1 for WASM evaluators.
+func retrievePACURL() (string, error) {
+	return "", ErrPACURLNotFound
+}
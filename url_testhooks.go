@@ -0,0 +1,26 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import (
+	"strings"
+	"sync"
+)
+
+// testPACURL is the OS PAC URL in tests, set by SetTestPACURL.
+var (
+	testPACURL   string
+	testPACURLMu sync.RWMutex
+)
+
+func retrievePACURL() (string, error) {
+	testPACURLMu.RLock()
+	pacURL := testPACURL
+	testPACURLMu.RUnlock()
+
+	if strings.TrimSpace(pacURL) == "" {
+		return "", ErrPACURLNotFound
+	}
+	return pacURL, nil
+}
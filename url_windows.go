@@ -1,5 +1,5 @@
-//go:build !unit && windows
-// +build !unit,windows
+//go:build !gopac_testhooks && windows
+// +build !gopac_testhooks,windows
 
 package pac
 
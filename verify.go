@@ -0,0 +1,97 @@
+package pac
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrScriptVerification is returned when a PAC script does not match
+// ScriptSHA256 or its signature does not verify against ScriptPublicKey.
+var ErrScriptVerification = errors.New("PAC script verification failed")
+
+const maxSignatureSize = 4 << 10
+
+// fetchVerifiedScript fetches the PAC script and verifies it.
+func (p *PACProxy) fetchVerifiedScript(ctx context.Context) ([]byte, error) {
+	source, err := p.fetchScript(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.verifyScript(ctx, source); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// verifyScript checks source against the configured hash pin and signature.
+func (p *PACProxy) verifyScript(ctx context.Context, source []byte) error {
+	err := p.checkScript(ctx, source)
+	if err != nil {
+		p.logf(ctx, LogError, "PAC script verification failed", "url", p.pacURL, "err", err)
+		p.emitError(ctx, "verify", err)
+	}
+	return err
+}
+
+func (p *PACProxy) checkScript(ctx context.Context, source []byte) error {
+	if p.scriptSHA256 != "" {
+		sum := sha256.Sum256(source)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, p.scriptSHA256) {
+			return fmt.Errorf("%w: SHA-256 %s does not match the pinned %s", ErrScriptVerification, got, p.scriptSHA256)
+		}
+	}
+	if p.scriptKey == nil {
+		return nil
+	}
+	sig, err := p.fetchSignature(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptVerification, err)
+	}
+	if !ed25519.Verify(p.scriptKey, source, sig) {
+		return fmt.Errorf("%w: invalid signature", ErrScriptVerification)
+	}
+	return nil
+}
+
+// fetchSignature downloads the detached Ed25519 signature of the script,
+// either raw or base64 encoded.
+func (p *PACProxy) fetchSignature(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.signatureURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSecureURL(req.URL, p.httpsOnly); err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch signature: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := checkTLSPins(resp.TLS, p.tlsPins); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch signature: status code %d", resp.StatusCode)
+	}
+	data, err := readPACScript(resp.Body, maxSignatureSize)
+	if err != nil {
+		return nil, fmt.Errorf("read signature: %v", err)
+	}
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, errors.New("malformed signature")
+	}
+	return sig, nil
+}
@@ -0,0 +1,54 @@
+package pac_test
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestScriptVerification tests hash pinning and signature verification of the PAC script.
+func TestScriptVerification(t *testing.T) {
+	script := `function FindProxyForURL(url, host) { return "DIRECT"; }`
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	var sig atomic.Value
+	sig.Store(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(script))))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sig") {
+			_, _ = io.WriteString(w, sig.Load().(string))
+			return
+		}
+		_, _ = io.WriteString(w, script)
+	}))
+	defer server.Close()
+	pacURL, _ := url.Parse(server.URL + "/proxy.pac")
+
+	sum := sha256.Sum256([]byte(script))
+	proxy, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{ScriptSHA256: hex.EncodeToString(sum[:]), ScriptPublicKey: pub})
+	if err != nil {
+		t.Fatalf("Expected the pinned and signed script to load, got %v", err)
+	}
+	proxy.Close()
+
+	if _, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{ScriptSHA256: strings.Repeat("0", 64)}); !errors.Is(err, pac.ErrScriptVerification) {
+		t.Fatalf("Expected ErrScriptVerification for a mismatching pin, got %v", err)
+	}
+
+	sig.Store(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("tampered"))))
+	if _, err := pac.NewPACProxy(pacURL, &pac.PACProxyConfig{ScriptPublicKey: pub}); !errors.Is(err, pac.ErrScriptVerification) {
+		t.Fatalf("Expected ErrScriptVerification for an invalid signature, got %v", err)
+	}
+}
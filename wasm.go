@@ -0,0 +1,100 @@
+package pac
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const wasmPageSize = 64 << 10
+
+var errEvaluatorKilled = errors.New("evaluator killed")
+
+// wasmEvaluator runs the PACProxyConfig.EvaluatorWASM module, compiled once
+// per PACProxy, with one instance per PAC script. Instances get WASI stdio,
+// clocks and randomness but no file system, network or environment; DNS is
+// only reachable through the lookups ServeEvaluator forwards to the host.
+type wasmEvaluator struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// newWASMEvaluator compiles module, capping the linear memory of each
+// instance at memoryLimit bytes if positive. cacheDir, if set, keeps the
+// compiled code across processes.
+func newWASMEvaluator(ctx context.Context, module []byte, memoryLimit int64, cacheDir string) (*wasmEvaluator, error) {
+	cfg := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if memoryLimit > 0 {
+		pages := (memoryLimit + wasmPageSize - 1) / wasmPageSize
+		cfg = cfg.WithMemoryLimitPages(uint32(min(pages, 1<<16)))
+	}
+	if cacheDir != "" {
+		cache, err := wazero.NewCompilationCacheWithDir(cacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEvaluatorProcess, err)
+		}
+		cfg = cfg.WithCompilationCache(cache)
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		_ = rt.Close(ctx)
+		return nil, fmt.Errorf("%w: %v", ErrEvaluatorProcess, err)
+	}
+	compiled, err := rt.CompileModule(ctx, module)
+	if err != nil {
+		_ = rt.Close(ctx)
+		return nil, fmt.Errorf("%w: compile WASM module: %v", ErrEvaluatorProcess, err)
+	}
+	return &wasmEvaluator{runtime: rt, compiled: compiled}, nil
+}
+
+// launch starts an instance of the module serving on pipes.
+func (w *wasmEvaluator) launch() (*evaluatorProcess, error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cfg := wazero.NewModuleConfig().
+			WithName("").
+			WithStdin(inR).
+			WithStdout(outW).
+			WithSysWalltime().
+			WithSysNanotime().
+			WithSysNanosleep().
+			WithRandSource(rand.Reader)
+		mod, err := w.runtime.InstantiateModule(ctx, w.compiled, cfg)
+		if mod != nil {
+			_ = mod.Close(context.Background())
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		outW.CloseWithError(err)
+	}()
+	return &evaluatorProcess{
+		stdin:  inW,
+		stdout: outR,
+		kill: func() {
+			cancel()
+			inR.CloseWithError(errEvaluatorKilled)
+			outR.CloseWithError(errEvaluatorKilled)
+		},
+		wait: func() {
+			<-done
+			cancel()
+		},
+	}, nil
+}
+
+func (w *wasmEvaluator) close() {
+	if w != nil {
+		_ = w.runtime.Close(context.Background())
+	}
+}
@@ -0,0 +1,72 @@
+package pac_test
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+// buildWASMEvaluator builds cmd/pac-evaluator for wasip1 and returns the
+// module, or skips the test if there is no Go toolchain to build it with.
+func buildWASMEvaluator(t *testing.T) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pac-evaluator.wasm")
+	cmd := exec.Command("go", "build", "-o", path, "./cmd/pac-evaluator")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build cmd/pac-evaluator for wasip1: %v\n%s", err, out)
+	}
+	module, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading WASM module: %v", err)
+	}
+	return module
+}
+
+// TestEvaluatorWASM tests evaluating the PAC script in a WASM instance.
+func TestEvaluatorWASM(t *testing.T) {
+	if raceEnabled {
+		// wazero compiles the module in minutes with the race detector.
+		t.Skip("compiling the WASM module is too slow with -race")
+	}
+	module := buildWASMEvaluator(t)
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (host == "alloc.example.com") { var s = "x"; var a = []; while (true) { s = s + s; a.push(s + ""); } }
+		if (host == "loop.example.com") { while (true) {} }
+		if (host == "dns.example.com") { return "PROXY " + isResolvable("localhost") + "-" + isResolvable("blocked.invalid") + ":1"; }
+		return "PROXY proxy.example.com:3128";
+	}`)
+	defer pacServer.Close()
+
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, &pac.PACProxyConfig{
+		EvaluatorWASM:        module,
+		EvaluatorMemoryLimit: 256 << 20,
+		ScriptTimeout:        5 * time.Second,
+		DNSFilter:            pac.DenyDNS(".invalid"),
+	})
+
+	for _, tc := range []struct {
+		host string
+		want pac.ProxyString
+		err  error
+	}{
+		{"example.com", "PROXY proxy.example.com:3128", nil},
+		{"dns.example.com", "PROXY true-false:1", nil},
+		// Exceeding EvaluatorMemoryLimit kills the instance.
+		{"alloc.example.com", "", pac.ErrEvaluatorProcess},
+		{"loop.example.com", "", pac.ErrPACScriptTimeout},
+		{"example.org", "PROXY proxy.example.com:3128", nil},
+	} {
+		targetURL, _ := url.Parse("http://" + tc.host)
+		got, err := proxy.FindProxyStringForURL(targetURL)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Fatalf("%s: expected %q, %v, got %q, %v", tc.host, tc.want, tc.err, got, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWatchUnsupported is returned by WatchNetworkChanges and WatchPACURL on
+// platforms without change notifications.
+var ErrWatchUnsupported = errors.New("network change notifications are not supported on this platform")
+
+const defaultWatchSettle = 2 * time.Second
+
+// WatchNetworkChanges calls changed each time the OS reports a change of
+// the network interfaces or of the proxy settings, until ctx is done, and
+// then returns ctx.Err(). On Windows it subscribes to IP interface change
+// notifications and to changes of the Internet Settings registry key, whose
+// edits are what WM_SETTINGCHANGE announces. On macOS it watches the proxy
+// settings and the network addresses in the SystemConfiguration dynamic
+// store with scutil, so VPN connects and disconnects are reported too. On
+// Linux it reports changes of the GNOME proxy settings through gsettings
+// monitor. Other platforms return ErrWatchUnsupported. Changes come in
+// bursts; changed is called for each.
+func WatchNetworkChanges(ctx context.Context, changed func()) error {
+	stop, err := subscribeNetworkChanges(changed)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// WatchOptions configures WatchPACURL.
+type WatchOptions struct {
+	DetectOptions
+	// Settle is how long the network must be quiet before detection runs
+	// again, since changes come in bursts and a new network needs a moment
+	// to answer DNS. It defaults to 2s.
+	Settle time.Duration
+}
+
+// WatchPACURL runs DetectPACURL and calls fn with its result, then runs it
+// again after each network or proxy settings change reported by
+// WatchNetworkChanges and calls fn whenever the detected PAC URL differs,
+// e.g. when the user moves from the office LAN to home Wi-Fi. An agent
+// typically builds a new PACProxy in fn. WatchPACURL blocks until ctx is
+// done and returns ctx.Err(), or ErrWatchUnsupported without calling fn. A
+// nil opts uses the defaults.
+func WatchPACURL(ctx context.Context, opts *WatchOptions, fn func(*Detection, error)) error {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	settle := opts.Settle
+	if settle <= 0 {
+		settle = defaultWatchSettle
+	}
+
+	// Subscribe before the first detection, so no change is missed.
+	changes := make(chan struct{}, 1)
+	stop, err := subscribeNetworkChanges(func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	last, first := "", true
+	detect := func() {
+		d, err := DetectPACURL(ctx, &opts.DetectOptions)
+		if ctx.Err() != nil {
+			return
+		}
+		current := ""
+		if d.URL != nil {
+			current = d.URL.String()
+		}
+		if first || current != last {
+			first, last = false, current
+			fn(d, err)
+		}
+	}
+
+	detect()
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changes:
+			settled = time.After(settle)
+		case <-settled:
+			settled = nil
+			detect()
+		}
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !gopac_testhooks && (darwin || (linux && !android))
+// +build !gopac_testhooks
+// +build darwin linux,!android
+
+package pac
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// subscribeCommand runs a monitoring command, writes input to it and calls
+// changed for each line of its output that isChange accepts, until the
+// returned function kills it. stdin stays open, since some monitors exit
+// at the end of their input.
+func subscribeCommand(cmd *exec.Cmd, input string, isChange func(line string) bool, changed func()) (func(), error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s command: %w", cmd.Args[0], err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s command: %w", cmd.Args[0], err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run %s command: %w", cmd.Args[0], err)
+	}
+	if _, err := io.WriteString(stdin, input); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("failed to run %s command: %w", cmd.Args[0], err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if isChange(scanner.Text()) {
+				changed()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cmd.Process.Kill()
+			<-done
+			cmd.Wait()
+		})
+	}, nil
+}
@@ -0,0 +1,28 @@
+//go:build !gopac_testhooks && darwin
+// +build !gopac_testhooks,darwin
+
+package pac
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// scutilWatch makes scutil report changes of the proxy settings and of the
+// global and per-interface addresses, which change on VPN connect and
+// disconnect, from the SystemConfiguration dynamic store.
+const scutilWatch = `n.add State:/Network/Global/Proxies
+n.add State:/Network/Global/IPv4
+n.add State:/Network/Global/IPv6
+n.add State:/Network/Interface/[^/]+/IPv4 pattern
+n.add State:/Network/Interface/[^/]+/IPv6 pattern
+n.watch
+`
+
+// subscribeNetworkChanges watches the dynamic store with scutil, whose
+// notifier prints a "changed key" line per changed key.
+func subscribeNetworkChanges(changed func()) (func(), error) {
+	return subscribeCommand(exec.Command("scutil"), scutilWatch, func(line string) bool {
+		return strings.Contains(line, "changed key")
+	}, changed)
+}
@@ -0,0 +1,20 @@
+//go:build !gopac_testhooks && linux && !android
+// +build !gopac_testhooks,linux,!android
+
+package pac
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// subscribeNetworkChanges watches the GNOME proxy settings with gsettings
+// monitor, which prints a "key: value" line per changed key, such as mode
+// or autoconfig-url.
+// Note: This function currently only supports GNOME.
+func subscribeNetworkChanges(changed func()) (func(), error) {
+	cmd := exec.Command("gsettings", "monitor", "org.gnome.system.proxy")
+	return subscribeCommand(cmd, "", func(line string) bool {
+		return strings.Contains(line, ":")
+	}, changed)
+}
@@ -0,0 +1,9 @@
+//go:build !gopac_testhooks && (android || (!darwin && !linux && !windows))
+// +build !gopac_testhooks
+// +build android !darwin,!linux,!windows
+
+package pac
+
+func subscribeNetworkChanges(func()) (func(), error) {
+	return nil, ErrWatchUnsupported
+}
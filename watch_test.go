@@ -0,0 +1,68 @@
+package pac_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/phlipse/go-pac"
+)
+
+func TestWatchPACURL(t *testing.T) {
+	pac.SetTestPACURL("https://office.example.com/proxy.pac")
+	t.Cleanup(func() { pac.SetTestPACURL("") })
+
+	type result struct {
+		url string
+		err error
+	}
+	results := make(chan result, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	watchErr := make(chan error, 1)
+	go func() {
+		opts := &pac.WatchOptions{DetectOptions: pac.DetectOptions{NoWPAD: true}, Settle: 20 * time.Millisecond}
+		watchErr <- pac.WatchPACURL(ctx, opts, func(d *pac.Detection, err error) {
+			r := result{err: err}
+			if d.URL != nil {
+				r.url = d.URL.String()
+			}
+			results <- r
+		})
+	}()
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a detection")
+			return result{}
+		}
+	}
+
+	if r := next(); r.err != nil || r.url != "https://office.example.com/proxy.pac" {
+		t.Fatalf("Expected the office PAC URL first, got %+v", r)
+	}
+	// A burst of changes settles into one detection; an unchanged URL is
+	// not reported again.
+	pac.SetTestPACURL("https://office.example.com/proxy.pac")
+	pac.SetTestPACURL("https://home.example.com/proxy.pac")
+	if r := next(); r.err != nil || r.url != "https://home.example.com/proxy.pac" {
+		t.Fatalf("Expected the home PAC URL after the change, got %+v", r)
+	}
+	pac.SetTestPACURL("")
+	if r := next(); !errors.Is(r.err, pac.ErrPACURLNotFound) || r.url != "" {
+		t.Fatalf("Expected ErrPACURLNotFound after the URL was removed, got %+v", r)
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("Unexpected detection %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-watchErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build gopac_testhooks
+// +build gopac_testhooks
+
+package pac
+
+import "sync"
+
+// testWatchers are the subscribers that SetTestPACURL notifies in unit
+// tests.
+var (
+	testWatchersMu sync.Mutex
+	testWatchers   = make(map[*func()]struct{})
+)
+
+func subscribeNetworkChanges(changed func()) (func(), error) {
+	testWatchersMu.Lock()
+	testWatchers[&changed] = struct{}{}
+	testWatchersMu.Unlock()
+	return func() {
+		testWatchersMu.Lock()
+		delete(testWatchers, &changed)
+		testWatchersMu.Unlock()
+	}, nil
+}
+
+func notifyTestWatchers() {
+	testWatchersMu.Lock()
+	defer testWatchersMu.Unlock()
+	for changed := range testWatchers {
+		(*changed)()
+	}
+}
@@ -0,0 +1,113 @@
+//go:build !gopac_testhooks && windows
+// +build !gopac_testhooks,windows
+
+package pac
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// interfaceEvents are the events set by the IP interface change callback,
+// which windows.NewCallback can only create a limited number of times.
+var (
+	interfaceEventsMu sync.Mutex
+	interfaceEvents   = make(map[windows.Handle]struct{})
+	interfaceCallback uintptr
+	interfaceOnce     sync.Once
+)
+
+func onInterfaceChange(_ uintptr, _ *windows.MibIpInterfaceRow, _ uint32) uintptr {
+	interfaceEventsMu.Lock()
+	defer interfaceEventsMu.Unlock()
+	for event := range interfaceEvents {
+		windows.SetEvent(event)
+	}
+	return 0
+}
+
+// subscribeNetworkChanges watches the Internet Settings registry key, which
+// holds AutoConfigURL, and the IP interfaces.
+func subscribeNetworkChanges(changed func()) (func(), error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.NOTIFY)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry key: %w", err)
+	}
+	var events [3]windows.Handle // stop, registry, interfaces
+	for i := range events {
+		if events[i], err = windows.CreateEvent(nil, 0, 0, nil); err != nil {
+			for _, event := range events[:i] {
+				windows.CloseHandle(event)
+			}
+			key.Close()
+			return nil, fmt.Errorf("failed to create event: %w", err)
+		}
+	}
+	stop, settingsChanged, interfacesChanged := events[0], events[1], events[2]
+	cleanup := func() {
+		for _, event := range events {
+			windows.CloseHandle(event)
+		}
+		key.Close()
+	}
+
+	interfaceOnce.Do(func() { interfaceCallback = windows.NewCallback(onInterfaceChange) })
+	interfaceEventsMu.Lock()
+	interfaceEvents[interfacesChanged] = struct{}{}
+	interfaceEventsMu.Unlock()
+	var notification windows.Handle
+	if err := windows.NotifyIpInterfaceChange(windows.AF_UNSPEC, interfaceCallback, nil, false, &notification); err != nil {
+		interfaceEventsMu.Lock()
+		delete(interfaceEvents, interfacesChanged)
+		interfaceEventsMu.Unlock()
+		cleanup()
+		return nil, fmt.Errorf("failed to subscribe to interface changes: %w", err)
+	}
+
+	armed := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// A registry notification ends with the thread that requested it.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		arm := func() error {
+			return windows.RegNotifyChangeKeyValue(windows.Handle(key), true, windows.REG_NOTIFY_CHANGE_LAST_SET, settingsChanged, true)
+		}
+		if err := arm(); err != nil {
+			armed <- fmt.Errorf("failed to watch registry key: %w", err)
+			return
+		}
+		armed <- nil
+		for {
+			n, err := windows.WaitForMultipleObjects(events[:], false, windows.INFINITE)
+			if err != nil || n == windows.WAIT_OBJECT_0 {
+				return
+			}
+			if n == windows.WAIT_OBJECT_0+1 && arm() != nil {
+				return
+			}
+			changed()
+		}
+	}()
+
+	unsubscribe := func() {
+		windows.CancelMibChangeNotify2(notification)
+		interfaceEventsMu.Lock()
+		delete(interfaceEvents, interfacesChanged)
+		interfaceEventsMu.Unlock()
+		windows.SetEvent(stop)
+		<-done
+		cleanup()
+	}
+	if err := <-armed; err != nil {
+		unsubscribe()
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(unsubscribe) }, nil
+}
@@ -0,0 +1,53 @@
+package pac
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WebSocketProxyFunc returns a proxy function for WebSocket dialers, e.g.
+// gorilla/websocket's Dialer.Proxy. ws:// and wss:// URLs are evaluated as
+// http:// and https://, as browsers do; wss connections through HTTP proxies
+// are tunneled with CONNECT by the dialer.
+func (p *PACProxy) WebSocketProxyFunc() func(*http.Request) (*url.URL, error) {
+	proxyFunc := p.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		if target := webSocketHTTPURL(req.URL); target != req.URL {
+			req = req.Clone(req.Context())
+			req.URL = target
+		}
+		return proxyFunc(req)
+	}
+}
+
+// NewWebSocketClient returns an *http.Client for WebSocket libraries that
+// perform the handshake with an http.Client, e.g. nhooyr.io/websocket's
+// DialOptions.HTTPClient. Every connection, ws:// included, is tunneled
+// through the PAC-selected proxies with CONNECT, since most proxies do not
+// forward Upgrade requests.
+func NewWebSocketClient(p *PACProxy) *http.Client {
+	tr := NewHTTPTransport(p)
+	tr.Proxy = nil
+	tr.DialContext = NewDialer(p).DialContext
+	// The WebSocket handshake requires HTTP/1.1.
+	tr.Protocols = new(http.Protocols)
+	tr.Protocols.SetHTTP1(true)
+	return &http.Client{Transport: tr}
+}
+
+// webSocketHTTPURL maps ws:// and wss:// URLs to their http(s) equivalent.
+func webSocketHTTPURL(u *url.URL) *url.URL {
+	var scheme string
+	switch strings.ToLower(u.Scheme) {
+	case "ws":
+		scheme = "http"
+	case "wss":
+		scheme = "https"
+	default:
+		return u
+	}
+	mapped := *u
+	mapped.Scheme = scheme
+	return &mapped
+}
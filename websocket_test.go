@@ -0,0 +1,62 @@
+package pac_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+)
+
+// TestWebSocketProxyFunc tests that ws and wss URLs are evaluated as http and https.
+func TestWebSocketProxyFunc(t *testing.T) {
+	pacServer := newScriptServer(t, `function FindProxyForURL(url, host) {
+		if (url.substring(0, 6) == "https:") { return "PROXY secure.example.com:8443"; }
+		if (url.substring(0, 5) == "http:") { return "PROXY plain.example.com:8080"; }
+		return "DIRECT";
+	}`)
+	defer pacServer.Close()
+	proxy := newTestPACProxyFromURL(t, pacServer.URL, nil)
+
+	tests := map[string]string{
+		"ws://example.com/socket":  "plain.example.com:8080",
+		"wss://example.com/socket": "secure.example.com:8443",
+	}
+	for target, expected := range tests {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		proxyURL, err := proxy.WebSocketProxyFunc()(req)
+		if err != nil {
+			t.Fatalf("Error finding proxy for %s: %v", target, err)
+		}
+		if proxyURL == nil || proxyURL.Host != expected {
+			t.Fatalf("Expected proxy %s for %s, got %v", expected, target, proxyURL)
+		}
+	}
+}
+
+// TestNewWebSocketClient tests that the client tunnels plain connections through CONNECT.
+func TestNewWebSocketClient(t *testing.T) {
+	var tunnels atomic.Int32
+	connectProxy := newConnectProxy(t, &tunnels)
+	defer connectProxy.Close()
+	targetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer targetServer.Close()
+
+	proxy := newTestPACProxy(t, "PROXY "+strings.TrimPrefix(connectProxy.URL, "http://"), nil)
+	client := pac.NewWebSocketClient(proxy)
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(targetServer.URL)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	resp.Body.Close()
+	if tunnels.Load() != 1 {
+		t.Fatalf("Expected 1 tunnel, got %d", tunnels.Load())
+	}
+}
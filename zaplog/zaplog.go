@@ -0,0 +1,40 @@
+// Package zaplog adapts a go.uber.org/zap logger to pac.Logger.
+package zaplog
+
+import (
+	"context"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/internal/logkv"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New returns a pac.Logger writing to l. Levels map to the zap level of the
+// same name and key/value pairs become zap fields.
+func New(l *zap.Logger) pac.Logger {
+	return pac.LoggerFunc(func(_ context.Context, level pac.LogLevel, msg string, args ...any) {
+		ce := l.Check(zapLevel(level), msg)
+		if ce == nil {
+			return
+		}
+		fields := make([]zap.Field, 0, (len(args)+1)/2)
+		logkv.Each(args, func(key string, value any) {
+			fields = append(fields, zap.Any(key, value))
+		})
+		ce.Write(fields...)
+	})
+}
+
+func zapLevel(level pac.LogLevel) zapcore.Level {
+	switch level {
+	case pac.LogDebug:
+		return zapcore.DebugLevel
+	case pac.LogWarn:
+		return zapcore.WarnLevel
+	case pac.LogError:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
@@ -0,0 +1,35 @@
+package zaplog_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/phlipse/go-pac"
+	"github.com/phlipse/go-pac/zaplog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestNew tests level mapping and field conversion.
+func TestNew(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zaplog.New(zap.New(core))
+
+	logger.Log(context.Background(), pac.LogDebug, "dropped")
+	logger.Log(context.Background(), pac.LogWarn, "proxy marked as failed", "proxy", "PROXY a:1", "err", errors.New("refused"), "odd")
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != zapcore.WarnLevel || entry.Message != "proxy marked as failed" {
+		t.Fatalf("Unexpected entry: %v %q", entry.Level, entry.Message)
+	}
+	fields := entry.ContextMap()
+	if fields["proxy"] != "PROXY a:1" || fields["err"] != "refused" || fields["!BADKEY"] != "odd" {
+		t.Fatalf("Unexpected fields: %v", fields)
+	}
+}